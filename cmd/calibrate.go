@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"mcp-xlsm-server/internal/token"
+)
+
+// runCalibrate implements `mcp-xlsm-server calibrate`, which measures the
+// token_scale of a model in models.yaml from sample server responses.
+// The API key is read from ANTHROPIC_API_KEY.
+func runCalibrate(args []string) {
+	flags := flag.NewFlagSet("calibrate", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: mcp-xlsm-server calibrate -model <API model> <sample>...")
+		flags.PrintDefaults()
+	}
+	model := flags.String("model", "", "API model name, e.g. claude-sonnet-4-20250514")
+	url := flags.String("url", token.CountTokensURL, "count_tokens endpoint")
+	flags.Parse(args)
+
+	if *model == "" || flags.NArg() == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	apiKey := os.Getenv("ANTHROPIC_API_KEY")
+	if apiKey == "" {
+		log.Fatal("Calibration failed: ANTHROPIC_API_KEY is not set")
+	}
+
+	var samples []string
+	for _, path := range flags.Args() {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			log.Fatalf("Calibration failed: %v", err)
+		}
+		samples = append(samples, string(data))
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	calibrator := &token.Calibrator{URL: *url, APIKey: apiKey, Model: *model}
+	scale, err := calibrator.Calibrate(ctx, samples)
+	if err != nil {
+		log.Fatalf("Calibration failed: %v", err)
+	}
+	fmt.Printf("token_scale: %.2f\n", scale)
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"mcp-xlsm-server/internal/server"
+	"mcp-xlsm-server/internal/workbook"
+)
+
+// runExport implements `mcp-xlsm-server export`, the command-line
+// counterpart of the export tool. Without -out the export goes to stdout.
+func runExport(args []string) {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: mcp-xlsm-server export -file <workbook> (-sheet <name> [-range A1:F50] | -table <name> | -query <text>) [options]")
+		flags.PrintDefaults()
+	}
+
+	filePath := flags.String("file", "", "Workbook to export from")
+	sheet := flags.String("sheet", "", "Sheet to export")
+	rangeRef := flags.String("range", "", "A1 range within the sheet")
+	table := flags.String("table", "", "Excel table to export")
+	query := flags.String("query", "", "Export the rows query_data returns for this query")
+	format := flags.String("format", "", "csv, ndjson or parquet (default: from the -out extension, else csv)")
+	delimiter := flags.String("delimiter", "", "CSV delimiter, one character or \"tab\"")
+	locale := flags.String("locale", "", "CSV number locale, e.g. fr-FR")
+	noHeader := flags.Bool("no-header", false, "The source has no header row")
+	noCSVHeader := flags.Bool("no-csv-header", false, "Leave out the CSV header line")
+	rowGroupSize := flags.Int("row-group-size", 0, "Rows per Parquet row group")
+	out := flags.String("out", "", "Output file (default: stdout)")
+	overwrite := flags.Bool("overwrite", false, "Replace the output file if it exists")
+	passwordsFile := flags.String("passwords-file", "", "Passwords of encrypted workbooks, by path pattern")
+	flags.Parse(args)
+
+	if *filePath == "" {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	params := map[string]interface{}{
+		"filepath":   *filePath,
+		"sheet":      *sheet,
+		"range":      *rangeRef,
+		"table":      *table,
+		"query":      *query,
+		"format":     *format,
+		"delimiter":  *delimiter,
+		"locale":     *locale,
+		"has_header": !*noHeader,
+		"csv_header": !*noCSVHeader,
+		"overwrite":  *overwrite,
+	}
+	if *rowGroupSize > 0 {
+		params["row_group_size"] = float64(*rowGroupSize)
+	}
+
+	if *passwordsFile != "" {
+		if err := workbook.LoadPasswords(*passwordsFile); err != nil {
+			log.Fatalf("Export failed: %v", err)
+		}
+	}
+
+	handler := server.NewExportHandler()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	if *out == "" || *out == "-" {
+		if _, err := handler.WriteExport(ctx, params, os.Stdout); err != nil {
+			log.Fatalf("Export failed: %v", err)
+		}
+		return
+	}
+
+	params["output_path"] = *out
+	response, err := handler.Export(ctx, params)
+	if err != nil {
+		log.Fatalf("Export failed: %v", err)
+	}
+	log.Printf("Exported %d rows of %s to %s (%s, %d bytes)", response.Rows, response.Source, response.OutputPath, response.Format, response.Bytes)
+}
@@ -14,6 +14,16 @@ import (
 )
 
 func main() {
+	// Subcommands come before the server flags
+	if len(os.Args) > 1 && os.Args[1] == "export" {
+		runExport(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "calibrate" {
+		runCalibrate(os.Args[2:])
+		return
+	}
+
 	// Parse command line flags to determine mode
 	var stdioMode bool
 	var configPath string
@@ -0,0 +1,418 @@
+package analytics
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type AggregateFunc string
+
+const (
+	Sum           AggregateFunc = "sum"
+	Avg           AggregateFunc = "avg"
+	Min           AggregateFunc = "min"
+	Max           AggregateFunc = "max"
+	Count         AggregateFunc = "count"
+	CountDistinct AggregateFunc = "count_distinct"
+	Median        AggregateFunc = "median"
+	Percentile    AggregateFunc = "percentile"
+)
+
+type AggregateSpec struct {
+	Function   AggregateFunc `json:"function"`
+	Column     string        `json:"column"`
+	Percentile float64       `json:"percentile,omitempty"`
+	Alias      string        `json:"alias,omitempty"`
+}
+
+type AggregateRequest struct {
+	Aggregates []AggregateSpec
+	GroupBy    []string
+	Having     string
+}
+
+type AggregateResult struct {
+	Source      string          `json:"source,omitempty"`
+	GroupBy     []string        `json:"group_by"`
+	Columns     []string        `json:"columns"`
+	Rows        [][]interface{} `json:"rows"`
+	RowsScanned int             `json:"rows_scanned"`
+	GroupsTotal int             `json:"groups_total"`
+	// Truncated is set when the rows scanned were only part of the source
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+type Engine struct{}
+
+func NewEngine() *Engine {
+	return &Engine{}
+}
+
+func (e *Engine) Aggregate(table *Table, req AggregateRequest) (*AggregateResult, error) {
+	if len(req.Aggregates) == 0 {
+		return nil, fmt.Errorf("at least one aggregate is required")
+	}
+
+	groupCols := make([]int, len(req.GroupBy))
+	for i, name := range req.GroupBy {
+		colIdx, err := table.ColumnIndex(name)
+		if err != nil {
+			return nil, err
+		}
+		groupCols[i] = colIdx
+	}
+
+	aggCols := make([]int, len(req.Aggregates))
+	columns := append([]string{}, req.GroupBy...)
+	for i, spec := range req.Aggregates {
+		if err := validateSpec(spec); err != nil {
+			return nil, err
+		}
+
+		aggCols[i] = -1
+		if spec.Column != "*" {
+			colIdx, err := table.ColumnIndex(spec.Column)
+			if err != nil {
+				return nil, err
+			}
+			aggCols[i] = colIdx
+		}
+		columns = append(columns, spec.OutputName())
+	}
+
+	// Bucket rows by group key, keeping first-seen order
+	var order []string
+	groups := make(map[string][][]interface{})
+	keys := make(map[string][]interface{})
+	for _, row := range table.Rows {
+		keyParts := make([]string, len(groupCols))
+		keyValues := make([]interface{}, len(groupCols))
+		for i, colIdx := range groupCols {
+			keyValues[i] = row[colIdx]
+			keyParts[i] = fmt.Sprint(row[colIdx])
+		}
+		key := strings.Join(keyParts, "\x00")
+
+		if _, exists := groups[key]; !exists {
+			order = append(order, key)
+			keys[key] = keyValues
+		}
+		groups[key] = append(groups[key], row)
+	}
+
+	// A global aggregate over zero rows still yields one row
+	if len(groupCols) == 0 && len(order) == 0 {
+		order = append(order, "")
+		keys[""] = []interface{}{}
+	}
+
+	having, err := ParseHaving(req.Having)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &AggregateResult{
+		GroupBy:     req.GroupBy,
+		Columns:     columns,
+		Rows:        [][]interface{}{},
+		RowsScanned: len(table.Rows),
+		GroupsTotal: len(order),
+	}
+
+	for _, key := range order {
+		outRow := append([]interface{}{}, keys[key]...)
+		values := make(map[string]interface{})
+
+		for i, spec := range req.Aggregates {
+			value := ComputeAggregate(spec, columnValues(groups[key], aggCols[i]))
+			outRow = append(outRow, value)
+			values[strings.ToLower(spec.OutputName())] = value
+		}
+
+		matched, err := having.Match(values)
+		if err != nil {
+			return nil, err
+		}
+		if matched {
+			result.Rows = append(result.Rows, outRow)
+		}
+	}
+
+	return result, nil
+}
+
+func (s AggregateSpec) OutputName() string {
+	if s.Alias != "" {
+		return s.Alias
+	}
+	if s.Function == Percentile {
+		return fmt.Sprintf("p%g_%s", s.Percentile, s.Column)
+	}
+	if s.Column == "*" {
+		return string(s.Function)
+	}
+	return fmt.Sprintf("%s_%s", s.Function, s.Column)
+}
+
+func validateSpec(spec AggregateSpec) error {
+	switch spec.Function {
+	case Sum, Avg, Min, Max, Median, CountDistinct:
+		if spec.Column == "" || spec.Column == "*" {
+			return fmt.Errorf("%s requires a column", spec.Function)
+		}
+	case Count:
+		if spec.Column == "" {
+			return fmt.Errorf("count requires a column or *")
+		}
+	case Percentile:
+		if spec.Column == "" || spec.Column == "*" {
+			return fmt.Errorf("percentile requires a column")
+		}
+		if spec.Percentile < 0 || spec.Percentile > 100 {
+			return fmt.Errorf("percentile must be between 0 and 100, got %g", spec.Percentile)
+		}
+	default:
+		return fmt.Errorf("unknown aggregate function: %s", spec.Function)
+	}
+	return nil
+}
+
+// columnValues returns a column's cells, or a non-nil marker per row when
+// colIdx is -1 (COUNT(*)).
+func columnValues(rows [][]interface{}, colIdx int) []interface{} {
+	values := make([]interface{}, len(rows))
+	for i, row := range rows {
+		if colIdx < 0 {
+			values[i] = true
+		} else {
+			values[i] = row[colIdx]
+		}
+	}
+	return values
+}
+
+// ComputeAggregate applies one aggregate to a list of cell values.
+func ComputeAggregate(spec AggregateSpec, values []interface{}) interface{} {
+	switch spec.Function {
+	case Count:
+		count := 0
+		for _, v := range values {
+			if !IsEmpty(v) {
+				count++
+			}
+		}
+		return count
+
+	case CountDistinct:
+		seen := make(map[string]bool)
+		for _, v := range values {
+			if !IsEmpty(v) {
+				seen[fmt.Sprint(v)] = true
+			}
+		}
+		return len(seen)
+	}
+
+	nums := NumericValues(values)
+	if len(nums) == 0 {
+		return nil
+	}
+
+	switch spec.Function {
+	case Sum:
+		return roundFloat(sumOf(nums))
+	case Avg:
+		return roundFloat(sumOf(nums) / float64(len(nums)))
+	case Min:
+		min := nums[0]
+		for _, n := range nums[1:] {
+			min = math.Min(min, n)
+		}
+		return min
+	case Max:
+		max := nums[0]
+		for _, n := range nums[1:] {
+			max = math.Max(max, n)
+		}
+		return max
+	case Median:
+		return roundFloat(Quantile(nums, 0.5))
+	case Percentile:
+		return roundFloat(Quantile(nums, spec.Percentile/100))
+	}
+
+	return nil
+}
+
+// NumericValues keeps the values that can be read as numbers.
+func NumericValues(values []interface{}) []float64 {
+	var nums []float64
+	for _, v := range values {
+		if n, ok := ToFloat(v); ok {
+			nums = append(nums, n)
+		}
+	}
+	return nums
+}
+
+// Quantile uses linear interpolation between closest ranks (Excel's
+// PERCENTILE.INC).
+func Quantile(nums []float64, q float64) float64 {
+	if len(nums) == 0 {
+		return math.NaN()
+	}
+
+	sorted := append([]float64{}, nums...)
+	sort.Float64s(sorted)
+
+	pos := q * float64(len(sorted)-1)
+	lower := int(math.Floor(pos))
+	upper := int(math.Ceil(pos))
+	if lower == upper {
+		return sorted[lower]
+	}
+	return sorted[lower] + (pos-float64(lower))*(sorted[upper]-sorted[lower])
+}
+
+func sumOf(nums []float64) float64 {
+	total := 0.0
+	for _, n := range nums {
+		total += n
+	}
+	return total
+}
+
+// roundFloat trims float noise so results stay readable in responses.
+func roundFloat(v float64) float64 {
+	return math.Round(v*1e6) / 1e6
+}
+
+// ToFloat reads numbers from typed values and from strings as ParseNumber
+// does. NaN and infinities are not numbers here.
+func ToFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, !math.IsNaN(v) && !math.IsInf(v, 0)
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case string:
+		return ParseNumber(v)
+	}
+	return 0, false
+}
+
+// ParseNumber reads a number written with thousands and decimal separators
+// in either the English or the French way: "12,500", "1,234.5", "1.234,5",
+// "12 500,75" and "1,5" all read as expected. When both a comma and a dot
+// appear, the last one is the decimal separator. A lone comma followed by
+// exactly three digits separates thousands; any other lone comma or dot is
+// decimal. Thousands groups must have three digits, and an exponent is
+// only read without them. Anything else, including "Inf" and "NaN", is
+// not a number.
+func ParseNumber(text string) (float64, bool) {
+	cleaned := strings.TrimSpace(text)
+	cleaned = strings.NewReplacer(" ", "", "\u00a0", "", "\u202f", "").Replace(cleaned)
+	if cleaned == "" {
+		return 0, false
+	}
+
+	sign := ""
+	if cleaned[0] == '-' || cleaned[0] == '+' {
+		sign, cleaned = cleaned[:1], cleaned[1:]
+	}
+
+	mantissa, exponent := cleaned, ""
+	if i := strings.IndexAny(cleaned, "eE"); i >= 0 {
+		mantissa, exponent = cleaned[:i], cleaned[i+1:]
+		if exponent != "" && (exponent[0] == '-' || exponent[0] == '+') {
+			exponent = exponent[1:]
+		}
+		if !allDigits(exponent) {
+			return 0, false
+		}
+		exponent = cleaned[i:]
+	}
+
+	commas, dots := strings.Count(mantissa, ","), strings.Count(mantissa, ".")
+	var decimal, thousands byte
+	switch {
+	case commas > 0 && dots > 0:
+		if strings.LastIndexByte(mantissa, ',') > strings.LastIndexByte(mantissa, '.') {
+			decimal, thousands = ',', '.'
+		} else {
+			decimal, thousands = '.', ','
+		}
+	case commas == 1:
+		if len(mantissa)-strings.IndexByte(mantissa, ',') == 4 && mantissa[0] != ',' && mantissa[0] != '0' {
+			thousands = ','
+		} else {
+			decimal = ','
+		}
+	case commas > 1:
+		thousands = ','
+	case dots == 1:
+		decimal = '.'
+	case dots > 1:
+		thousands = '.'
+	}
+
+	integer, fraction := mantissa, ""
+	if decimal != 0 {
+		i := strings.LastIndexByte(mantissa, decimal)
+		integer, fraction = mantissa[:i], mantissa[i+1:]
+		if !allDigits(fraction) && fraction != "" {
+			return 0, false
+		}
+	}
+	if thousands != 0 {
+		if exponent != "" {
+			return 0, false
+		}
+		groups := strings.Split(integer, string(thousands))
+		if len(groups[0]) == 0 || len(groups[0]) > 3 {
+			return 0, false
+		}
+		for _, group := range groups[1:] {
+			if len(group) != 3 {
+				return 0, false
+			}
+		}
+		integer = strings.Join(groups, "")
+	}
+	if !allDigits(integer) && integer != "" || integer == "" && fraction == "" {
+		return 0, false
+	}
+
+	n, err := strconv.ParseFloat(sign+integer+"."+fraction+exponent, 64)
+	if err != nil || math.IsInf(n, 0) {
+		return 0, false
+	}
+	return n, true
+}
+
+func allDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func IsEmpty(value interface{}) bool {
+	if value == nil {
+		return true
+	}
+	if s, ok := value.(string); ok {
+		return strings.TrimSpace(s) == ""
+	}
+	return false
+}
@@ -0,0 +1,62 @@
+package analytics
+
+import (
+	"math"
+	"testing"
+)
+
+func TestParseNumber(t *testing.T) {
+	tests := []struct {
+		input string
+		want  float64
+		ok    bool
+	}{
+		{"42", 42, true},
+		{"-3.5", -3.5, true},
+		{"+7", 7, true},
+		{"1,5", 1.5, true},
+		{"0,500", 0.5, true},
+		{"12,500", 12500, true},
+		{"1,234.5", 1234.5, true},
+		{"12,500.00", 12500, true},
+		{"1.234,5", 1234.5, true},
+		{"1.234.567", 1234567, true},
+		{"1,234,567", 1234567, true},
+		{"12 500,75", 12500.75, true},
+		{"12 500", 12500, true},
+		{"12 500,5", 12500.5, true},
+		{".5", 0.5, true},
+		{"1e3", 1000, true},
+		{"2.5E-2", 0.025, true},
+		{"", 0, false},
+		{"-", 0, false},
+		{"abc", 0, false},
+		{"Inf", 0, false},
+		{"-Infinity", 0, false},
+		{"NaN", 0, false},
+		{"0x1p3", 0, false},
+		{"1e999", 0, false},
+		{"1,2,3", 0, false},
+		{"1,23.4", 0, false},
+		{"1,234e3", 0, false},
+		{"12a", 0, false},
+	}
+
+	for _, tt := range tests {
+		got, ok := ParseNumber(tt.input)
+		if ok != tt.ok || (ok && math.Abs(got-tt.want) > 1e-9) {
+			t.Errorf("ParseNumber(%q) = %v, %v; want %v, %v", tt.input, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestToFloatRejectsNonFinite(t *testing.T) {
+	for _, value := range []interface{}{math.NaN(), math.Inf(1), math.Inf(-1), "NaN", nil, true} {
+		if _, ok := ToFloat(value); ok {
+			t.Errorf("ToFloat(%v) accepted a non-number", value)
+		}
+	}
+	if n, ok := ToFloat(int64(12)); !ok || n != 12 {
+		t.Errorf("ToFloat(int64(12)) = %v, %v", n, ok)
+	}
+}
@@ -0,0 +1,355 @@
+package analytics
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"mcp-xlsm-server/internal/models"
+)
+
+type AnomalyMethod string
+
+const (
+	ZScore         AnomalyMethod = "zscore"
+	IQR            AnomalyMethod = "iqr"
+	MAD            AnomalyMethod = "mad"
+	MonthOverMonth AnomalyMethod = "mom"
+)
+
+// DefaultThresholds are the usual cut-offs: 3 standard deviations, 1.5
+// interquartile ranges, a modified z-score of 3.5 and a 50% jump.
+var DefaultThresholds = map[AnomalyMethod]float64{
+	ZScore:         3.0,
+	IQR:            1.5,
+	MAD:            3.5,
+	MonthOverMonth: 0.5,
+}
+
+// Series orientation for month-over-month detection
+const (
+	SeriesByColumn = "column" // periods run down the rows
+	SeriesByRow    = "row"    // periods run across the columns
+)
+
+type AnomalyRequest struct {
+	Columns    []string
+	Methods    []AnomalyMethod
+	Thresholds map[AnomalyMethod]float64
+	Series     string
+	MinSamples int
+}
+
+type Detector struct{}
+
+func NewDetector() *Detector {
+	return &Detector{}
+}
+
+// Detect runs each method over the requested columns, or over every
+// mostly-numeric column when none are given.
+func (d *Detector) Detect(table *Table, req AnomalyRequest) ([]models.Anomaly, []string, error) {
+	minSamples := req.MinSamples
+	if minSamples <= 0 {
+		minSamples = 4
+	}
+
+	var colIdxs []int
+	if len(req.Columns) > 0 {
+		for _, name := range req.Columns {
+			colIdx, err := table.ColumnIndex(name)
+			if err != nil {
+				return nil, nil, err
+			}
+			colIdxs = append(colIdxs, colIdx)
+		}
+	} else {
+		colIdxs = NumericColumns(table, minSamples)
+	}
+
+	scanned := make([]string, len(colIdxs))
+	for i, colIdx := range colIdxs {
+		scanned[i] = table.Headers[colIdx]
+	}
+
+	var anomalies []models.Anomaly
+	for _, method := range req.Methods {
+		threshold, ok := req.Thresholds[method]
+		if !ok {
+			threshold, ok = DefaultThresholds[method]
+			if !ok {
+				return nil, nil, fmt.Errorf("unknown anomaly method: %s", method)
+			}
+		}
+
+		if method == MonthOverMonth && req.Series == SeriesByRow {
+			anomalies = append(anomalies, d.detectRowJumps(table, colIdxs, threshold)...)
+			continue
+		}
+
+		for _, colIdx := range colIdxs {
+			points := columnPoints(table, colIdx)
+			if len(points) < minSamples {
+				continue
+			}
+
+			var flagged []flaggedPoint
+			switch method {
+			case ZScore:
+				flagged = detectZScore(points, threshold)
+			case IQR:
+				flagged = detectIQR(points, threshold)
+			case MAD:
+				flagged = detectMAD(points, threshold)
+			case MonthOverMonth:
+				flagged = detectJumps(points, threshold)
+			}
+
+			for _, f := range flagged {
+				anomalies = append(anomalies, d.toAnomaly(table, f.point.row, colIdx, f.point.value, method, f.score, f.reason))
+			}
+		}
+	}
+
+	sort.SliceStable(anomalies, func(i, j int) bool {
+		return math.Abs(anomalies[i].Score) > math.Abs(anomalies[j].Score)
+	})
+
+	return anomalies, scanned, nil
+}
+
+type point struct {
+	row   int
+	col   int
+	value float64
+}
+
+type flaggedPoint struct {
+	point  point
+	score  float64
+	reason string
+}
+
+// NumericColumns lists columns where most non-empty cells are numbers.
+func NumericColumns(table *Table, minSamples int) []int {
+	var cols []int
+	for colIdx := range table.Headers {
+		numeric, nonEmpty := 0, 0
+		for _, row := range table.Rows {
+			if IsEmpty(row[colIdx]) {
+				continue
+			}
+			nonEmpty++
+			if _, ok := ToFloat(row[colIdx]); ok {
+				numeric++
+			}
+		}
+		if numeric >= minSamples && float64(numeric) >= 0.6*float64(nonEmpty) {
+			cols = append(cols, colIdx)
+		}
+	}
+	return cols
+}
+
+func columnPoints(table *Table, colIdx int) []point {
+	var points []point
+	for rowIdx, row := range table.Rows {
+		if v, ok := ToFloat(row[colIdx]); ok {
+			points = append(points, point{row: rowIdx, col: colIdx, value: v})
+		}
+	}
+	return points
+}
+
+func detectZScore(points []point, threshold float64) []flaggedPoint {
+	mean, sd := meanStdDev(points)
+	if sd == 0 {
+		return nil
+	}
+
+	var flagged []flaggedPoint
+	for _, p := range points {
+		z := (p.value - mean) / sd
+		if math.Abs(z) > threshold {
+			flagged = append(flagged, flaggedPoint{
+				point:  p,
+				score:  roundFloat(z),
+				reason: fmt.Sprintf("z-score %.2f beyond ±%g (mean %.2f, sd %.2f)", z, threshold, mean, sd),
+			})
+		}
+	}
+	return flagged
+}
+
+func detectIQR(points []point, k float64) []flaggedPoint {
+	values := pointValues(points)
+	q1 := Quantile(values, 0.25)
+	q3 := Quantile(values, 0.75)
+	iqr := q3 - q1
+	if iqr == 0 {
+		return nil
+	}
+
+	low := q1 - k*iqr
+	high := q3 + k*iqr
+
+	var flagged []flaggedPoint
+	for _, p := range points {
+		if p.value < low || p.value > high {
+			// Score is the distance outside the fence in IQR units
+			distance := (p.value - high) / iqr
+			if p.value < low {
+				distance = (p.value - low) / iqr
+			}
+			flagged = append(flagged, flaggedPoint{
+				point:  p,
+				score:  roundFloat(distance),
+				reason: fmt.Sprintf("outside IQR fences [%.2f, %.2f] (Q1 %.2f, Q3 %.2f, k %g)", low, high, q1, q3, k),
+			})
+		}
+	}
+	return flagged
+}
+
+func detectMAD(points []point, threshold float64) []flaggedPoint {
+	values := pointValues(points)
+	median := Quantile(values, 0.5)
+
+	deviations := make([]float64, len(values))
+	for i, v := range values {
+		deviations[i] = math.Abs(v - median)
+	}
+	mad := Quantile(deviations, 0.5)
+	if mad == 0 {
+		return nil
+	}
+
+	var flagged []flaggedPoint
+	for _, p := range points {
+		// 0.6745 makes the modified z-score comparable to a normal z-score
+		modified := 0.6745 * (p.value - median) / mad
+		if math.Abs(modified) > threshold {
+			flagged = append(flagged, flaggedPoint{
+				point:  p,
+				score:  roundFloat(modified),
+				reason: fmt.Sprintf("modified z-score %.2f beyond ±%g (median %.2f, MAD %.2f)", modified, threshold, median, mad),
+			})
+		}
+	}
+	return flagged
+}
+
+// detectJumps flags a period whose relative change from the previous
+// numeric period exceeds the threshold (0.5 = 50%). From a zero period,
+// where no relative change exists, the change is measured against the
+// typical level of the series, the median of its non-zero magnitudes, so
+// 0 -> 120 in a series around 100 is flagged and 0 -> 0.01 is not.
+func detectJumps(points []point, threshold float64) []flaggedPoint {
+	var flagged []flaggedPoint
+	level := -1.0
+	for i := 1; i < len(points); i++ {
+		prev := points[i-1].value
+		curr := points[i].value
+		if prev == 0 {
+			if curr == 0 {
+				continue
+			}
+			if level < 0 {
+				level = typicalLevel(points)
+			}
+			change := curr / level
+			if math.Abs(change) > threshold {
+				flagged = append(flagged, flaggedPoint{
+					point:  points[i],
+					score:  roundFloat(change),
+					reason: fmt.Sprintf("0 -> %.2f vs previous period, %+.1f%% of the typical level %.2f, threshold %g%%", curr, change*100, level, threshold*100),
+				})
+			}
+			continue
+		}
+
+		change := (curr - prev) / math.Abs(prev)
+		if math.Abs(change) > threshold {
+			flagged = append(flagged, flaggedPoint{
+				point:  points[i],
+				score:  roundFloat(change),
+				reason: fmt.Sprintf("%+.1f%% vs previous period (%.2f -> %.2f), threshold %g%%", change*100, prev, curr, threshold*100),
+			})
+		}
+	}
+	return flagged
+}
+
+// typicalLevel is the median magnitude of the non-zero points. Only
+// called when one is non-zero.
+func typicalLevel(points []point) float64 {
+	var magnitudes []float64
+	for _, p := range points {
+		if p.value != 0 {
+			magnitudes = append(magnitudes, math.Abs(p.value))
+		}
+	}
+	return Quantile(magnitudes, 0.5)
+}
+
+func (d *Detector) detectRowJumps(table *Table, colIdxs []int, threshold float64) []models.Anomaly {
+	var anomalies []models.Anomaly
+	for rowIdx, row := range table.Rows {
+		var points []point
+		for _, colIdx := range colIdxs {
+			if v, ok := ToFloat(row[colIdx]); ok {
+				points = append(points, point{row: rowIdx, col: colIdx, value: v})
+			}
+		}
+
+		for _, f := range detectJumps(points, threshold) {
+			anomalies = append(anomalies, d.toAnomaly(table, rowIdx, f.point.col, f.point.value, MonthOverMonth, f.score, f.reason))
+		}
+	}
+	return anomalies
+}
+
+func (d *Detector) toAnomaly(table *Table, rowIdx, colIdx int, value float64, method AnomalyMethod, score float64, reason string) models.Anomaly {
+	location := table.CellRef(rowIdx, colIdx)
+	if location == "" {
+		location = fmt.Sprintf("row %d", rowIdx+1)
+	}
+
+	return models.Anomaly{
+		Location:   location,
+		Column:     table.Headers[colIdx],
+		Value:      value,
+		Method:     string(method),
+		Score:      score,
+		Reason:     reason,
+		RowContext: table.RowContext(rowIdx, 6),
+	}
+}
+
+func meanStdDev(points []point) (float64, float64) {
+	if len(points) < 2 {
+		return 0, 0
+	}
+
+	sum := 0.0
+	for _, p := range points {
+		sum += p.value
+	}
+	mean := sum / float64(len(points))
+
+	variance := 0.0
+	for _, p := range points {
+		variance += (p.value - mean) * (p.value - mean)
+	}
+	variance /= float64(len(points) - 1)
+
+	return mean, math.Sqrt(variance)
+}
+
+func pointValues(points []point) []float64 {
+	values := make([]float64, len(points))
+	for i, p := range points {
+		values[i] = p.value
+	}
+	return values
+}
@@ -0,0 +1,104 @@
+package analytics
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// column builds a one-column table named "Montant" from values
+func column(values ...interface{}) *Table {
+	rows := [][]interface{}{{"Montant"}}
+	for _, v := range values {
+		rows = append(rows, []interface{}{v})
+	}
+	return NewTable(rows, true)
+}
+
+func TestDetect(t *testing.T) {
+	spiked := column(10.0, 11.0, 9.0, 10.0, 12.0, 10.0, 50.0)
+	constant := column(5.0, 5.0, 5.0, 5.0, 5.0)
+
+	tests := []struct {
+		name      string
+		table     *Table
+		method    AnomalyMethod
+		threshold float64
+		// "location value score" per anomaly
+		want []string
+	}{
+		{"zscore", spiked, ZScore, 2, []string{"row 7 50 2.263316"}},
+		{"zscore under the default threshold", spiked, ZScore, 0, nil},
+		{"zscore constant", constant, ZScore, 0, nil},
+		{"iqr", spiked, IQR, 0, []string{"row 7 50 24.166667"}},
+		{"iqr constant", constant, IQR, 0, nil},
+		{"mad", spiked, MAD, 0, []string{"row 7 50 26.98"}},
+		{"mad constant", constant, MAD, 0, nil},
+		{"mom", column(100.0, 110.0, 40.0, 45.0), MonthOverMonth, 0, []string{"row 3 40 -0.636364"}},
+		{"mom from and to zero", column(100.0, 110.0, 0.0, 0.0, 120.0, 130.0), MonthOverMonth, 0, []string{"row 5 120 1.043478", "row 3 0 -1"}},
+		{"mom small step from zero", column(100.0, 0.0, 20.0, 110.0), MonthOverMonth, 0, []string{"row 4 110 4.5", "row 2 0 -1"}},
+		{"mom constant", constant, MonthOverMonth, 0, nil},
+		{"fewer than 4 points", column(1.0, 1000.0, 1.0), ZScore, 0.1, nil},
+		{"text is skipped", column(10.0, "n/a", 11.0, 9.0, 10.0, 60.0), IQR, 0, []string{"row 6 60 47.5"}},
+	}
+
+	detector := NewDetector()
+	for _, tt := range tests {
+		req := AnomalyRequest{Columns: []string{"Montant"}, Methods: []AnomalyMethod{tt.method}}
+		if tt.threshold > 0 {
+			req.Thresholds = map[AnomalyMethod]float64{tt.method: tt.threshold}
+		}
+		anomalies, scanned, err := detector.Detect(tt.table, req)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if !reflect.DeepEqual(scanned, []string{"Montant"}) {
+			t.Errorf("%s: scanned %v", tt.name, scanned)
+		}
+
+		var got []string
+		for _, a := range anomalies {
+			if a.Method != string(tt.method) || a.Column != "Montant" || a.Reason == "" {
+				t.Errorf("%s: anomaly %+v", tt.name, a)
+			}
+			got = append(got, fmt.Sprintf("%s %v %v", a.Location, a.Value, a.Score))
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDetectRowSeries(t *testing.T) {
+	// Periods run across the columns; only the second row jumps
+	table := NewTable([][]interface{}{
+		{"Rayon", "Jan", "Fev", "Mar", "Avr"},
+		{"Frais", 100.0, 105.0, 98.0, 102.0},
+		{"Bazar", 0.0, 80.0, 82.0, 20.0},
+	}, true)
+
+	anomalies, _, err := NewDetector().Detect(table, AnomalyRequest{
+		Columns: []string{"Jan", "Fev", "Mar", "Avr"},
+		Methods: []AnomalyMethod{MonthOverMonth},
+		Series:  SeriesByRow,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, a := range anomalies {
+		got = append(got, fmt.Sprintf("%s %s %v", a.Location, a.Column, a.Score))
+	}
+	want := []string{"row 2 Fev 1", "row 2 Avr -0.756098"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestDetectUnknownMethod(t *testing.T) {
+	_, _, err := NewDetector().Detect(column(1.0, 2.0, 3.0, 4.0), AnomalyRequest{Methods: []AnomalyMethod{"grubbs"}})
+	if err == nil {
+		t.Error("Detect accepted an unknown method")
+	}
+}
@@ -0,0 +1,111 @@
+package analytics
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// HavingClause is a conjunction of comparisons against aggregate outputs,
+// e.g. "sum_amount > 1000 AND count >= 3".
+type HavingClause struct {
+	conditions []havingCondition
+}
+
+type havingCondition struct {
+	name  string
+	op    string
+	value float64
+}
+
+var (
+	havingCondPattern = regexp.MustCompile(`^\s*(.+?)\s*(>=|<=|<>|!=|=|>|<)\s*(-?[0-9][0-9.,]*)\s*$`)
+	havingFuncPattern = regexp.MustCompile(`^(?i)(\w+)\(\s*([^)]*?)\s*\)$`)
+	havingAndPattern  = regexp.MustCompile(`(?i)\s+and\s+`)
+)
+
+func ParseHaving(expr string) (*HavingClause, error) {
+	clause := &HavingClause{}
+	if strings.TrimSpace(expr) == "" {
+		return clause, nil
+	}
+
+	for _, part := range havingAndPattern.Split(expr, -1) {
+		match := havingCondPattern.FindStringSubmatch(part)
+		if match == nil {
+			return nil, fmt.Errorf("invalid having condition: %q", strings.TrimSpace(part))
+		}
+
+		value, ok := ParseNumber(match[3])
+		if !ok {
+			return nil, fmt.Errorf("invalid having value %q", match[3])
+		}
+
+		clause.conditions = append(clause.conditions, havingCondition{
+			name:  normalizeAggregateName(match[1]),
+			op:    match[2],
+			value: value,
+		})
+	}
+
+	return clause, nil
+}
+
+// Match reports whether a group's aggregate values satisfy every condition.
+// Values are keyed by lower-cased output name; a condition on a name that
+// is not among them is an error rather than a group that never matches.
+func (hc *HavingClause) Match(values map[string]interface{}) (bool, error) {
+	for _, cond := range hc.conditions {
+		raw, exists := values[cond.name]
+		if !exists {
+			names := make([]string, 0, len(values))
+			for name := range values {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			return false, fmt.Errorf("having refers to unknown aggregate %q, expected one of %s", cond.name, strings.Join(names, ", "))
+		}
+		v, ok := ToFloat(raw)
+		if !ok {
+			return false, nil
+		}
+		if !compareFloat(v, cond.op, cond.value) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// normalizeAggregateName maps "SUM(amount)" to the default output name
+// "sum_amount" so both spellings work in HAVING.
+func normalizeAggregateName(name string) string {
+	name = strings.TrimSpace(name)
+	if match := havingFuncPattern.FindStringSubmatch(name); match != nil {
+		fn := strings.ToLower(match[1])
+		col := strings.Trim(match[2], `"'`)
+		if col == "*" {
+			return fn
+		}
+		return strings.ToLower(fmt.Sprintf("%s_%s", fn, col))
+	}
+	return strings.ToLower(strings.Trim(name, `"'`))
+}
+
+func compareFloat(a float64, op string, b float64) bool {
+	switch op {
+	case ">":
+		return a > b
+	case ">=":
+		return a >= b
+	case "<":
+		return a < b
+	case "<=":
+		return a <= b
+	case "=":
+		return a == b
+	case "<>", "!=":
+		return a != b
+	}
+	return false
+}
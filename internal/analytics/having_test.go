@@ -0,0 +1,65 @@
+package analytics
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHavingMatch(t *testing.T) {
+	values := map[string]interface{}{"total": 1500.0, "count": 2}
+
+	tests := []struct {
+		expr    string
+		want    bool
+		wantErr string
+	}{
+		{"total > 1000", true, ""},
+		{"total > 1000 AND count >= 3", false, ""},
+		{"total <= 1500,5", true, ""},
+		{"SUM(amount) > 0", false, "unknown aggregate"},
+		{"totl > 1000", false, "unknown aggregate"},
+	}
+
+	for _, tt := range tests {
+		clause, err := ParseHaving(tt.expr)
+		if err != nil {
+			t.Fatalf("ParseHaving(%q): %v", tt.expr, err)
+		}
+		got, err := clause.Match(values)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Match(%q) error = %v, want %q", tt.expr, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("Match(%q) = %v, %v; want %v", tt.expr, got, err, tt.want)
+		}
+	}
+}
+
+func TestAggregateUnknownHavingAlias(t *testing.T) {
+	table := NewTable([][]interface{}{
+		{"Classe", "Montant"},
+		{"6", 100.0},
+		{"7", 250.0},
+	}, true)
+
+	req := AggregateRequest{
+		Aggregates: []AggregateSpec{{Function: Sum, Column: "Montant", Alias: "total"}},
+		GroupBy:    []string{"Classe"},
+		Having:     "totl > 0",
+	}
+	if _, err := NewEngine().Aggregate(table, req); err == nil {
+		t.Fatal("expected an error for a having on an unknown alias")
+	}
+
+	req.Having = "total > 150"
+	result, err := NewEngine().Aggregate(table, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Rows) != 1 || result.Rows[0][1] != 250.0 {
+		t.Errorf("rows = %v, want the 7 group only", result.Rows)
+	}
+}
@@ -0,0 +1,298 @@
+package analytics
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"mcp-xlsm-server/internal/models"
+)
+
+type JoinType string
+
+const (
+	InnerJoin JoinType = "inner"
+	LeftJoin  JoinType = "left"
+	AntiJoin  JoinType = "anti"
+)
+
+// Match modes: "first" keeps the first lookup row per key like VLOOKUP
+// and XLOOKUP, "all" returns every matching lookup row.
+const (
+	MatchFirst = "first"
+	MatchAll   = "all"
+)
+
+type JoinRequest struct {
+	LeftKeys      []string
+	RightKeys     []string
+	Type          JoinType
+	MatchMode     string
+	CaseSensitive bool
+	// Columns restricts the output; empty means every column
+	Columns []string
+}
+
+type JoinResult struct {
+	Columns []string
+	Rows    [][]interface{}
+	Stats   models.JoinStats
+}
+
+// Join matches left rows to right (lookup) rows on key columns. An anti
+// join returns each unmatched left key once, with how often it occurs and
+// where it first appears.
+func Join(left, right *Table, req JoinRequest) (*JoinResult, error) {
+	if len(req.LeftKeys) == 0 || len(req.LeftKeys) != len(req.RightKeys) {
+		return nil, fmt.Errorf("left and right key lists must be non-empty and of equal length")
+	}
+
+	leftIdx, err := columnIndexes(left, req.LeftKeys)
+	if err != nil {
+		return nil, fmt.Errorf("left: %w", err)
+	}
+	rightIdx, err := columnIndexes(right, req.RightKeys)
+	if err != nil {
+		return nil, fmt.Errorf("right: %w", err)
+	}
+
+	stats := models.JoinStats{LeftRows: len(left.Rows), RightRows: len(right.Rows)}
+
+	// Index the lookup side
+	lookup := make(map[string][]int)
+	for rowIdx, row := range right.Rows {
+		key, ok := compositeKey(row, rightIdx, req.CaseSensitive)
+		if !ok {
+			continue
+		}
+		if len(lookup[key]) == 1 {
+			stats.DuplicateKeys++
+		}
+		lookup[key] = append(lookup[key], rowIdx)
+	}
+
+	if req.Type == AntiJoin {
+		return antiJoin(left, leftIdx, lookup, req, stats), nil
+	}
+
+	columns, pick := joinColumns(left, right, req.Columns)
+	if pick == nil {
+		return nil, fmt.Errorf("unknown output column in %v", req.Columns)
+	}
+
+	result := &JoinResult{Columns: columns, Rows: [][]interface{}{}}
+	for _, leftRow := range left.Rows {
+		var matches []int
+		if key, ok := compositeKey(leftRow, leftIdx, req.CaseSensitive); ok {
+			matches = lookup[key]
+		}
+
+		if len(matches) == 0 {
+			stats.UnmatchedLeftRows++
+			if req.Type == LeftJoin {
+				result.Rows = append(result.Rows, pick(leftRow, nil))
+			}
+			continue
+		}
+
+		stats.MatchedLeftRows++
+		if req.MatchMode != MatchAll {
+			matches = matches[:1]
+		}
+		for _, rightIdx := range matches {
+			result.Rows = append(result.Rows, pick(leftRow, right.Rows[rightIdx]))
+		}
+	}
+
+	result.Stats = stats
+	return result, nil
+}
+
+func antiJoin(left *Table, leftIdx []int, lookup map[string][]int, req JoinRequest, stats models.JoinStats) *JoinResult {
+	result := &JoinResult{Rows: [][]interface{}{}}
+	for _, colIdx := range leftIdx {
+		result.Columns = append(result.Columns, left.Headers[colIdx])
+	}
+	result.Columns = append(result.Columns, "occurrences", "first_location")
+
+	positions := make(map[string]int)
+	for rowIdx, row := range left.Rows {
+		key, ok := compositeKey(row, leftIdx, req.CaseSensitive)
+		if !ok {
+			continue
+		}
+		if _, matched := lookup[key]; matched {
+			stats.MatchedLeftRows++
+			continue
+		}
+
+		stats.UnmatchedLeftRows++
+		if pos, seen := positions[key]; seen {
+			result.Rows[pos][len(leftIdx)] = result.Rows[pos][len(leftIdx)].(int) + 1
+			continue
+		}
+
+		out := make([]interface{}, 0, len(leftIdx)+2)
+		for _, colIdx := range leftIdx {
+			out = append(out, row[colIdx])
+		}
+		location := left.CellRef(rowIdx, leftIdx[0])
+		if location == "" {
+			location = fmt.Sprintf("row %d", rowIdx+1)
+		}
+		out = append(out, 1, location)
+
+		positions[key] = len(result.Rows)
+		result.Rows = append(result.Rows, out)
+	}
+
+	result.Stats = stats
+	return result
+}
+
+// joinColumns lists the output columns and returns a function building
+// one output row. Right columns whose name clashes with a left column are
+// prefixed with "right.". pick is nil when a requested column is unknown.
+func joinColumns(left, right *Table, wanted []string) ([]string, func(l, r []interface{}) []interface{}) {
+	type source struct {
+		right bool
+		idx   int
+	}
+
+	var all []string
+	var sources []source
+	leftNames := make(map[string]bool)
+	for i, header := range left.Headers {
+		all = append(all, header)
+		sources = append(sources, source{idx: i})
+		leftNames[strings.ToLower(header)] = true
+	}
+	for i, header := range right.Headers {
+		name := header
+		if leftNames[strings.ToLower(header)] {
+			name = "right." + header
+		}
+		all = append(all, name)
+		sources = append(sources, source{right: true, idx: i})
+	}
+
+	selected := make([]int, 0, len(all))
+	if len(wanted) == 0 {
+		for i := range all {
+			selected = append(selected, i)
+		}
+	} else {
+		for _, name := range wanted {
+			found := -1
+			for i, col := range all {
+				if strings.EqualFold(col, name) {
+					found = i
+					break
+				}
+			}
+			if found < 0 {
+				return nil, nil
+			}
+			selected = append(selected, found)
+		}
+	}
+
+	columns := make([]string, len(selected))
+	for i, idx := range selected {
+		columns[i] = all[idx]
+	}
+
+	pick := func(l, r []interface{}) []interface{} {
+		out := make([]interface{}, len(selected))
+		for i, idx := range selected {
+			src := sources[idx]
+			if src.right {
+				if r != nil {
+					out[i] = r[src.idx]
+				}
+			} else {
+				out[i] = l[src.idx]
+			}
+		}
+		return out
+	}
+
+	return columns, pick
+}
+
+func columnIndexes(table *Table, names []string) ([]int, error) {
+	idxs := make([]int, len(names))
+	for i, name := range names {
+		idx, err := table.ColumnIndex(name)
+		if err != nil {
+			return nil, err
+		}
+		idxs[i] = idx
+	}
+	return idxs, nil
+}
+
+// compositeKey joins normalized key parts; ok is false when any part is
+// empty, since blank keys never match in a lookup.
+func compositeKey(row []interface{}, idxs []int, caseSensitive bool) (string, bool) {
+	parts := make([]string, len(idxs))
+	for i, idx := range idxs {
+		if IsEmpty(row[idx]) {
+			return "", false
+		}
+		parts[i] = NormalizeKey(row[idx], caseSensitive)
+	}
+	return strings.Join(parts, "\x00"), true
+}
+
+// NormalizeKey makes lookup keys compare the way Excel lookups do: numbers
+// match whether stored as text or number, surrounding spaces are ignored
+// and, unless caseSensitive, case is ignored. Text of digits is compared
+// digit for digit, so long account numbers keep every digit and "007"
+// stays apart from 7; only text written as a plain decimal such as "1.5"
+// is read as a number. Thousands separators and decimal commas are not.
+func NormalizeKey(value interface{}, caseSensitive bool) string {
+	switch v := value.(type) {
+	case float64:
+		if !math.IsNaN(v) && !math.IsInf(v, 0) {
+			return numberKey(v)
+		}
+	case int:
+		return "n:" + strconv.Itoa(v)
+	case int64:
+		return "n:" + strconv.FormatInt(v, 10)
+	}
+
+	s := strings.TrimSpace(fmt.Sprint(value))
+	digits := strings.TrimPrefix(s, "+")
+	if allDigits(strings.TrimPrefix(digits, "-")) {
+		return "n:" + digits
+	}
+	if decimalPattern.MatchString(s) {
+		if n, err := strconv.ParseFloat(s, 64); err == nil && !math.IsInf(n, 0) {
+			return numberKey(n)
+		}
+	}
+
+	if !caseSensitive {
+		s = strings.ToLower(s)
+	}
+	return "s:" + s
+}
+
+// A number written with a dot for decimals and no thousands separator
+var decimalPattern = regexp.MustCompile(`^[+-]?(?:[0-9]+\.?[0-9]*|\.[0-9]+)(?:[eE][+-]?[0-9]+)?$`)
+
+// numberKey writes whole numbers as their digits, so they meet the same
+// digits written as text, and other numbers in their shortest exact form
+func numberKey(n float64) string {
+	if n == 0 {
+		return "n:0"
+	}
+	if n == math.Trunc(n) {
+		return "n:" + strconv.FormatFloat(n, 'f', -1, 64)
+	}
+	return "n:" + strconv.FormatFloat(n, 'g', -1, 64)
+}
@@ -0,0 +1,152 @@
+package analytics
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+)
+
+func TestNormalizeKey(t *testing.T) {
+	tests := []struct {
+		a, b          interface{}
+		caseSensitive bool
+		match         bool
+	}{
+		{"42", 42.0, false, true},
+		{" 42 ", int64(42), false, true},
+		{"42.0", 42, false, true},
+		{"1.5", 1.5, false, true},
+		{"+7", 7.0, false, true},
+		{"-3", -3.0, false, true},
+		{"007", 7.0, false, false},
+		{"1,5", "1.5", false, false},
+		{"1,5", 1.5, false, false},
+		{"12,500", 12500.0, false, false},
+		{"12345678901234567", "12345678901234568", false, false},
+		{"12345678901234567", "12345678901234567", false, true},
+		{"12345678901234567", 12345678901234567.0, false, false},
+		{"Banque", "BANQUE", false, true},
+		{"Banque", "BANQUE", true, false},
+		{"1e3", 1000.0, false, true},
+		{"Inf", "inf", false, true},
+	}
+
+	for _, tt := range tests {
+		a, b := NormalizeKey(tt.a, tt.caseSensitive), NormalizeKey(tt.b, tt.caseSensitive)
+		if (a == b) != tt.match {
+			t.Errorf("NormalizeKey(%#v) = %q, NormalizeKey(%#v) = %q, want match %v", tt.a, a, tt.b, b, tt.match)
+		}
+	}
+}
+
+func TestJoinLongAccountNumbers(t *testing.T) {
+	left := NewTable([][]interface{}{
+		{"Compte", "Montant"},
+		{"40110000000000001", 10.0},
+		{"40110000000000002", 20.0},
+	}, true)
+	right := NewTable([][]interface{}{
+		{"Compte", "Tiers"},
+		{"40110000000000002", "Fournisseur B"},
+		{"40110000000000001", "Fournisseur A"},
+	}, true)
+
+	result, err := Join(left, right, JoinRequest{
+		LeftKeys:  []string{"Compte"},
+		RightKeys: []string{"Compte"},
+		Type:      InnerJoin,
+		MatchMode: MatchAll,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Rows) != 2 {
+		t.Fatalf("rows = %v, want one match per account", result.Rows)
+	}
+	for _, row := range result.Rows {
+		want := map[string]string{"40110000000000001": "Fournisseur A", "40110000000000002": "Fournisseur B"}[row[0].(string)]
+		if row[len(row)-1] != want {
+			t.Errorf("account %v joined to %v, want %s", row[0], row[len(row)-1], want)
+		}
+	}
+}
+
+func TestParseCellKeepsCodes(t *testing.T) {
+	tests := []struct {
+		cell string
+		want interface{}
+	}{
+		{"", nil},
+		{"7", 7.0},
+		{"0.5", 0.5},
+		{"1 234,5", 1234.5},
+		{"007", "007"},
+		{" 0123 ", " 0123 "},
+		{"123456789012345", 123456789012345.0},
+		{"1234567890123456", "1234567890123456"},
+		{"-12345678901234567890", "-12345678901234567890"},
+		{"1.2345678901234567E+19", 1.2345678901234567e19},
+	}
+	for _, tt := range tests {
+		if got := ParseCell(tt.cell); got != tt.want {
+			t.Errorf("ParseCell(%q) = %#v, want %#v", tt.cell, got, tt.want)
+		}
+	}
+}
+
+func TestJoinSheetTables(t *testing.T) {
+	f := excelize.NewFile()
+	f.NewSheet("Tiers")
+	for sheet, rows := range map[string][][]interface{}{
+		"Sheet1": {
+			{"Compte", "Montant"},
+			{"12345678901234567891", 10},
+			{"12345678901234567890", 20},
+			{"007", 30},
+		},
+		"Tiers": {
+			{"Compte", "Tiers"},
+			{"12345678901234567890", "Fournisseur B"},
+			{"12345678901234567891", "Fournisseur A"},
+			{7, "Client sept"},
+		},
+	} {
+		for i, row := range rows {
+			cell, _ := excelize.CoordinatesToCellName(1, i+1)
+			f.SetSheetRow(sheet, cell, &row)
+		}
+	}
+
+	left, err := LoadSheetTable(f, "Sheet1", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	right, err := LoadSheetTable(f, "Tiers", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := Join(left, right, JoinRequest{
+		LeftKeys:  []string{"Compte"},
+		RightKeys: []string{"Compte"},
+		Type:      LeftJoin,
+		MatchMode: MatchAll,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Keys and values keep every digit; "007" is not 7
+	got := make(map[interface{}]interface{})
+	for _, row := range result.Rows {
+		got[row[0]] = row[len(row)-1]
+	}
+	want := map[interface{}]interface{}{
+		"12345678901234567891": "Fournisseur A",
+		"12345678901234567890": "Fournisseur B",
+		"007":                  nil,
+	}
+	if len(result.Rows) != 3 || !reflect.DeepEqual(got, want) {
+		t.Errorf("joined rows = %v, want %v", result.Rows, want)
+	}
+}
@@ -0,0 +1,242 @@
+package analytics
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// Table is a rectangular set of rows with one header per column.
+// Cell values are float64, string or nil.
+type Table struct {
+	Sheet   string
+	Headers []string
+	Rows    [][]interface{}
+	// RowNumbers holds the 1-based sheet row of each data row when the
+	// table was read straight from a sheet.
+	RowNumbers []int
+	// FirstCol is the 1-based sheet column of the first table column;
+	// 0 means column A.
+	FirstCol int
+}
+
+// NewTable builds a table from raw rows, using the first row as headers
+// when hasHeader is set and column letters otherwise.
+func NewTable(rows [][]interface{}, hasHeader bool) *Table {
+	width := 0
+	for _, row := range rows {
+		if len(row) > width {
+			width = len(row)
+		}
+	}
+
+	table := &Table{Headers: make([]string, width)}
+	for i := 0; i < width; i++ {
+		colName, _ := excelize.ColumnNumberToName(i + 1)
+		table.Headers[i] = colName
+	}
+
+	start := 0
+	if hasHeader && len(rows) > 0 {
+		for i, cell := range rows[0] {
+			if cell != nil && fmt.Sprint(cell) != "" {
+				table.Headers[i] = strings.TrimSpace(fmt.Sprint(cell))
+			}
+		}
+		start = 1
+	}
+
+	for _, row := range rows[start:] {
+		padded := make([]interface{}, width)
+		copy(padded, row)
+		table.Rows = append(table.Rows, padded)
+	}
+
+	return table
+}
+
+// ColumnIndex resolves a column by header name (case-insensitive) or by
+// column letter.
+func (t *Table) ColumnIndex(name string) (int, error) {
+	for i, header := range t.Headers {
+		if strings.EqualFold(header, name) {
+			return i, nil
+		}
+	}
+
+	if colNum, err := excelize.ColumnNameToNumber(name); err == nil && colNum <= len(t.Headers) {
+		return colNum - 1, nil
+	}
+
+	return -1, fmt.Errorf("unknown column: %s", name)
+}
+
+// LoadSheetTable reads a sheet into a table. headerRow is 1-based; rows
+// above it are skipped and 0 means the sheet has no header row.
+func LoadSheetTable(file *excelize.File, sheetName string, headerRow int) (*Table, error) {
+	rows, err := file.GetRows(sheetName)
+	if err != nil {
+		return nil, err
+	}
+
+	start := 0
+	if headerRow > 0 {
+		start = headerRow - 1
+	}
+
+	var raw [][]interface{}
+	var rowNumbers []int
+	for rowIdx := start; rowIdx < len(rows); rowIdx++ {
+		row := make([]interface{}, len(rows[rowIdx]))
+		for colIdx, cell := range rows[rowIdx] {
+			row[colIdx] = ParseCell(cell)
+		}
+		raw = append(raw, row)
+		rowNumbers = append(rowNumbers, rowIdx+1)
+	}
+
+	table := NewTable(raw, headerRow > 0)
+	table.Sheet = sheetName
+	if headerRow > 0 && len(rowNumbers) > 0 {
+		rowNumbers = rowNumbers[1:]
+	}
+	table.RowNumbers = rowNumbers
+
+	return table, nil
+}
+
+// ParseCell converts a formatted cell string to float64 when it reads as a
+// number, nil when empty, and leaves it as text otherwise. Codes such as
+// "00123" or long account numbers stay text, see IsCode.
+func ParseCell(cell string) interface{} {
+	text := strings.TrimSpace(cell)
+	if text == "" {
+		return nil
+	}
+	if IsCode(text) {
+		return cell
+	}
+	if num, ok := ToFloat(text); ok {
+		return num
+	}
+	return cell
+}
+
+// Digits a float64 holds exactly
+const maxExactDigits = 15
+
+// IsCode reports whether numeric-looking text is a code rather than a
+// quantity: it has a leading zero, as in "00123", or more digits than a
+// float64 keeps, as in a 20-digit account number. Reading either as a
+// number would change it.
+func IsCode(text string) bool {
+	text = strings.TrimSpace(text)
+	if len(text) > 1 && text[0] == '0' && text[1] >= '0' && text[1] <= '9' {
+		return true
+	}
+	digits := strings.TrimLeft(text, "+-")
+	return len(digits) > maxExactDigits && allDigits(digits)
+}
+
+// CellRef returns the A1 reference of a data cell, or "" when the table
+// does not know its sheet position.
+func (t *Table) CellRef(rowIdx, colIdx int) string {
+	if rowIdx >= len(t.RowNumbers) {
+		return ""
+	}
+	firstCol := t.FirstCol
+	if firstCol == 0 {
+		firstCol = 1
+	}
+	ref, err := excelize.CoordinatesToCellName(firstCol+colIdx, t.RowNumbers[rowIdx])
+	if err != nil {
+		return ""
+	}
+	if t.Sheet != "" {
+		return fmt.Sprintf("%s!%s", t.Sheet, ref)
+	}
+	return ref
+}
+
+// RowContext returns the first non-empty cells of a row keyed by header,
+// enough to identify the row without returning all of it.
+func (t *Table) RowContext(rowIdx int, maxCells int) map[string]interface{} {
+	context := make(map[string]interface{})
+	for colIdx, value := range t.Rows[rowIdx] {
+		if len(context) >= maxCells {
+			break
+		}
+		if !IsEmpty(value) {
+			context[t.Headers[colIdx]] = value
+		}
+	}
+	return context
+}
+
+// LoadRangeTable reads an A1 range such as "B3:F120" from a sheet. The
+// first row of the range is used as headers when hasHeader is set.
+func LoadRangeTable(file *excelize.File, sheetName string, rangeRef string, hasHeader bool) (*Table, error) {
+	startCol, startRow, endCol, endRow, err := ParseRange(rangeRef)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := file.GetRows(sheetName)
+	if err != nil {
+		return nil, err
+	}
+
+	var raw [][]interface{}
+	var rowNumbers []int
+	for rowIdx := startRow - 1; rowIdx < endRow && rowIdx < len(rows); rowIdx++ {
+		row := make([]interface{}, endCol-startCol+1)
+		for colIdx := startCol - 1; colIdx < endCol && colIdx < len(rows[rowIdx]); colIdx++ {
+			row[colIdx-startCol+1] = ParseCell(rows[rowIdx][colIdx])
+		}
+		raw = append(raw, row)
+		rowNumbers = append(rowNumbers, rowIdx+1)
+	}
+
+	table := NewTable(raw, hasHeader)
+	table.Sheet = sheetName
+	table.FirstCol = startCol
+	if !hasHeader {
+		for i := range table.Headers {
+			table.Headers[i], _ = excelize.ColumnNumberToName(startCol + i)
+		}
+	}
+	if hasHeader && len(rowNumbers) > 0 {
+		rowNumbers = rowNumbers[1:]
+	}
+	table.RowNumbers = rowNumbers
+
+	return table, nil
+}
+
+// ParseRange splits "A1:C10" into 1-based column and row bounds. A single
+// cell reference is a one-cell range.
+func ParseRange(rangeRef string) (startCol, startRow, endCol, endRow int, err error) {
+	parts := strings.Split(strings.ReplaceAll(rangeRef, "$", ""), ":")
+	startCol, startRow, err = excelize.CellNameToCoordinates(parts[0])
+	if err != nil {
+		return 0, 0, 0, 0, fmt.Errorf("invalid range %q: %w", rangeRef, err)
+	}
+	endCol, endRow = startCol, startRow
+
+	if len(parts) == 2 {
+		endCol, endRow, err = excelize.CellNameToCoordinates(parts[1])
+		if err != nil {
+			return 0, 0, 0, 0, fmt.Errorf("invalid range %q: %w", rangeRef, err)
+		}
+	}
+
+	if endCol < startCol {
+		startCol, endCol = endCol, startCol
+	}
+	if endRow < startRow {
+		startRow, endRow = endRow, startRow
+	}
+
+	return startCol, startRow, endCol, endRow, nil
+}
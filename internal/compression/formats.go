@@ -0,0 +1,160 @@
+package compression
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"strings"
+)
+
+// Encodings for tabular output. Headers come once at the top in every
+// format; json_rows is the row-of-arrays layout used so far.
+const (
+	FormatJSONRows = "json_rows"
+	FormatColumnar = "columnar"
+	FormatCSV      = "csv"
+	FormatMarkdown = "markdown"
+	FormatTSV      = "tsv"
+)
+
+// Formats lists the encodings in the order their costs are reported
+var Formats = []string{FormatJSONRows, FormatColumnar, FormatCSV, FormatMarkdown, FormatTSV}
+
+// Columnar holds one array of values per column, so each header appears
+// once and values of a column sit together
+type Columnar struct {
+	Columns []string        `json:"columns"`
+	Values  [][]interface{} `json:"values"`
+}
+
+func ValidFormat(format string) bool {
+	for _, f := range Formats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+// Encode renders rows under header. The JSON formats give a value to
+// marshal; csv, markdown and tsv give text.
+func Encode(format string, header []string, rows [][]interface{}) (interface{}, error) {
+	switch format {
+	case FormatJSONRows:
+		encoded := make([][]interface{}, 0, len(rows)+1)
+		headerRow := make([]interface{}, len(header))
+		for i, name := range header {
+			headerRow[i] = name
+		}
+		return append(append(encoded, headerRow), rows...), nil
+	case FormatColumnar:
+		columnar := Columnar{Columns: header, Values: make([][]interface{}, len(header))}
+		for col := range header {
+			values := make([]interface{}, len(rows))
+			for i, row := range rows {
+				values[i] = cell(row, col)
+			}
+			columnar.Values[col] = values
+		}
+		return columnar, nil
+	case FormatCSV:
+		return encodeCSV(header, rows), nil
+	case FormatMarkdown:
+		return encodeMarkdown(header, rows), nil
+	case FormatTSV:
+		return encodeTSV(header, rows), nil
+	default:
+		return nil, fmt.Errorf("unknown format %q, expected one of %s", format, strings.Join(Formats, ", "))
+	}
+}
+
+// FormatCosts counts the tokens rows would take in each format, as they
+// appear in a JSON response
+func (cm *Manager) FormatCosts(header []string, rows [][]interface{}) (map[string]int, error) {
+	costs := make(map[string]int, len(Formats))
+	for _, format := range Formats {
+		encoded, err := Encode(format, header, rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens, err := cm.count(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("failed to count tokens: %w", err)
+		}
+		costs[format] = tokens
+	}
+	return costs, nil
+}
+
+func encodeMarkdown(header []string, rows [][]interface{}) string {
+	var b strings.Builder
+	writeRow := func(values []string) {
+		b.WriteString("|")
+		for _, value := range values {
+			b.WriteString(" ")
+			b.WriteString(markdownEscaper.Replace(value))
+			b.WriteString(" |")
+		}
+		b.WriteString("\n")
+	}
+
+	writeRow(header)
+	b.WriteString("|")
+	for range header {
+		b.WriteString(" --- |")
+	}
+	b.WriteString("\n")
+	record := make([]string, len(header))
+	for _, row := range rows {
+		for i := range record {
+			record[i] = formatCell(cell(row, i))
+		}
+		writeRow(record)
+	}
+	return b.String()
+}
+
+var markdownEscaper = strings.NewReplacer("|", `\|`, "\r\n", "<br>", "\n", "<br>")
+
+// encodeTSV writes tab-separated rows; tabs and line breaks inside a
+// cell become spaces, since TSV has no quoting
+func encodeTSV(header []string, rows [][]interface{}) string {
+	var buf bytes.Buffer
+	writeRow := func(values []string) {
+		for i, value := range values {
+			if i > 0 {
+				buf.WriteByte('\t')
+			}
+			buf.WriteString(tsvEscaper.Replace(value))
+		}
+		buf.WriteByte('\n')
+	}
+
+	writeRow(header)
+	record := make([]string, len(header))
+	for _, row := range rows {
+		for i := range record {
+			record[i] = formatCell(cell(row, i))
+		}
+		writeRow(record)
+	}
+	return buf.String()
+}
+
+var tsvEscaper = strings.NewReplacer("\t", " ", "\r\n", " ", "\n", " ", "\r", " ")
+
+// encodeCSV writes rows under a header line, quoting as RFC 4180 asks
+func encodeCSV(columns []string, rows [][]interface{}) string {
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	writer.Write(columns)
+	record := make([]string, len(columns))
+	for _, row := range rows {
+		for i := range record {
+			record[i] = formatCell(cell(row, i))
+		}
+		writer.Write(record)
+	}
+	writer.Flush()
+	return buf.String()
+}
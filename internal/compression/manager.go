@@ -1,312 +1,306 @@
 package compression
 
 import (
-	"bytes"
-	"compress/gzip"
-	"encoding/json"
 	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
 
-	"github.com/andybalholm/brotli"
-
+	"mcp-xlsm-server/internal/models"
 	"mcp-xlsm-server/internal/token"
 )
 
+// Shaping steps, applied in this order until the table fits its budget
+const (
+	StepDropNulls       = "drop_nulls"
+	StepCollapseRepeats = "collapse_repeats"
+	StepCompactEncoding = "compact_encoding"
+	StepSampleRows      = "sample_rows"
+	StepPruneColumns    = "prune_columns"
+)
+
+// Columns are pruned rather than sampling a page below this many rows
+const minShapedRows = 10
+
+// Manager fits tabular responses into a token budget with reductions a
+// model can still read, instead of compressing them into opaque bytes
 type Manager struct {
-	tokenCounter *token.Counter
+	counter *token.Counter
+	count   func(data interface{}) (int, error)
 }
 
 func NewManager(tokenCounter *token.Counter) *Manager {
 	return &Manager{
-		tokenCounter: tokenCounter,
+		counter: tokenCounter,
+		count:   tokenCounter.Count,
 	}
 }
 
-func (cm *Manager) OptimizeResponse(data interface{}, limit int) ([]byte, string, error) {
-	tokens, err := cm.tokenCounter.Count(data)
-	if err != nil {
-		return nil, "", fmt.Errorf("failed to count tokens: %w", err)
+// ForModel is a manager counting tokens the way model reads them, so a
+// budget taken from a session's context is spent in that model's tokens
+func (cm *Manager) ForModel(model string) *Manager {
+	if cm.counter == nil || model == "" {
+		return cm
 	}
+	return &Manager{
+		counter: cm.counter,
+		count: func(data interface{}) (int, error) {
+			return cm.counter.CountForModel(model, data)
+		},
+	}
+}
 
-	ratio := float64(tokens) / float64(limit)
-
-	var result []byte
-	var method string
+// Table is a page of rows under named columns. Once shaped, Rows may be
+// replaced by CSV, and columns holding a single value move to Constants.
+type Table struct {
+	Columns   []string
+	Rows      [][]interface{}
+	CSV       string
+	Constants map[string]interface{}
+}
 
-	switch {
-	case ratio < 0.5:
-		// No compression needed
-		result, err = json.Marshal(data)
-		if err != nil {
-			return nil, "", fmt.Errorf("failed to marshal data: %w", err)
-		}
-		method = "none"
+// Shape reduces table until it fits budget tokens and reports each step
+// taken. Rows are only ever cut from the end, so the caller can resume
+// after RowsReturned rows; NextCursor is left for the caller to fill.
+func (cm *Manager) Shape(table Table, budget int) (Table, models.ShapingReport, error) {
+	report := models.ShapingReport{
+		TokenBudget:  budget,
+		Steps:        []string{},
+		RowsReturned: len(table.Rows),
+		RowsTotal:    len(table.Rows),
+	}
 
-	case ratio < 0.8:
-		// Light compression with GZIP
-		result, err = cm.compressGzip(data)
-		if err != nil {
-			return nil, "", fmt.Errorf("failed to compress with gzip: %w", err)
-		}
-		method = "gzip"
+	tokens, err := cm.count(table.payload())
+	if err != nil {
+		return table, report, fmt.Errorf("failed to count tokens: %w", err)
+	}
+	report.Tokens = tokens
+	if budget <= 0 || tokens <= budget {
+		return table, report, nil
+	}
 
-	case ratio < 1.0:
-		// Medium compression with Brotli level 4
-		result, err = cm.compressBrotli(data, 4)
-		if err != nil {
-			return nil, "", fmt.Errorf("failed to compress with brotli-4: %w", err)
-		}
-		method = "brotli-4"
+	// Work on a copy; the rows may be shared with a cached result
+	shaped := Table{
+		Columns:   append([]string(nil), table.Columns...),
+		Rows:      make([][]interface{}, len(table.Rows)),
+		Constants: map[string]interface{}{},
+	}
+	for i, row := range table.Rows {
+		shaped.Rows[i] = append([]interface{}(nil), row...)
+	}
 
-	default:
-		// Aggressive compression + truncation
-		truncated := cm.truncateData(data, int(float64(limit)*0.7))
-		result, err = cm.compressBrotli(truncated, 11)
+	fits := func() (bool, error) {
+		tokens, err := cm.count(shaped.payload())
 		if err != nil {
-			return nil, "", fmt.Errorf("failed to compress with brotli-11: %w", err)
+			return false, fmt.Errorf("failed to count tokens: %w", err)
 		}
-		method = "brotli-11-truncated"
+		report.Tokens = tokens
+		return tokens <= budget, nil
 	}
 
-	return result, method, nil
-}
-
-func (cm *Manager) compressGzip(data interface{}) ([]byte, error) {
-	var buf bytes.Buffer
-	gzWriter := gzip.NewWriter(&buf)
-	
-	encoder := json.NewEncoder(gzWriter)
-	if err := encoder.Encode(data); err != nil {
-		gzWriter.Close()
-		return nil, err
+	// Columns with no value in any row
+	var empty []string
+	for col := len(shaped.Columns) - 1; col >= 0; col-- {
+		if columnValue(shaped.Rows, col, isEmpty) {
+			empty = append([]string{shaped.Columns[col]}, empty...)
+			shaped.removeColumn(col)
+		}
 	}
-	
-	if err := gzWriter.Close(); err != nil {
-		return nil, err
+	if len(empty) > 0 {
+		report.Steps = append(report.Steps, StepDropNulls)
+		report.Omitted = append(report.Omitted, fmt.Sprintf("%d empty columns: %s", len(empty), strings.Join(empty, ", ")))
+		if ok, err := fits(); ok || err != nil {
+			return shaped.finish(), report, err
+		}
 	}
-	
-	return buf.Bytes(), nil
-}
 
-func (cm *Manager) compressBrotli(data interface{}, level int) ([]byte, error) {
-	jsonData, err := json.Marshal(data)
-	if err != nil {
-		return nil, err
-	}
-	
-	var buf bytes.Buffer
-	writer := brotli.NewWriterLevel(&buf, level)
-	
-	if _, err := writer.Write(jsonData); err != nil {
-		writer.Close()
-		return nil, err
+	// Columns holding the same value in every row
+	var constant []string
+	if len(shaped.Rows) > 1 {
+		for col := len(shaped.Columns) - 1; col >= 0; col-- {
+			first := cell(shaped.Rows[0], col)
+			if columnValue(shaped.Rows, col, func(v interface{}) bool { return reflect.DeepEqual(v, first) }) {
+				constant = append([]string{shaped.Columns[col]}, constant...)
+				shaped.Constants[shaped.Columns[col]] = first
+				shaped.removeColumn(col)
+			}
+		}
 	}
-	
-	if err := writer.Close(); err != nil {
-		return nil, err
+	if len(constant) > 0 {
+		report.Steps = append(report.Steps, StepCollapseRepeats)
+		report.Omitted = append(report.Omitted, fmt.Sprintf("%d columns with one value in every row moved to constants: %s", len(constant), strings.Join(constant, ", ")))
+		if ok, err := fits(); ok || err != nil {
+			return shaped.finish(), report, err
+		}
 	}
-	
-	return buf.Bytes(), nil
-}
 
-func (cm *Manager) truncateData(data interface{}, targetTokens int) interface{} {
-	// Implement intelligent truncation based on data type
-	switch v := data.(type) {
-	case map[string]interface{}:
-		return cm.truncateMap(v, targetTokens)
-	case []interface{}:
-		return cm.truncateSlice(v, targetTokens)
-	case string:
-		return cm.truncateString(v, targetTokens)
-	default:
-		return data
+	// CSV drops the quotes, brackets and commas JSON spends per cell
+	report.Steps = append(report.Steps, StepCompactEncoding)
+	shaped.CSV = encodeCSV(shaped.Columns, shaped.Rows)
+	if ok, err := fits(); ok || err != nil {
+		return shaped.finish(), report, err
 	}
-}
 
-func (cm *Manager) truncateMap(data map[string]interface{}, targetTokens int) map[string]interface{} {
-	result := make(map[string]interface{})
-	currentTokens := 0
-	
-	// Priority order for keeping fields
-	priorityFields := []string{"metadata", "summary", "index", "pagination"}
-	
-	// Add priority fields first
-	for _, field := range priorityFields {
-		if value, exists := data[field]; exists {
-			fieldTokens, err := cm.tokenCounter.Count(value)
-			if err == nil && currentTokens+fieldTokens <= targetTokens {
-				result[field] = value
-				currentTokens += fieldTokens
-			}
-		}
+	allRows := shaped.Rows
+	floor := minShapedRows
+	if floor > len(allRows) {
+		floor = len(allRows)
 	}
-	
-	// Add remaining fields until token limit
-	for key, value := range data {
-		if _, exists := result[key]; exists {
-			continue // Already added
-		}
-		
-		fieldTokens, err := cm.tokenCounter.Count(value)
-		if err != nil {
-			continue
+
+	// The longest prefix of rows that fits, if at least floor rows do
+	sample := func() (bool, error) {
+		shaped.setRows(allRows[:floor])
+		if ok, err := fits(); !ok || err != nil {
+			return false, err
 		}
-		
-		if currentTokens+fieldTokens <= targetTokens {
-			result[key] = value
-			currentTokens += fieldTokens
-		} else {
-			// Try to truncate the value
-			truncatedValue := cm.truncateData(value, targetTokens-currentTokens)
-			truncatedTokens, err := cm.tokenCounter.Count(truncatedValue)
-			if err == nil && truncatedTokens > 0 {
-				result[key] = truncatedValue
-				currentTokens += truncatedTokens
+		low, high := floor, len(allRows)
+		for low < high {
+			mid := (low + high + 1) / 2
+			shaped.setRows(allRows[:mid])
+			ok, err := fits()
+			if err != nil {
+				return false, err
+			}
+			if ok {
+				low = mid
+			} else {
+				high = mid - 1
 			}
-			break
 		}
+		shaped.setRows(allRows[:low])
+		_, err := fits()
+		return true, err
 	}
-	
-	// Add truncation marker
-	result["_truncated"] = true
-	result["_original_size"] = len(data)
-	result["_included_fields"] = len(result) - 2
-	
-	return result
-}
 
-func (cm *Manager) truncateSlice(data []interface{}, targetTokens int) []interface{} {
-	var result []interface{}
-	currentTokens := 0
-	
-	for i, item := range data {
-		itemTokens, err := cm.tokenCounter.Count(item)
-		if err != nil {
-			continue
-		}
-		
-		if currentTokens+itemTokens <= targetTokens {
-			result = append(result, item)
-			currentTokens += itemTokens
-		} else {
-			// Try to truncate the item
-			truncatedItem := cm.truncateData(item, targetTokens-currentTokens)
-			truncatedTokens, err := cm.tokenCounter.Count(truncatedItem)
-			if err == nil && truncatedTokens > 0 {
-				result = append(result, truncatedItem)
-			}
-			
-			// Add summary of remaining items
-			if i < len(data)-1 {
-				summary := map[string]interface{}{
-					"_truncated_items": len(data) - i - 1,
-					"_total_items":     len(data),
+	if ok, err := sample(); err != nil {
+		return shaped.finish(), report, err
+	} else if !ok && len(shaped.Columns) > 1 {
+		// Drop the widest columns, never the first, which usually names
+		// the row, until floor rows fit
+		report.Steps = append(report.Steps, StepPruneColumns)
+		widths := columnWidths(allRows, len(shaped.Columns))
+		for len(shaped.Columns) > 1 {
+			widest := 1
+			for col := 2; col < len(widths); col++ {
+				if widths[col] > widths[widest] {
+					widest = col
 				}
-				result = append(result, summary)
 			}
-			break
+			report.DroppedColumns = append(report.DroppedColumns, shaped.Columns[widest])
+			widths = append(widths[:widest:widest], widths[widest+1:]...)
+			shaped.setRows(allRows)
+			shaped.removeColumn(widest)
+			allRows = shaped.Rows
+			shaped.setRows(allRows[:floor])
+			ok, err := fits()
+			if err != nil {
+				return shaped.finish(), report, err
+			}
+			if ok {
+				break
+			}
+		}
+		report.Omitted = append(report.Omitted, fmt.Sprintf("%d columns pruned: %s", len(report.DroppedColumns), strings.Join(report.DroppedColumns, ", ")))
+		if _, err := sample(); err != nil {
+			return shaped.finish(), report, err
 		}
 	}
-	
-	return result
-}
 
-func (cm *Manager) truncateString(data string, targetTokens int) string {
-	tokens := cm.tokenCounter.CountString(data)
-	
-	if tokens <= targetTokens {
-		return data
+	report.RowsReturned = len(shaped.Rows)
+	if report.RowsReturned < report.RowsTotal {
+		report.Steps = append(report.Steps, StepSampleRows)
+		report.Omitted = append(report.Omitted, fmt.Sprintf("rows %d to %d of %d", report.RowsReturned+1, report.RowsTotal, report.RowsTotal))
 	}
-	
-	// Rough estimation: average 4 characters per token
-	targetLength := targetTokens * 4
-	if targetLength >= len(data) {
-		return data
+	return shaped.finish(), report, nil
+}
+
+// payload is what the table costs once serialized in a response
+func (t Table) payload() map[string]interface{} {
+	payload := map[string]interface{}{"columns": t.Columns}
+	if t.CSV != "" {
+		payload["csv"] = t.CSV
+	} else {
+		payload["rows"] = t.Rows
 	}
-	
-	// Try to cut at word boundaries
-	truncated := data[:targetLength]
-	if lastSpace := bytes.LastIndexByte([]byte(truncated), ' '); lastSpace > targetLength/2 {
-		truncated = truncated[:lastSpace]
+	if len(t.Constants) > 0 {
+		payload["constants"] = t.Constants
 	}
-	
-	return truncated + "... [truncated]"
+	return payload
 }
 
-// Decompression methods
-func (cm *Manager) Decompress(data []byte, method string) ([]byte, error) {
-	switch method {
-	case "none":
-		return data, nil
-	case "gzip":
-		return cm.decompressGzip(data)
-	case "brotli-4", "brotli-11", "brotli-11-truncated":
-		return cm.decompressBrotli(data)
-	default:
-		return nil, fmt.Errorf("unknown compression method: %s", method)
+func (t Table) finish() Table {
+	if len(t.Constants) == 0 {
+		t.Constants = nil
 	}
+	if t.CSV != "" {
+		t.Rows = nil
+	}
+	return t
 }
 
-func (cm *Manager) decompressGzip(data []byte) ([]byte, error) {
-	reader, err := gzip.NewReader(bytes.NewReader(data))
-	if err != nil {
-		return nil, err
+func (t *Table) removeColumn(col int) {
+	t.Columns = append(t.Columns[:col:col], t.Columns[col+1:]...)
+	for i, row := range t.Rows {
+		if col < len(row) {
+			t.Rows[i] = append(row[:col:col], row[col+1:]...)
+		}
 	}
-	defer reader.Close()
-	
-	var buf bytes.Buffer
-	if _, err := buf.ReadFrom(reader); err != nil {
-		return nil, err
+	if t.CSV != "" {
+		t.CSV = encodeCSV(t.Columns, t.Rows)
 	}
-	
-	return buf.Bytes(), nil
 }
 
-func (cm *Manager) decompressBrotli(data []byte) ([]byte, error) {
-	reader := brotli.NewReader(bytes.NewReader(data))
-	
-	var buf bytes.Buffer
-	if _, err := buf.ReadFrom(reader); err != nil {
-		return nil, err
+func (t *Table) setRows(rows [][]interface{}) {
+	t.Rows = rows
+	if t.CSV != "" {
+		t.CSV = encodeCSV(t.Columns, rows)
 	}
-	
-	return buf.Bytes(), nil
 }
 
-// Estimation methods
-func (cm *Manager) EstimateCompressionRatio(data interface{}, method string) (float64, error) {
-	_, err := cm.tokenCounter.Count(data)
-	if err != nil {
-		return 0, err
+func columnValue(rows [][]interface{}, col int, match func(interface{}) bool) bool {
+	for _, row := range rows {
+		if !match(cell(row, col)) {
+			return false
+		}
 	}
-	
-	switch method {
-	case "gzip":
-		return 0.7, nil
-	case "brotli-4":
-		return 0.6, nil
-	case "brotli-11":
-		return 0.5, nil
-	default:
-		return 1.0, nil
+	return true
+}
+
+func cell(row []interface{}, col int) interface{} {
+	if col < len(row) {
+		return row[col]
 	}
+	return nil
 }
 
-func (cm *Manager) SuggestCompressionMethod(data interface{}, tokenLimit int) (string, error) {
-	tokens, err := cm.tokenCounter.Count(data)
-	if err != nil {
-		return "", err
+func isEmpty(value interface{}) bool {
+	return value == nil || value == ""
+}
+
+// columnWidths gives the characters each column takes across rows
+func columnWidths(rows [][]interface{}, columns int) []int {
+	widths := make([]int, columns)
+	for _, row := range rows {
+		for col, value := range row {
+			if col < columns {
+				widths[col] += len(formatCell(value))
+			}
+		}
 	}
-	
-	ratio := float64(tokens) / float64(tokenLimit)
-	
-	switch {
-	case ratio < 0.5:
-		return "none", nil
-	case ratio < 0.8:
-		return "gzip", nil
-	case ratio < 1.0:
-		return "brotli-4", nil
+	return widths
+}
+
+func formatCell(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
 	default:
-		return "brotli-11-truncated", nil
+		return fmt.Sprint(v)
 	}
-}
\ No newline at end of file
+}
@@ -0,0 +1,151 @@
+package compression
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"mcp-xlsm-server/internal/token"
+)
+
+// byteCounter counts one token per byte of JSON, so budgets in the tests
+// below are easy to reason about
+func byteCounter() *Manager {
+	return &Manager{count: func(data interface{}) (int, error) {
+		b, err := json.Marshal(data)
+		return len(b), err
+	}}
+}
+
+func TestShape(t *testing.T) {
+	rows := make([][]interface{}, 40)
+	for i := range rows {
+		rows[i] = []interface{}{float64(i), "2025", nil, "une description assez longue pour peser"}
+	}
+	table := Table{Columns: []string{"Ligne", "Exercice", "Vide", "Libelle"}, Rows: rows}
+
+	full, _ := byteCounter().count(table.payload())
+
+	tests := []struct {
+		name      string
+		budget    int
+		steps     []string
+		columns   []string
+		constants map[string]interface{}
+		csv       bool
+		rows      int
+	}{
+		{name: "no budget", budget: 0, steps: []string{}, columns: table.Columns, rows: 40},
+		{name: "fits", budget: full, steps: []string{}, columns: table.Columns, rows: 40},
+		{
+			name:    "drop nulls",
+			budget:  full - 40*5,
+			steps:   []string{StepDropNulls},
+			columns: []string{"Ligne", "Exercice", "Libelle"},
+			rows:    40,
+		},
+		{
+			name:      "collapse repeats then csv",
+			budget:    300,
+			steps:     []string{StepDropNulls, StepCollapseRepeats, StepCompactEncoding},
+			columns:   []string{"Ligne"},
+			constants: map[string]interface{}{"Exercice": "2025", "Libelle": "une description assez longue pour peser"},
+			csv:       true,
+			rows:      40,
+		},
+		{
+			name:      "sample rows",
+			budget:    200,
+			steps:     []string{StepDropNulls, StepCollapseRepeats, StepCompactEncoding, StepSampleRows},
+			columns:   []string{"Ligne"},
+			constants: map[string]interface{}{"Exercice": "2025", "Libelle": "une description assez longue pour peser"},
+			csv:       true,
+			rows:      22,
+		},
+		{
+			// A single column is never pruned; the floor of rows is kept
+			name:      "floor",
+			budget:    100,
+			steps:     []string{StepDropNulls, StepCollapseRepeats, StepCompactEncoding, StepSampleRows},
+			columns:   []string{"Ligne"},
+			constants: map[string]interface{}{"Exercice": "2025", "Libelle": "une description assez longue pour peser"},
+			csv:       true,
+			rows:      minShapedRows,
+		},
+	}
+
+	for _, tt := range tests {
+		shaped, report, err := byteCounter().Shape(table, tt.budget)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if !reflect.DeepEqual(report.Steps, tt.steps) {
+			t.Errorf("%s: steps = %v, want %v", tt.name, report.Steps, tt.steps)
+		}
+		if !reflect.DeepEqual(shaped.Columns, tt.columns) {
+			t.Errorf("%s: columns = %v, want %v", tt.name, shaped.Columns, tt.columns)
+		}
+		if !reflect.DeepEqual(shaped.Constants, tt.constants) {
+			t.Errorf("%s: constants = %v, want %v", tt.name, shaped.Constants, tt.constants)
+		}
+		if (shaped.CSV != "") != tt.csv {
+			t.Errorf("%s: csv = %q, want csv %v", tt.name, shaped.CSV, tt.csv)
+		}
+		if report.RowsReturned != tt.rows || report.RowsTotal != 40 {
+			t.Errorf("%s: rows %d of %d, want %d of 40", tt.name, report.RowsReturned, report.RowsTotal, tt.rows)
+		}
+		if tt.rows > minShapedRows && report.Tokens > tt.budget && tt.budget > 0 {
+			t.Errorf("%s: %d tokens over a budget of %d", tt.name, report.Tokens, tt.budget)
+		}
+	}
+
+	// The caller's rows are left as they were
+	if len(rows[0]) != 4 || rows[0][2] != nil {
+		t.Errorf("Shape modified the input rows: %v", rows[0])
+	}
+}
+
+func TestShapePrunesColumns(t *testing.T) {
+	rows := make([][]interface{}, 20)
+	for i := range rows {
+		rows[i] = []interface{}{float64(i), float64(i * 2), "texte long qui ne tient pas dans le budget " + string(rune('a'+i))}
+	}
+	table := Table{Columns: []string{"Ligne", "Double", "Texte"}, Rows: rows}
+
+	shaped, report, err := byteCounter().Shape(table, 150)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(report.DroppedColumns, []string{"Texte"}) {
+		t.Errorf("dropped %v, want the widest column", report.DroppedColumns)
+	}
+	if !reflect.DeepEqual(shaped.Columns, []string{"Ligne", "Double"}) {
+		t.Errorf("columns = %v", shaped.Columns)
+	}
+	if report.RowsReturned < minShapedRows {
+		t.Errorf("returned %d rows, want at least %d", report.RowsReturned, minShapedRows)
+	}
+}
+
+func TestForModelCountsForThatModel(t *testing.T) {
+	counter := token.NewCounter()
+	manager := NewManager(counter)
+
+	data := map[string]interface{}{"rows": [][]interface{}{{"Compte", 512000.0, "Banque"}}}
+	for _, model := range []string{"", token.DefaultModel(), "gpt-4o"} {
+		want, err := counter.CountForModel(model, data)
+		if model == "" {
+			want, err = counter.Count(data)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := manager.ForModel(model).count(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("ForModel(%q) counted %d tokens, want %d", model, got, want)
+		}
+	}
+}
@@ -0,0 +1,578 @@
+package diff
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+
+	"mcp-xlsm-server/internal/models"
+)
+
+// Sheets removed and added with at least this share of identical rows are
+// reported as a rename.
+const renameSimilarity = 0.8
+
+// Past this many cells in the LCS table, rows are aligned by position.
+const maxAlignCells = 4_000_000
+
+var (
+	// A1 reference with optional $ anchors; boundaries are checked by hand
+	// so that function names such as LOG10( are left alone
+	cellRefPattern = regexp.MustCompile(`(\$?)([A-Z]{1,3})(\$?)([0-9]+)`)
+	// String literals and quoted sheet names
+	quotedPattern = regexp.MustCompile(`"(?:[^"]|"")*"|'(?:[^']|'')*'`)
+)
+
+type Options struct {
+	// IncludeRecalculated reports cells whose formula is unchanged but
+	// whose cached value moved; they are only counted otherwise.
+	IncludeRecalculated bool
+}
+
+type Result struct {
+	Summary models.DiffSummary
+	Sheets  []models.SheetDiff
+	Modules []models.VBAModuleDiff
+	Changes []models.Delta
+}
+
+// Compare lists what changed from base to target: sheets added, removed
+// or renamed, rows inserted or deleted, cell values and formulas, and VBA
+// modules.
+func Compare(base, target *Snapshot, opts Options) *Result {
+	result := &Result{
+		Sheets:  []models.SheetDiff{},
+		Modules: []models.VBAModuleDiff{},
+		Changes: []models.Delta{},
+	}
+
+	baseByName := make(map[string]int)
+	for i, sheet := range base.Sheets {
+		baseByName[sheet.Name] = i
+	}
+
+	pairs := make(map[int]int)
+	matchedBase := make(map[int]bool)
+	var addedTargets []int
+	for ti, sheet := range target.Sheets {
+		if bi, ok := baseByName[sheet.Name]; ok {
+			pairs[ti] = bi
+			matchedBase[bi] = true
+		} else {
+			addedTargets = append(addedTargets, ti)
+		}
+	}
+
+	// Match the remaining sheets by content to detect renames
+	renamed := make(map[int]bool)
+	for _, ti := range addedTargets {
+		best, bestScore := -1, 0.0
+		for bi := range base.Sheets {
+			if matchedBase[bi] {
+				continue
+			}
+			if score := sheetSimilarity(&base.Sheets[bi], &target.Sheets[ti]); score > bestScore {
+				best, bestScore = bi, score
+			}
+		}
+		if best >= 0 && bestScore >= renameSimilarity {
+			pairs[ti] = best
+			matchedBase[best] = true
+			renamed[ti] = true
+		}
+	}
+
+	for ti := range target.Sheets {
+		targetSheet := &target.Sheets[ti]
+		bi, paired := pairs[ti]
+		if !paired {
+			cells := countCells(targetSheet)
+			result.Summary.SheetsAdded++
+			result.Sheets = append(result.Sheets, models.SheetDiff{Sheet: targetSheet.Name, Status: "added"})
+			result.Changes = append(result.Changes, models.Delta{
+				Type:          models.SheetAdd,
+				SheetID:       targetSheet.Name,
+				AffectedCells: cells,
+			})
+			continue
+		}
+
+		baseSheet := &base.Sheets[bi]
+		if renamed[ti] {
+			result.Changes = append(result.Changes, models.Delta{
+				Type:     models.SheetRename,
+				SheetID:  targetSheet.Name,
+				OldValue: baseSheet.Name,
+				NewValue: targetSheet.Name,
+			})
+		}
+		sheetDiff := compareSheet(baseSheet, targetSheet, result, opts)
+		if renamed[ti] {
+			sheetDiff.Status = "renamed"
+			sheetDiff.OldName = baseSheet.Name
+			result.Summary.SheetsRenamed++
+		} else if sheetDiff.Status == "modified" {
+			result.Summary.SheetsModified++
+		}
+		if sheetDiff.Status != "unchanged" {
+			result.Sheets = append(result.Sheets, sheetDiff)
+		}
+	}
+
+	for bi := range base.Sheets {
+		if matchedBase[bi] {
+			continue
+		}
+		baseSheet := &base.Sheets[bi]
+		result.Summary.SheetsRemoved++
+		result.Sheets = append(result.Sheets, models.SheetDiff{Sheet: baseSheet.Name, Status: "removed"})
+		result.Changes = append(result.Changes, models.Delta{
+			Type:          models.SheetRemove,
+			SheetID:       baseSheet.Name,
+			AffectedCells: countCells(baseSheet),
+		})
+	}
+
+	result.Modules = compareModules(base.Modules, target.Modules)
+	result.Summary.VBAModulesChanged = len(result.Modules)
+
+	return result
+}
+
+func compareSheet(base, target *SheetSnapshot, result *Result, opts Options) models.SheetDiff {
+	sheetDiff := models.SheetDiff{Sheet: target.Name, Status: "unchanged"}
+	recalculated := 0
+
+	baseKeys := rowKeys(base.Rows)
+	targetKeys := rowKeys(target.Rows)
+
+	var insertRun, deleteRun []int
+	flushRuns := func() {
+		if len(insertRun) > 0 {
+			result.Changes = append(result.Changes, rowRunDelta(models.RowInsert, target.Name, insertRun))
+			sheetDiff.RowsInserted += len(insertRun)
+			insertRun = nil
+		}
+		if len(deleteRun) > 0 {
+			result.Changes = append(result.Changes, rowRunDelta(models.RowDelete, target.Name, deleteRun))
+			sheetDiff.RowsDeleted += len(deleteRun)
+			deleteRun = nil
+		}
+	}
+
+	for _, p := range alignRows(baseKeys, targetKeys) {
+		switch {
+		case p.base < 0:
+			if len(insertRun) > 0 && insertRun[len(insertRun)-1] != p.target-1 {
+				flushRuns()
+			}
+			insertRun = append(insertRun, p.target)
+			continue
+		case p.target < 0:
+			if len(deleteRun) > 0 && deleteRun[len(deleteRun)-1] != p.base-1 {
+				flushRuns()
+			}
+			deleteRun = append(deleteRun, p.base)
+			continue
+		}
+
+		flushRuns()
+		if baseKeys[p.base] == targetKeys[p.target] {
+			continue
+		}
+
+		baseRow, targetRow := base.Rows[p.base], target.Rows[p.target]
+		for col := 0; col < len(baseRow) || col < len(targetRow); col++ {
+			var before, after Cell
+			if col < len(baseRow) {
+				before = baseRow[col]
+			}
+			if col < len(targetRow) {
+				after = targetRow[col]
+			}
+			sameFormula := relativeFormula(before.Formula, col+1, p.base+1) == relativeFormula(after.Formula, col+1, p.target+1)
+			if sameFormula && before.Value == after.Value {
+				continue
+			}
+
+			cellRef, _ := excelize.CoordinatesToCellName(col+1, p.target+1)
+			location := fmt.Sprintf("%s!%s", target.Name, cellRef)
+
+			switch {
+			case !sameFormula:
+				sheetDiff.FormulasChanged++
+				result.Changes = append(result.Changes, models.Delta{
+					Type:          models.FormulaChange,
+					SheetID:       target.Name,
+					Location:      location,
+					OldValue:      cellContent(before),
+					NewValue:      cellContent(after),
+					AffectedCells: 1,
+				})
+			case after.Formula != "":
+				recalculated++
+				if opts.IncludeRecalculated {
+					result.Changes = append(result.Changes, models.Delta{
+						Type:          models.CellUpdate,
+						SheetID:       target.Name,
+						Location:      location,
+						OldValue:      before.Value,
+						NewValue:      after.Value,
+						AffectedCells: 1,
+					})
+				}
+			default:
+				sheetDiff.CellsChanged++
+				result.Changes = append(result.Changes, models.Delta{
+					Type:          models.CellUpdate,
+					SheetID:       target.Name,
+					Location:      location,
+					OldValue:      before.Value,
+					NewValue:      after.Value,
+					AffectedCells: 1,
+				})
+			}
+		}
+	}
+	flushRuns()
+
+	result.Summary.RowsInserted += sheetDiff.RowsInserted
+	result.Summary.RowsDeleted += sheetDiff.RowsDeleted
+	result.Summary.CellsChanged += sheetDiff.CellsChanged
+	result.Summary.FormulasChanged += sheetDiff.FormulasChanged
+	result.Summary.RecalculatedCells += recalculated
+
+	if sheetDiff.RowsInserted+sheetDiff.RowsDeleted+sheetDiff.CellsChanged+sheetDiff.FormulasChanged+recalculated > 0 {
+		sheetDiff.Status = "modified"
+	}
+	return sheetDiff
+}
+
+// rowRunDelta describes consecutive inserted (target numbering) or deleted
+// (base numbering) rows as one delta, e.g. "Sheet!5:7".
+func rowRunDelta(deltaType models.DeltaType, sheet string, rows []int) models.Delta {
+	return models.Delta{
+		Type:          deltaType,
+		SheetID:       sheet,
+		Location:      fmt.Sprintf("%s!%d:%d", sheet, rows[0]+1, rows[len(rows)-1]+1),
+		AffectedCells: len(rows),
+	}
+}
+
+func cellContent(cell Cell) string {
+	if cell.Formula != "" {
+		return "=" + cell.Formula
+	}
+	return cell.Value
+}
+
+type rowPair struct {
+	base   int
+	target int
+}
+
+// alignRows pairs base and target rows so that inserted or deleted rows
+// show up as such instead of shifting every row below them. Identical rows
+// are anchored with a longest common subsequence; between anchors, rows
+// are paired in order as modified and the surplus is inserted or deleted.
+func alignRows(base, target []string) []rowPair {
+	var pairs []rowPair
+
+	// Common prefix and suffix need no alignment
+	prefix := 0
+	for prefix < len(base) && prefix < len(target) && base[prefix] == target[prefix] {
+		pairs = append(pairs, rowPair{prefix, prefix})
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(base)-prefix && suffix < len(target)-prefix &&
+		base[len(base)-1-suffix] == target[len(target)-1-suffix] {
+		suffix++
+	}
+
+	midBase := base[prefix : len(base)-suffix]
+	midTarget := target[prefix : len(target)-suffix]
+
+	var ops []rowPair
+	if len(midBase)*len(midTarget) <= maxAlignCells {
+		ops = lcsPairs(midBase, midTarget)
+	} else {
+		for i := 0; i < len(midBase) || i < len(midTarget); i++ {
+			p := rowPair{-1, -1}
+			if i < len(midBase) {
+				p.base = i
+			}
+			if i < len(midTarget) {
+				p.target = i
+			}
+			ops = append(ops, p)
+		}
+	}
+
+	for _, p := range ops {
+		if p.base >= 0 {
+			p.base += prefix
+		}
+		if p.target >= 0 {
+			p.target += prefix
+		}
+		pairs = append(pairs, p)
+	}
+
+	for i := suffix; i > 0; i-- {
+		pairs = append(pairs, rowPair{len(base) - i, len(target) - i})
+	}
+
+	return pairs
+}
+
+func lcsPairs(base, target []string) []rowPair {
+	n, m := len(base), len(target)
+	width := m + 1
+	// lengths[i*width+j] is the LCS length of base[i:] and target[j:]
+	lengths := make([]int32, (n+1)*width)
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if base[i] == target[j] {
+				lengths[i*width+j] = lengths[(i+1)*width+j+1] + 1
+			} else if lengths[(i+1)*width+j] >= lengths[i*width+j+1] {
+				lengths[i*width+j] = lengths[(i+1)*width+j]
+			} else {
+				lengths[i*width+j] = lengths[i*width+j+1]
+			}
+		}
+	}
+
+	var pairs []rowPair
+	var deleted, inserted []int
+	flushGap := func() {
+		paired := len(deleted)
+		if len(inserted) < paired {
+			paired = len(inserted)
+		}
+		for k := 0; k < paired; k++ {
+			pairs = append(pairs, rowPair{deleted[k], inserted[k]})
+		}
+		for _, b := range deleted[paired:] {
+			pairs = append(pairs, rowPair{b, -1})
+		}
+		for _, t := range inserted[paired:] {
+			pairs = append(pairs, rowPair{-1, t})
+		}
+		deleted, inserted = nil, nil
+	}
+
+	i, j := 0, 0
+	for i < n || j < m {
+		switch {
+		case i < n && j < m && base[i] == target[j]:
+			flushGap()
+			pairs = append(pairs, rowPair{i, j})
+			i++
+			j++
+		case j >= m || (i < n && lengths[(i+1)*width+j] >= lengths[i*width+j+1]):
+			deleted = append(deleted, i)
+			i++
+		default:
+			inserted = append(inserted, j)
+			j++
+		}
+	}
+	flushGap()
+
+	return pairs
+}
+
+// rowKeys identifies rows by content. Formulas are keyed in relative
+// R1C1 form, so a row moved by an insertion above it, whose references
+// Excel shifted along, keeps its key.
+func rowKeys(rows [][]Cell) []string {
+	keys := make([]string, len(rows))
+	var sb strings.Builder
+	for i, row := range rows {
+		sb.Reset()
+		for col, cell := range row {
+			sb.WriteString(cell.Value)
+			sb.WriteByte(0x1f)
+			sb.WriteString(relativeFormula(cell.Formula, col+1, i+1))
+			sb.WriteByte(0x1e)
+		}
+		keys[i] = sb.String()
+	}
+	return keys
+}
+
+// relativeFormula rewrites the A1 references of a formula written in the
+// cell at col, row as R1C1 offsets: =B3*2 in C3 and =B4*2 in C4 both
+// become =RC[-1]*2. Anchored parts keep their absolute number. String
+// literals and quoted sheet names are left as they are.
+func relativeFormula(formula string, col, row int) string {
+	if formula == "" {
+		return ""
+	}
+
+	var sb strings.Builder
+	last := 0
+	for _, lit := range quotedPattern.FindAllStringIndex(formula, -1) {
+		sb.WriteString(relativeRefs(formula[last:lit[0]], col, row))
+		sb.WriteString(formula[lit[0]:lit[1]])
+		last = lit[1]
+	}
+	sb.WriteString(relativeRefs(formula[last:], col, row))
+	return sb.String()
+}
+
+func relativeRefs(text string, col, row int) string {
+	var sb strings.Builder
+	last := 0
+	for _, m := range cellRefPattern.FindAllStringSubmatchIndex(text, -1) {
+		start, end := m[0], m[1]
+		// Part of a longer name, a function call, a sheet name or a number
+		if start > 0 && isNameByte(text[start-1]) {
+			continue
+		}
+		if end < len(text) && (isNameByte(text[end]) || text[end] == '(' || text[end] == '!') {
+			continue
+		}
+		refCol, err := excelize.ColumnNameToNumber(text[m[4]:m[5]])
+		if err != nil {
+			continue
+		}
+		refRow, err := strconv.Atoi(text[m[8]:m[9]])
+		if err != nil {
+			continue
+		}
+
+		sb.WriteString(text[last:start])
+		sb.WriteByte('R')
+		sb.WriteString(r1c1Part(refRow, row, m[7] > m[6]))
+		sb.WriteByte('C')
+		sb.WriteString(r1c1Part(refCol, col, m[3] > m[2]))
+		last = end
+	}
+	sb.WriteString(text[last:])
+	return sb.String()
+}
+
+// r1c1Part writes one coordinate: 5 when anchored, [-2] as an offset,
+// nothing for the same row or column.
+func r1c1Part(ref, origin int, anchored bool) string {
+	switch {
+	case anchored:
+		return strconv.Itoa(ref)
+	case ref == origin:
+		return ""
+	default:
+		return "[" + strconv.Itoa(ref-origin) + "]"
+	}
+}
+
+func isNameByte(c byte) bool {
+	return c == '_' || c == '.' || c == '\\' ||
+		(c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9')
+}
+
+// sheetSimilarity is the share of rows the two sheets have in common.
+func sheetSimilarity(a, b *SheetSnapshot) float64 {
+	if len(a.Rows) == 0 && len(b.Rows) == 0 {
+		return 1
+	}
+
+	counts := make(map[string]int)
+	for _, key := range rowKeys(a.Rows) {
+		counts[key]++
+	}
+	common := 0
+	for _, key := range rowKeys(b.Rows) {
+		if counts[key] > 0 {
+			counts[key]--
+			common++
+		}
+	}
+
+	longest := len(a.Rows)
+	if len(b.Rows) > longest {
+		longest = len(b.Rows)
+	}
+	return float64(common) / float64(longest)
+}
+
+func countCells(sheet *SheetSnapshot) int {
+	count := 0
+	for _, row := range sheet.Rows {
+		for _, cell := range row {
+			if cell.Value != "" || cell.Formula != "" {
+				count++
+			}
+		}
+	}
+	return count
+}
+
+// compareModules counts added and removed source lines per module; lines
+// that only moved are not counted.
+func compareModules(base, target map[string]string) []models.VBAModuleDiff {
+	names := make(map[string]bool)
+	for name := range base {
+		names[name] = true
+	}
+	for name := range target {
+		names[name] = true
+	}
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+
+	var diffs []models.VBAModuleDiff
+	for _, name := range sorted {
+		before, inBase := base[name]
+		after, inTarget := target[name]
+
+		switch {
+		case !inBase:
+			diffs = append(diffs, models.VBAModuleDiff{Module: name, Status: "added", LinesAdded: len(sourceLines(after))})
+		case !inTarget:
+			diffs = append(diffs, models.VBAModuleDiff{Module: name, Status: "removed", LinesRemoved: len(sourceLines(before))})
+		case before != after:
+			added, removed := lineChanges(sourceLines(before), sourceLines(after))
+			diffs = append(diffs, models.VBAModuleDiff{Module: name, Status: "modified", LinesAdded: added, LinesRemoved: removed})
+		}
+	}
+
+	if diffs == nil {
+		diffs = []models.VBAModuleDiff{}
+	}
+	return diffs
+}
+
+func sourceLines(source string) []string {
+	source = strings.TrimRight(source, "\n")
+	if source == "" {
+		return nil
+	}
+	return strings.Split(source, "\n")
+}
+
+func lineChanges(before, after []string) (added, removed int) {
+	counts := make(map[string]int)
+	for _, line := range before {
+		counts[line]++
+	}
+	for _, line := range after {
+		if counts[line] > 0 {
+			counts[line]--
+		} else {
+			added++
+		}
+	}
+	for _, remaining := range counts {
+		removed += remaining
+	}
+	return added, removed
+}
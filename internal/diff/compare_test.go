@@ -0,0 +1,270 @@
+package diff
+
+import (
+	"reflect"
+	"testing"
+
+	"mcp-xlsm-server/internal/models"
+)
+
+// sheet builds a snapshot sheet from cell contents, where a leading "="
+// marks a formula whose cached value follows a "|", as in "=A1*2|42".
+func sheet(name string, rows ...[]string) SheetSnapshot {
+	s := SheetSnapshot{Name: name}
+	for _, row := range rows {
+		cells := make([]Cell, len(row))
+		for i, content := range row {
+			if len(content) > 0 && content[0] == '=' {
+				for j := 1; j < len(content); j++ {
+					if content[j] == '|' {
+						cells[i] = Cell{Formula: content[1:j], Value: content[j+1:]}
+						break
+					}
+				}
+				continue
+			}
+			cells[i] = Cell{Value: content}
+		}
+		s.Rows = append(s.Rows, cells)
+	}
+	return s
+}
+
+func TestCompare(t *testing.T) {
+	ventes := sheet("Ventes",
+		[]string{"Rayon", "Montant"},
+		[]string{"Frais", "120"},
+		[]string{"Epicerie", "80"},
+		[]string{"Bazar", "15"},
+		[]string{"Total", "=SUM(B2:B4)|215"},
+	)
+
+	tests := []struct {
+		name    string
+		base    []SheetSnapshot
+		target  []SheetSnapshot
+		opts    Options
+		summary models.DiffSummary
+		sheets  []models.SheetDiff
+		changes []models.Delta
+	}{
+		{
+			name:    "unchanged",
+			base:    []SheetSnapshot{ventes},
+			target:  []SheetSnapshot{ventes},
+			sheets:  []models.SheetDiff{},
+			changes: []models.Delta{},
+		},
+		{
+			name: "cell and formula changes",
+			base: []SheetSnapshot{ventes},
+			target: []SheetSnapshot{sheet("Ventes",
+				[]string{"Rayon", "Montant"},
+				[]string{"Frais", "125"},
+				[]string{"Epicerie", "80"},
+				[]string{"Bazar", "15"},
+				[]string{"Total", "=SUM(B2:B3)|205"},
+			)},
+			summary: models.DiffSummary{SheetsModified: 1, CellsChanged: 1, FormulasChanged: 1},
+			sheets:  []models.SheetDiff{{Sheet: "Ventes", Status: "modified", CellsChanged: 1, FormulasChanged: 1}},
+			changes: []models.Delta{
+				{Type: models.CellUpdate, SheetID: "Ventes", Location: "Ventes!B2", OldValue: "120", NewValue: "125", AffectedCells: 1},
+				{Type: models.FormulaChange, SheetID: "Ventes", Location: "Ventes!B5", OldValue: "=SUM(B2:B4)", NewValue: "=SUM(B2:B3)", AffectedCells: 1},
+			},
+		},
+		{
+			name: "inserted and deleted rows keep the rest aligned",
+			base: []SheetSnapshot{ventes},
+			target: []SheetSnapshot{sheet("Ventes",
+				[]string{"Rayon", "Montant"},
+				[]string{"Frais", "120"},
+				[]string{"Textile", "40"},
+				[]string{"Jardin", "10"},
+				[]string{"Bazar", "15"},
+				[]string{"Total", "=SUM(B2:B5)|185"},
+			)},
+			summary: models.DiffSummary{SheetsModified: 1, CellsChanged: 2, FormulasChanged: 1, RowsInserted: 1},
+			sheets:  []models.SheetDiff{{Sheet: "Ventes", Status: "modified", RowsInserted: 1, CellsChanged: 2, FormulasChanged: 1}},
+			changes: []models.Delta{
+				{Type: models.CellUpdate, SheetID: "Ventes", Location: "Ventes!A3", OldValue: "Epicerie", NewValue: "Textile", AffectedCells: 1},
+				{Type: models.CellUpdate, SheetID: "Ventes", Location: "Ventes!B3", OldValue: "80", NewValue: "40", AffectedCells: 1},
+				{Type: models.RowInsert, SheetID: "Ventes", Location: "Ventes!4:4", AffectedCells: 1},
+				{Type: models.FormulaChange, SheetID: "Ventes", Location: "Ventes!B6", OldValue: "=SUM(B2:B4)", NewValue: "=SUM(B2:B5)", AffectedCells: 1},
+			},
+		},
+		{
+			name: "rows inserted above formulas",
+			base: []SheetSnapshot{sheet("S",
+				[]string{"Article", "Qte", "Double"},
+				[]string{"a", "1", "=B2*2|2"},
+				[]string{"b", "2", "=B3*2|4"},
+				[]string{"c", "3", "=B4*2|6"},
+			)},
+			target: []SheetSnapshot{sheet("S",
+				[]string{"Article", "Qte", "Double"},
+				[]string{"z", "5", "=B2*2|10"},
+				[]string{"a", "1", "=B3*2|2"},
+				[]string{"b", "2", "=B4*2|4"},
+				[]string{"c", "3", "=B5*2|6"},
+			)},
+			summary: models.DiffSummary{SheetsModified: 1, RowsInserted: 1},
+			sheets:  []models.SheetDiff{{Sheet: "S", Status: "modified", RowsInserted: 1}},
+			changes: []models.Delta{
+				{Type: models.RowInsert, SheetID: "S", Location: "S!2:2", AffectedCells: 1},
+			},
+		},
+		{
+			name: "deleted run",
+			base: []SheetSnapshot{sheet("Ventes",
+				[]string{"Rayon", "Montant"},
+				[]string{"Frais", "120"},
+				[]string{"Epicerie", "80"},
+				[]string{"Bazar", "15"},
+				[]string{"Total", "215"},
+			)},
+			target: []SheetSnapshot{sheet("Ventes",
+				[]string{"Rayon", "Montant"},
+				[]string{"Total", "215"},
+			)},
+			summary: models.DiffSummary{SheetsModified: 1, RowsDeleted: 3},
+			sheets:  []models.SheetDiff{{Sheet: "Ventes", Status: "modified", RowsDeleted: 3}},
+			changes: []models.Delta{
+				{Type: models.RowDelete, SheetID: "Ventes", Location: "Ventes!2:4", AffectedCells: 3},
+			},
+		},
+		{
+			name: "recalculated values are only counted",
+			base: []SheetSnapshot{ventes},
+			target: []SheetSnapshot{sheet("Ventes",
+				[]string{"Rayon", "Montant"},
+				[]string{"Frais", "120"},
+				[]string{"Epicerie", "80"},
+				[]string{"Bazar", "15"},
+				[]string{"Total", "=SUM(B2:B4)|216"},
+			)},
+			summary: models.DiffSummary{SheetsModified: 1, RecalculatedCells: 1},
+			sheets:  []models.SheetDiff{{Sheet: "Ventes", Status: "modified"}},
+			changes: []models.Delta{},
+		},
+		{
+			name: "recalculated values reported on request",
+			base: []SheetSnapshot{ventes},
+			target: []SheetSnapshot{sheet("Ventes",
+				[]string{"Rayon", "Montant"},
+				[]string{"Frais", "120"},
+				[]string{"Epicerie", "80"},
+				[]string{"Bazar", "15"},
+				[]string{"Total", "=SUM(B2:B4)|216"},
+			)},
+			opts:    Options{IncludeRecalculated: true},
+			summary: models.DiffSummary{SheetsModified: 1, RecalculatedCells: 1},
+			sheets:  []models.SheetDiff{{Sheet: "Ventes", Status: "modified"}},
+			changes: []models.Delta{
+				{Type: models.CellUpdate, SheetID: "Ventes", Location: "Ventes!B5", OldValue: "215", NewValue: "216", AffectedCells: 1},
+			},
+		},
+		{
+			name:    "renamed sheet",
+			base:    []SheetSnapshot{ventes},
+			target:  []SheetSnapshot{func() SheetSnapshot { s := ventes; s.Name = "Ventes 2025"; return s }()},
+			summary: models.DiffSummary{SheetsRenamed: 1},
+			sheets:  []models.SheetDiff{{Sheet: "Ventes 2025", OldName: "Ventes", Status: "renamed"}},
+			changes: []models.Delta{
+				{Type: models.SheetRename, SheetID: "Ventes 2025", OldValue: "Ventes", NewValue: "Ventes 2025"},
+			},
+		},
+		{
+			name:    "added and removed sheets",
+			base:    []SheetSnapshot{ventes, sheet("Brouillon", []string{"x"})},
+			target:  []SheetSnapshot{ventes, sheet("Notes", []string{"a", "b"}, []string{"", "=A1|a"})},
+			summary: models.DiffSummary{SheetsAdded: 1, SheetsRemoved: 1},
+			sheets:  []models.SheetDiff{{Sheet: "Notes", Status: "added"}, {Sheet: "Brouillon", Status: "removed"}},
+			changes: []models.Delta{
+				{Type: models.SheetAdd, SheetID: "Notes", AffectedCells: 3},
+				{Type: models.SheetRemove, SheetID: "Brouillon", AffectedCells: 1},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		result := Compare(&Snapshot{Sheets: tt.base}, &Snapshot{Sheets: tt.target}, tt.opts)
+		if result.Summary != tt.summary {
+			t.Errorf("%s: summary = %+v, want %+v", tt.name, result.Summary, tt.summary)
+		}
+		if !reflect.DeepEqual(result.Sheets, tt.sheets) {
+			t.Errorf("%s: sheets = %+v, want %+v", tt.name, result.Sheets, tt.sheets)
+		}
+		if !reflect.DeepEqual(result.Changes, tt.changes) {
+			t.Errorf("%s: changes = %+v, want %+v", tt.name, result.Changes, tt.changes)
+		}
+	}
+}
+
+func TestAlignRows(t *testing.T) {
+	tests := []struct {
+		name   string
+		base   []string
+		target []string
+		want   []rowPair
+	}{
+		{"identical", []string{"a", "b"}, []string{"a", "b"}, []rowPair{{0, 0}, {1, 1}}},
+		{"insert in the middle", []string{"a", "c"}, []string{"a", "b", "c"}, []rowPair{{0, 0}, {-1, 1}, {1, 2}}},
+		{"delete at the start", []string{"a", "b", "c"}, []string{"b", "c"}, []rowPair{{0, -1}, {1, 0}, {2, 1}}},
+		{"modified rows pair in order", []string{"a", "x", "y", "d"}, []string{"a", "X", "d"}, []rowPair{{0, 0}, {1, 1}, {2, -1}, {3, 2}}},
+		{"moved row", []string{"a", "b", "c"}, []string{"b", "c", "a"}, []rowPair{{0, -1}, {1, 0}, {2, 1}, {-1, 2}}},
+		{"empty base", nil, []string{"a"}, []rowPair{{-1, 0}}},
+	}
+
+	for _, tt := range tests {
+		if got := alignRows(tt.base, tt.target); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: alignRows() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRelativeFormula(t *testing.T) {
+	tests := []struct {
+		formula  string
+		col, row int
+		want     string
+	}{
+		{"B3*2", 3, 3, "RC[-1]*2"},
+		{"SUM(B2:B4)", 2, 6, "SUM(R[-4]C:R[-2]C)"},
+		{"B5*$B$1+B$1+$A5", 3, 5, "RC[-1]*R1C2+R1C[-1]+RC1"},
+		{"Ventes!A1+'Q1 2025'!A2", 1, 2, "Ventes!R[-1]C+'Q1 2025'!RC"},
+		{"Q1!A1", 1, 1, "Q1!RC"},
+		{`LOG10(A1)&"B2"`, 1, 1, `LOG10(RC)&"B2"`},
+		{"", 1, 1, ""},
+	}
+
+	for _, tt := range tests {
+		if got := relativeFormula(tt.formula, tt.col, tt.row); got != tt.want {
+			t.Errorf("%s: relativeFormula() = %s, want %s", tt.formula, got, tt.want)
+		}
+	}
+}
+
+func TestCompareModules(t *testing.T) {
+	base := map[string]string{
+		"Module1":  "Sub A()\nEnd Sub\n",
+		"Module2":  "Sub B()\n  x = 1\nEnd Sub",
+		"Obsolete": "Sub C()\nEnd Sub",
+	}
+	target := map[string]string{
+		"Module1": "Sub A()\nEnd Sub\n",
+		"Module2": "Sub B()\n  x = 2\n  y = 3\nEnd Sub",
+		"Nouveau": "Sub D()\n\nEnd Sub\n",
+	}
+
+	want := []models.VBAModuleDiff{
+		{Module: "Module2", Status: "modified", LinesAdded: 2, LinesRemoved: 1},
+		{Module: "Nouveau", Status: "added", LinesAdded: 3},
+		{Module: "Obsolete", Status: "removed", LinesRemoved: 2},
+	}
+	if got := compareModules(base, target); !reflect.DeepEqual(got, want) {
+		t.Errorf("compareModules() = %+v, want %+v", got, want)
+	}
+	if got := compareModules(nil, nil); got == nil || len(got) != 0 {
+		t.Errorf("compareModules(nil, nil) = %#v, want an empty list", got)
+	}
+}
@@ -0,0 +1,205 @@
+package diff
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+
+	"mcp-xlsm-server/internal/vba"
+	"mcp-xlsm-server/internal/workbook"
+)
+
+type Cell struct {
+	Value   string
+	Formula string
+}
+
+type SheetSnapshot struct {
+	Name string
+	Rows [][]Cell
+}
+
+// Snapshot is the cell content of a workbook at one checksum, enough to
+// diff it later against another version.
+type Snapshot struct {
+	Path     string
+	Checksum string
+	TakenAt  time.Time
+	Sheets   []SheetSnapshot
+	Modules  map[string]string
+}
+
+func TakeSnapshot(path, checksum string, opts ...workbook.Options) (*Snapshot, error) {
+	file, err := workbook.Open(path, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open XLSM file: %w", err)
+	}
+	defer file.Close()
+
+	// Only plain OOXML packages carry a VBA project that can be read
+	moduleSources := make(map[string]string)
+	format, _ := workbook.Detect(path)
+	encryption, _ := workbook.DetectEncryption(path)
+	if format.IsOOXML() && encryption == workbook.EncryptionNone {
+		modules, err := vba.ExtractModules(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read VBA project: %w", err)
+		}
+		for _, module := range modules {
+			moduleSources[module.Name] = module.Source
+		}
+	}
+
+	return SnapshotFile(file, path, checksum, moduleSources)
+}
+
+// SnapshotFile snapshots an open workbook, which may hold unsaved
+// changes. Modules are taken as given since they cannot be read back from
+// memory.
+func SnapshotFile(file *excelize.File, path, checksum string, modules map[string]string) (*Snapshot, error) {
+	snapshot := &Snapshot{
+		Path:     path,
+		Checksum: checksum,
+		TakenAt:  time.Now(),
+		Modules:  make(map[string]string),
+	}
+	for name, source := range modules {
+		snapshot.Modules[name] = source
+	}
+
+	for _, sheetName := range file.GetSheetList() {
+		sheet, err := snapshotSheet(file, sheetName)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read sheet %s: %w", sheetName, err)
+		}
+		snapshot.Sheets = append(snapshot.Sheets, *sheet)
+	}
+
+	return snapshot, nil
+}
+
+// SetCell overrides one cell, e.g. with a value computed for a formula
+// that has no stored value yet. col and row are 1-based.
+func (s *Snapshot) SetCell(sheetName string, col, row int, cell Cell) {
+	for i := range s.Sheets {
+		sheet := &s.Sheets[i]
+		if sheet.Name != sheetName {
+			continue
+		}
+		for len(sheet.Rows) < row {
+			sheet.Rows = append(sheet.Rows, nil)
+		}
+		for len(sheet.Rows[row-1]) < col {
+			sheet.Rows[row-1] = append(sheet.Rows[row-1], Cell{})
+		}
+		sheet.Rows[row-1][col-1] = cell
+		return
+	}
+}
+
+func snapshotSheet(file *excelize.File, sheetName string) (*SheetSnapshot, error) {
+	rows, err := file.GetRows(sheetName)
+	if err != nil {
+		return nil, err
+	}
+
+	sheet := &SheetSnapshot{Name: sheetName, Rows: make([][]Cell, len(rows))}
+	for rowIdx, row := range rows {
+		cells := make([]Cell, len(row))
+		for colIdx, value := range row {
+			cells[colIdx].Value = value
+			if value == "" {
+				continue
+			}
+			cellRef, _ := excelize.CoordinatesToCellName(colIdx+1, rowIdx+1)
+			if formula, err := file.GetCellFormula(sheetName, cellRef); err == nil {
+				cells[colIdx].Formula = formula
+			}
+		}
+		sheet.Rows[rowIdx] = cells
+	}
+
+	return sheet, nil
+}
+
+// Store keeps the most recent snapshots in memory, by checksum, and
+// remembers which versions of each path it has seen.
+type Store struct {
+	mu         sync.Mutex
+	maxEntries int
+	snapshots  map[string]*Snapshot
+	order      []string
+	history    map[string][]string
+}
+
+func NewStore(maxEntries int) *Store {
+	return &Store{
+		maxEntries: maxEntries,
+		snapshots:  make(map[string]*Snapshot),
+		history:    make(map[string][]string),
+	}
+}
+
+func (s *Store) Get(checksum string) (*Snapshot, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	snapshot, ok := s.snapshots[checksum]
+	return snapshot, ok
+}
+
+func (s *Store) Put(snapshot *Snapshot) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.snapshots[snapshot.Checksum]; !exists {
+		s.snapshots[snapshot.Checksum] = snapshot
+		s.order = append(s.order, snapshot.Checksum)
+	}
+
+	// Evict the oldest snapshots beyond capacity
+	for len(s.order) > s.maxEntries {
+		delete(s.snapshots, s.order[0])
+		s.order = s.order[1:]
+	}
+
+	versions := s.history[snapshot.Path]
+	if len(versions) == 0 || versions[len(versions)-1] != snapshot.Checksum {
+		s.history[snapshot.Path] = append(versions, snapshot.Checksum)
+	}
+}
+
+// Previous returns the latest cached snapshot of path whose checksum
+// differs from checksum.
+func (s *Store) Previous(path, checksum string) (*Snapshot, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	versions := s.history[path]
+	for i := len(versions) - 1; i >= 0; i-- {
+		if versions[i] == checksum {
+			continue
+		}
+		if snapshot, ok := s.snapshots[versions[i]]; ok {
+			return snapshot, true
+		}
+	}
+	return nil, false
+}
+
+// Load returns the cached snapshot for checksum, taking one from path
+// when it is missing. opts are passed to workbook.Open.
+func (s *Store) Load(path, checksum string, opts ...workbook.Options) (*Snapshot, error) {
+	if snapshot, ok := s.Get(checksum); ok {
+		return snapshot, nil
+	}
+
+	snapshot, err := TakeSnapshot(path, checksum, opts...)
+	if err != nil {
+		return nil, err
+	}
+	s.Put(snapshot)
+	return snapshot, nil
+}
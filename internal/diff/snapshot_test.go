@@ -0,0 +1,99 @@
+package diff
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+)
+
+func TestSnapshotFile(t *testing.T) {
+	f := excelize.NewFile()
+	f.SetSheetRow("Sheet1", "A1", &[]interface{}{"Montant", 12})
+	f.SetCellValue("Sheet1", "B2", 24)
+	f.SetCellFormula("Sheet1", "B2", "B1*2")
+	f.NewSheet("Vide")
+
+	snapshot, err := SnapshotFile(f, "/data/ventes.xlsx", "abc", map[string]string{"Module1": "Sub A()"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []SheetSnapshot{
+		{Name: "Sheet1", Rows: [][]Cell{{{Value: "Montant"}, {Value: "12"}}, {{}, {Value: "24", Formula: "B1*2"}}}},
+		{Name: "Vide", Rows: [][]Cell{}},
+	}
+	if !reflect.DeepEqual(snapshot.Sheets, want) {
+		t.Errorf("sheets = %+v, want %+v", snapshot.Sheets, want)
+	}
+	if snapshot.Modules["Module1"] != "Sub A()" || snapshot.Checksum != "abc" {
+		t.Errorf("snapshot = %+v", snapshot)
+	}
+
+	snapshot.SetCell("Vide", 2, 3, Cell{Value: "x"})
+	if rows := snapshot.Sheets[1].Rows; len(rows) != 3 || len(rows[2]) != 2 || rows[2][1].Value != "x" {
+		t.Errorf("SetCell rows = %+v", rows)
+	}
+}
+
+func TestStore(t *testing.T) {
+	store := NewStore(2)
+	for _, checksum := range []string{"v1", "v2", "v2", "v3"} {
+		store.Put(&Snapshot{Path: "/data/a.xlsx", Checksum: checksum})
+	}
+	store.Put(&Snapshot{Path: "/data/b.xlsx", Checksum: "b1"})
+
+	tests := []struct {
+		name     string
+		path     string
+		checksum string
+		want     string
+	}{
+		// v1 was evicted and v2 came back twice in a row, once in history
+		{"previous version", "/data/a.xlsx", "v3", ""},
+		{"latest other version", "/data/a.xlsx", "v9", "v3"},
+		{"other path", "/data/b.xlsx", "b2", "b1"},
+		{"only version", "/data/b.xlsx", "b1", ""},
+		{"unknown path", "/data/c.xlsx", "c1", ""},
+	}
+	for _, tt := range tests {
+		got := ""
+		if snapshot, ok := store.Previous(tt.path, tt.checksum); ok {
+			got = snapshot.Checksum
+		}
+		if got != tt.want {
+			t.Errorf("%s: Previous() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	if _, ok := store.Get("v2"); ok {
+		t.Error("v2 kept beyond capacity")
+	}
+	if _, ok := store.Get("b1"); !ok {
+		t.Error("b1 missing")
+	}
+}
+
+func TestStoreLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ventes.xlsx")
+	f := excelize.NewFile()
+	f.SetCellValue("Sheet1", "A1", "Montant")
+	if err := f.SaveAs(path); err != nil {
+		t.Fatal(err)
+	}
+
+	store := NewStore(4)
+	snapshot, err := store.Load(path, "abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshot.Sheets) != 1 || snapshot.Sheets[0].Rows[0][0].Value != "Montant" {
+		t.Errorf("snapshot sheets = %+v", snapshot.Sheets)
+	}
+	if again, _ := store.Load(filepath.Join(t.TempDir(), "absent.xlsx"), "abc"); again != snapshot {
+		t.Error("Load did not return the cached snapshot")
+	}
+	if _, err := store.Load(filepath.Join(t.TempDir(), "absent.xlsx"), "def"); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
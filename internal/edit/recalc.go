@@ -0,0 +1,281 @@
+package edit
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+
+	"mcp-xlsm-server/internal/models"
+)
+
+// A reference in a formula: optional sheet, then a cell, a cell range or
+// a whole-column range. Named ranges are not followed.
+var formulaRefPattern = regexp.MustCompile(
+	`(?:(?:'((?:[^']|'')+)'|([A-Za-z0-9_.]+))!)?` +
+		`(?:\$?([A-Z]{1,3})\$?([0-9]+)(?::\$?([A-Z]{1,3})\$?([0-9]+))?|\$?([A-Z]{1,3}):\$?([A-Z]{1,3}))`)
+
+// area is a rectangle of a sheet; 0 bounds are open.
+type area struct {
+	sheet                          string
+	minCol, minRow, maxCol, maxRow int
+}
+
+func (a area) overlaps(b area) bool {
+	if !strings.EqualFold(a.sheet, b.sheet) {
+		return false
+	}
+	return spans(a.minCol, a.maxCol, b.minCol, b.maxCol) && spans(a.minRow, a.maxRow, b.minRow, b.maxRow)
+}
+
+func spans(aMin, aMax, bMin, bMax int) bool {
+	if aMax != 0 && bMin != 0 && bMin > aMax {
+		return false
+	}
+	if bMax != 0 && aMin != 0 && aMin > bMax {
+		return false
+	}
+	return true
+}
+
+type formulaCell struct {
+	sheet    string
+	col, row int
+	formula  string
+	refs     []area
+}
+
+// Recalculate computes the formulas affected by the session's changes,
+// directly or through other affected formulas, and returns those whose
+// value differs from the one Excel last stored. At most max cells are
+// returned, along with the total.
+func (s *Session) Recalculate(max int) ([]models.RecalculatedCell, int, error) {
+	dirty := s.changedAreas()
+	if len(dirty) == 0 {
+		return nil, 0, nil
+	}
+
+	cells, err := s.formulaCells()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// Start from the formulas reading a change, then follow the formulas
+	// reading each affected one
+	affected := make(map[int]bool)
+	var queue []int
+	for i, cell := range cells {
+		if s.formulas[cell.sheet][cellPos{cell.col, cell.row}] || touches(cell.refs, dirty) {
+			affected[i] = true
+			queue = append(queue, i)
+		}
+	}
+	readers := dependents(cells)
+	for len(queue) > 0 {
+		i := queue[0]
+		queue = queue[1:]
+		for _, j := range readers[i] {
+			if !affected[j] {
+				affected[j] = true
+				queue = append(queue, j)
+			}
+		}
+	}
+
+	indexes := make([]int, 0, len(affected))
+	for i := range affected {
+		indexes = append(indexes, i)
+	}
+	sort.Ints(indexes)
+
+	var results []models.RecalculatedCell
+	total := 0
+	for _, i := range indexes {
+		cell := cells[i]
+		ref, _ := excelize.CoordinatesToCellName(cell.col, cell.row)
+		oldValue, _ := s.file.GetCellValue(cell.sheet, ref)
+
+		result := models.RecalculatedCell{
+			Location: fmt.Sprintf("%s!%s", cell.sheet, ref),
+			Formula:  "=" + cell.formula,
+			OldValue: oldValue,
+		}
+		newValue, err := s.file.CalcCellValue(cell.sheet, ref)
+		if err != nil {
+			result.Error = err.Error()
+		} else if newValue == oldValue {
+			continue
+		}
+		result.NewValue = newValue
+
+		total++
+		if len(results) < max {
+			results = append(results, result)
+		}
+	}
+
+	return results, total, nil
+}
+
+// changedAreas are the cells the session wrote. Inserted rows shift every
+// row below them, so those are treated as changed in full.
+func (s *Session) changedAreas() []area {
+	var areas []area
+	for _, delta := range s.deltas {
+		switch delta.Type {
+		case models.CellUpdate, models.FormulaChange:
+			sheet, ref, _ := strings.Cut(delta.Location, "!")
+			col, row, err := excelize.CellNameToCoordinates(ref)
+			if err == nil {
+				areas = append(areas, area{sheet, col, row, col, row})
+			}
+		case models.RowInsert:
+			var first int
+			_, rows, _ := strings.Cut(delta.Location, "!")
+			if _, err := fmt.Sscanf(rows, "%d:", &first); err == nil {
+				areas = append(areas, area{sheet: delta.SheetID, minRow: first})
+			}
+		case models.SheetAdd:
+			areas = append(areas, area{sheet: delta.SheetID})
+		}
+	}
+	return areas
+}
+
+// formulaCells lists every formula of the workbook with the areas it
+// reads.
+func (s *Session) formulaCells() ([]formulaCell, error) {
+	var cells []formulaCell
+	for _, sheet := range s.file.GetSheetList() {
+		rows, err := s.file.GetRows(sheet)
+		if err != nil {
+			return nil, err
+		}
+
+		positions := make(map[cellPos]bool)
+		for rowIdx, row := range rows {
+			for colIdx, value := range row {
+				if value != "" {
+					positions[cellPos{colIdx + 1, rowIdx + 1}] = true
+				}
+			}
+		}
+		// Formulas written in this session have no stored value yet
+		for pos := range s.formulas[sheet] {
+			positions[pos] = true
+		}
+
+		for pos := range positions {
+			ref, _ := excelize.CoordinatesToCellName(pos.col, pos.row)
+			formula, err := s.file.GetCellFormula(sheet, ref)
+			if err != nil || formula == "" {
+				continue
+			}
+			cells = append(cells, formulaCell{
+				sheet:   sheet,
+				col:     pos.col,
+				row:     pos.row,
+				formula: formula,
+				refs:    formulaRefs(sheet, formula),
+			})
+		}
+	}
+
+	sort.Slice(cells, func(i, j int) bool {
+		if cells[i].sheet != cells[j].sheet {
+			return cells[i].sheet < cells[j].sheet
+		}
+		if cells[i].row != cells[j].row {
+			return cells[i].row < cells[j].row
+		}
+		return cells[i].col < cells[j].col
+	})
+	return cells, nil
+}
+
+func formulaRefs(sheet, formula string) []area {
+	var refs []area
+	for _, m := range formulaRefPattern.FindAllStringSubmatch(formula, -1) {
+		a := area{sheet: sheet}
+		if m[1] != "" {
+			a.sheet = strings.ReplaceAll(m[1], "''", "'")
+		} else if m[2] != "" {
+			a.sheet = m[2]
+		}
+
+		if m[3] != "" {
+			a.minCol, _ = excelize.ColumnNameToNumber(m[3])
+			fmt.Sscanf(m[4], "%d", &a.minRow)
+			a.maxCol, a.maxRow = a.minCol, a.minRow
+			if m[5] != "" {
+				a.maxCol, _ = excelize.ColumnNameToNumber(m[5])
+				fmt.Sscanf(m[6], "%d", &a.maxRow)
+			}
+		} else {
+			a.minCol, _ = excelize.ColumnNameToNumber(m[7])
+			a.maxCol, _ = excelize.ColumnNameToNumber(m[8])
+		}
+		if a.minCol > a.maxCol {
+			a.minCol, a.maxCol = a.maxCol, a.minCol
+		}
+		if a.minRow > a.maxRow {
+			a.minRow, a.maxRow = a.maxRow, a.minRow
+		}
+		refs = append(refs, a)
+	}
+	return refs
+}
+
+// dependents lists, for each formula cell, the formulas reading it.
+// References to a single cell are looked up by position; only ranges are
+// compared one by one.
+func dependents(cells []formulaCell) [][]int {
+	type sheetPos struct {
+		sheet string
+		pos   cellPos
+	}
+	type rangeRef struct {
+		reader int
+		area   area
+	}
+
+	single := make(map[sheetPos][]int)
+	ranges := make(map[string][]rangeRef)
+	for i, cell := range cells {
+		for _, ref := range cell.refs {
+			sheet := strings.ToLower(ref.sheet)
+			if ref.minCol != 0 && ref.minRow != 0 && ref.minCol == ref.maxCol && ref.minRow == ref.maxRow {
+				key := sheetPos{sheet, cellPos{ref.minCol, ref.minRow}}
+				single[key] = append(single[key], i)
+			} else {
+				ranges[sheet] = append(ranges[sheet], rangeRef{i, ref})
+			}
+		}
+	}
+
+	readers := make([][]int, len(cells))
+	for i, cell := range cells {
+		sheet := strings.ToLower(cell.sheet)
+		readers[i] = append(readers[i], single[sheetPos{sheet, cellPos{cell.col, cell.row}}]...)
+		at := area{cell.sheet, cell.col, cell.row, cell.col, cell.row}
+		for _, r := range ranges[sheet] {
+			if r.area.overlaps(at) {
+				readers[i] = append(readers[i], r.reader)
+			}
+		}
+	}
+	return readers
+}
+
+func touches(refs, dirty []area) bool {
+	for _, ref := range refs {
+		for _, d := range dirty {
+			if ref.overlaps(d) {
+				return true
+			}
+		}
+	}
+	return false
+}
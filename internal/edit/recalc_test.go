@@ -0,0 +1,197 @@
+package edit
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+
+	"mcp-xlsm-server/internal/models"
+)
+
+func TestFormulaRefs(t *testing.T) {
+	tests := []struct {
+		formula string
+		want    []area
+	}{
+		{"A1*2", []area{{"Feuil1", 1, 1, 1, 1}}},
+		{"SUM($B$2:B10)", []area{{"Feuil1", 2, 2, 2, 10}}},
+		{"SUM(C10:A2)", []area{{"Feuil1", 1, 2, 3, 10}}},
+		{"Data!A1+'Grand Livre'!C:D", []area{{"Data", 1, 1, 1, 1}, {"Grand Livre", 3, 0, 4, 0}}},
+		{"'l''an'!B2", []area{{"l'an", 2, 2, 2, 2}}},
+		{"TODAY()", nil},
+	}
+
+	for _, tt := range tests {
+		if got := formulaRefs("Feuil1", tt.formula); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("formulaRefs(%q) = %v, want %v", tt.formula, got, tt.want)
+		}
+	}
+}
+
+func TestAreaOverlaps(t *testing.T) {
+	tests := []struct {
+		a, b area
+		want bool
+	}{
+		{area{"S", 1, 1, 3, 3}, area{"S", 3, 3, 3, 3}, true},
+		{area{"S", 1, 1, 3, 3}, area{"S", 4, 1, 4, 1}, false},
+		{area{"S", 1, 1, 3, 3}, area{"s", 2, 2, 2, 2}, true},
+		{area{"S", 1, 1, 3, 3}, area{"T", 2, 2, 2, 2}, false},
+		// Whole columns and rows from an insert are open-ended
+		{area{"S", 2, 0, 2, 0}, area{"S", 2, 500, 2, 500}, true},
+		{area{"S", 1, 1, 5, 4}, area{sheet: "S", minRow: 5}, false},
+		{area{"S", 1, 1, 5, 5}, area{sheet: "S", minRow: 5}, true},
+		{area{"S", 1, 1, 1, 1}, area{sheet: "S"}, true},
+	}
+
+	for _, tt := range tests {
+		if got := tt.a.overlaps(tt.b); got != tt.want {
+			t.Errorf("%v overlaps %v = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestDependents(t *testing.T) {
+	cells := []formulaCell{
+		{sheet: "S", col: 1, row: 3, refs: []area{{"S", 1, 1, 1, 2}}},
+		{sheet: "S", col: 2, row: 1, refs: []area{{"S", 1, 3, 1, 3}}},
+		{sheet: "T", col: 1, row: 1, refs: []area{{"s", 1, 3, 1, 3}, {"S", 2, 0, 2, 0}}},
+		{sheet: "T", col: 1, row: 2, refs: []area{{"T", 1, 1, 1, 1}}},
+		{sheet: "T", col: 1, row: 3, refs: []area{{"T", 2, 1, 2, 1}}},
+	}
+	want := [][]int{
+		// S!A3 is read as a cell by S!B1 and T!A1, T!A1 naming its sheet
+		// in another case
+		{1, 2},
+		// S!B1 falls in the S!B:B column T!A1 reads
+		{2},
+		{3},
+		nil,
+		nil,
+	}
+
+	if got := dependents(cells); !reflect.DeepEqual(got, want) {
+		t.Errorf("dependents() = %v, want %v", got, want)
+	}
+}
+
+// newRecalcSession opens a workbook whose formulas hold the values Excel
+// would have cached for them.
+func newRecalcSession(t *testing.T) *Session {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "budget.xlsx")
+	f := excelize.NewFile()
+	f.NewSheet("Synthese")
+	formulas := []struct {
+		sheet, cell string
+		value       interface{}
+		formula     string
+	}{
+		{"Sheet1", "A1", 10, ""},
+		{"Sheet1", "A2", 20, ""},
+		{"Sheet1", "A3", 30, "SUM(A1:A2)"},
+		{"Sheet1", "B1", 60, "A3*2"},
+		{"Sheet1", "C1", 1, "IF(A1>0,1,0)"},
+		{"Sheet1", "D1", 2, "1+1"},
+		{"Synthese", "A1", 31, "Sheet1!A3+1"},
+	}
+	for _, c := range formulas {
+		f.SetCellValue(c.sheet, c.cell, c.value)
+		if c.formula != "" {
+			f.SetCellFormula(c.sheet, c.cell, c.formula)
+		}
+	}
+	if err := f.SaveAs(path); err != nil {
+		t.Fatal(err)
+	}
+	checksum, _ := FileChecksum(path)
+	session, err := Open(path, checksum)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { session.Close() })
+	return session
+}
+
+func TestRecalculate(t *testing.T) {
+	tests := []struct {
+		name  string
+		edit  func(*Session) error
+		max   int
+		want  []models.RecalculatedCell
+		total int
+	}{
+		{
+			name:  "no change",
+			edit:  func(*Session) error { return nil },
+			max:   10,
+			total: 0,
+		},
+		{
+			name: "dependents across sheets, unchanged values skipped",
+			edit: func(s *Session) error {
+				return s.SetCells([]CellWrite{{Sheet: "Sheet1", Cell: "A1", Value: 15}})
+			},
+			max: 10,
+			want: []models.RecalculatedCell{
+				{Location: "Sheet1!B1", Formula: "=A3*2", OldValue: "60", NewValue: "70"},
+				{Location: "Sheet1!A3", Formula: "=SUM(A1:A2)", OldValue: "30", NewValue: "35"},
+				{Location: "Synthese!A1", Formula: "=Sheet1!A3+1", OldValue: "31", NewValue: "36"},
+			},
+			total: 3,
+		},
+		{
+			name: "capped list keeps the total",
+			edit: func(s *Session) error {
+				return s.SetCells([]CellWrite{{Sheet: "Sheet1", Cell: "A2", Value: 25}})
+			},
+			max: 1,
+			want: []models.RecalculatedCell{
+				{Location: "Sheet1!B1", Formula: "=A3*2", OldValue: "60", NewValue: "70"},
+			},
+			total: 3,
+		},
+		{
+			name: "new formula has no stored value",
+			edit: func(s *Session) error {
+				return s.SetCells([]CellWrite{{Sheet: "Sheet1", Cell: "E1", Formula: "=D1*5"}})
+			},
+			max: 10,
+			want: []models.RecalculatedCell{
+				{Location: "Sheet1!E1", Formula: "=D1*5", NewValue: "10"},
+			},
+			total: 1,
+		},
+		{
+			name: "inserted rows dirty everything below",
+			edit: func(s *Session) error {
+				_, err := s.InsertRows("Sheet1", 2, [][]interface{}{{5}})
+				return err
+			},
+			max: 10,
+			want: []models.RecalculatedCell{
+				{Location: "Sheet1!B1", Formula: "=A4*2", OldValue: "60", NewValue: "70"},
+				{Location: "Sheet1!A4", Formula: "=SUM(A1:A3)", OldValue: "30", NewValue: "35"},
+				{Location: "Synthese!A1", Formula: "=Sheet1!A4+1", OldValue: "31", NewValue: "36"},
+			},
+			total: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		session := newRecalcSession(t)
+		if err := tt.edit(session); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		got, total, err := session.Recalculate(tt.max)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) || total != tt.total {
+			t.Errorf("%s: Recalculate() = %+v, %d; want %+v, %d", tt.name, got, total, tt.want, tt.total)
+		}
+	}
+}
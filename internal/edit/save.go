@@ -0,0 +1,173 @@
+package edit
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Backups are written to this directory next to the workbook
+const backupDirName = ".backups"
+
+// Older backups of the same workbook are pruned beyond this count
+const maxBackups = 20
+
+var ErrChecksumMismatch = errors.New("workbook changed on disk")
+
+// saveLocks serializes saves of the same path within the process.
+var saveLocks sync.Map
+
+type SaveResult struct {
+	OldChecksum string
+	NewChecksum string
+	BackupPath  string
+}
+
+// Save writes the workbook back to its path. The new content goes to a
+// temporary file in the same directory which then replaces the original
+// with a rename, so readers see either the old or the new version. The
+// original is first kept as a timestamped backup. The save fails if the
+// file changed on disk since the session was opened.
+func (s *Session) Save() (*SaveResult, error) {
+	if s.err != nil {
+		return nil, fmt.Errorf("refusing to save a partial edit: %w", s.err)
+	}
+
+	dir := filepath.Dir(s.path)
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(s.path)+".tmp-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath)
+
+	// excelize keeps the parts it does not model, the VBA project
+	// included, and WriteTo keeps the macro-enabled content type of the
+	// original path
+	hash := sha256.New()
+	if _, err := s.file.WriteTo(io.MultiWriter(tmp, hash)); err != nil {
+		tmp.Close()
+		return nil, fmt.Errorf("failed to write workbook: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return nil, err
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, err
+	}
+
+	lock, _ := saveLocks.LoadOrStore(s.path, &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+	defer lock.(*sync.Mutex).Unlock()
+
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return nil, err
+	}
+	current, err := FileChecksum(s.path)
+	if err != nil {
+		return nil, err
+	}
+	if current != s.checksum {
+		return nil, fmt.Errorf("%w: expected %s, file is at %s", ErrChecksumMismatch, s.checksum, current)
+	}
+
+	backupPath, err := backup(s.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to back up workbook: %w", err)
+	}
+
+	if err := os.Chmod(tmpPath, info.Mode().Perm()); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(tmpPath, s.path); err != nil {
+		return nil, fmt.Errorf("failed to replace workbook: %w", err)
+	}
+
+	newChecksum := fmt.Sprintf("%x", hash.Sum(nil))
+	oldChecksum := s.checksum
+	s.checksum = newChecksum
+
+	return &SaveResult{
+		OldChecksum: oldChecksum,
+		NewChecksum: newChecksum,
+		BackupPath:  backupPath,
+	}, nil
+}
+
+// backup copies path to .backups/<name>.<timestamp><ext> and prunes the
+// oldest backups of the same workbook.
+func backup(path string) (string, error) {
+	dir := filepath.Join(filepath.Dir(path), backupDirName)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+
+	ext := filepath.Ext(path)
+	stem := strings.TrimSuffix(filepath.Base(path), ext)
+	backupPath := filepath.Join(dir, fmt.Sprintf("%s.%s%s", stem, time.Now().Format("20060102-150405.000"), ext))
+
+	if err := copyFile(path, backupPath); err != nil {
+		return "", err
+	}
+
+	existing, err := filepath.Glob(filepath.Join(dir, globEscape(stem)+".*"+ext))
+	if err == nil && len(existing) > maxBackups {
+		// Timestamps sort chronologically
+		sort.Strings(existing)
+		for _, old := range existing[:len(existing)-maxBackups] {
+			os.Remove(old)
+		}
+	}
+
+	return backupPath, nil
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+func globEscape(s string) string {
+	replacer := strings.NewReplacer(`*`, `\*`, `?`, `\?`, `[`, `\[`, `\`, `\\`)
+	return replacer.Replace(s)
+}
+
+func FileChecksum(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", hash.Sum(nil)), nil
+}
@@ -0,0 +1,334 @@
+package edit
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+
+	"mcp-xlsm-server/internal/models"
+	"mcp-xlsm-server/internal/workbook"
+)
+
+// CellWrite sets one cell. A non-empty Formula wins over Value; a nil
+// Value with no formula clears the cell.
+type CellWrite struct {
+	Sheet   string
+	Cell    string
+	Value   interface{}
+	Formula string
+}
+
+type cellPos struct {
+	col, row int
+}
+
+// Session holds a workbook opened for writing. Changes stay in memory
+// until Save, and every change is recorded as an index delta.
+//
+// Inputs are validated before anything is changed. If a change still
+// fails halfway the session is marked broken and refuses further work, so
+// a partial edit can never be saved.
+type Session struct {
+	path     string
+	checksum string
+	file     *excelize.File
+	deltas   []models.Delta
+	err      error
+	// formulas holds the cells given a formula in this session, per sheet;
+	// they have no cached value until Excel recalculates them
+	formulas map[string]map[cellPos]bool
+}
+
+// Open loads path for editing. expectedChecksum must match the file on
+// disk so that edits are never applied to a version the caller has not
+// seen.
+func Open(path, expectedChecksum string) (*Session, error) {
+	checksum, err := FileChecksum(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to calculate checksum: %w", err)
+	}
+	if checksum != expectedChecksum {
+		return nil, fmt.Errorf("%w: expected %s, file is at %s", ErrChecksumMismatch, expectedChecksum, checksum)
+	}
+
+	// Converted formats would be saved as OOXML under their own name
+	format, err := workbook.Detect(path)
+	if err != nil {
+		return nil, err
+	}
+	if !format.IsOOXML() {
+		return nil, fmt.Errorf("%s workbooks are read-only, save the file as .xlsx or .xlsm to edit it", format)
+	}
+	// Saving would write the package back without its encryption
+	if encryption, err := workbook.DetectEncryption(path); err != nil {
+		return nil, err
+	} else if encryption != workbook.EncryptionNone {
+		return nil, fmt.Errorf("encrypted workbooks are read-only, remove the password in Excel to edit it")
+	}
+
+	file, err := excelize.OpenFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open XLSM file: %w", err)
+	}
+
+	return &Session{
+		path:     path,
+		checksum: checksum,
+		file:     file,
+		formulas: make(map[string]map[cellPos]bool),
+	}, nil
+}
+
+func (s *Session) Path() string {
+	return s.path
+}
+
+// Checksum is the checksum of the version the session was opened on.
+func (s *Session) Checksum() string {
+	return s.checksum
+}
+
+// File gives read access to the edited workbook.
+func (s *Session) File() *excelize.File {
+	return s.file
+}
+
+// Deltas lists the changes made so far, in order.
+func (s *Session) Deltas() []models.Delta {
+	return append([]models.Delta{}, s.deltas...)
+}
+
+// Err reports why the session is broken, if it is.
+func (s *Session) Err() error {
+	return s.err
+}
+
+func (s *Session) Close() error {
+	return s.file.Close()
+}
+
+func (s *Session) fail(err error) error {
+	s.err = err
+	return err
+}
+
+func (s *Session) checkSheet(sheet string) error {
+	if s.err != nil {
+		return fmt.Errorf("edit session is broken by an earlier failure: %w", s.err)
+	}
+	if idx, _ := s.file.GetSheetIndex(sheet); idx < 0 {
+		return fmt.Errorf("unknown sheet: %s", sheet)
+	}
+	return nil
+}
+
+// SetCells applies writes in order. Every write is validated first, so an
+// invalid one leaves the workbook unchanged.
+func (s *Session) SetCells(writes []CellWrite) error {
+	for i, w := range writes {
+		if err := s.checkSheet(w.Sheet); err != nil {
+			return err
+		}
+		cell := strings.ToUpper(strings.ReplaceAll(w.Cell, "$", ""))
+		if _, _, err := excelize.CellNameToCoordinates(cell); err != nil {
+			return fmt.Errorf("invalid cell %s: %w", w.Cell, err)
+		}
+		writes[i].Cell = cell
+	}
+
+	for _, w := range writes {
+		if err := s.setCell(w); err != nil {
+			return s.fail(err)
+		}
+	}
+	return nil
+}
+
+func (s *Session) setCell(w CellWrite) error {
+	oldValue, _ := s.file.GetCellValue(w.Sheet, w.Cell)
+	oldFormula, _ := s.file.GetCellFormula(w.Sheet, w.Cell)
+
+	formula := strings.TrimPrefix(w.Formula, "=")
+	if text, ok := w.Value.(string); ok && formula == "" && strings.HasPrefix(text, "=") {
+		formula = strings.TrimPrefix(text, "=")
+	}
+
+	delta := models.Delta{
+		Type:          models.CellUpdate,
+		SheetID:       w.Sheet,
+		Location:      fmt.Sprintf("%s!%s", w.Sheet, w.Cell),
+		OldValue:      oldValue,
+		AffectedCells: 1,
+	}
+
+	var err error
+	switch {
+	case formula != "":
+		err = s.setFormula(w.Sheet, w.Cell, formula)
+		delta.Type = models.FormulaChange
+		delta.NewValue = "=" + formula
+		if oldFormula != "" {
+			delta.OldValue = "=" + oldFormula
+		}
+	case w.Value == nil:
+		err = s.file.SetCellValue(w.Sheet, w.Cell, nil)
+		delta.NewValue = ""
+	default:
+		err = s.file.SetCellValue(w.Sheet, w.Cell, w.Value)
+		delta.NewValue, _ = s.file.GetCellValue(w.Sheet, w.Cell)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", delta.Location, err)
+	}
+
+	s.deltas = append(s.deltas, delta)
+	return nil
+}
+
+// AppendRows writes rows below the last used row of sheet and returns the
+// rows written, e.g. "Journal!120:124".
+func (s *Session) AppendRows(sheet string, rows [][]interface{}) (string, error) {
+	if err := s.checkSheet(sheet); err != nil {
+		return "", err
+	}
+	if len(rows) == 0 {
+		return "", fmt.Errorf("no rows to append")
+	}
+
+	existing, err := s.file.GetRows(sheet)
+	if err != nil {
+		return "", err
+	}
+	first := len(existing) + 1
+
+	location, err := s.writeRows(sheet, first, rows)
+	if err != nil {
+		return "", s.fail(err)
+	}
+	return location, nil
+}
+
+// InsertRows shifts the rows from row (1-based) down and writes rows in
+// their place. References to the shifted cells are adjusted.
+func (s *Session) InsertRows(sheet string, row int, rows [][]interface{}) (string, error) {
+	if err := s.checkSheet(sheet); err != nil {
+		return "", err
+	}
+	if row < 1 {
+		return "", fmt.Errorf("row must be 1 or more")
+	}
+	if len(rows) == 0 {
+		return "", fmt.Errorf("no rows to insert")
+	}
+
+	if err := s.file.InsertRows(sheet, row, len(rows)); err != nil {
+		return "", s.fail(fmt.Errorf("failed to insert rows: %w", err))
+	}
+	shifted := make(map[cellPos]bool, len(s.formulas[sheet]))
+	for pos := range s.formulas[sheet] {
+		if pos.row >= row {
+			pos.row += len(rows)
+		}
+		shifted[pos] = true
+	}
+	s.formulas[sheet] = shifted
+
+	location, err := s.writeRows(sheet, row, rows)
+	if err != nil {
+		return "", s.fail(err)
+	}
+	return location, nil
+}
+
+func (s *Session) writeRows(sheet string, first int, rows [][]interface{}) (string, error) {
+	cells := 0
+	for i, row := range rows {
+		for j, value := range row {
+			if value == nil {
+				continue
+			}
+			cell, _ := excelize.CoordinatesToCellName(j+1, first+i)
+			if err := s.writeValue(sheet, cell, value); err != nil {
+				return "", err
+			}
+			cells++
+		}
+	}
+
+	location := fmt.Sprintf("%s!%d:%d", sheet, first, first+len(rows)-1)
+	s.deltas = append(s.deltas, models.Delta{
+		Type:          models.RowInsert,
+		SheetID:       sheet,
+		Location:      location,
+		NewValue:      len(rows),
+		AffectedCells: cells,
+	})
+	return location, nil
+}
+
+// AddSheet creates a sheet at the end of the workbook, optionally filled
+// with rows starting at A1.
+func (s *Session) AddSheet(name string, rows [][]interface{}) error {
+	if s.err != nil {
+		return fmt.Errorf("edit session is broken by an earlier failure: %w", s.err)
+	}
+	if name == "" {
+		return fmt.Errorf("sheet name is required")
+	}
+	if idx, _ := s.file.GetSheetIndex(name); idx >= 0 {
+		return fmt.Errorf("sheet %s already exists", name)
+	}
+	if _, err := s.file.NewSheet(name); err != nil {
+		return fmt.Errorf("failed to add sheet %s: %w", name, err)
+	}
+
+	cells := 0
+	for i, row := range rows {
+		for j, value := range row {
+			if value == nil {
+				continue
+			}
+			cell, _ := excelize.CoordinatesToCellName(j+1, i+1)
+			if err := s.writeValue(name, cell, value); err != nil {
+				return s.fail(err)
+			}
+			cells++
+		}
+	}
+
+	s.deltas = append(s.deltas, models.Delta{
+		Type:          models.SheetAdd,
+		SheetID:       name,
+		Location:      name,
+		AffectedCells: cells,
+	})
+	return nil
+}
+
+// writeValue writes a row value; strings starting with "=" are formulas.
+func (s *Session) writeValue(sheet, cell string, value interface{}) error {
+	var err error
+	if text, ok := value.(string); ok && strings.HasPrefix(text, "=") {
+		err = s.setFormula(sheet, cell, strings.TrimPrefix(text, "="))
+	} else {
+		err = s.file.SetCellValue(sheet, cell, value)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write %s!%s: %w", sheet, cell, err)
+	}
+	return nil
+}
+
+func (s *Session) setFormula(sheet, cell, formula string) error {
+	if err := s.file.SetCellFormula(sheet, cell, formula); err != nil {
+		return err
+	}
+
+	col, row, _ := excelize.CellNameToCoordinates(cell)
+	if s.formulas[sheet] == nil {
+		s.formulas[sheet] = make(map[cellPos]bool)
+	}
+	s.formulas[sheet][cellPos{col, row}] = true
+	return nil
+}
@@ -0,0 +1,141 @@
+package edit
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Transaction groups several edits of one workbook. Nothing reaches the
+// file until Commit; Rollback, a failed commit or expiry discard it all.
+type Transaction struct {
+	// mu serializes the steps of one transaction
+	mu        sync.Mutex
+	ID        string
+	Session   *Session
+	Steps     int
+	StartedAt time.Time
+	lastUsed  time.Time
+}
+
+// Lock reserves the transaction for one step. Release with Unlock.
+func (t *Transaction) Lock() {
+	t.mu.Lock()
+}
+
+func (t *Transaction) Unlock() {
+	t.mu.Unlock()
+}
+
+// Manager keeps the open transactions, at most one per workbook.
+type Manager struct {
+	mu           sync.Mutex
+	ttl          time.Duration
+	transactions map[string]*Transaction
+}
+
+func NewManager(ttl time.Duration) *Manager {
+	return &Manager{
+		ttl:          ttl,
+		transactions: make(map[string]*Transaction),
+	}
+}
+
+// Begin opens a transaction on path at expectedChecksum.
+func (m *Manager) Begin(path, expectedChecksum string) (*Transaction, error) {
+	m.mu.Lock()
+	for _, tx := range m.transactions {
+		if tx.Session.Path() == path {
+			m.mu.Unlock()
+			return nil, fmt.Errorf("workbook already has an open edit %s; commit or roll it back first", tx.ID)
+		}
+	}
+	m.mu.Unlock()
+
+	session, err := Open(path, expectedChecksum)
+	if err != nil {
+		return nil, err
+	}
+
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		session.Close()
+		return nil, err
+	}
+
+	now := time.Now()
+	tx := &Transaction{
+		ID:        "edit_" + hex.EncodeToString(id),
+		Session:   session,
+		StartedAt: now,
+		lastUsed:  now,
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, other := range m.transactions {
+		if other.Session.Path() == path {
+			session.Close()
+			return nil, fmt.Errorf("workbook already has an open edit %s; commit or roll it back first", other.ID)
+		}
+	}
+	m.transactions[tx.ID] = tx
+	return tx, nil
+}
+
+// Get returns an open transaction and extends its lifetime.
+func (m *Manager) Get(id string) (*Transaction, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	tx, ok := m.transactions[id]
+	if !ok {
+		return nil, fmt.Errorf("no open edit %s; it was committed, rolled back or expired", id)
+	}
+	tx.lastUsed = time.Now()
+	return tx, nil
+}
+
+// End removes a transaction; the caller commits or discards its session.
+func (m *Manager) End(id string) (*Transaction, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	tx, ok := m.transactions[id]
+	if !ok {
+		return nil, fmt.Errorf("no open edit %s; it was committed, rolled back or expired", id)
+	}
+	delete(m.transactions, id)
+	return tx, nil
+}
+
+// ExpiresAt is when tx is rolled back if left unused.
+func (m *Manager) ExpiresAt(tx *Transaction) time.Time {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return tx.lastUsed.Add(m.ttl)
+}
+
+// Expire rolls back the transactions unused for longer than the TTL and
+// returns how many there were.
+func (m *Manager) Expire() int {
+	m.mu.Lock()
+	var expired []*Transaction
+	for id, tx := range m.transactions {
+		if time.Since(tx.lastUsed) > m.ttl {
+			expired = append(expired, tx)
+			delete(m.transactions, id)
+		}
+	}
+	m.mu.Unlock()
+
+	for _, tx := range expired {
+		tx.Lock()
+		tx.Session.Close()
+		tx.Unlock()
+	}
+	return len(expired)
+}
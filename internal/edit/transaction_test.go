@@ -0,0 +1,187 @@
+package edit
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// newWorkbook saves a one-sheet workbook in a fresh directory and returns
+// its path and checksum.
+func newWorkbook(t *testing.T, rows ...[]interface{}) (string, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "journal.xlsx")
+	f := excelize.NewFile()
+	for i, row := range rows {
+		cell, _ := excelize.CoordinatesToCellName(1, i+1)
+		f.SetSheetRow("Sheet1", cell, &row)
+	}
+	if err := f.SaveAs(path); err != nil {
+		t.Fatal(err)
+	}
+	checksum, err := FileChecksum(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path, checksum
+}
+
+func TestManagerLifecycle(t *testing.T) {
+	path, checksum := newWorkbook(t, []interface{}{"Compte", "Montant"})
+	m := NewManager(time.Hour)
+
+	if _, err := m.Begin(path, "stale"); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("Begin() with a stale checksum = %v, want ErrChecksumMismatch", err)
+	}
+
+	tx, err := m.Begin(path, checksum)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(tx.ID, "edit_") {
+		t.Errorf("transaction id %q", tx.ID)
+	}
+	if _, err := m.Begin(path, checksum); err == nil || !strings.Contains(err.Error(), tx.ID) {
+		t.Errorf("second Begin() = %v, want the open edit named", err)
+	}
+
+	got, err := m.Get(tx.ID)
+	if err != nil || got != tx {
+		t.Fatalf("Get() = %v, %v", got, err)
+	}
+	if err := tx.Session.SetCells([]CellWrite{{Sheet: "Sheet1", Cell: "B2", Value: 42}}); err != nil {
+		t.Fatal(err)
+	}
+	if expires := m.ExpiresAt(tx); time.Until(expires) < 59*time.Minute {
+		t.Errorf("ExpiresAt() = %v, want an hour from now", expires)
+	}
+
+	// Nothing reaches the file before commit
+	if current, _ := FileChecksum(path); current != checksum {
+		t.Error("file changed before commit")
+	}
+
+	ended, err := m.End(tx.ID)
+	if err != nil || ended != tx {
+		t.Fatalf("End() = %v, %v", ended, err)
+	}
+	result, err := ended.Session.Save()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ended.Session.Close()
+	if result.OldChecksum != checksum || result.NewChecksum == checksum {
+		t.Errorf("save result = %+v", result)
+	}
+	if current, _ := FileChecksum(path); current != result.NewChecksum {
+		t.Errorf("file checksum %s, want %s", current, result.NewChecksum)
+	}
+	if _, err := os.Stat(result.BackupPath); err != nil {
+		t.Errorf("backup missing: %v", err)
+	}
+
+	for _, call := range []func(string) (*Transaction, error){m.Get, m.End} {
+		if _, err := call(tx.ID); err == nil || !strings.Contains(err.Error(), "no open edit") {
+			t.Errorf("ended transaction still reachable: %v", err)
+		}
+	}
+
+	// The path is free again, at its new version
+	next, err := m.Begin(path, result.NewChecksum)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value, _ := next.Session.File().GetCellValue("Sheet1", "B2"); value != "42" {
+		t.Errorf("B2 = %q after commit, want 42", value)
+	}
+	m.End(next.ID)
+	next.Session.Close()
+}
+
+func TestManagerExpire(t *testing.T) {
+	m := NewManager(time.Minute)
+	idlePath, idleChecksum := newWorkbook(t, []interface{}{"a"})
+	activePath, activeChecksum := newWorkbook(t, []interface{}{"b"})
+
+	idle, err := m.Begin(idlePath, idleChecksum)
+	if err != nil {
+		t.Fatal(err)
+	}
+	active, err := m.Begin(activePath, activeChecksum)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idle.lastUsed = time.Now().Add(-2 * time.Minute)
+
+	if expired := m.Expire(); expired != 1 {
+		t.Errorf("Expire() = %d, want 1", expired)
+	}
+	if _, err := m.Get(idle.ID); err == nil {
+		t.Error("idle transaction survived expiry")
+	}
+	if _, err := m.Get(active.ID); err != nil {
+		t.Errorf("active transaction expired: %v", err)
+	}
+
+	// A rolled back workbook can be edited again from its unchanged version
+	again, err := m.Begin(idlePath, idleChecksum)
+	if err != nil {
+		t.Fatalf("Begin() after expiry: %v", err)
+	}
+	for _, tx := range []*Transaction{again, active} {
+		m.End(tx.ID)
+		tx.Session.Close()
+	}
+}
+
+func TestSessionRefusesPartialEdits(t *testing.T) {
+	path, checksum := newWorkbook(t, []interface{}{"a"})
+	session, err := Open(path, checksum)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer session.Close()
+
+	// Invalid writes are caught before anything changes
+	err = session.SetCells([]CellWrite{
+		{Sheet: "Sheet1", Cell: "A2", Value: "ok"},
+		{Sheet: "Absente", Cell: "A1", Value: "x"},
+	})
+	if err == nil || session.Err() != nil || len(session.Deltas()) != 0 {
+		t.Errorf("SetCells() = %v, deltas %v, session error %v", err, session.Deltas(), session.Err())
+	}
+
+	session.fail(errors.New("disk full"))
+	if err := session.SetCells([]CellWrite{{Sheet: "Sheet1", Cell: "A2", Value: 1}}); err == nil || !strings.Contains(err.Error(), "broken") {
+		t.Errorf("SetCells() on a broken session = %v", err)
+	}
+	if _, err := session.Save(); err == nil || !strings.Contains(err.Error(), "partial edit") {
+		t.Errorf("Save() on a broken session = %v", err)
+	}
+}
+
+func TestSaveDetectsConcurrentChanges(t *testing.T) {
+	path, checksum := newWorkbook(t, []interface{}{"a"})
+	session, err := Open(path, checksum)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer session.Close()
+
+	other, _ := excelize.OpenFile(path)
+	other.SetCellValue("Sheet1", "A1", "changed elsewhere")
+	if err := other.Save(); err != nil {
+		t.Fatal(err)
+	}
+	other.Close()
+
+	session.SetCells([]CellWrite{{Sheet: "Sheet1", Cell: "A1", Value: "mine"}})
+	if _, err := session.Save(); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("Save() = %v, want ErrChecksumMismatch", err)
+	}
+}
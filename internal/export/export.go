@@ -0,0 +1,294 @@
+package export
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+type Format string
+
+const (
+	FormatCSV     Format = "csv"
+	FormatNDJSON  Format = "ndjson"
+	FormatParquet Format = "parquet"
+)
+
+// ParseFormat accepts a format name or a file extension such as ".jsonl".
+func ParseFormat(name string) (Format, error) {
+	switch strings.ToLower(strings.TrimPrefix(name, ".")) {
+	case "csv":
+		return FormatCSV, nil
+	case "ndjson", "jsonl", "json":
+		return FormatNDJSON, nil
+	case "parquet", "pq":
+		return FormatParquet, nil
+	}
+	return "", fmt.Errorf("unsupported export format: %s (expected csv, ndjson or parquet)", name)
+}
+
+type Options struct {
+	Format Format
+	// Delimiter separates CSV fields; 0 picks ';' for locales that write
+	// decimals with a comma and ',' otherwise
+	Delimiter rune
+	// Locale sets the CSV decimal separator, e.g. "fr-FR"
+	Locale string
+	// NoHeader leaves out the CSV header line
+	NoHeader bool
+	// RowGroupSize is the number of rows per Parquet row group; column
+	// types are inferred from the first one, and a later value that does
+	// not fit its column fails the export
+	RowGroupSize int
+}
+
+type Column struct {
+	Name string
+	Type string
+}
+
+type Result struct {
+	Rows    int64
+	Columns []Column
+	Bytes   int64
+}
+
+// rowWriter encodes rows in one format.
+type rowWriter interface {
+	writeRow(row []interface{}) error
+	close() (*Result, error)
+}
+
+// Write streams every row of src to w. Memory stays bounded by one row,
+// or one row group for Parquet, whatever the size of the source.
+func Write(ctx context.Context, src Source, w io.Writer, opts Options) (*Result, error) {
+	counter := &countingWriter{w: w}
+	buffered := bufio.NewWriterSize(counter, 64*1024)
+
+	var rw rowWriter
+	var err error
+	switch opts.Format {
+	case FormatCSV, "":
+		rw, err = newCSVWriter(buffered, src.Columns(), opts)
+	case FormatNDJSON:
+		rw = newNDJSONWriter(buffered, src.Columns())
+	case FormatParquet:
+		rw, err = newParquetWriter(buffered, src.Columns(), opts.RowGroupSize)
+	default:
+		err = fmt.Errorf("unsupported export format: %s", opts.Format)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for rows := 0; ; rows++ {
+		if rows%10000 == 0 {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+		}
+		row, err := src.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read row: %w", err)
+		}
+		if err := rw.writeRow(row); err != nil {
+			return nil, err
+		}
+	}
+
+	result, err := rw.close()
+	if err != nil {
+		return nil, err
+	}
+	if err := buffered.Flush(); err != nil {
+		return nil, err
+	}
+	result.Bytes = counter.n
+	return result, nil
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// Languages that write decimals with a comma
+var decimalCommaLanguages = map[string]bool{
+	"fr": true, "de": true, "es": true, "it": true, "pt": true, "nl": true,
+	"ru": true, "pl": true, "sv": true, "da": true, "fi": true, "nb": true,
+	"no": true, "cs": true, "sk": true, "tr": true, "el": true, "hu": true,
+	"ro": true, "uk": true, "bg": true, "hr": true, "sl": true, "lt": true,
+	"lv": true, "et": true, "id": true,
+}
+
+func decimalSeparator(locale string) byte {
+	language, _, _ := strings.Cut(strings.ToLower(locale), "-")
+	language, _, _ = strings.Cut(language, "_")
+	if decimalCommaLanguages[language] {
+		return ','
+	}
+	return '.'
+}
+
+type csvWriter struct {
+	w       *csv.Writer
+	decimal byte
+	record  []string
+	rows    int64
+	columns []string
+}
+
+func newCSVWriter(w io.Writer, columns []string, opts Options) (*csvWriter, error) {
+	decimal := decimalSeparator(opts.Locale)
+	delimiter := opts.Delimiter
+	if delimiter == 0 {
+		delimiter = ','
+		if decimal == ',' {
+			delimiter = ';'
+		}
+	}
+	if delimiter == rune(decimal) {
+		return nil, fmt.Errorf("delimiter %q is the decimal separator of locale %s", delimiter, opts.Locale)
+	}
+	if delimiter == '"' || delimiter == '\r' || delimiter == '\n' || delimiter == utf8.RuneError {
+		return nil, fmt.Errorf("invalid CSV delimiter %q", delimiter)
+	}
+
+	cw := csv.NewWriter(w)
+	cw.Comma = delimiter
+	writer := &csvWriter{w: cw, decimal: decimal, record: make([]string, len(columns)), columns: columns}
+	if !opts.NoHeader {
+		if err := cw.Write(columns); err != nil {
+			return nil, err
+		}
+	}
+	return writer, nil
+}
+
+func (c *csvWriter) writeRow(row []interface{}) error {
+	for i := range c.record {
+		c.record[i] = ""
+		if i >= len(row) || row[i] == nil {
+			continue
+		}
+		if num, ok := row[i].(float64); ok {
+			text := strconv.FormatFloat(num, 'f', -1, 64)
+			if c.decimal != '.' {
+				text = strings.Replace(text, ".", string(c.decimal), 1)
+			}
+			c.record[i] = text
+			continue
+		}
+		c.record[i] = formatText(row[i])
+	}
+	c.rows++
+	return c.w.Write(c.record)
+}
+
+func (c *csvWriter) close() (*Result, error) {
+	c.w.Flush()
+	if err := c.w.Error(); err != nil {
+		return nil, err
+	}
+	return &Result{Rows: c.rows, Columns: untypedColumns(c.columns)}, nil
+}
+
+// ndjsonWriter writes one JSON object per line, keys in column order.
+type ndjsonWriter struct {
+	w       io.Writer
+	keys    [][]byte
+	line    []byte
+	rows    int64
+	columns []string
+}
+
+func newNDJSONWriter(w io.Writer, columns []string) *ndjsonWriter {
+	keys := make([][]byte, len(columns))
+	for i, name := range columns {
+		keys[i], _ = json.Marshal(name)
+	}
+	return &ndjsonWriter{w: w, keys: keys, columns: columns}
+}
+
+func (n *ndjsonWriter) writeRow(row []interface{}) error {
+	n.line = append(n.line[:0], '{')
+	for i, key := range n.keys {
+		if i > 0 {
+			n.line = append(n.line, ',')
+		}
+		n.line = append(n.line, key...)
+		n.line = append(n.line, ':')
+
+		var value interface{}
+		if i < len(row) {
+			value = row[i]
+		}
+		switch value.(type) {
+		case Date, time.Time:
+			value = formatText(value)
+		}
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return fmt.Errorf("failed to encode %s: %w", n.columns[i], err)
+		}
+		n.line = append(n.line, encoded...)
+	}
+	n.line = append(n.line, '}', '\n')
+	n.rows++
+	_, err := n.w.Write(n.line)
+	return err
+}
+
+func (n *ndjsonWriter) close() (*Result, error) {
+	return &Result{Rows: n.rows, Columns: untypedColumns(n.columns)}, nil
+}
+
+func untypedColumns(names []string) []Column {
+	columns := make([]Column, len(names))
+	for i, name := range names {
+		columns[i] = Column{Name: name}
+	}
+	return columns
+}
+
+// ISO 8601 layouts of exported dates. Excel stores no time zone, so none
+// is written.
+const (
+	dateLayout      = "2006-01-02"
+	timestampLayout = "2006-01-02T15:04:05"
+)
+
+func formatText(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case Date:
+		return v.Format(dateLayout)
+	case time.Time:
+		if v.Nanosecond() >= int(time.Millisecond) {
+			return v.Format(timestampLayout + ".000")
+		}
+		return v.Format(timestampLayout)
+	case nil:
+		return ""
+	}
+	return fmt.Sprint(value)
+}
@@ -0,0 +1,85 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+)
+
+func TestWriteDates(t *testing.T) {
+	f := excelize.NewFile()
+	style := func(numFmt int, custom string) int {
+		s := &excelize.Style{NumFmt: numFmt}
+		if custom != "" {
+			s.CustomNumFmt = &custom
+		}
+		id, err := f.NewStyle(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+	f.SetSheetRow("Sheet1", "A1", &[]interface{}{"Jour", "Saisie", "Echeance", "Duree", "Montant"})
+	f.SetSheetRow("Sheet1", "A2", &[]interface{}{45747, 45747.6, 45748, 1.5, 12.5})
+	f.SetCellStyle("Sheet1", "A2", "A2", style(14, ""))
+	f.SetCellStyle("Sheet1", "B2", "B2", style(22, ""))
+	f.SetCellStyle("Sheet1", "C2", "C2", style(0, "dd/mm/yyyy"))
+	f.SetCellStyle("Sheet1", "D2", "D2", style(0, "[h]:mm"))
+	path := filepath.Join(t.TempDir(), "dates.xlsx")
+	if err := f.SaveAs(path); err != nil {
+		t.Fatal(err)
+	}
+
+	saved, err := excelize.OpenFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer saved.Close()
+
+	tests := []struct {
+		format Format
+		want   string
+	}{
+		{FormatCSV, "Jour,Saisie,Echeance,Duree,Montant\n2025-03-31,2025-03-31T14:24:00,2025-04-01,1.5,12.5\n"},
+		{FormatNDJSON, `{"Jour":"2025-03-31","Saisie":"2025-03-31T14:24:00","Echeance":"2025-04-01","Duree":1.5,"Montant":12.5}` + "\n"},
+	}
+
+	for _, tt := range tests {
+		src, err := OpenRange(saved, "Sheet1", "", true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out bytes.Buffer
+		_, err = Write(context.Background(), src, &out, Options{Format: tt.format, Delimiter: ','})
+		src.Close()
+		if err != nil {
+			t.Fatalf("%s: %v", tt.format, err)
+		}
+		if got := out.String(); got != tt.want {
+			t.Errorf("%s export = %q, want %q", tt.format, got, tt.want)
+		}
+	}
+}
+
+func TestFormatText(t *testing.T) {
+	tests := []struct {
+		value interface{}
+		want  string
+	}{
+		{nil, ""},
+		{"texte", "texte"},
+		{3.0, "3"},
+		{Date{time.Date(1900, 1, 1, 0, 0, 0, 0, time.UTC)}, "1900-01-01"},
+		{time.Date(2025, 3, 31, 8, 5, 0, 0, time.UTC), "2025-03-31T08:05:00"},
+		{time.Date(2025, 3, 31, 8, 5, 0, 250e6, time.UTC), "2025-03-31T08:05:00.250"},
+	}
+	for _, tt := range tests {
+		if got := formatText(tt.value); got != tt.want {
+			t.Errorf("formatText(%v) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,401 @@
+package export
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+// Rows per Parquet row group unless Options.RowGroupSize says otherwise
+const defaultRowGroupSize = 50000
+
+// Parquet physical types
+const (
+	parquetInt32     int32 = 1
+	parquetInt64     int32 = 2
+	parquetDouble    int32 = 5
+	parquetByteArray int32 = 6
+)
+
+// Parquet enum values used by the writer
+const (
+	pageTypeData         int32 = 0
+	encodingPlain        int32 = 0
+	encodingRLE          int32 = 3
+	repetitionOptional   int32 = 1
+	convertedTypeUTF8    int32 = 0
+	convertedTypeDate    int32 = 6
+	compressionNone      int32 = 0
+	parquetMagic               = "PAR1"
+	parquetFormatVersion       = 1
+)
+
+// Column types the writer infers
+type columnType int
+
+const (
+	typeString columnType = iota
+	typeInt64
+	typeDouble
+	// Days since the Unix epoch, as a DATE
+	typeDate
+	// Milliseconds since the Unix epoch, as a TIMESTAMP in local time
+	typeTimestamp
+)
+
+var columnTypes = map[columnType]struct {
+	name     string
+	physical int32
+}{
+	typeString:    {"string", parquetByteArray},
+	typeInt64:     {"int64", parquetInt64},
+	typeDouble:    {"double", parquetDouble},
+	typeDate:      {"date", parquetInt32},
+	typeTimestamp: {"timestamp", parquetInt64},
+}
+
+type columnChunk struct {
+	offset    int64
+	size      int64
+	numValues int64
+}
+
+type rowGroup struct {
+	numRows int64
+	chunks  []columnChunk
+}
+
+// parquetWriter writes an uncompressed Parquet file with one optional
+// column per source column and one PLAIN-encoded data page per column
+// chunk. Rows are buffered one row group at a time; column types are
+// inferred from the first row group, and a later value that does not fit
+// its column fails the export, as the groups written cannot be retyped.
+type parquetWriter struct {
+	w            io.Writer
+	offset       int64
+	columns      []string
+	types        []columnType
+	buffer       [][]interface{}
+	rowGroupSize int
+	groups       []rowGroup
+	rows         int64
+}
+
+func newParquetWriter(w io.Writer, columns []string, rowGroupSize int) (*parquetWriter, error) {
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("nothing to export: the source has no columns")
+	}
+	if rowGroupSize <= 0 {
+		rowGroupSize = defaultRowGroupSize
+	}
+
+	p := &parquetWriter{w: w, columns: columns, rowGroupSize: rowGroupSize}
+	if err := p.write([]byte(parquetMagic)); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *parquetWriter) write(data []byte) error {
+	n, err := p.w.Write(data)
+	p.offset += int64(n)
+	return err
+}
+
+func (p *parquetWriter) writeRow(row []interface{}) error {
+	p.buffer = append(p.buffer, row)
+	if len(p.buffer) >= p.rowGroupSize {
+		return p.flush()
+	}
+	return nil
+}
+
+func (p *parquetWriter) close() (*Result, error) {
+	if err := p.flush(); err != nil {
+		return nil, err
+	}
+	if p.types == nil {
+		p.types = inferTypes(nil, len(p.columns))
+	}
+
+	footer := p.fileMetaData()
+	var length [4]byte
+	binary.LittleEndian.PutUint32(length[:], uint32(len(footer)))
+	for _, part := range [][]byte{footer, length[:], []byte(parquetMagic)} {
+		if err := p.write(part); err != nil {
+			return nil, err
+		}
+	}
+
+	columns := make([]Column, len(p.columns))
+	for i, name := range p.columns {
+		columns[i] = Column{Name: name, Type: columnTypes[p.types[i]].name}
+	}
+	return &Result{Rows: p.rows, Columns: columns}, nil
+}
+
+// flush writes the buffered rows as a row group.
+func (p *parquetWriter) flush() error {
+	if len(p.buffer) == 0 {
+		return nil
+	}
+	if p.types == nil {
+		p.types = inferTypes(p.buffer, len(p.columns))
+	}
+
+	group := rowGroup{numRows: int64(len(p.buffer))}
+	for col := range p.columns {
+		levels, values, err := p.encodeColumn(col)
+		if err != nil {
+			return err
+		}
+
+		var page []byte
+		page = binary.LittleEndian.AppendUint32(page, uint32(len(levels)))
+		page = append(page, levels...)
+		page = append(page, values...)
+
+		header := pageHeader(len(page), len(p.buffer))
+		chunk := columnChunk{
+			offset:    p.offset,
+			size:      int64(len(header) + len(page)),
+			numValues: int64(len(p.buffer)),
+		}
+		if err := p.write(header); err != nil {
+			return err
+		}
+		if err := p.write(page); err != nil {
+			return err
+		}
+		group.chunks = append(group.chunks, chunk)
+	}
+
+	p.groups = append(p.groups, group)
+	p.rows += group.numRows
+	p.buffer = p.buffer[:0]
+	return nil
+}
+
+// inferTypes picks int64 for columns holding only whole numbers, double
+// for other numeric columns, date for columns of days, timestamp for
+// columns of days and times, and string for the rest, empty columns
+// included.
+func inferTypes(rows [][]interface{}, width int) []columnType {
+	types := make([]columnType, width)
+	for col := range types {
+		numbers, days, times, integral, other := 0, 0, 0, true, false
+		for _, row := range rows {
+			if col >= len(row) || row[col] == nil {
+				continue
+			}
+			switch v := row[col].(type) {
+			case float64:
+				numbers++
+				if !isInt64(v) {
+					integral = false
+				}
+			case Date:
+				days++
+			case time.Time:
+				times++
+			default:
+				other = true
+			}
+			if other {
+				break
+			}
+		}
+
+		switch {
+		case other || numbers+days+times == 0:
+			types[col] = typeString
+		case numbers > 0 && days+times > 0:
+			types[col] = typeString
+		case times > 0:
+			types[col] = typeTimestamp
+		case days > 0:
+			types[col] = typeDate
+		case integral:
+			types[col] = typeInt64
+		default:
+			types[col] = typeDouble
+		}
+	}
+	return types
+}
+
+func isInt64(num float64) bool {
+	return num == math.Trunc(num) && num >= math.MinInt64 && num < math.MaxInt64
+}
+
+// encodeColumn returns the definition levels (1 for a value, 0 for null)
+// in the RLE hybrid encoding, and the PLAIN-encoded values.
+func (p *parquetWriter) encodeColumn(col int) ([]byte, []byte, error) {
+	defined := make([]bool, len(p.buffer))
+	var values []byte
+
+	for i, row := range p.buffer {
+		if col >= len(row) || row[col] == nil {
+			continue
+		}
+		value := row[col]
+		num, isNum := value.(float64)
+
+		switch p.types[col] {
+		case typeInt64:
+			if !isNum || !isInt64(num) {
+				return nil, nil, p.misfit(col, i, value)
+			}
+			values = binary.LittleEndian.AppendUint64(values, uint64(int64(num)))
+		case typeDouble:
+			if !isNum {
+				return nil, nil, p.misfit(col, i, value)
+			}
+			values = binary.LittleEndian.AppendUint64(values, math.Float64bits(num))
+		case typeDate:
+			day, ok := value.(Date)
+			if !ok {
+				return nil, nil, p.misfit(col, i, value)
+			}
+			values = binary.LittleEndian.AppendUint32(values, uint32(int32(day.Unix()/86400)))
+		case typeTimestamp:
+			var t time.Time
+			switch v := value.(type) {
+			case Date:
+				t = v.Time
+			case time.Time:
+				t = v
+			default:
+				return nil, nil, p.misfit(col, i, value)
+			}
+			values = binary.LittleEndian.AppendUint64(values, uint64(t.UnixMilli()))
+		default:
+			text := formatText(value)
+			values = binary.LittleEndian.AppendUint32(values, uint32(len(text)))
+			values = append(values, text...)
+		}
+		defined[i] = true
+	}
+
+	return encodeLevels(defined), values, nil
+}
+
+// misfit reports a value of the buffered row i that does not fit the type
+// inferred for its column.
+func (p *parquetWriter) misfit(col, i int, value interface{}) error {
+	return fmt.Errorf("column %q was typed %s from the first %d rows, but row %d holds %q; raise row_group_size to cover it",
+		p.columns[col], columnTypes[p.types[col]].name, p.groups[0].numRows, p.rows+int64(i)+1, formatText(value))
+}
+
+// encodeLevels writes 1-bit definition levels as RLE runs.
+func encodeLevels(defined []bool) []byte {
+	var out []byte
+	for i := 0; i < len(defined); {
+		j := i
+		for j < len(defined) && defined[j] == defined[i] {
+			j++
+		}
+		out = binary.AppendUvarint(out, uint64(j-i)<<1)
+		if defined[i] {
+			out = append(out, 1)
+		} else {
+			out = append(out, 0)
+		}
+		i = j
+	}
+	return out
+}
+
+func pageHeader(size, numValues int) []byte {
+	c := &compactWriter{}
+	c.beginStruct()
+	c.i32Field(1, pageTypeData)
+	c.i32Field(2, int32(size)) // uncompressed_page_size
+	c.i32Field(3, int32(size)) // compressed_page_size
+	c.structField(5)           // data_page_header
+	c.i32Field(1, int32(numValues))
+	c.i32Field(2, encodingPlain)
+	c.i32Field(3, encodingRLE) // definition levels
+	c.i32Field(4, encodingRLE) // repetition levels
+	c.endStruct()
+	c.endStruct()
+	return c.Bytes()
+}
+
+func (p *parquetWriter) fileMetaData() []byte {
+	c := &compactWriter{}
+	c.beginStruct()
+	c.i32Field(1, parquetFormatVersion)
+
+	c.listField(2, thriftStruct, len(p.columns)+1) // schema
+	c.beginStruct()
+	c.stringField(4, "schema")
+	c.i32Field(5, int32(len(p.columns))) // num_children
+	c.endStruct()
+	for i, name := range p.columns {
+		c.beginStruct()
+		c.i32Field(1, columnTypes[p.types[i]].physical)
+		c.i32Field(3, repetitionOptional)
+		c.stringField(4, name)
+		switch p.types[i] {
+		case typeString:
+			c.i32Field(6, convertedTypeUTF8)
+		case typeDate:
+			c.i32Field(6, convertedTypeDate)
+			c.structField(10) // logicalType
+			c.structField(6)  // DATE
+			c.endStruct()
+			c.endStruct()
+		case typeTimestamp:
+			// Local time, which TIMESTAMP_MILLIS cannot say, so only
+			// the logical type is written
+			c.structField(10)     // logicalType
+			c.structField(8)      // TIMESTAMP
+			c.boolField(1, false) // isAdjustedToUTC
+			c.structField(2)      // unit
+			c.structField(1)      // MILLIS
+			c.endStruct()
+			c.endStruct()
+			c.endStruct()
+			c.endStruct()
+		}
+		c.endStruct()
+	}
+
+	c.i64Field(3, p.rows)
+
+	c.listField(4, thriftStruct, len(p.groups)) // row_groups
+	for _, group := range p.groups {
+		c.beginStruct()
+		c.listField(1, thriftStruct, len(group.chunks))
+		var total int64
+		for col, chunk := range group.chunks {
+			total += chunk.size
+			c.beginStruct()
+			c.i64Field(2, chunk.offset) // file_offset
+			c.structField(3)            // meta_data
+			c.i32Field(1, columnTypes[p.types[col]].physical)
+			c.listField(2, thriftI32, 2) // encodings
+			c.i32(encodingPlain)
+			c.i32(encodingRLE)
+			c.listField(3, thriftBinary, 1) // path_in_schema
+			c.str(p.columns[col])
+			c.i32Field(4, compressionNone)
+			c.i64Field(5, chunk.numValues)
+			c.i64Field(6, chunk.size) // total_uncompressed_size
+			c.i64Field(7, chunk.size) // total_compressed_size
+			c.i64Field(9, chunk.offset)
+			c.endStruct()
+			c.endStruct()
+		}
+		c.i64Field(2, total) // total_byte_size
+		c.i64Field(3, group.numRows)
+		c.endStruct()
+	}
+
+	c.stringField(6, "mcp-xlsm-server")
+	c.endStruct()
+	return c.Bytes()
+}
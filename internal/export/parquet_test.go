@@ -0,0 +1,208 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+// compactReader decodes Thrift compact structs into maps of field ID to
+// value, enough to read back the metadata the writer produces
+type compactReader struct {
+	data []byte
+	pos  int
+}
+
+func (r *compactReader) byte() byte {
+	b := r.data[r.pos]
+	r.pos++
+	return b
+}
+
+func (r *compactReader) uvarint() uint64 {
+	v, n := binary.Uvarint(r.data[r.pos:])
+	r.pos += n
+	return v
+}
+
+func (r *compactReader) readStruct() map[int16]interface{} {
+	fields := make(map[int16]interface{})
+	var last int16
+	for {
+		header := r.byte()
+		if header == 0 {
+			return fields
+		}
+		id := last + int16(header>>4)
+		if header>>4 == 0 {
+			id = int16(unzigzag(r.uvarint()))
+		}
+		last = id
+		fields[id] = r.value(header & 0x0f)
+	}
+}
+
+func (r *compactReader) value(typ byte) interface{} {
+	switch typ {
+	case thriftTrue:
+		return true
+	case thriftFalse:
+		return false
+	case thriftI32, thriftI64:
+		return unzigzag(r.uvarint())
+	case thriftBinary:
+		n := int(r.uvarint())
+		s := string(r.data[r.pos : r.pos+n])
+		r.pos += n
+		return s
+	case thriftList:
+		header := r.byte()
+		size := int(header >> 4)
+		if size == 15 {
+			size = int(r.uvarint())
+		}
+		list := make([]interface{}, size)
+		for i := range list {
+			list[i] = r.value(header & 0x0f)
+		}
+		return list
+	case thriftStruct:
+		return r.readStruct()
+	}
+	panic("unsupported thrift type")
+}
+
+func unzigzag(v uint64) int64 {
+	return int64(v>>1) ^ -int64(v&1)
+}
+
+type parquetFile struct {
+	data     []byte
+	metadata map[int16]interface{}
+}
+
+func readParquet(t *testing.T, data []byte) parquetFile {
+	t.Helper()
+	if !bytes.HasPrefix(data, []byte(parquetMagic)) || !bytes.HasSuffix(data, []byte(parquetMagic)) {
+		t.Fatalf("missing PAR1 magic")
+	}
+	size := int(binary.LittleEndian.Uint32(data[len(data)-8:]))
+	footer := &compactReader{data: data[len(data)-8-size : len(data)-8]}
+	return parquetFile{data: data, metadata: footer.readStruct()}
+}
+
+// schema returns the column schema elements, after the root
+func (f parquetFile) schema() []map[int16]interface{} {
+	var columns []map[int16]interface{}
+	for _, element := range f.metadata[2].([]interface{})[1:] {
+		columns = append(columns, element.(map[int16]interface{}))
+	}
+	return columns
+}
+
+// page returns the definition levels and values of a column chunk
+func (f parquetFile) page(group, col int) ([]byte, []byte) {
+	groups := f.metadata[4].([]interface{})
+	chunk := groups[group].(map[int16]interface{})[1].([]interface{})[col].(map[int16]interface{})
+	offset := int(chunk[3].(map[int16]interface{})[9].(int64))
+
+	r := &compactReader{data: f.data, pos: offset}
+	header := r.readStruct()
+	page := f.data[r.pos : r.pos+int(header[2].(int64))]
+	levels := int(binary.LittleEndian.Uint32(page))
+	return page[4 : 4+levels], page[4+levels:]
+}
+
+func TestParquetTypes(t *testing.T) {
+	day := func(y int, m time.Month, d int) Date { return Date{time.Date(y, m, d, 0, 0, 0, 0, time.UTC)} }
+	columns := []string{"Quantite", "Prix", "Libelle", "Echeance", "Saisie", "Melange"}
+	rows := [][]interface{}{
+		{3.0, 12.5, "Vis", day(2025, 1, 31), time.Date(2025, 1, 2, 9, 30, 0, 0, time.UTC), 1.0},
+		{nil, 7.0, nil, day(1969, 12, 31), day(2025, 1, 3), day(2025, 1, 3)},
+	}
+
+	var out bytes.Buffer
+	result, err := Write(context.Background(), NewSliceSource(columns, rows), &out, Options{Format: FormatParquet})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		physical  int64
+		converted interface{}
+		logical   int16
+	}{
+		{"int64", int64(parquetInt64), nil, 0},
+		{"double", int64(parquetDouble), nil, 0},
+		{"string", int64(parquetByteArray), int64(convertedTypeUTF8), 0},
+		{"date", int64(parquetInt32), int64(convertedTypeDate), 6},
+		{"timestamp", int64(parquetInt64), nil, 8},
+		{"string", int64(parquetByteArray), int64(convertedTypeUTF8), 0},
+	}
+
+	file := readParquet(t, out.Bytes())
+	if got := file.metadata[3].(int64); got != 2 {
+		t.Errorf("num_rows = %d, want 2", got)
+	}
+	schema := file.schema()
+	for i, tt := range tests {
+		if result.Columns[i].Type != tt.name {
+			t.Errorf("column %s typed %s, want %s", columns[i], result.Columns[i].Type, tt.name)
+		}
+		element := schema[i]
+		if element[4] != columns[i] || element[1] != tt.physical || element[6] != tt.converted {
+			t.Errorf("column %s schema = %v, want type %d converted %v", columns[i], element, tt.physical, tt.converted)
+		}
+		logical, _ := element[10].(map[int16]interface{})
+		if tt.logical == 0 && logical != nil || tt.logical != 0 && logical[tt.logical] == nil {
+			t.Errorf("column %s logical type = %v, want field %d", columns[i], logical, tt.logical)
+		}
+	}
+
+	// Local time: not adjusted to UTC, in milliseconds
+	timestamp := schema[4][10].(map[int16]interface{})[8].(map[int16]interface{})
+	if timestamp[1] != false || timestamp[2].(map[int16]interface{})[1] == nil {
+		t.Errorf("timestamp logical type = %v", timestamp)
+	}
+
+	_, values := file.page(0, 3)
+	if days := []int32{int32(binary.LittleEndian.Uint32(values)), int32(binary.LittleEndian.Uint32(values[4:]))}; days[0] != 20119 || days[1] != -1 {
+		t.Errorf("dates written as days %v, want [20119 -1]", days)
+	}
+	_, values = file.page(0, 4)
+	if ms := int64(binary.LittleEndian.Uint64(values)); ms != time.Date(2025, 1, 2, 9, 30, 0, 0, time.UTC).UnixMilli() {
+		t.Errorf("timestamp written as %d ms", ms)
+	}
+	levels, values := file.page(0, 1)
+	if len(levels) == 0 || math.Float64frombits(binary.LittleEndian.Uint64(values[8:])) != 7 {
+		t.Errorf("double column values %v", values)
+	}
+}
+
+func TestParquetRejectsLaterMisfits(t *testing.T) {
+	rows := [][]interface{}{{1.0}, {2.0}, {"trois"}, {4.0}}
+
+	var out bytes.Buffer
+	_, err := Write(context.Background(), NewSliceSource([]string{"N"}, rows), &out, Options{Format: FormatParquet, RowGroupSize: 2})
+	if err == nil || !strings.Contains(err.Error(), `column "N" was typed int64 from the first 2 rows, but row 3 holds "trois"`) {
+		t.Errorf("Write() error = %v, want the misfit reported", err)
+	}
+
+	// A row group covering every row types the column as string
+	out.Reset()
+	result, err := Write(context.Background(), NewSliceSource([]string{"N"}, rows), &out, Options{Format: FormatParquet, RowGroupSize: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Columns[0].Type != "string" || result.Rows != 4 {
+		t.Errorf("result = %+v, want a string column over 4 rows", result)
+	}
+	if _, values := readParquet(t, out.Bytes()).page(0, 0); !bytes.Contains(values, []byte("trois")) {
+		t.Errorf("values %q do not hold every row", values)
+	}
+}
@@ -0,0 +1,258 @@
+package export
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+
+	"mcp-xlsm-server/internal/analytics"
+	"mcp-xlsm-server/internal/workbook"
+)
+
+// Source yields the rows to export one at a time. Values are float64,
+// string, Date, time.Time or nil. Next returns io.EOF after the last row.
+type Source interface {
+	Columns() []string
+	Next() ([]interface{}, error)
+	Close() error
+}
+
+// rangeSource streams a rectangle of a sheet through the excelize row
+// iterator, so only the current row is held in memory.
+type rangeSource struct {
+	rows     *excelize.Rows
+	dates    *workbook.CellDates
+	columns  []string
+	rowNum   int
+	startCol int
+	startRow int
+	endRow   int
+	width    int
+}
+
+// OpenRange streams rangeRef ("B3:F120") of sheet, or the whole sheet when
+// rangeRef is empty. With hasHeader the first non-empty row gives the
+// column names; otherwise columns are named after their letters. Empty
+// rows are skipped and values are read as stored, not as displayed, except
+// that cells formatted as dates are read as Date, or as time.Time when
+// they show a time of day too.
+func OpenRange(file *excelize.File, sheet, rangeRef string, hasHeader bool) (Source, error) {
+	if idx, _ := file.GetSheetIndex(sheet); idx < 0 {
+		return nil, fmt.Errorf("unknown sheet: %s", sheet)
+	}
+
+	src := &rangeSource{startCol: 1, startRow: 1}
+	if rangeRef != "" {
+		startCol, startRow, endCol, endRow, err := analytics.ParseRange(rangeRef)
+		if err != nil {
+			return nil, err
+		}
+		src.startCol, src.startRow, src.endRow = startCol, startRow, endRow
+		src.width = endCol - startCol + 1
+	} else {
+		width, err := sheetWidth(file, sheet)
+		if err != nil {
+			return nil, err
+		}
+		src.width = width
+	}
+
+	rows, err := file.Rows(sheet)
+	if err != nil {
+		return nil, err
+	}
+	src.rows = rows
+	// After Rows, which saves pending changes to the sheet part
+	src.dates = workbook.NewCellDates(file, sheet)
+
+	var header []interface{}
+	if hasHeader {
+		header, err = src.Next()
+		if err != nil && err != io.EOF {
+			src.Close()
+			return nil, err
+		}
+	}
+	src.columns = ColumnNames(header, src.startCol, src.width)
+
+	return src, nil
+}
+
+func (s *rangeSource) Columns() []string {
+	return s.columns
+}
+
+func (s *rangeSource) Next() ([]interface{}, error) {
+	for s.rows.Next() {
+		s.rowNum++
+		if s.rowNum < s.startRow {
+			continue
+		}
+		if s.endRow > 0 && s.rowNum > s.endRow {
+			break
+		}
+
+		cells, err := s.rows.Columns(excelize.Options{RawCellValue: true})
+		if err != nil {
+			return nil, err
+		}
+
+		dates := s.dates.Row(s.rowNum)
+		row := make([]interface{}, s.width)
+		empty := true
+		for i := range row {
+			colIdx := s.startCol - 1 + i
+			if colIdx >= len(cells) {
+				break
+			}
+			row[i] = parseValue(cells[colIdx])
+			if row[i] != nil {
+				empty = false
+			}
+			if colIdx < len(dates) {
+				row[i] = dateValue(row[i], dates[colIdx], s.dates.Date1904)
+			}
+		}
+		if !empty {
+			return row, nil
+		}
+	}
+	if err := s.rows.Error(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
+
+func (s *rangeSource) Close() error {
+	s.dates.Close()
+	return s.rows.Close()
+}
+
+// sheetWidth is the column count of the used range. Sheets written without
+// a dimension element are scanned once instead.
+func sheetWidth(file *excelize.File, sheet string) (int, error) {
+	if dimension, err := file.GetSheetDimension(sheet); err == nil && dimension != "" {
+		if _, _, endCol, _, err := analytics.ParseRange(dimension); err == nil && endCol > 1 {
+			return endCol, nil
+		}
+	}
+
+	rows, err := file.Rows(sheet)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	width := 0
+	for rows.Next() {
+		cells, err := rows.Columns(excelize.Options{RawCellValue: true})
+		if err != nil {
+			return 0, err
+		}
+		for i := len(cells); i > width; i-- {
+			if cells[i-1] != "" {
+				width = i
+				break
+			}
+		}
+	}
+	return width, rows.Error()
+}
+
+// sliceSource serves rows already in memory, such as a query result set.
+type sliceSource struct {
+	columns []string
+	rows    [][]interface{}
+	next    int
+}
+
+// NewSliceSource exports rows held in memory. Rows are padded or cut to
+// the number of columns.
+func NewSliceSource(columns []string, rows [][]interface{}) Source {
+	return &sliceSource{columns: columns, rows: rows}
+}
+
+func (s *sliceSource) Columns() []string {
+	return s.columns
+}
+
+func (s *sliceSource) Next() ([]interface{}, error) {
+	if s.next >= len(s.rows) {
+		return nil, io.EOF
+	}
+	row := make([]interface{}, len(s.columns))
+	copy(row, s.rows[s.next])
+	s.next++
+	return row, nil
+}
+
+func (s *sliceSource) Close() error {
+	return nil
+}
+
+// ColumnNames names width columns from a header row: blank headers take
+// the column letter and duplicates get a numeric suffix, so every name is
+// unique. firstCol is the 1-based sheet column of the first one.
+func ColumnNames(header []interface{}, firstCol, width int) []string {
+	names := make([]string, width)
+	seen := make(map[string]int)
+	for i := range names {
+		name := ""
+		if i < len(header) && header[i] != nil {
+			name = strings.TrimSpace(formatText(header[i]))
+		}
+		if name == "" {
+			name, _ = excelize.ColumnNumberToName(firstCol + i)
+		}
+		key := strings.ToLower(name)
+		if n := seen[key]; n > 0 {
+			seen[key] = n + 1
+			name = fmt.Sprintf("%s_%d", name, n+1)
+		} else {
+			seen[key] = 1
+		}
+		names[i] = name
+	}
+	return names
+}
+
+// Date is a calendar day, exported without a time of day
+type Date struct {
+	time.Time
+}
+
+// dateValue reads the serial of a cell formatted as a date as the day, or
+// the day and time, it shows. Times of day alone stay numbers.
+func dateValue(value interface{}, kind workbook.DateKind, date1904 bool) interface{} {
+	serial, ok := value.(float64)
+	if !ok || (kind != workbook.DateOnly && kind != workbook.DateTime) {
+		return value
+	}
+	t, err := excelize.ExcelDateToTime(serial, date1904)
+	if err != nil {
+		return value
+	}
+	if kind == workbook.DateOnly {
+		return Date{time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)}
+	}
+	return t
+}
+
+// parseValue reads a raw cell value as a number when it is one. Codes such
+// as "00123" or long account numbers stay text so they survive the export.
+func parseValue(cell string) interface{} {
+	text := strings.TrimSpace(cell)
+	if text == "" {
+		return nil
+	}
+	if analytics.IsCode(text) {
+		return cell
+	}
+	if num, ok := analytics.ParseNumber(text); ok {
+		return num
+	}
+	return cell
+}
@@ -0,0 +1,110 @@
+package export
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// Thrift compact protocol type codes, as used by the Parquet metadata
+const (
+	thriftTrue   byte = 1
+	thriftFalse  byte = 2
+	thriftI32    byte = 5
+	thriftI64    byte = 6
+	thriftBinary byte = 8
+	thriftList   byte = 9
+	thriftStruct byte = 12
+)
+
+// compactWriter encodes Thrift structs with the compact protocol. Field
+// IDs are written as deltas from the previous field of the same struct, so
+// nested structs keep a stack of the last IDs.
+type compactWriter struct {
+	buf  bytes.Buffer
+	last []int16
+}
+
+func (c *compactWriter) Bytes() []byte {
+	return c.buf.Bytes()
+}
+
+func (c *compactWriter) beginStruct() {
+	c.last = append(c.last, 0)
+}
+
+func (c *compactWriter) endStruct() {
+	c.buf.WriteByte(0) // stop field
+	c.last = c.last[:len(c.last)-1]
+}
+
+func (c *compactWriter) fieldHeader(id int16, typ byte) {
+	last := &c.last[len(c.last)-1]
+	if delta := id - *last; delta > 0 && delta <= 15 {
+		c.buf.WriteByte(byte(delta)<<4 | typ)
+	} else {
+		c.buf.WriteByte(typ)
+		c.varint(zigzag(int64(id)))
+	}
+	*last = id
+}
+
+// boolField carries its value in the field type
+func (c *compactWriter) boolField(id int16, v bool) {
+	if v {
+		c.fieldHeader(id, thriftTrue)
+	} else {
+		c.fieldHeader(id, thriftFalse)
+	}
+}
+
+func (c *compactWriter) i32Field(id int16, v int32) {
+	c.fieldHeader(id, thriftI32)
+	c.varint(zigzag(int64(v)))
+}
+
+func (c *compactWriter) i64Field(id int16, v int64) {
+	c.fieldHeader(id, thriftI64)
+	c.varint(zigzag(v))
+}
+
+func (c *compactWriter) stringField(id int16, v string) {
+	c.fieldHeader(id, thriftBinary)
+	c.str(v)
+}
+
+// structField opens a nested struct; close it with endStruct.
+func (c *compactWriter) structField(id int16) {
+	c.fieldHeader(id, thriftStruct)
+	c.beginStruct()
+}
+
+// listField starts a list of size elements of elemType, which follow as
+// i32, str or beginStruct/endStruct calls.
+func (c *compactWriter) listField(id int16, elemType byte, size int) {
+	c.fieldHeader(id, thriftList)
+	if size < 15 {
+		c.buf.WriteByte(byte(size)<<4 | elemType)
+	} else {
+		c.buf.WriteByte(0xf0 | elemType)
+		c.varint(uint64(size))
+	}
+}
+
+func (c *compactWriter) i32(v int32) {
+	c.varint(zigzag(int64(v)))
+}
+
+func (c *compactWriter) str(v string) {
+	c.varint(uint64(len(v)))
+	c.buf.WriteString(v)
+}
+
+func (c *compactWriter) varint(v uint64) {
+	var tmp [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(tmp[:], v)
+	c.buf.Write(tmp[:n])
+}
+
+func zigzag(v int64) uint64 {
+	return uint64((v << 1) ^ (v >> 63))
+}
@@ -11,6 +11,7 @@ import (
 	"github.com/xuri/excelize/v2"
 
 	"mcp-xlsm-server/internal/models"
+	"mcp-xlsm-server/internal/workbook"
 )
 
 type Manager struct {
@@ -21,6 +22,11 @@ type Manager struct {
 	lastUpdate  time.Time
 	mu          sync.RWMutex
 	deltaBuffer []models.Delta
+	// source is the workbook path sheets are re-read from when a delta
+	// needs more than the values it carries, opened with options
+	source     string
+	options    workbook.Options
+	rebuilding map[string]bool
 }
 
 type Location struct {
@@ -73,6 +79,21 @@ func NewManager() *Manager {
 		spatial:  NewQuadTree(Rectangle{0, 0, 1000, 1000}, 10),
 		bloom:    bloomFilter,
 		deltaBuffer: make([]models.Delta, 0),
+		rebuilding:  make(map[string]bool),
+	}
+}
+
+// SetSource records the workbook the index was built from, so that sheet
+// level deltas can re-read it. opts, such as the password of an encrypted
+// workbook, are passed to workbook.Open.
+func (idx *Manager) SetSource(path string, opts ...workbook.Options) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.source = path
+	idx.options = workbook.Options{}
+	if len(opts) > 0 {
+		idx.options = opts[0]
 	}
 }
 
@@ -106,6 +127,43 @@ func (idx *Manager) indexSheet(file *excelize.File, sheetName string) error {
 		return err
 	}
 
+	idx.indexRows(sheetName, rows)
+
+	comments, err := workbook.Comments(file, sheetName)
+	if err != nil {
+		return err
+	}
+	idx.indexComments(sheetName, comments)
+	return nil
+}
+
+// indexComments makes comment and reply text searchable at the cell
+// carrying the comment. Words go into the bloom filter too, so a word of
+// a longer comment is not rejected before the inverted index is read.
+func (idx *Manager) indexComments(sheetName string, comments []models.CellComment) {
+	for _, comment := range comments {
+		col, row, err := excelize.CellNameToCoordinates(comment.Cell)
+		if err != nil {
+			continue
+		}
+		loc := Location{SheetName: sheetName, CellRef: comment.Cell, Row: row, Col: col}
+
+		texts := []string{comment.Text}
+		for _, reply := range comment.Replies {
+			texts = append(texts, reply.Text)
+		}
+		for _, text := range texts {
+			idx.addToInverted(text, loc)
+			idx.bloom.Add([]byte(text))
+			for _, word := range strings.Fields(text) {
+				idx.bloom.Add([]byte(word))
+				idx.bloom.Add([]byte(strings.ToLower(word)))
+			}
+		}
+	}
+}
+
+func (idx *Manager) indexRows(sheetName string, rows [][]string) {
 	for rowIdx, row := range rows {
 		for colIdx, cellValue := range row {
 			if cellValue == "" {
@@ -145,30 +203,119 @@ func (idx *Manager) indexSheet(file *excelize.File, sheetName string) error {
 			idx.bloom.Add([]byte(cellValue))
 		}
 	}
+}
 
+// removeSheet drops every entry of a sheet. The bloom filter cannot
+// forget values, which only costs extra lookups.
+func (idx *Manager) removeSheet(sheetName string) {
+	var stale []btree.Item
+	idx.primary.Ascend(func(item btree.Item) bool {
+		if numKey, ok := item.(NumericKey); ok && numKey.Loc.SheetName == sheetName {
+			stale = append(stale, item)
+		}
+		return true
+	})
+	for _, item := range stale {
+		idx.primary.Delete(item)
+	}
+
+	for token, locations := range idx.inverted {
+		kept := locations[:0]
+		for _, loc := range locations {
+			if loc.SheetName != sheetName {
+				kept = append(kept, loc)
+			}
+		}
+		if len(kept) == 0 {
+			delete(idx.inverted, token)
+		} else {
+			idx.inverted[token] = kept
+		}
+	}
+
+	idx.spatial.RemoveSheet(sheetName)
+}
+
+// reindexSheet replaces a sheet's entries with its current content in the
+// source workbook. Callers hold the write lock.
+func (idx *Manager) reindexSheet(sheetName string) error {
+	rows, comments, err := readSheet(idx.source, idx.options, sheetName)
+	if err != nil {
+		return err
+	}
+
+	idx.removeSheet(sheetName)
+	idx.indexRows(sheetName, rows)
+	idx.indexComments(sheetName, comments)
 	return nil
 }
 
+func readSheet(source string, options workbook.Options, sheetName string) ([][]string, []models.CellComment, error) {
+	if source == "" {
+		return nil, nil, fmt.Errorf("index has no source workbook")
+	}
+
+	file, err := workbook.Open(source, options)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+
+	rows, err := file.GetRows(sheetName)
+	if err != nil {
+		return nil, nil, err
+	}
+	comments, err := workbook.Comments(file, sheetName)
+	if err != nil {
+		return nil, nil, err
+	}
+	return rows, comments, nil
+}
+
 func (idx *Manager) UpdateDelta(changes []models.Delta) error {
 	idx.mu.Lock()
 	defer idx.mu.Unlock()
 
+	// Retry deltas that could not be applied earlier
+	if len(idx.deltaBuffer) > 0 {
+		changes = append(idx.deltaBuffer, changes...)
+		idx.deltaBuffer = make([]models.Delta, 0)
+	}
+
 	for _, change := range changes {
 		switch change.Type {
 		case models.CellUpdate:
 			idx.updateCellIndexes(change)
 
 		case models.SheetAdd:
-			// Handle new sheet - would need file access
-			idx.deltaBuffer = append(idx.deltaBuffer, change)
+			if err := idx.reindexSheet(change.SheetID); err != nil {
+				// Keep it for a later rebuild
+				idx.deltaBuffer = append(idx.deltaBuffer, change)
+			}
+
+		case models.SheetRemove:
+			idx.removeSheet(change.SheetID)
+
+		case models.SheetRename:
+			if oldName, ok := change.OldValue.(string); ok {
+				idx.removeSheet(oldName)
+			}
+			if err := idx.reindexSheet(change.SheetID); err != nil {
+				idx.deltaBuffer = append(idx.deltaBuffer, change)
+			}
 
 		case models.FormulaChange:
 			idx.updateFormulaDependencies(change)
 
-		case models.BulkChange:
+		case models.BulkChange, models.RowInsert, models.RowDelete:
+			// Row shifts move every location below them, so they are
+			// handled like bulk changes
 			if change.AffectedCells > 1000 {
 				// Schedule partial rebuild
-				go idx.rebuildPartialAsync(change.SheetID)
+				if !idx.rebuilding[change.SheetID] {
+					idx.rebuilding[change.SheetID] = true
+					go idx.rebuildPartialAsync(change.SheetID)
+				}
 			} else {
 				idx.applyBulkChanges(change)
 			}
@@ -217,12 +364,45 @@ func (idx *Manager) updateFormulaDependencies(change models.Delta) {
 	// Simplified implementation - in production would parse formula dependencies
 }
 
+// applyBulkChanges re-reads the affected sheet; a delta covering many
+// cells does not carry their values.
 func (idx *Manager) applyBulkChanges(change models.Delta) {
-	// Apply multiple changes efficiently
+	if err := idx.reindexSheet(change.SheetID); err != nil {
+		idx.deltaBuffer = append(idx.deltaBuffer, change)
+	}
 }
 
+// rebuildPartialAsync reads the sheet without holding the lock, then swaps
+// its entries in.
 func (idx *Manager) rebuildPartialAsync(sheetID string) {
-	// Asynchronous partial rebuild for large changes
+	idx.mu.RLock()
+	source, options := idx.source, idx.options
+	idx.mu.RUnlock()
+
+	rows, comments, err := readSheet(source, options, sheetID)
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	delete(idx.rebuilding, sheetID)
+	if err != nil {
+		idx.deltaBuffer = append(idx.deltaBuffer, models.Delta{Type: models.BulkChange, SheetID: sheetID})
+		return
+	}
+
+	idx.removeSheet(sheetID)
+	idx.indexRows(sheetID, rows)
+	idx.indexComments(sheetID, comments)
+	idx.lastUpdate = time.Now()
+}
+
+// RebuildPending reports whether an asynchronous sheet rebuild is still
+// running or a sheet delta is waiting to be retried.
+func (idx *Manager) RebuildPending() bool {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	return len(idx.rebuilding) > 0 || len(idx.deltaBuffer) > 0
 }
 
 func (idx *Manager) addToInverted(text string, loc Location) {
@@ -375,6 +555,23 @@ func (qt *QuadTree) Update(point SpatialPoint) {
 	qt.Insert(point)
 }
 
+// RemoveSheet drops the points of a sheet from the tree.
+func (qt *QuadTree) RemoveSheet(sheetName string) {
+	kept := qt.points[:0]
+	for _, point := range qt.points {
+		if point.Loc.SheetName != sheetName {
+			kept = append(kept, point)
+		}
+	}
+	qt.points = kept
+
+	if qt.children[0] != nil {
+		for i := 0; i < 4; i++ {
+			qt.children[i].RemoveSheet(sheetName)
+		}
+	}
+}
+
 func (qt *QuadTree) contains(point SpatialPoint) bool {
 	return point.X >= qt.bounds.X && point.X < qt.bounds.X+qt.bounds.Width &&
 		   point.Y >= qt.bounds.Y && point.Y < qt.bounds.Y+qt.bounds.Height
@@ -507,6 +704,7 @@ func (idx *Manager) GetStats() map[string]interface{} {
 		"spatial_points":     idx.spatial.countPoints(),
 		"last_update":        idx.lastUpdate,
 		"delta_buffer_size":  len(idx.deltaBuffer),
+		"rebuilds_pending":   len(idx.rebuilding),
 	}
 }
 
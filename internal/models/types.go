@@ -54,11 +54,103 @@ type ChunkingStrategy struct {
 
 type FileMetadata struct {
 	Checksum         string    `json:"checksum"`
+	Format           string    `json:"format"`
+	Encryption       string    `json:"encryption,omitempty"`
 	FileSize         int64     `json:"file_size"`
 	SheetsCount      int       `json:"sheets_count"`
 	Timestamp        time.Time `json:"timestamp"`
 	ComplexityScore  float64   `json:"complexity_score"`
 	MemoryEstimate   int64     `json:"memory_estimate"`
+	WorkbookProtection *WorkbookProtection `json:"workbook_protection,omitempty"`
+	Sheets           []SheetProperties `json:"sheets"`
+	PivotCaches      []PivotCacheInfo  `json:"pivot_caches,omitempty"`
+}
+
+// Workbook structure protection
+type WorkbookProtection struct {
+	LockStructure bool `json:"lock_structure"`
+	LockWindows   bool `json:"lock_windows"`
+	HasPassword   bool `json:"has_password"`
+}
+
+// Sheet visibility is visible, hidden or veryHidden (only unhidden from VBA)
+type SheetProperties struct {
+	Name        string           `json:"name"`
+	Visibility  string           `json:"visibility"`
+	TabColor    string           `json:"tab_color,omitempty"`
+	Protection  *SheetProtection `json:"protection,omitempty"`
+	Charts      []ChartInfo      `json:"charts,omitempty"`
+	PivotTables []PivotTableInfo `json:"pivot_tables,omitempty"`
+}
+
+// Chart drawn on a sheet. Type joins the plot types of combined charts,
+// e.g. column+line; Anchor is the cell under its top-left corner.
+type ChartInfo struct {
+	Name   string        `json:"name,omitempty"`
+	Type   string        `json:"type"`
+	Title  string        `json:"title,omitempty"`
+	Anchor string        `json:"anchor,omitempty"`
+	Series []ChartSeries `json:"series"`
+}
+
+// Chart series and the ranges it reads; scatter and bubble charts give
+// their X values as Categories
+type ChartSeries struct {
+	Name       string `json:"name,omitempty"`
+	NameRef    string `json:"name_ref,omitempty"`
+	Categories string `json:"categories,omitempty"`
+	Values     string `json:"values,omitempty"`
+}
+
+// Pivot table and the cache it summarizes
+type PivotTableInfo struct {
+	Name         string            `json:"name"`
+	Location     string            `json:"location"`
+	CacheID      int               `json:"cache_id"`
+	SourceType   string            `json:"source_type"`
+	Source       string            `json:"source,omitempty"`
+	RowFields    []string          `json:"row_fields"`
+	ColumnFields []string          `json:"column_fields"`
+	FilterFields []string          `json:"filter_fields,omitempty"`
+	ValueFields  []PivotValueField `json:"value_fields"`
+	RecordCount  int               `json:"record_count"`
+}
+
+type PivotValueField struct {
+	Name     string `json:"name"`
+	Field    string `json:"field"`
+	Function string `json:"function"`
+}
+
+// Pivot cache: a copy of the source data saved with the workbook, which
+// sql_query reads as the relation named Relation
+type PivotCacheInfo struct {
+	ID          int      `json:"id"`
+	SourceType  string   `json:"source_type"`
+	Source      string   `json:"source,omitempty"`
+	Fields      []string `json:"fields"`
+	RecordCount int      `json:"record_count"`
+	HasRecords  bool     `json:"has_records"`
+	Relation    string   `json:"relation,omitempty"`
+}
+
+// Protection of a sheet. LockedRanges cover the locked cells holding a
+// value or formula, UnlockedRanges the cells and whole rows or columns
+// left open for input; both are capped and flagged as truncated.
+type SheetProtection struct {
+	HasPassword     bool             `json:"has_password"`
+	AllowedActions  []string         `json:"allowed_actions"`
+	LockedRanges    []string         `json:"locked_ranges,omitempty"`
+	UnlockedRanges  []string         `json:"unlocked_ranges,omitempty"`
+	RangesTruncated bool             `json:"ranges_truncated,omitempty"`
+	ProtectedRanges []ProtectedRange `json:"protected_ranges,omitempty"`
+}
+
+// Range editable under sheet protection, with its own password if any
+type ProtectedRange struct {
+	Name        string `json:"name"`
+	Range       string `json:"range"`
+	HasPassword bool   `json:"has_password"`
 }
 
 type PatternsDetected struct {
@@ -87,11 +179,54 @@ type AnalyzeFileResponse struct {
 	PatternsDetected PatternsDetected   `json:"patterns_detected"`
 	TokenManagement  TokenManagement    `json:"token_management"`
 	IndexSummary     IndexSummary       `json:"index_summary"`
+	ExternalDependencies ExternalDependencies `json:"external_dependencies"`
 	NextCursor       string             `json:"next_cursor"`
 	HasMore          bool               `json:"has_more"`
 	Performance      PerformanceMetrics `json:"performance_metrics"`
 }
 
+// Files and addresses a workbook depends on: linked workbooks used by
+// formulas and hyperlink targets
+type ExternalDependencies struct {
+	Links               []ExternalLink `json:"links"`
+	Hyperlinks          []Hyperlink    `json:"hyperlinks"`
+	HyperlinksTotal     int            `json:"hyperlinks_total"`
+	HyperlinksTruncated bool           `json:"hyperlinks_truncated,omitempty"`
+	BrokenLinks         int            `json:"broken_links"`
+}
+
+// External link part; formulas refer to it as [Index]Sheet!A1. Status is
+// found, missing or remote, and empty for DDE links.
+type ExternalLink struct {
+	Index          int             `json:"index"`
+	Part           string          `json:"part"`
+	Kind           string          `json:"kind"`
+	Target         string          `json:"target"`
+	ResolvedPath   string          `json:"resolved_path,omitempty"`
+	Status         string          `json:"status,omitempty"`
+	Sheets         []string        `json:"sheets,omitempty"`
+	DefinedNames   []string        `json:"defined_names,omitempty"`
+	References     int             `json:"references"`
+	Cells          []LinkReference `json:"cells"`
+	CellsTruncated bool            `json:"cells_truncated,omitempty"`
+}
+
+// Formula using an external link; Cell is a range for shared formulas
+type LinkReference struct {
+	Cell    string `json:"cell"`
+	Formula string `json:"formula"`
+}
+
+// Cell hyperlink to a URL or file (Target) or to a place in the workbook
+// (Location). Status is set for file targets only.
+type Hyperlink struct {
+	Cell     string `json:"cell"`
+	Target   string `json:"target,omitempty"`
+	Location string `json:"location,omitempty"`
+	Display  string `json:"display,omitempty"`
+	Status   string `json:"status,omitempty"`
+}
+
 // Sheet metadata for navigation
 type SheetMetadata struct {
 	Rows          int     `json:"rows"`
@@ -109,12 +244,59 @@ type Zone struct {
 }
 
 type SheetIndex struct {
-	SheetID   string        `json:"sheet_id"`
-	Name      string        `json:"name"`
-	Metadata  SheetMetadata `json:"metadata"`
-	Zones     []Zone        `json:"zones"`
-	KeyPoints []string      `json:"key_points"`
-	HotZones  []string      `json:"hot_zones"`
+	SheetID            string                  `json:"sheet_id"`
+	Name               string                  `json:"name"`
+	Visibility         string                  `json:"visibility"`
+	MergedCells        []MergedRegion          `json:"merged_cells,omitempty"`
+	MergedCellsTotal   int                     `json:"merged_cells_total,omitempty"`
+	DataValidations    []DataValidationRule    `json:"data_validations,omitempty"`
+	ConditionalFormats []ConditionalFormatRule `json:"conditional_formats,omitempty"`
+	Charts             []ChartInfo             `json:"charts,omitempty"`
+	PivotTables        []PivotTableInfo        `json:"pivot_tables,omitempty"`
+	Metadata           SheetMetadata           `json:"metadata"`
+	Zones              []Zone                  `json:"zones"`
+	KeyPoints          []string                `json:"key_points"`
+	HotZones           []string                `json:"hot_zones"`
+	InputZones         []string                `json:"input_zones,omitempty"`
+	Role               *SheetRole              `json:"role,omitempty"`
+}
+
+// Role of a sheet in the workbook (input, calculation, report, data,
+// lookup or scratch), inferred from its content and the references
+// between sheets; Signals explain the choice
+type SheetRole struct {
+	Role         string   `json:"role"`
+	Confidence   float64  `json:"confidence"`
+	Signals      []string `json:"signals"`
+	References   []string `json:"references,omitempty"`
+	ReferencedBy []string `json:"referenced_by,omitempty"`
+}
+
+// Data validation rule. Source holds the allowed values of a list rule,
+// or the range or name they come from; other types compare the cell to
+// Formula1 and Formula2 with Operator.
+type DataValidationRule struct {
+	Ranges     []string `json:"ranges"`
+	Type       string   `json:"type"`
+	Operator   string   `json:"operator,omitempty"`
+	Source     string   `json:"source,omitempty"`
+	Formula1   string   `json:"formula1,omitempty"`
+	Formula2   string   `json:"formula2,omitempty"`
+	AllowBlank bool     `json:"allow_blank"`
+	Prompt     string   `json:"prompt,omitempty"`
+}
+
+// Conditional formatting rule: cellIs compares to Formulas with Operator,
+// expression applies when its formula is true, colorScale, dataBar and
+// iconSet grade the values
+type ConditionalFormatRule struct {
+	Ranges     []string `json:"ranges"`
+	Type       string   `json:"type"`
+	Operator   string   `json:"operator,omitempty"`
+	Formulas   []string `json:"formulas,omitempty"`
+	Text       string   `json:"text,omitempty"`
+	Priority   int      `json:"priority"`
+	StopIfTrue bool     `json:"stop_if_true,omitempty"`
 }
 
 type Connection struct {
@@ -141,6 +323,7 @@ type NavigationIndex struct {
 	InvalidationRequired bool          `json:"invalidation_required"`
 	ChunkInfo           ChunkInfo     `json:"chunk_info"`
 	SheetIndex          []SheetIndex  `json:"sheet_index"`
+	ReadingOrder        []string      `json:"reading_order"`
 	Connections         Connection    `json:"connections"`
 	SearchIndex         SearchIndex   `json:"search_index"`
 	DeltaTracking       DeltaTracking `json:"delta_tracking"`
@@ -193,12 +376,20 @@ type QueryExecution struct {
 	BloomFilterUsed bool     `json:"bloom_filter_used"`
 }
 
+// Match returned by query_data. With a format other than json_rows,
+// DataChunk holds the rows in that encoding, headers first, and Anchor is
+// the cell of the first header. A chunk shaped to the token budget comes
+// back as json_rows or csv, with Shaping reporting what was left out.
 type DataChunk struct {
-	Location   string      `json:"location"`
-	Window     string      `json:"window"`
-	DataChunk  interface{} `json:"data_chunk"`
-	Metadata   ChunkMetadata `json:"metadata"`
-	Context    Context     `json:"context"`
+	Location  string                 `json:"location"`
+	Window    string                 `json:"window"`
+	Format    string                 `json:"format,omitempty"`
+	Anchor    string                 `json:"anchor,omitempty"`
+	DataChunk interface{}            `json:"data_chunk"`
+	Constants map[string]interface{} `json:"constants,omitempty"`
+	Shaping   *ShapingReport         `json:"shaping,omitempty"`
+	Metadata  ChunkMetadata          `json:"metadata"`
+	Context   Context                `json:"context"`
 }
 
 type ChunkMetadata struct {
@@ -211,10 +402,22 @@ type Context struct {
 	Headers  []string               `json:"headers"`
 	Nearby   map[string]interface{} `json:"nearby"`
 	Formulas []string               `json:"formulas"`
+	Merged   []MergedRegion         `json:"merged,omitempty"`
+	Comments []CellComment          `json:"comments,omitempty"`
 }
 
+// Merged cell region; Value is the value of its top-left cell, shown
+// across the whole range
+type MergedRegion struct {
+	Range string `json:"range"`
+	Value string `json:"value"`
+}
+
+// FormatCosts gives the tokens the tabular matches would take in each
+// format, so the cheapest readable one can be asked for next time
 type QueryResults struct {
-	Data []DataChunk `json:"data"`
+	Data        []DataChunk    `json:"data"`
+	FormatCosts map[string]int `json:"format_costs,omitempty"`
 }
 
 type Statistics struct {
@@ -224,10 +427,13 @@ type Statistics struct {
 	FormulaEvaluations  []interface{} `json:"formula_evaluations"`
 }
 
+// Used counts every response of the session, this one included;
+// PreciseCount is this response alone
 type ModelContext struct {
 	Detected     string `json:"detected"`
 	Limit        int    `json:"limit"`
 	Used         int    `json:"used"`
+	Remaining    int    `json:"remaining"`
 	PreciseCount int    `json:"precise_count"`
 }
 
@@ -275,6 +481,10 @@ const (
 	SheetAdd      DeltaType = "sheet_add"
 	FormulaChange DeltaType = "formula_change"
 	BulkChange    DeltaType = "bulk_change"
+	SheetRemove   DeltaType = "sheet_remove"
+	SheetRename   DeltaType = "sheet_rename"
+	RowInsert     DeltaType = "row_insert"
+	RowDelete     DeltaType = "row_delete"
 )
 
 type Delta struct {
@@ -292,4 +502,348 @@ type HotEntry struct {
 	LastAccess  time.Time     `json:"last_access"`
 	TTL         time.Duration `json:"ttl"`
 	Size        int64         `json:"size"`
-}
\ No newline at end of file
+}
+// Anomaly detection
+type Anomaly struct {
+	Location   string                 `json:"location"`
+	Column     string                 `json:"column"`
+	Value      interface{}            `json:"value"`
+	Method     string                 `json:"method"`
+	Score      float64                `json:"score"`
+	Reason     string                 `json:"reason"`
+	RowContext map[string]interface{} `json:"row_context"`
+}
+
+// Tool 4 Response
+type DetectAnomaliesResponse struct {
+	Sheet          string         `json:"sheet"`
+	RowsScanned    int            `json:"rows_scanned"`
+	ColumnsScanned []string       `json:"columns_scanned"`
+	Anomalies      []Anomaly      `json:"anomalies"`
+	CountByMethod  map[string]int `json:"count_by_method"`
+	Truncated      bool           `json:"truncated"`
+}
+
+// SQL query over sheets and tables
+type SQLColumn struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// Tool 5 Response. With a token budget the page is shaped: Rows may be
+// replaced by CSV and Constants, and Shaping reports what was left out.
+type SQLQueryResponse struct {
+	Columns     []SQLColumn            `json:"columns"`
+	Rows        [][]interface{}        `json:"rows"`
+	CSV         string                 `json:"csv,omitempty"`
+	Constants   map[string]interface{} `json:"constants,omitempty"`
+	RowCount    int                    `json:"row_count"`
+	TotalRows   int                    `json:"total_rows"`
+	Relations   []string               `json:"relations"`
+	Shaping     *ShapingReport         `json:"shaping,omitempty"`
+	Pagination  Pagination             `json:"pagination"`
+	Performance QueryPerformance       `json:"performance"`
+}
+
+// How a table was fitted to a token budget: the steps applied in order,
+// what each one left out, and the rows returned out of the page
+type ShapingReport struct {
+	TokenBudget    int      `json:"token_budget"`
+	Tokens         int      `json:"tokens"`
+	Steps          []string `json:"steps"`
+	Omitted        []string `json:"omitted,omitempty"`
+	DroppedColumns []string `json:"dropped_columns,omitempty"`
+	RowsReturned   int      `json:"rows_returned"`
+	RowsTotal      int      `json:"rows_total"`
+	NextCursor     string   `json:"next_cursor,omitempty"`
+}
+
+// Lookup join between two sheets or tables
+type JoinStats struct {
+	LeftRows          int `json:"left_rows"`
+	RightRows         int `json:"right_rows"`
+	MatchedLeftRows   int `json:"matched_left_rows"`
+	UnmatchedLeftRows int `json:"unmatched_left_rows"`
+	DuplicateKeys     int `json:"duplicate_lookup_keys"`
+}
+
+// Tool 6 Response. With a token budget the page is shaped like sql_query.
+type JoinSheetsResponse struct {
+	Left        string                 `json:"left"`
+	Right       string                 `json:"right"`
+	JoinType    string                 `json:"join_type"`
+	Columns     []string               `json:"columns"`
+	Rows        [][]interface{}        `json:"rows"`
+	CSV         string                 `json:"csv,omitempty"`
+	Constants   map[string]interface{} `json:"constants,omitempty"`
+	RowCount    int                    `json:"row_count"`
+	TotalRows   int                    `json:"total_rows"`
+	Stats       JoinStats              `json:"stats"`
+	Shaping     *ShapingReport         `json:"shaping,omitempty"`
+	Pagination  Pagination             `json:"pagination"`
+	Performance QueryPerformance       `json:"performance"`
+}
+
+// Workbook comparison
+type DiffSummary struct {
+	SheetsAdded       int `json:"sheets_added"`
+	SheetsRemoved     int `json:"sheets_removed"`
+	SheetsRenamed     int `json:"sheets_renamed"`
+	SheetsModified    int `json:"sheets_modified"`
+	RowsInserted      int `json:"rows_inserted"`
+	RowsDeleted       int `json:"rows_deleted"`
+	CellsChanged      int `json:"cells_changed"`
+	FormulasChanged   int `json:"formulas_changed"`
+	RecalculatedCells int `json:"recalculated_cells"`
+	VBAModulesChanged int `json:"vba_modules_changed"`
+}
+
+type SheetDiff struct {
+	Sheet           string `json:"sheet"`
+	OldName         string `json:"old_name,omitempty"`
+	Status          string `json:"status"`
+	RowsInserted    int    `json:"rows_inserted"`
+	RowsDeleted     int    `json:"rows_deleted"`
+	CellsChanged    int    `json:"cells_changed"`
+	FormulasChanged int    `json:"formulas_changed"`
+}
+
+type VBAModuleDiff struct {
+	Module       string `json:"module"`
+	Status       string `json:"status"`
+	LinesAdded   int    `json:"lines_added"`
+	LinesRemoved int    `json:"lines_removed"`
+}
+
+// Tool 7 Response
+type DiffWorkbooksResponse struct {
+	BaseChecksum   string           `json:"base_checksum"`
+	TargetChecksum string           `json:"target_checksum"`
+	Summary        DiffSummary      `json:"summary"`
+	Sheets         []SheetDiff      `json:"sheets"`
+	VBAModules     []VBAModuleDiff  `json:"vba_modules"`
+	Changes        []Delta          `json:"changes"`
+	TotalChanges   int              `json:"total_changes"`
+	Pagination     Pagination       `json:"pagination"`
+	Performance    QueryPerformance `json:"performance"`
+}
+
+// Tools 8-11 Response; inside an edit transaction nothing is saved yet
+// and the checksums stay empty
+type WriteResponse struct {
+	Filepath     string           `json:"filepath"`
+	EditID       string           `json:"edit_id,omitempty"`
+	OldChecksum  string           `json:"old_checksum"`
+	NewChecksum  string           `json:"new_checksum"`
+	BackupPath   string           `json:"backup_path"`
+	Written      string           `json:"written,omitempty"`
+	Deltas       []Delta          `json:"deltas"`
+	IndexUpdated bool             `json:"index_updated"`
+	Warning      string           `json:"warning,omitempty"`
+	Performance  QueryPerformance `json:"performance"`
+}
+
+type RecalculatedCell struct {
+	Location string `json:"location"`
+	Formula  string `json:"formula"`
+	OldValue string `json:"old_value"`
+	NewValue string `json:"new_value"`
+	Error    string `json:"error,omitempty"`
+}
+
+// Tool 12 Response (begin_edit, rollback_edit)
+type EditStatus struct {
+	EditID       string    `json:"edit_id"`
+	Filepath     string    `json:"filepath"`
+	BaseChecksum string    `json:"base_checksum"`
+	Steps        int       `json:"steps"`
+	StartedAt    time.Time `json:"started_at"`
+	ExpiresAt    time.Time `json:"expires_at"`
+	State        string    `json:"state"`
+}
+
+// Tool 13 Response
+type PreviewEditResponse struct {
+	EditID            string             `json:"edit_id"`
+	BaseChecksum      string             `json:"base_checksum"`
+	Summary           DiffSummary        `json:"summary"`
+	Sheets            []SheetDiff        `json:"sheets"`
+	Changes           []Delta            `json:"changes"`
+	TotalChanges      int                `json:"total_changes"`
+	Recalculated      []RecalculatedCell `json:"recalculated"`
+	TotalRecalculated int                `json:"total_recalculated"`
+	Performance       QueryPerformance   `json:"performance"`
+}
+
+// ExportColumn types are only set for Parquet: int64, double, string,
+// date or timestamp
+type ExportColumn struct {
+	Name string `json:"name"`
+	Type string `json:"type,omitempty"`
+}
+
+// Tool 16 Response
+type ExportResponse struct {
+	Filepath    string           `json:"filepath"`
+	Source      string           `json:"source"`
+	Format      string           `json:"format"`
+	OutputPath  string           `json:"output_path,omitempty"`
+	Rows        int64            `json:"rows"`
+	Columns     []ExportColumn   `json:"columns"`
+	Bytes       int64            `json:"bytes"`
+	Performance QueryPerformance `json:"performance"`
+}
+
+// Cell comment: a legacy note, or a threaded comment with its replies
+type CellComment struct {
+	Sheet    string         `json:"sheet"`
+	Cell     string         `json:"cell"`
+	Kind     string         `json:"kind"`
+	Author   string         `json:"author"`
+	Text     string         `json:"text"`
+	Date     string         `json:"date,omitempty"`
+	Resolved bool           `json:"resolved,omitempty"`
+	Replies  []CommentReply `json:"replies,omitempty"`
+}
+
+type CommentReply struct {
+	Author string `json:"author"`
+	Text   string `json:"text"`
+	Date   string `json:"date,omitempty"`
+}
+
+// Tool 17 Response
+type ListCommentsResponse struct {
+	Filepath    string           `json:"filepath"`
+	Comments    []CellComment    `json:"comments"`
+	Total       int              `json:"total"`
+	Authors     []string         `json:"authors"`
+	Performance QueryPerformance `json:"performance"`
+}
+
+// Tool 18 Response
+type PivotCacheResponse struct {
+	Filepath    string                 `json:"filepath"`
+	Cache       PivotCacheInfo         `json:"cache"`
+	Columns     []SQLColumn            `json:"columns"`
+	Rows        [][]interface{}        `json:"rows"`
+	CSV         string                 `json:"csv,omitempty"`
+	Constants   map[string]interface{} `json:"constants,omitempty"`
+	RowCount    int                    `json:"row_count"`
+	TotalRows   int                    `json:"total_rows"`
+	Truncated   bool                   `json:"truncated"`
+	Shaping     *ShapingReport         `json:"shaping,omitempty"`
+	Performance QueryPerformance       `json:"performance"`
+}
+
+// Tool 19 Response. DetailLevel runs from 4 (full) down to 0 (sheet
+// names and roles only); Omitted lists what was cut to fit TokenBudget.
+type SummarizeWorkbookResponse struct {
+	Filepath    string           `json:"filepath"`
+	Summary     WorkbookSummary  `json:"summary"`
+	DetailLevel int              `json:"detail_level"`
+	TokenCount  int              `json:"token_count"`
+	TokenBudget int              `json:"token_budget"`
+	Omitted     []string         `json:"omitted,omitempty"`
+	Performance QueryPerformance `json:"performance"`
+}
+
+// What a workbook holds, with its sheets in reading order
+type WorkbookSummary struct {
+	Format           string              `json:"format"`
+	SheetsCount      int                 `json:"sheets_count"`
+	Roles            map[string]int      `json:"roles"`
+	Macros           *MacroSummary       `json:"macros,omitempty"`
+	ExternalLinks    int                 `json:"external_links,omitempty"`
+	Sheets           []SheetSummary      `json:"sheets"`
+	NamedRanges      []NamedRangeSummary `json:"named_ranges,omitempty"`
+	NamedRangesTotal int                 `json:"named_ranges_total"`
+}
+
+type MacroSummary struct {
+	Modules []string `json:"modules"`
+}
+
+// Size is rows x columns of the used range; Headers are the column
+// titles of a sheet without Excel tables
+type SheetSummary struct {
+	Name        string           `json:"name"`
+	Role        string           `json:"role"`
+	Visibility  string           `json:"visibility,omitempty"`
+	Size        string           `json:"size,omitempty"`
+	Headers     []string         `json:"headers,omitempty"`
+	Tables      []TableSummary   `json:"tables,omitempty"`
+	TopFormulas []FormulaSummary `json:"top_formulas,omitempty"`
+	Charts      int              `json:"charts,omitempty"`
+	PivotTables int              `json:"pivot_tables,omitempty"`
+}
+
+type TableSummary struct {
+	Name    string   `json:"name"`
+	Range   string   `json:"range"`
+	Headers []string `json:"headers,omitempty"`
+}
+
+// Formula copied over Count cells, shown as written in Cell
+type FormulaSummary struct {
+	Formula string `json:"formula"`
+	Cell    string `json:"cell"`
+	Count   int    `json:"count"`
+}
+
+// Named range; Uses counts the formulas referring to it
+type NamedRangeSummary struct {
+	Name     string `json:"name"`
+	RefersTo string `json:"refers_to"`
+	Scope    string `json:"scope,omitempty"`
+	Uses     int    `json:"uses,omitempty"`
+}
+
+// MCP resources
+type Resource struct {
+	URI         string `json:"uri"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	MimeType    string `json:"mimeType,omitempty"`
+}
+
+type ResourceTemplate struct {
+	URITemplate string `json:"uriTemplate"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	MimeType    string `json:"mimeType,omitempty"`
+}
+
+// Anchor is the cell of the first value of a sheet, range or table read.
+// A read shaped to a token budget reports it in Shaping.
+type ResourceContents struct {
+	URI       string                 `json:"uri"`
+	MimeType  string                 `json:"mimeType,omitempty"`
+	Anchor    string                 `json:"anchor,omitempty"`
+	Text      string                 `json:"text"`
+	Constants map[string]interface{} `json:"constants,omitempty"`
+	Shaping   *ShapingReport         `json:"shaping,omitempty"`
+}
+
+// MCP prompts
+type PromptArgument struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Required    bool   `json:"required"`
+}
+
+type Prompt struct {
+	Name        string           `json:"name"`
+	Description string           `json:"description,omitempty"`
+	Arguments   []PromptArgument `json:"arguments,omitempty"`
+}
+
+type PromptContent struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+type PromptMessage struct {
+	Role    string        `json:"role"`
+	Content PromptContent `json:"content"`
+}
@@ -0,0 +1,131 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"mcp-xlsm-server/internal/analytics"
+	"mcp-xlsm-server/internal/models"
+	"mcp-xlsm-server/internal/workbook"
+)
+
+// Tool 4: detect_anomalies
+func (h *ToolHandler) DetectAnomalies(ctx context.Context, params map[string]interface{}) (*models.DetectAnomaliesResponse, error) {
+	// Extract parameters
+	filepath, ok := params["filepath"].(string)
+	if !ok {
+		return nil, fmt.Errorf("filepath parameter is required")
+	}
+
+	sheetName, ok := params["sheet"].(string)
+	if !ok {
+		return nil, fmt.Errorf("sheet parameter is required")
+	}
+
+	headerRow := 1
+	if hr, ok := params["header_row"].(float64); ok {
+		headerRow = int(hr)
+	}
+
+	maxResults := 100
+	if mr, ok := params["max_results"].(float64); ok {
+		maxResults = int(mr)
+	}
+
+	anomalyReq, err := parseAnomalyRequest(params)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := workbook.Open(filepath, workbookOptions(ctx, params))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open XLSM file: %w", err)
+	}
+	defer file.Close()
+
+	table, err := analytics.LoadSheetTable(file, sheetName, headerRow)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read sheet %s: %w", sheetName, err)
+	}
+
+	anomalies, columns, err := h.detector.Detect(table, *anomalyReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to detect anomalies: %w", err)
+	}
+
+	countByMethod := make(map[string]int)
+	for _, anomaly := range anomalies {
+		countByMethod[anomaly.Method]++
+	}
+
+	truncated := false
+	if maxResults > 0 && len(anomalies) > maxResults {
+		anomalies = anomalies[:maxResults]
+		truncated = true
+	}
+
+	return &models.DetectAnomaliesResponse{
+		Sheet:          sheetName,
+		RowsScanned:    len(table.Rows),
+		ColumnsScanned: columns,
+		Anomalies:      anomalies,
+		CountByMethod:  countByMethod,
+		Truncated:      truncated,
+	}, nil
+}
+
+// parseAnomalyRequest reads columns, methods, thresholds and series from
+// the tool parameters. Methods default to z-score and IQR.
+func parseAnomalyRequest(params map[string]interface{}) (*analytics.AnomalyRequest, error) {
+	req := &analytics.AnomalyRequest{
+		Thresholds: make(map[analytics.AnomalyMethod]float64),
+		Series:     analytics.SeriesByColumn,
+	}
+
+	if cols, ok := params["columns"].([]interface{}); ok {
+		for _, col := range cols {
+			if name, ok := col.(string); ok {
+				req.Columns = append(req.Columns, name)
+			}
+		}
+	}
+
+	if methods, ok := params["methods"].([]interface{}); ok {
+		for _, m := range methods {
+			name, ok := m.(string)
+			if !ok {
+				continue
+			}
+			method := analytics.AnomalyMethod(strings.ToLower(name))
+			if _, known := analytics.DefaultThresholds[method]; !known {
+				return nil, fmt.Errorf("unknown anomaly method: %s", name)
+			}
+			req.Methods = append(req.Methods, method)
+		}
+	}
+	if len(req.Methods) == 0 {
+		req.Methods = []analytics.AnomalyMethod{analytics.ZScore, analytics.IQR}
+	}
+
+	if thresholds, ok := params["thresholds"].(map[string]interface{}); ok {
+		for name, v := range thresholds {
+			if value, ok := v.(float64); ok {
+				req.Thresholds[analytics.AnomalyMethod(strings.ToLower(name))] = value
+			}
+		}
+	}
+
+	if series, ok := params["series"].(string); ok {
+		if series != analytics.SeriesByColumn && series != analytics.SeriesByRow {
+			return nil, fmt.Errorf("series must be %q or %q", analytics.SeriesByColumn, analytics.SeriesByRow)
+		}
+		req.Series = series
+	}
+
+	if ms, ok := params["min_samples"].(float64); ok {
+		req.MinSamples = int(ms)
+	}
+
+	return req, nil
+}
@@ -0,0 +1,106 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"mcp-xlsm-server/internal/models"
+	"mcp-xlsm-server/internal/workbook"
+)
+
+// Tool 17: list_comments
+func (h *ToolHandler) ListComments(ctx context.Context, params map[string]interface{}) (*models.ListCommentsResponse, error) {
+	filepath, ok := params["filepath"].(string)
+	if !ok {
+		return nil, fmt.Errorf("filepath parameter is required")
+	}
+
+	sheet, _ := params["sheet"].(string)
+	author, _ := params["author"].(string)
+
+	includeHidden := false
+	if ih, ok := params["include_hidden_sheets"].(bool); ok {
+		includeHidden = ih
+	}
+
+	startTime := time.Now()
+
+	file, err := workbook.Open(filepath, workbookOptions(ctx, params))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open XLSM file: %w", err)
+	}
+	defer file.Close()
+
+	sheets := file.GetSheetList()
+	if sheet != "" {
+		if idx, _ := file.GetSheetIndex(sheet); idx < 0 {
+			return nil, fmt.Errorf("sheet %s not found", sheet)
+		}
+		// An explicitly requested sheet is listed even when hidden
+		sheets = []string{sheet}
+		includeHidden = true
+	}
+	hidden := workbook.HiddenSheets(file)
+
+	comments := []models.CellComment{}
+	authors := make(map[string]bool)
+	for _, name := range sheets {
+		if _, ok := hidden[name]; ok && !includeHidden {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		sheetComments, err := workbook.Comments(file, name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read comments of sheet %s: %w", name, err)
+		}
+		for _, comment := range sheetComments {
+			if comment.Author != "" {
+				authors[comment.Author] = true
+			}
+			for _, reply := range comment.Replies {
+				if reply.Author != "" {
+					authors[reply.Author] = true
+				}
+			}
+			if author == "" || commentByAuthor(comment, author) {
+				comments = append(comments, comment)
+			}
+		}
+	}
+
+	authorList := make([]string, 0, len(authors))
+	for name := range authors {
+		authorList = append(authorList, name)
+	}
+	sort.Strings(authorList)
+
+	return &models.ListCommentsResponse{
+		Filepath: filepath,
+		Comments: comments,
+		Total:    len(comments),
+		Authors:  authorList,
+		Performance: models.QueryPerformance{
+			QueryTimeMs: time.Since(startTime).Milliseconds(),
+		},
+	}, nil
+}
+
+// commentByAuthor reports whether the comment or one of its replies was
+// written by author, ignoring case.
+func commentByAuthor(comment models.CellComment, author string) bool {
+	if strings.EqualFold(comment.Author, author) {
+		return true
+	}
+	for _, reply := range comment.Replies {
+		if strings.EqualFold(reply.Author, author) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,157 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"mcp-xlsm-server/internal/diff"
+	"mcp-xlsm-server/internal/models"
+	"mcp-xlsm-server/internal/workbook"
+)
+
+// Tool 7: diff_workbooks
+func (h *ToolHandler) DiffWorkbooks(ctx context.Context, params map[string]interface{}) (*models.DiffWorkbooksResponse, error) {
+	// Extract parameters
+	filepath, ok := params["filepath"].(string)
+	if !ok {
+		return nil, fmt.Errorf("filepath parameter is required")
+	}
+
+	baseFilepath, _ := params["base_filepath"].(string)
+	baseChecksum, _ := params["base_checksum"].(string)
+
+	opts := diff.Options{}
+	if ir, ok := params["include_recalculated"].(bool); ok {
+		opts.IncludeRecalculated = ir
+	}
+
+	pageSize := 200
+	if ps, ok := params["page_size"].(float64); ok && ps > 0 {
+		pageSize = int(ps)
+	}
+
+	startTime := time.Now()
+
+	targetChecksum, err := h.calculateFileChecksum(filepath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to calculate checksum: %w", err)
+	}
+	targetOpts := workbookOptions(ctx, params)
+	if err := workbook.Unlock(filepath, targetOpts.Password); err != nil {
+		return nil, err
+	}
+
+	// A cursor pins the two versions being compared
+	var offset int64
+	currentCursor := ""
+	if cc, ok := params["cursor"].(string); ok && cc != "" {
+		cursorData, err := h.cursorManager.ParseCursor(cc)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cursor: %w", err)
+		}
+		if cursorData.Checksum != targetChecksum {
+			return nil, fmt.Errorf("workbook changed since the cursor was issued, run the comparison again")
+		}
+		parts := strings.SplitN(cursorData.ChunkID, ":", 4)
+		if len(parts) != 4 || parts[0] != "diff" {
+			return nil, fmt.Errorf("cursor belongs to a different tool")
+		}
+		baseFilepath = ""
+		baseChecksum = parts[1]
+		opts.IncludeRecalculated = parts[3] == "true"
+		offset = cursorData.Offset
+		currentCursor = cc
+	}
+
+	var base *diff.Snapshot
+	switch {
+	case baseFilepath != "":
+		checksum, err := h.calculateFileChecksum(baseFilepath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to calculate base checksum: %w", err)
+		}
+		basePassword, _ := params["base_password"].(string)
+		baseOpts := workbook.Options{Password: sessionFrom(ctx).Password(baseFilepath, basePassword)}
+		if err := workbook.Unlock(baseFilepath, baseOpts.Password); err != nil {
+			return nil, err
+		}
+		if base, err = h.snapshots.Load(baseFilepath, checksum, baseOpts); err != nil {
+			return nil, err
+		}
+	case baseChecksum != "":
+		var found bool
+		if base, found = h.snapshots.Get(baseChecksum); !found {
+			return nil, fmt.Errorf("no cached snapshot for checksum %s, pass base_filepath instead", baseChecksum)
+		}
+	default:
+		previous, found := h.snapshots.Previous(filepath, targetChecksum)
+		if !found {
+			if _, err := h.snapshots.Load(filepath, targetChecksum, targetOpts); err != nil {
+				return nil, err
+			}
+			return nil, fmt.Errorf("no earlier version of %s is cached; the current version is now the baseline for the next comparison", filepath)
+		}
+		base = previous
+	}
+
+	target, err := h.snapshots.Load(filepath, targetChecksum, targetOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	result := diff.Compare(base, target, opts)
+
+	// Paginate the change list; summary and per-sheet counts cover all of it
+	totalChanges := len(result.Changes)
+	start := int(offset)
+	if start > totalChanges {
+		start = totalChanges
+	}
+	end := start + pageSize
+	if end > totalChanges {
+		end = totalChanges
+	}
+
+	signature := fmt.Sprintf("diff:%s:%s:%t", base.Checksum, target.Checksum, opts.IncludeRecalculated)
+	var nextCursor, previousCursor string
+	if end < totalChanges {
+		nextCursor = h.cursorManager.CreateQueryCursor(signature, int64(end), targetChecksum, nil)
+	}
+	if start > 0 {
+		prev := start - pageSize
+		if prev < 0 {
+			prev = 0
+		}
+		previousCursor = h.cursorManager.CreateQueryCursor(signature, int64(prev), targetChecksum, nil)
+	}
+
+	remainingPages := (totalChanges - end + pageSize - 1) / pageSize
+
+	return &models.DiffWorkbooksResponse{
+		BaseChecksum:   base.Checksum,
+		TargetChecksum: target.Checksum,
+		Summary:        result.Summary,
+		Sheets:         result.Sheets,
+		VBAModules:     result.Modules,
+		Changes:        result.Changes[start:end],
+		TotalChanges:   totalChanges,
+		Pagination: models.Pagination{
+			CurrentCursor:   currentCursor,
+			NextCursor:      nextCursor,
+			PreviousCursor:  previousCursor,
+			RemainingChunks: remainingPages,
+		},
+		Performance: models.QueryPerformance{
+			QueryTimeMs: time.Since(startTime).Milliseconds(),
+		},
+	}, nil
+}
+
+// recordSnapshot caches the workbook content under its checksum so that a
+// later diff_workbooks call can compare against this version. A failure
+// only means there is no baseline, so it is ignored.
+func (h *ToolHandler) recordSnapshot(filepath, checksum string, opts ...workbook.Options) {
+	_, _ = h.snapshots.Load(filepath, checksum, opts...)
+}
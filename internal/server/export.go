@@ -0,0 +1,276 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/xuri/excelize/v2"
+
+	"mcp-xlsm-server/internal/export"
+	"mcp-xlsm-server/internal/models"
+	"mcp-xlsm-server/internal/workbook"
+)
+
+// Tool 16: export
+func (h *ToolHandler) Export(ctx context.Context, params map[string]interface{}) (*models.ExportResponse, error) {
+	outputPath, ok := params["output_path"].(string)
+	if !ok || outputPath == "" {
+		return nil, fmt.Errorf("output_path parameter is required")
+	}
+
+	overwrite := false
+	if ow, ok := params["overwrite"].(bool); ok {
+		overwrite = ow
+	}
+
+	opts, err := exportOptions(params, filepath.Ext(outputPath))
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := os.Stat(outputPath); err == nil && !overwrite {
+		return nil, fmt.Errorf("%s already exists, pass overwrite to replace it", outputPath)
+	}
+
+	// Write next to the target and rename once complete, so a failed or
+	// cancelled export never leaves a truncated file behind
+	tmp, err := os.CreateTemp(filepath.Dir(outputPath), "."+filepath.Base(outputPath)+".tmp-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create output file: %w", err)
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath)
+
+	response, err := h.writeExport(ctx, params, opts, tmp)
+	if err != nil {
+		tmp.Close()
+		return nil, err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return nil, err
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(tmpPath, 0o644); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(tmpPath, outputPath); err != nil {
+		return nil, fmt.Errorf("failed to write %s: %w", outputPath, err)
+	}
+
+	response.OutputPath = outputPath
+	return response, nil
+}
+
+// WriteExport streams an export to w instead of a file, for the export
+// subcommand writing to stdout.
+func (h *ToolHandler) WriteExport(ctx context.Context, params map[string]interface{}, w io.Writer) (*models.ExportResponse, error) {
+	opts, err := exportOptions(params, "")
+	if err != nil {
+		return nil, err
+	}
+	return h.writeExport(ctx, params, opts, w)
+}
+
+func (h *ToolHandler) writeExport(ctx context.Context, params map[string]interface{}, opts export.Options, w io.Writer) (*models.ExportResponse, error) {
+	path, ok := params["filepath"].(string)
+	if !ok {
+		return nil, fmt.Errorf("filepath parameter is required")
+	}
+
+	hasHeader := true
+	if hh, ok := params["has_header"].(bool); ok {
+		hasHeader = hh
+	}
+
+	startTime := time.Now()
+
+	var src export.Source
+	var description string
+	if query, ok := params["query"].(string); ok && query != "" {
+		var err error
+		src, err = h.queryExportSource(ctx, params, hasHeader)
+		if err != nil {
+			return nil, err
+		}
+		description = "query:" + query
+	} else {
+		file, err := workbook.Open(path, workbookOptions(ctx, params))
+		if err != nil {
+			return nil, fmt.Errorf("failed to open XLSM file: %w", err)
+		}
+		defer file.Close()
+
+		src, description, err = openExportSource(file, params, hasHeader)
+		if err != nil {
+			return nil, err
+		}
+	}
+	defer src.Close()
+
+	result, err := export.Write(ctx, src, w, opts)
+	if err != nil {
+		return nil, fmt.Errorf("export of %s failed: %w", description, err)
+	}
+
+	columns := make([]models.ExportColumn, len(result.Columns))
+	for i, col := range result.Columns {
+		columns[i] = models.ExportColumn{Name: col.Name, Type: col.Type}
+	}
+
+	return &models.ExportResponse{
+		Filepath: path,
+		Source:   description,
+		Format:   string(opts.Format),
+		Rows:     result.Rows,
+		Columns:  columns,
+		Bytes:    result.Bytes,
+		Performance: models.QueryPerformance{
+			QueryTimeMs: time.Since(startTime).Milliseconds(),
+		},
+	}, nil
+}
+
+// exportOptions reads the format options. Without a format parameter the
+// format follows the output extension, then defaults to CSV.
+func exportOptions(params map[string]interface{}, ext string) (export.Options, error) {
+	opts := export.Options{Format: export.FormatCSV}
+	if f, ok := params["format"].(string); ok && f != "" {
+		format, err := export.ParseFormat(f)
+		if err != nil {
+			return opts, err
+		}
+		opts.Format = format
+	} else if format, err := export.ParseFormat(ext); err == nil {
+		opts.Format = format
+	}
+
+	if d, ok := params["delimiter"].(string); ok && d != "" {
+		if d == `\t` || strings.EqualFold(d, "tab") {
+			d = "\t"
+		}
+		if utf8.RuneCountInString(d) != 1 {
+			return opts, fmt.Errorf("delimiter must be a single character")
+		}
+		opts.Delimiter, _ = utf8.DecodeRuneInString(d)
+	}
+	if l, ok := params["locale"].(string); ok {
+		opts.Locale = l
+	}
+	if ch, ok := params["csv_header"].(bool); ok {
+		opts.NoHeader = !ch
+	}
+	if rg, ok := params["row_group_size"].(float64); ok && rg > 0 {
+		opts.RowGroupSize = int(rg)
+	}
+	return opts, nil
+}
+
+// openExportSource resolves a table, or a sheet with an optional range.
+func openExportSource(file *excelize.File, params map[string]interface{}, hasHeader bool) (export.Source, string, error) {
+	sheet, _ := params["sheet"].(string)
+	rangeRef, _ := params["range"].(string)
+
+	if tableName, ok := params["table"].(string); ok && tableName != "" {
+		for _, sheetName := range file.GetSheetList() {
+			if sheet != "" && sheetName != sheet {
+				continue
+			}
+			tables, err := file.GetTables(sheetName)
+			if err != nil {
+				continue
+			}
+			for _, tbl := range tables {
+				if !strings.EqualFold(tbl.Name, tableName) {
+					continue
+				}
+				tableHeader := tbl.ShowHeaderRow == nil || *tbl.ShowHeaderRow
+				src, err := export.OpenRange(file, sheetName, tbl.Range, tableHeader)
+				if err != nil {
+					return nil, "", err
+				}
+				return src, fmt.Sprintf("%s!%s (table %s)", sheetName, tbl.Range, tbl.Name), nil
+			}
+		}
+		return nil, "", fmt.Errorf("unknown table: %s", tableName)
+	}
+
+	if sheet == "" {
+		return nil, "", fmt.Errorf("sheet, table or query parameter is required")
+	}
+	if i := strings.LastIndex(rangeRef, "!"); i >= 0 {
+		rangeRef = rangeRef[i+1:]
+	}
+
+	src, err := export.OpenRange(file, sheet, rangeRef, hasHeader)
+	if err != nil {
+		return nil, "", err
+	}
+	if rangeRef != "" {
+		return src, fmt.Sprintf("%s!%s", sheet, rangeRef), nil
+	}
+	return src, sheet, nil
+}
+
+// queryExportSource runs query_data with the same parameters and exports
+// the rows it matched. Chunks share the columns of the first one; with a
+// header, the first row of each chunk is its header and is not exported.
+// format and token_budget are the export's own: the rows must come back
+// as value arrays, whole.
+func (h *ToolHandler) queryExportSource(ctx context.Context, params map[string]interface{}, hasHeader bool) (export.Source, error) {
+	queryParams := make(map[string]interface{}, len(params)+3)
+	for k, v := range params {
+		queryParams[k] = v
+	}
+	delete(queryParams, "format")
+	delete(queryParams, "token_budget")
+	if _, ok := queryParams["navigation_index"]; !ok {
+		queryParams["navigation_index"] = map[string]interface{}{}
+	}
+	queryParams["include_rows"] = true
+	queryParams["token_aware"] = false
+
+	response, err := h.QueryData(ctx, queryParams)
+	if err != nil {
+		return nil, err
+	}
+
+	var header []interface{}
+	var rows [][]interface{}
+	width := 0
+	for _, chunk := range response.Results.Data {
+		chunkRows, ok := chunk.DataChunk.([][]interface{})
+		if !ok {
+			// Index hits are single cells
+			if chunk.DataChunk != nil {
+				rows = append(rows, []interface{}{chunk.Location, chunk.DataChunk})
+			}
+			continue
+		}
+		if hasHeader && len(chunkRows) > 0 {
+			if header == nil {
+				header = chunkRows[0]
+			}
+			chunkRows = chunkRows[1:]
+		}
+		rows = append(rows, chunkRows...)
+	}
+	for _, row := range rows {
+		if len(row) > width {
+			width = len(row)
+		}
+	}
+	if len(header) > width {
+		width = len(header)
+	}
+
+	return export.NewSliceSource(export.ColumnNames(header, 1, width), rows), nil
+}
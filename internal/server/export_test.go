@@ -0,0 +1,48 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+)
+
+func TestQueryExportIgnoresQueryFormat(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ventes.xlsx")
+	f := excelize.NewFile()
+	f.SetSheetRow("Sheet1", "A1", &[]interface{}{"Rayon", "Ventes"})
+	f.SetSheetRow("Sheet1", "A2", &[]interface{}{"Frais", 120.5})
+	f.SetSheetRow("Sheet1", "A3", &[]interface{}{"Epicerie", 80})
+	if err := f.SaveAs(path); err != nil {
+		t.Fatal(err)
+	}
+
+	h := newTestToolHandler(t)
+
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{"csv", "Rayon,Ventes\nFrais,120.5\nEpicerie,80\n"},
+		{"ndjson", `{"Rayon":"Frais","Ventes":120.5}`},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		_, err := h.WriteExport(context.Background(), map[string]interface{}{
+			"filepath":     path,
+			"query":        "Sheet",
+			"format":       tt.format,
+			"token_budget": float64(10),
+		}, &out)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.format, err)
+		}
+		if !strings.Contains(out.String(), tt.want) {
+			t.Errorf("%s export = %q, want it to contain %q", tt.format, out.String(), tt.want)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"mcp-xlsm-server/internal/analytics"
+	"mcp-xlsm-server/internal/compression"
+	"mcp-xlsm-server/internal/models"
+	"mcp-xlsm-server/internal/sqlquery"
+	"mcp-xlsm-server/internal/workbook"
+)
+
+// Tool 6: join_sheets
+func (h *ToolHandler) JoinSheets(ctx context.Context, params map[string]interface{}) (*models.JoinSheetsResponse, error) {
+	// Extract parameters
+	filepath, ok := params["filepath"].(string)
+	if !ok {
+		return nil, fmt.Errorf("filepath parameter is required")
+	}
+
+	left, _ := params["left"].(string)
+	right, _ := params["right"].(string)
+	if left == "" || right == "" {
+		return nil, fmt.Errorf("left and right parameters are required")
+	}
+
+	req := analytics.JoinRequest{
+		LeftKeys:  stringList(params["left_key"]),
+		RightKeys: stringList(params["right_key"]),
+		Type:      analytics.InnerJoin,
+		MatchMode: analytics.MatchFirst,
+		Columns:   stringList(params["columns"]),
+	}
+	if len(req.RightKeys) == 0 {
+		req.RightKeys = req.LeftKeys
+	}
+	if jt, ok := params["join_type"].(string); ok && jt != "" {
+		req.Type = analytics.JoinType(strings.ToLower(jt))
+		if req.Type != analytics.InnerJoin && req.Type != analytics.LeftJoin && req.Type != analytics.AntiJoin {
+			return nil, fmt.Errorf("join_type must be inner, left or anti")
+		}
+	}
+	if mm, ok := params["match_mode"].(string); ok && mm != "" {
+		req.MatchMode = strings.ToLower(mm)
+		if req.MatchMode != analytics.MatchFirst && req.MatchMode != analytics.MatchAll {
+			return nil, fmt.Errorf("match_mode must be first or all")
+		}
+	}
+	if cs, ok := params["case_sensitive"].(bool); ok {
+		req.CaseSensitive = cs
+	}
+
+	pageSize := 100
+	if ps, ok := params["page_size"].(float64); ok && ps > 0 {
+		pageSize = int(ps)
+	}
+
+	headerRow := 1
+	if hr, ok := params["header_row"].(float64); ok {
+		headerRow = int(hr)
+	}
+
+	tokenBudget := 0
+	if tb, ok := params["token_budget"].(float64); ok && tb > 0 {
+		tokenBudget = int(tb)
+	}
+
+	startTime := time.Now()
+
+	checksum, err := h.calculateFileChecksum(filepath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to calculate checksum: %w", err)
+	}
+
+	// The cursor records the join it was issued for; callers resend the
+	// same parameters with it
+	signature := joinSignature(left, right, req)
+	var offset int64
+	currentCursor := ""
+	if cc, ok := params["cursor"].(string); ok && cc != "" {
+		cursorData, err := h.cursorManager.ParseCursor(cc)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cursor: %w", err)
+		}
+		if cursorData.Checksum != checksum {
+			return nil, fmt.Errorf("workbook changed since the cursor was issued, run the join again")
+		}
+		if cursorData.ChunkID != signature {
+			return nil, fmt.Errorf("cursor belongs to a different join")
+		}
+		offset = cursorData.Offset
+		currentCursor = cc
+	}
+
+	file, err := workbook.Open(filepath, workbookOptions(ctx, params))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open XLSM file: %w", err)
+	}
+	defer file.Close()
+
+	catalog := sqlquery.NewWorkbookCatalog(file, headerRow)
+	leftRel, err := catalog.Load(left)
+	if err != nil {
+		return nil, err
+	}
+	rightRel, err := catalog.Load(right)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := analytics.Join(leftRel.Table, rightRel.Table, req)
+	if err != nil {
+		return nil, fmt.Errorf("join failed: %w", err)
+	}
+
+	// Paginate the full result
+	totalRows := len(result.Rows)
+	start := int(offset)
+	if start > totalRows {
+		start = totalRows
+	}
+	end := start + pageSize
+	if end > totalRows {
+		end = totalRows
+	}
+
+	response := &models.JoinSheetsResponse{
+		Left:      leftRel.Name,
+		Right:     rightRel.Name,
+		JoinType:  string(req.Type),
+		Columns:   result.Columns,
+		Rows:      result.Rows[start:end],
+		TotalRows: totalRows,
+		Stats:     result.Stats,
+	}
+
+	// Fit the page to the budget; the next page starts after the last
+	// row the shaped page kept
+	if tokenBudget > 0 {
+		shaped, report, err := h.shaper.ForModel(h.detectModel(ctx)).Shape(compression.Table{Columns: result.Columns, Rows: response.Rows}, tokenBudget)
+		if err != nil {
+			return nil, err
+		}
+		if len(report.Steps) > 0 {
+			response.Columns = shaped.Columns
+			response.Rows = shaped.Rows
+			response.CSV = shaped.CSV
+			response.Constants = shaped.Constants
+			response.Shaping = &report
+		}
+		if end, err = shapedPageEnd(start, end, report, tokenBudget); err != nil {
+			return nil, err
+		}
+	}
+
+	var nextCursor, previousCursor string
+	if end < totalRows {
+		nextCursor = h.cursorManager.CreateQueryCursor(signature, int64(end), checksum, nil)
+	}
+	if start > 0 {
+		prev := start - pageSize
+		if prev < 0 {
+			prev = 0
+		}
+		previousCursor = h.cursorManager.CreateQueryCursor(signature, int64(prev), checksum, nil)
+	}
+	if response.Shaping != nil {
+		response.Shaping.NextCursor = nextCursor
+	}
+
+	response.RowCount = end - start
+	response.Pagination = models.Pagination{
+		CurrentCursor:   currentCursor,
+		NextCursor:      nextCursor,
+		PreviousCursor:  previousCursor,
+		RemainingChunks: (totalRows - end + pageSize - 1) / pageSize,
+	}
+	response.Performance = models.QueryPerformance{
+		QueryTimeMs: time.Since(startTime).Milliseconds(),
+	}
+	return response, nil
+}
+
+func joinSignature(left, right string, req analytics.JoinRequest) string {
+	return fmt.Sprintf("join:%s|%s|%s|%s|%s|%s|%t|%s",
+		strings.ToLower(left), strings.ToLower(right),
+		strings.Join(req.LeftKeys, ","), strings.Join(req.RightKeys, ","),
+		req.Type, req.MatchMode, req.CaseSensitive, strings.Join(req.Columns, ","))
+}
+
+// stringList accepts either a single string or an array of strings.
+func stringList(value interface{}) []string {
+	switch v := value.(type) {
+	case string:
+		if v != "" {
+			return []string{v}
+		}
+	case []interface{}:
+		var list []string
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				list = append(list, s)
+			}
+		}
+		return list
+	}
+	return nil
+}
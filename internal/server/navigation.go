@@ -2,15 +2,23 @@ package server
 
 import (
 	"context"
+	"crypto/sha256"
 	"fmt"
+	"io"
+	"os"
 	"time"
 
 	"github.com/xuri/excelize/v2"
 
 	"mcp-xlsm-server/internal/index"
 	"mcp-xlsm-server/internal/models"
+	"mcp-xlsm-server/internal/token"
+	"mcp-xlsm-server/internal/workbook"
 )
 
+// Merged regions listed per sheet in the navigation index
+const maxIndexedMerges = 200
+
 // Tool 2: build_navigation_map
 func (h *ToolHandler) BuildNavigationMap(ctx context.Context, params map[string]interface{}) (*models.BuildNavigationResponse, error) {
 	// Extract parameters
@@ -40,6 +48,11 @@ func (h *ToolHandler) BuildNavigationMap(ctx context.Context, params map[string]
 		streamResults = sr
 	}
 
+	watchFile := true
+	if wf, ok := params["watch"].(bool); ok {
+		watchFile = wf
+	}
+
 	// Token configuration
 	var tokenConfig map[string]interface{}
 	if tc, ok := params["token_config"].(map[string]interface{}); ok {
@@ -49,7 +62,7 @@ func (h *ToolHandler) BuildNavigationMap(ctx context.Context, params map[string]
 	_ = time.Now() // startTime for timing if needed
 
 	// Open file
-	file, err := excelize.OpenFile(filepath)
+	file, err := workbook.Open(filepath, workbookOptions(ctx, params))
 	if err != nil {
 		return nil, fmt.Errorf("failed to open XLSM file: %w", err)
 	}
@@ -85,8 +98,19 @@ func (h *ToolHandler) BuildNavigationMap(ctx context.Context, params map[string]
 	navigationIndex.ChecksumMatch = checksumMatch
 	navigationIndex.InvalidationRequired = invalidationRequired
 
+	// Register the workbook so later edits are applied as deltas
+	if watchFile {
+		if _, err := h.watcher.Register(filepath, workbookOptions(ctx, params)); err != nil {
+			return nil, fmt.Errorf("failed to watch workbook: %w", err)
+		}
+	}
+	if tracking, ok := h.watcher.Tracking(filepath); ok {
+		tracking.RebuildRequired = tracking.RebuildRequired || invalidationRequired
+		navigationIndex.DeltaTracking = tracking
+	}
+
 	// Track token usage
-	tokenTracking, err := h.calculateTokenTracking(navigationIndex, tokenConfig)
+	tokenTracking, err := h.calculateTokenTracking(ctx, navigationIndex, tokenConfig)
 	if err != nil {
 		return nil, fmt.Errorf("failed to calculate token tracking: %w", err)
 	}
@@ -127,6 +151,8 @@ func (h *ToolHandler) buildNavigationIndex(file *excelize.File, currentChunk str
 	}
 
 	// Build sheet index
+	hidden := workbook.HiddenSheets(file)
+	roles := workbook.SheetRoles(file)
 	var sheetIndex []models.SheetIndex
 	for i := startIdx; i < endIdx; i++ {
 		sheetName := sheetList[i]
@@ -136,12 +162,19 @@ func (h *ToolHandler) buildNavigationIndex(file *excelize.File, currentChunk str
 		if err != nil {
 			return nil, fmt.Errorf("failed to build sheet index for %s: %w", sheetName, err)
 		}
+		sheetIdx.Visibility = workbook.VisibilityVisible
+		if visibility, ok := hidden[sheetName]; ok {
+			sheetIdx.Visibility = visibility
+		}
+		if role, ok := roles[sheetName]; ok {
+			sheetIdx.Role = &role
+		}
 
 		sheetIndex = append(sheetIndex, *sheetIdx)
 	}
 
 	// Build connections (relationships between sheets)
-	connections, err := h.buildConnections(file, sheetIndex)
+	connections, err := h.buildConnections(file, sheetIndex, roles)
 	if err != nil {
 		return nil, fmt.Errorf("failed to build connections: %w", err)
 	}
@@ -162,6 +195,7 @@ func (h *ToolHandler) buildNavigationIndex(file *excelize.File, currentChunk str
 	return &models.NavigationIndex{
 		ChunkInfo:     chunkInfo,
 		SheetIndex:    sheetIndex,
+		ReadingOrder:  workbook.ReadingOrder(sheetList, roles),
 		Connections:   *connections,
 		SearchIndex:   *searchIndex,
 		DeltaTracking: deltaTracking,
@@ -222,14 +256,41 @@ func (h *ToolHandler) buildSheetIndex(file *excelize.File, sheetName string, she
 	// Identify hot zones (areas with high data density)
 	hotZones := h.identifyHotZones(rows)
 
-	return &models.SheetIndex{
+	sheetIdx := &models.SheetIndex{
 		SheetID:   fmt.Sprintf("sheet_%d", sheetID),
 		Name:      sheetName,
 		Metadata:  metadata,
 		Zones:     zones,
 		KeyPoints: keyPoints,
 		HotZones:  hotZones,
-	}, nil
+	}
+
+	// Merged regions, so covered cells can be read with their header
+	merges, err := workbook.ReadMerges(file, sheetName)
+	if err != nil {
+		return nil, err
+	}
+	if len(merges) > maxIndexedMerges {
+		sheetIdx.MergedCellsTotal = len(merges)
+		merges = merges[:maxIndexedMerges]
+	}
+	sheetIdx.MergedCells = merges.Regions()
+
+	// Validated ranges are where users type assumptions; formatting rules
+	// mark alerts
+	validations, formats, err := workbook.SheetRules(file, sheetName)
+	if err != nil {
+		return nil, err
+	}
+	sheetIdx.DataValidations = validations
+	sheetIdx.ConditionalFormats = formats
+	sheetIdx.InputZones = workbook.InputZones(validations)
+
+	// Charts and pivot tables often hold the figures a sheet is about
+	sheetIdx.Charts = workbook.Charts(file, sheetName)
+	sheetIdx.PivotTables = workbook.PivotTables(file, sheetName, workbook.PivotCaches(file))
+
+	return sheetIdx, nil
 }
 
 func (h *ToolHandler) createZones(totalRows, totalCols int) []models.Zone {
@@ -330,10 +391,17 @@ func (h *ToolHandler) calculateDensityInWindow(rows [][]string, startRow, startC
 	return float64(nonEmptyCells) / float64(totalCells)
 }
 
-func (h *ToolHandler) buildConnections(file *excelize.File, sheetIndex []models.SheetIndex) (*models.Connection, error) {
-	// Simplified implementation
+func (h *ToolHandler) buildConnections(file *excelize.File, sheetIndex []models.SheetIndex, roles map[string]models.SheetRole) (*models.Connection, error) {
+	// Sheets read by the formulas of the indexed sheets
+	formulaLinks := []string{}
+	for _, sheet := range sheetIndex {
+		for _, target := range roles[sheet.Name].References {
+			formulaLinks = append(formulaLinks, sheet.Name+" -> "+target)
+		}
+	}
+
 	return &models.Connection{
-		FormulaLinks:           []string{},
+		FormulaLinks:           formulaLinks,
 		StructuralSimilarities: []string{},
 		CircularDependencies:   []string{},
 	}, nil
@@ -365,28 +433,33 @@ func (h *ToolHandler) buildSearchIndex(file *excelize.File, sheetIndex []models.
 	}, nil
 }
 
-func (h *ToolHandler) calculateTokenTracking(navigationIndex *models.NavigationIndex, tokenConfig map[string]interface{}) (*models.TokenTracking, error) {
-	// Count tokens in response
-	tokenCount, err := h.tokenCounter.Count(navigationIndex)
-	if err != nil {
-		return nil, err
-	}
+// calculateTokenTracking counts the map for the session's model, unless
+// token_config names another, and what the session has left after it
+func (h *ToolHandler) calculateTokenTracking(ctx context.Context, navigationIndex *models.NavigationIndex, tokenConfig map[string]interface{}) (*models.TokenTracking, error) {
+	session := sessionFrom(ctx)
 
 	// Determine model from config
-	modelName := "sonnet-4"
+	modelName := session.Model()
 	if tc := tokenConfig; tc != nil {
 		if model, ok := tc["model"].(string); ok {
-			modelName = model
+			if resolved, ok := token.ResolveModel(model); ok {
+				modelName = resolved
+			}
 		}
 	}
 
+	// Count tokens in response with that model's tokenizer
+	tokenCount, err := h.tokenCounter.CountForModel(modelName, navigationIndex)
+	if err != nil {
+		return nil, err
+	}
+
 	limits := h.tokenCounter.GetModelLimits(modelName)
-	compressionStrategy := h.tokenCounter.GetCompressionStrategy(tokenCount, modelName)
 
 	return &models.TokenTracking{
-		Used:               tokenCount,
-		Remaining:          limits.SafeBuffer - tokenCount,
-		CompressionApplied: compressionStrategy,
+		Used:               session.Used() + tokenCount,
+		Remaining:          limits.SafeBuffer - session.Used() - tokenCount,
+		CompressionApplied: "none",
 		Optimization:       "none",
 		ActualCount:        tokenCount,
 	}, nil
@@ -431,7 +504,17 @@ func (h *ToolHandler) createCacheControl(checksum string, checksumMatch bool) *m
 }
 
 func (h *ToolHandler) calculateFileChecksum(filepath string) (string, error) {
-	// Reuse the checksum calculation from analyze_file
-	// This is a simplified version - in production would cache this
-	return "dummy_checksum", nil
+	// Same SHA-256 as analyze_file, streamed instead of read in one go
+	file, err := os.Open(filepath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%x", hash.Sum(nil)), nil
 }
\ No newline at end of file
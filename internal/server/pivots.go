@@ -0,0 +1,129 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"mcp-xlsm-server/internal/compression"
+	"mcp-xlsm-server/internal/models"
+	"mcp-xlsm-server/internal/sqlquery"
+	"mcp-xlsm-server/internal/workbook"
+)
+
+// Tool 18: read_pivot_cache
+func (h *ToolHandler) ReadPivotCache(ctx context.Context, params map[string]interface{}) (*models.PivotCacheResponse, error) {
+	filepath, ok := params["filepath"].(string)
+	if !ok {
+		return nil, fmt.Errorf("filepath parameter is required")
+	}
+
+	cacheID := -1
+	if id, ok := params["cache_id"].(float64); ok {
+		cacheID = int(id)
+	}
+	pivotTable, _ := params["pivot_table"].(string)
+	if cacheID < 0 && pivotTable == "" {
+		return nil, fmt.Errorf("cache_id or pivot_table parameter is required")
+	}
+
+	maxRows := 1000
+	if mr, ok := params["max_rows"].(float64); ok && mr > 0 {
+		maxRows = int(mr)
+	}
+
+	tokenBudget := 0
+	if tb, ok := params["token_budget"].(float64); ok && tb > 0 {
+		tokenBudget = int(tb)
+	}
+
+	startTime := time.Now()
+
+	file, err := workbook.Open(filepath, workbookOptions(ctx, params))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open XLSM file: %w", err)
+	}
+	defer file.Close()
+
+	caches := workbook.PivotCaches(file)
+	if pivotTable != "" {
+		// Pivot table names are only unique per sheet; the first wins
+		cacheID = -1
+		for _, sheet := range file.GetSheetList() {
+			for _, table := range workbook.PivotTables(file, sheet, caches) {
+				if cacheID < 0 && strings.EqualFold(table.Name, pivotTable) {
+					cacheID = table.CacheID
+				}
+			}
+		}
+		if cacheID < 0 {
+			return nil, fmt.Errorf("pivot table %s not found", pivotTable)
+		}
+	}
+
+	var cache *workbook.PivotCache
+	for i := range caches {
+		if caches[i].ID == cacheID {
+			cache = &caches[i]
+			break
+		}
+	}
+	if cache == nil {
+		return nil, fmt.Errorf("pivot cache %d not found", cacheID)
+	}
+	if cache.RecordsPart == "" {
+		return nil, fmt.Errorf("pivot cache %d was saved without its records, refresh the pivot table with \"Save source data with file\" enabled", cacheID)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	relation, err := sqlquery.NewWorkbookCatalog(file, 1).Load(workbook.PivotCacheRelation(cacheID))
+	if err != nil {
+		return nil, err
+	}
+
+	columns := make([]models.SQLColumn, len(relation.Columns))
+	names := make([]string, len(relation.Columns))
+	for i, col := range relation.Columns {
+		columns[i] = models.SQLColumn{Name: col.Name, Type: col.Type}
+		names[i] = col.Name
+	}
+	rows := relation.Table.Rows
+	totalRows := len(rows)
+	if len(rows) > maxRows {
+		rows = rows[:maxRows]
+	}
+
+	response := &models.PivotCacheResponse{
+		Filepath:  filepath,
+		Cache:     cache.Info(),
+		Columns:   columns,
+		Rows:      rows,
+		RowCount:  len(rows),
+		TotalRows: totalRows,
+	}
+
+	// Records past the shaped rows are read with sql_query on the cache
+	if tokenBudget > 0 {
+		shaped, report, err := h.shaper.ForModel(h.detectModel(ctx)).Shape(compression.Table{Columns: names, Rows: rows}, tokenBudget)
+		if err != nil {
+			return nil, err
+		}
+		if len(report.Steps) > 0 {
+			response.Columns = shapedColumns(columns, shaped.Columns)
+			response.Rows = shaped.Rows
+			response.CSV = shaped.CSV
+			response.Constants = shaped.Constants
+			response.RowCount = report.RowsReturned
+			response.Shaping = &report
+		}
+	}
+
+	response.Truncated = response.RowCount < totalRows
+	response.Performance = models.QueryPerformance{
+		QueryTimeMs: time.Since(startTime).Milliseconds(),
+	}
+	return response, nil
+}
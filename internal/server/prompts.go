@@ -0,0 +1,459 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+
+	"mcp-xlsm-server/internal/analytics"
+	"mcp-xlsm-server/internal/models"
+	"mcp-xlsm-server/internal/workbook"
+)
+
+const (
+	// Workbooks with more sheets are summarized by their first ones only
+	maxPromptSheets = 40
+	// Distinct formula shapes listed in the audit prompt
+	maxPromptFormulas = 25
+)
+
+var (
+	cellRefPattern  = regexp.MustCompile(`\$?[A-Z]{1,3}\$?[0-9]+`)
+	sheetRefPattern = regexp.MustCompile(`(?:'([^']+)'|([A-Za-z0-9_.]+))!`)
+	numberPattern   = regexp.MustCompile(`[0-9]+(?:\.[0-9]+)?`)
+	// Trailing integer arguments such as ROUND(x,2) or INDEX(r,3) are not
+	// business constants
+	trailingArgPattern = regexp.MustCompile(`,\s*-?[0-9]+\s*\)`)
+	formulaErrorCodes  = []string{"#REF!", "#DIV/0!", "#VALUE!", "#N/A", "#NAME?", "#NUM!", "#NULL!"}
+)
+
+// PromptHandler serves parameterized prompt templates for the usual
+// analysis workflows. Each prompt embeds the current state of the
+// workbook so an agent can start working from a single prompts/get.
+type PromptHandler struct {
+	tools *ToolHandler
+}
+
+func NewPromptHandler(tools *ToolHandler) *PromptHandler {
+	return &PromptHandler{tools: tools}
+}
+
+var promptCatalog = []models.Prompt{
+	{
+		Name:        "audit_formulas",
+		Description: "Audit the formulas of one sheet: inconsistent patterns, hard-coded values, broken references",
+		Arguments: []models.PromptArgument{
+			{Name: "filepath", Description: "Path to the workbook", Required: true},
+			{Name: "sheet", Description: "Sheet to audit", Required: true},
+		},
+	},
+	{
+		Name:        "summarize_financial_statements",
+		Description: "Summarize the financial statements of a workbook with key figures and trends",
+		Arguments: []models.PromptArgument{
+			{Name: "filepath", Description: "Path to the workbook", Required: true},
+			{Name: "sheets", Description: "Comma-separated sheets holding the statements; defaults to the whole workbook", Required: false},
+		},
+	},
+	{
+		Name:        "reconcile_sheets",
+		Description: "Reconcile two sheets or tables on a key column and explain the differences",
+		Arguments: []models.PromptArgument{
+			{Name: "filepath", Description: "Path to the workbook", Required: true},
+			{Name: "sheet_a", Description: "First sheet", Required: true},
+			{Name: "sheet_b", Description: "Second sheet", Required: true},
+			{Name: "key", Description: "Key column header; defaults to the first header both sheets share", Required: false},
+		},
+	},
+}
+
+// prompts/list
+func (ph *PromptHandler) List(params map[string]interface{}) (interface{}, error) {
+	return map[string]interface{}{"prompts": promptCatalog}, nil
+}
+
+// prompts/get
+func (ph *PromptHandler) Get(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	name, _ := params["name"].(string)
+
+	args := make(map[string]string)
+	if raw, ok := params["arguments"].(map[string]interface{}); ok {
+		for key, value := range raw {
+			if s, ok := value.(string); ok {
+				args[key] = strings.TrimSpace(s)
+			}
+		}
+	}
+
+	var prompt *models.Prompt
+	for i := range promptCatalog {
+		if promptCatalog[i].Name == name {
+			prompt = &promptCatalog[i]
+		}
+	}
+	if prompt == nil {
+		return nil, fmt.Errorf("unknown prompt: %s", name)
+	}
+	for _, arg := range prompt.Arguments {
+		if arg.Required && args[arg.Name] == "" {
+			return nil, fmt.Errorf("%s argument is required", arg.Name)
+		}
+	}
+
+	// An encrypted workbook opens with the password the session gave
+	// for it, or a configured one
+	path := args["filepath"]
+	file, err := workbook.Open(path, workbook.Options{Password: sessionFrom(ctx).Password(path, "")})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open XLSM file: %w", err)
+	}
+	defer file.Close()
+
+	var text string
+	switch name {
+	case "audit_formulas":
+		text, err = ph.auditFormulas(file, args)
+	case "summarize_financial_statements":
+		text, err = ph.summarizeFinancials(file, args)
+	case "reconcile_sheets":
+		text, err = ph.reconcileSheets(file, args)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"description": prompt.Description,
+		"messages": []models.PromptMessage{{
+			Role:    "user",
+			Content: models.PromptContent{Type: "text", Text: text},
+		}},
+	}, nil
+}
+
+func (ph *PromptHandler) auditFormulas(file *excelize.File, args map[string]string) (string, error) {
+	filepath, sheetName := args["filepath"], args["sheet"]
+	if idx, _ := file.GetSheetIndex(sheetName); idx < 0 {
+		return "", fmt.Errorf("unknown sheet: %s", sheetName)
+	}
+
+	rows, err := file.GetRows(sheetName)
+	if err != nil {
+		return "", err
+	}
+
+	// Group formulas by shape: the same formula copied down a column has
+	// one shape, so a lone variant stands out
+	type shape struct {
+		example string
+		cells   []string
+	}
+	shapes := make(map[string]*shape)
+	linkedSheets := make(map[string]int)
+	var hardcoded, errorCells []string
+	formulaCount := 0
+
+	// Formulas saved without a cached value read as empty cells, so every
+	// cell of the used range is checked for one
+	lastRow, lastCol := len(rows), 0
+	for _, row := range rows {
+		lastCol = max(lastCol, len(row))
+	}
+	if dimension, err := file.GetSheetDimension(sheetName); err == nil && dimension != "" {
+		if _, _, endCol, endRow, err := analytics.ParseRange(dimension); err == nil {
+			lastRow, lastCol = max(lastRow, endRow), max(lastCol, endCol)
+		}
+	}
+
+	for rowIdx := 0; rowIdx < lastRow; rowIdx++ {
+		for colIdx := 0; colIdx < lastCol; colIdx++ {
+			cellRef, _ := excelize.CoordinatesToCellName(colIdx+1, rowIdx+1)
+			formula, err := file.GetCellFormula(sheetName, cellRef)
+			if err != nil || formula == "" {
+				continue
+			}
+			formulaCount++
+
+			// The cached value only tells whether the formula shows an error
+			if rowIdx < len(rows) && colIdx < len(rows[rowIdx]) {
+				value := rows[rowIdx][colIdx]
+				for _, code := range formulaErrorCodes {
+					if value == code {
+						errorCells = append(errorCells, fmt.Sprintf("%s (%s)", cellRef, value))
+					}
+				}
+			}
+
+			key := relativeShape(formula, colIdx+1, rowIdx+1)
+			s, ok := shapes[key]
+			if !ok {
+				s = &shape{example: formula}
+				shapes[key] = s
+			}
+			s.cells = append(s.cells, cellRef)
+
+			for _, m := range sheetRefPattern.FindAllStringSubmatch(formula, -1) {
+				linkedSheets[m[1]+m[2]]++
+			}
+			if hasHardcodedNumber(formula) {
+				hardcoded = append(hardcoded, cellRef)
+			}
+		}
+	}
+
+	keys := make([]string, 0, len(shapes))
+	for key := range shapes {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if len(shapes[keys[i]].cells) != len(shapes[keys[j]].cells) {
+			return len(shapes[keys[i]].cells) > len(shapes[keys[j]].cells)
+		}
+		return keys[i] < keys[j]
+	})
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Audit the formulas of sheet %q in %s.\n\n", sheetName, filepath)
+	b.WriteString(ph.sheetSummary(file, []string{sheetName}))
+
+	fmt.Fprintf(&b, "\nFormulas: %d cells, %d distinct shapes.\n", formulaCount, len(shapes))
+	for i, key := range keys {
+		if i == maxPromptFormulas {
+			fmt.Fprintf(&b, "- ... %d more shapes\n", len(keys)-maxPromptFormulas)
+			break
+		}
+		s := shapes[key]
+		fmt.Fprintf(&b, "- =%s in %d cells (%s)\n", s.example, len(s.cells), cellList(s.cells, 5))
+	}
+	if len(linkedSheets) > 0 {
+		b.WriteString("\nReferenced sheets:\n")
+		for _, name := range sortedKeys(linkedSheets) {
+			fmt.Fprintf(&b, "- %s (%d references)\n", name, linkedSheets[name])
+		}
+	}
+	if len(hardcoded) > 0 {
+		fmt.Fprintf(&b, "\nFormulas with hard-coded numbers: %s\n", cellList(hardcoded, 20))
+	}
+	if len(errorCells) > 0 {
+		fmt.Fprintf(&b, "\nCells showing an error: %s\n", cellList(errorCells, 20))
+	}
+
+	b.WriteString(`
+Steps:
+1. Review each formula shape; a shape used by only a few cells inside a column of another shape is a likely copy error.
+2. Check hard-coded numbers and decide whether they belong in an input cell.
+3. Trace the error cells and the cross-sheet references with query_data, and read suspicious ranges through the xlsm:// range resources.
+4. Report findings as a table: cell, formula, issue, suggested fix, severity.
+`)
+
+	return b.String(), nil
+}
+
+func (ph *PromptHandler) summarizeFinancials(file *excelize.File, args map[string]string) (string, error) {
+	filepath := args["filepath"]
+
+	var sheets []string
+	if args["sheets"] != "" {
+		for _, name := range strings.Split(args["sheets"], ",") {
+			name = strings.TrimSpace(name)
+			if idx, _ := file.GetSheetIndex(name); idx < 0 {
+				return "", fmt.Errorf("unknown sheet: %s", name)
+			}
+			sheets = append(sheets, name)
+		}
+	} else {
+		sheets = file.GetSheetList()
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Summarize the financial statements in %s.\n\n", filepath)
+	b.WriteString(ph.sheetSummary(file, sheets))
+	b.WriteString(tableSummary(file, sheets))
+
+	b.WriteString(`
+Steps:
+1. Identify which sheets hold the income statement, balance sheet and cash flow, and the periods they cover.
+2. Pull the key lines (revenue, gross margin, operating result, net result, equity, debt, cash) with query_data or sql_query.
+3. Compute period-over-period changes and the main ratios, and run detect_anomalies on the numeric columns.
+4. Write a short summary: key figures, trends, anomalies, and points needing follow-up, citing the source cells.
+`)
+
+	return b.String(), nil
+}
+
+func (ph *PromptHandler) reconcileSheets(file *excelize.File, args map[string]string) (string, error) {
+	filepath, sheetA, sheetB := args["filepath"], args["sheet_a"], args["sheet_b"]
+
+	tableA, err := analytics.LoadSheetTable(file, sheetA, 1)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", sheetA, err)
+	}
+	tableB, err := analytics.LoadSheetTable(file, sheetB, 1)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", sheetB, err)
+	}
+
+	var common []string
+	for _, header := range tableA.Headers {
+		if _, err := tableB.ColumnIndex(header); err == nil && header != "" {
+			common = append(common, header)
+		}
+	}
+
+	key := args["key"]
+	if key == "" && len(common) > 0 {
+		key = common[0]
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Reconcile sheet %q against sheet %q in %s.\n\n", sheetA, sheetB, filepath)
+	b.WriteString(ph.sheetSummary(file, []string{sheetA, sheetB}))
+	fmt.Fprintf(&b, "\n%s headers: %s\n", sheetA, strings.Join(tableA.Headers, ", "))
+	fmt.Fprintf(&b, "%s headers: %s\n", sheetB, strings.Join(tableB.Headers, ", "))
+	if len(common) > 0 {
+		fmt.Fprintf(&b, "Shared headers: %s\n", strings.Join(common, ", "))
+	}
+
+	if key != "" {
+		fmt.Fprintf(&b, "\nKey column: %s\n", key)
+		for _, pair := range [][2]*analytics.Table{{tableA, tableB}, {tableB, tableA}} {
+			result, err := analytics.Join(pair[0], pair[1], analytics.JoinRequest{
+				LeftKeys:  []string{key},
+				RightKeys: []string{key},
+				Type:      analytics.AntiJoin,
+				MatchMode: analytics.MatchFirst,
+			})
+			if err != nil {
+				fmt.Fprintf(&b, "- %s: %v\n", pair[0].Sheet, err)
+				continue
+			}
+			fmt.Fprintf(&b, "- %s: %d rows, %d without a match in %s (%d distinct keys), %d duplicate keys in %s\n",
+				pair[0].Sheet, result.Stats.LeftRows, result.Stats.UnmatchedLeftRows, pair[1].Sheet,
+				len(result.Rows), result.Stats.DuplicateKeys, pair[1].Sheet)
+		}
+	} else {
+		b.WriteString("\nThe sheets share no header; ask which columns identify a line before reconciling.\n")
+	}
+
+	b.WriteString(`
+Steps:
+1. Confirm the key column, and the amount columns that should agree.
+2. List keys present on one side only with join_sheets (join_type "anti", both directions).
+3. Compare amounts for matched keys with join_sheets or sql_query and isolate the differences.
+4. Report totals on each side, the unmatched items, the amount differences and their likely causes.
+`)
+
+	return b.String(), nil
+}
+
+// sheetSummary is the navigation summary of the given sheets: role, size,
+// density and whether they hold formulas.
+func (ph *PromptHandler) sheetSummary(file *excelize.File, sheets []string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Workbook has %d sheets.\n", file.SheetCount)
+	roles := workbook.SheetRoles(file)
+	for i, sheetName := range sheets {
+		if i == maxPromptSheets {
+			fmt.Fprintf(&b, "- ... %d more sheets\n", len(sheets)-maxPromptSheets)
+			break
+		}
+		idx, err := ph.tools.buildSheetIndex(file, sheetName, i)
+		if err != nil {
+			continue
+		}
+		meta := idx.Metadata
+		line := fmt.Sprintf("- %s: %d rows x %d cols, density %.0f%%", sheetName, meta.Rows, meta.Cols, meta.DataDensity*100)
+		if role, ok := roles[sheetName]; ok {
+			line = fmt.Sprintf("- %s (%s): %d rows x %d cols, density %.0f%%", sheetName, role.Role, meta.Rows, meta.Cols, meta.DataDensity*100)
+		}
+		if meta.HasFormulas {
+			line += ", formulas"
+		}
+		if len(idx.HotZones) > 0 {
+			line += ", hot zones " + strings.Join(idx.HotZones, " ")
+		}
+		if len(idx.InputZones) > 0 {
+			line += ", input zones " + strings.Join(idx.InputZones, " ")
+		}
+		b.WriteString(line + "\n")
+	}
+	return b.String()
+}
+
+// tableSummary lists the Excel tables defined on the given sheets.
+func tableSummary(file *excelize.File, sheets []string) string {
+	var lines []string
+	for _, sheetName := range sheets {
+		tables, err := file.GetTables(sheetName)
+		if err != nil {
+			continue
+		}
+		for _, tbl := range tables {
+			lines = append(lines, fmt.Sprintf("- %s (%s!%s)", tbl.Name, sheetName, tbl.Range))
+		}
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+	return "\nExcel tables:\n" + strings.Join(lines, "\n") + "\n"
+}
+
+// relativeShape rewrites the references of a formula relative to its own
+// cell in R1C1 style, so =B2*C2 in D2 and =B3*C3 in D3 share one shape.
+func relativeShape(formula string, col, row int) string {
+	return cellRefPattern.ReplaceAllStringFunc(formula, func(ref string) string {
+		absCol := strings.HasPrefix(ref, "$")
+		absRow := strings.Contains(strings.TrimPrefix(ref, "$"), "$")
+		refCol, refRow, err := excelize.CellNameToCoordinates(strings.ReplaceAll(ref, "$", ""))
+		if err != nil {
+			return ref
+		}
+
+		r := fmt.Sprintf("R[%d]", refRow-row)
+		if absRow {
+			r = fmt.Sprintf("R%d", refRow)
+		}
+		c := fmt.Sprintf("C[%d]", refCol-col)
+		if absCol {
+			c = fmt.Sprintf("C%d", refCol)
+		}
+		return r + c
+	})
+}
+
+// hasHardcodedNumber reports whether a formula mixes references with a
+// literal number other than 0 or 1, e.g. =B4*1.2.
+func hasHardcodedNumber(formula string) bool {
+	if !cellRefPattern.MatchString(formula) {
+		return false
+	}
+	stripped := sheetRefPattern.ReplaceAllString(formula, "")
+	stripped = cellRefPattern.ReplaceAllString(stripped, "")
+	stripped = trailingArgPattern.ReplaceAllString(stripped, ")")
+	for _, token := range numberPattern.FindAllString(stripped, -1) {
+		if token != "0" && token != "1" {
+			return true
+		}
+	}
+	return false
+}
+
+func cellList(cells []string, max int) string {
+	if len(cells) <= max {
+		return strings.Join(cells, ", ")
+	}
+	return fmt.Sprintf("%s and %d more", strings.Join(cells[:max], ", "), len(cells)-max)
+}
+
+func sortedKeys(counts map[string]int) []string {
+	keys := make([]string, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,41 @@
+package server
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+)
+
+func TestAuditFormulasWithoutCachedValues(t *testing.T) {
+	f := excelize.NewFile()
+	f.SetSheetRow("Sheet1", "A1", &[]interface{}{"HT", "TVA", "TTC"})
+	f.SetSheetRow("Sheet1", "A2", &[]interface{}{100.0})
+	f.SetSheetRow("Sheet1", "A3", &[]interface{}{250.0})
+	// Written by a tool that stores no cached values, the formula cells
+	// read as empty and sit past the last value of their rows
+	for _, formula := range []struct{ cell, formula string }{
+		{"B2", "A2*0.2"}, {"C2", "A2+B2"},
+		{"B3", "A3*0.2"}, {"C3", "A3+B3"},
+	} {
+		if err := f.SetCellFormula("Sheet1", formula.cell, formula.formula); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	text, err := (&PromptHandler{}).auditFormulas(f, map[string]string{"filepath": "tva.xlsx", "sheet": "Sheet1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{
+		"Formulas: 4 cells, 2 distinct shapes.",
+		"=A2*0.2 in 2 cells (B2, B3)",
+		"=A2+B2 in 2 cells (C2, C3)",
+		"Formulas with hard-coded numbers: B2, B3",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("audit prompt lacks %q:\n%s", want, text)
+		}
+	}
+}
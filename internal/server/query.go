@@ -2,14 +2,19 @@ package server
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/xuri/excelize/v2"
 
+	"mcp-xlsm-server/internal/analytics"
+	"mcp-xlsm-server/internal/compression"
 	"mcp-xlsm-server/internal/index"
 	"mcp-xlsm-server/internal/models"
+	"mcp-xlsm-server/internal/workbook"
 )
 
 // Tool 3: query_data
@@ -25,6 +30,19 @@ func (h *ToolHandler) QueryData(ctx context.Context, params map[string]interface
 		return nil, fmt.Errorf("navigation_index parameter is required")
 	}
 
+	filepath, ok := params["filepath"].(string)
+	if !ok || filepath == "" {
+		return nil, fmt.Errorf("filepath parameter is required")
+	}
+
+	// Sheet reads below skip files they cannot open, so an encrypted
+	// workbook without a valid password is reported here
+	opts := workbookOptions(ctx, params)
+	var encrypted *workbook.EncryptedError
+	if err := workbook.Unlock(filepath, opts.Password); errors.As(err, &encrypted) {
+		return nil, err
+	}
+
 	// Optional parameters
 	continuationCursor := ""
 	if cc, ok := params["continuation_cursor"].(string); ok {
@@ -59,6 +77,55 @@ func (h *ToolHandler) QueryData(ctx context.Context, params map[string]interface
 		}
 	}
 
+	aggregateReq, err := parseAggregateRequest(params)
+	if err != nil {
+		return nil, fmt.Errorf("invalid aggregation: %w", err)
+	}
+
+	includeRows := aggregateReq == nil
+	if ir, ok := params["include_rows"].(bool); ok {
+		includeRows = ir
+	}
+
+	hasHeader := true
+	if hh, ok := params["has_header"].(bool); ok {
+		hasHeader = hh
+	}
+
+	tokenBudget := 0
+	if tb, ok := params["token_budget"].(float64); ok && tb > 0 {
+		tokenBudget = int(tb)
+	}
+
+	// Tabular matches stay row arrays unless another encoding is asked for
+	format, _ := params["format"].(string)
+	if format != "" && !compression.ValidFormat(format) {
+		return nil, fmt.Errorf("unknown format %q, expected one of %s", format, strings.Join(compression.Formats, ", "))
+	}
+
+	// Hidden sheets usually hold scratch or lookup data, not reports
+	includeHidden := false
+	if ih, ok := params["include_hidden_sheets"].(bool); ok {
+		includeHidden = ih
+	}
+
+	// Repeat merged values in the cells they cover and list the regions
+	// in each result's context
+	propagateMerged := false
+	if pm, ok := params["propagate_merged"].(bool); ok {
+		propagateMerged = pm
+	}
+	windowConfig["propagate_merged"] = propagateMerged
+
+	// Outlier detection over matched rows, reported in statistics.outliers
+	var anomalyReq *analytics.AnomalyRequest
+	if do, ok := params["detect_outliers"].(bool); ok && do {
+		anomalyReq, err = parseAnomalyRequest(params)
+		if err != nil {
+			return nil, fmt.Errorf("invalid outlier detection: %w", err)
+		}
+	}
+
 	startTime := time.Now()
 
 	// Parse navigation index
@@ -80,16 +147,47 @@ func (h *ToolHandler) QueryData(ctx context.Context, params map[string]interface
 	}
 
 	// Execute query
-	queryExecution, results, err := h.executeQuery(query, navigationIndex, offset, window, windowConfig, optimizationHints)
+	queryExecution, results, err := h.executeQuery(filepath, opts, query, navigationIndex, offset, window, windowConfig, optimizationHints)
 	if err != nil {
 		return nil, fmt.Errorf("failed to execute query: %w", err)
 	}
+	var file *excelize.File
+	if len(results.Data) > 0 {
+		if f, err := workbook.Open(filepath, opts); err == nil {
+			file = f
+			defer file.Close()
+			if !includeHidden {
+				results.Data = dropHiddenSheets(file, results.Data)
+			}
+			if propagateMerged {
+				addMergedContext(file, results.Data)
+			}
+			addCommentContext(file, results.Data)
+		}
+	}
 
 	// Calculate statistics if needed
-	statistics := h.calculateStatistics(results, query)
+	statistics, err := h.calculateStatistics(file, results, query, aggregateReq, anomalyReq, hasHeader, propagateMerged)
+	if err != nil {
+		return nil, fmt.Errorf("failed to calculate statistics: %w", err)
+	}
+
+	// Aggregated queries return the summary table, not the matched rows
+	if !includeRows {
+		for i := range results.Data {
+			results.Data[i].DataChunk = nil
+			results.Data[i].Metadata.Truncated = true
+		}
+	}
+
+	if includeRows {
+		if err := h.encodeResults(ctx, results, format, hasHeader, tokenAware, tokenBudget); err != nil {
+			return nil, fmt.Errorf("failed to encode results: %w", err)
+		}
+	}
 
 	// Apply adaptive response based on model and token limits
-	adaptiveResponse, err := h.applyAdaptiveResponse(results, tokenAware)
+	adaptiveResponse, err := h.applyAdaptiveResponse(ctx, results, tokenAware)
 	if err != nil {
 		return nil, fmt.Errorf("failed to apply adaptive response: %w", err)
 	}
@@ -147,12 +245,15 @@ func (h *ToolHandler) parseNavigationIndex(data map[string]interface{}) (*models
 	}, nil
 }
 
-func (h *ToolHandler) executeQuery(query string, navIndex *models.NavigationIndex, offset int64, window *models.Window, windowConfig map[string]interface{}, hints map[string]interface{}) (*models.QueryExecution, *models.QueryResults, error) {
+func (h *ToolHandler) executeQuery(filepath string, opts workbook.Options, query string, navIndex *models.NavigationIndex, offset int64, window *models.Window, windowConfig map[string]interface{}, hints map[string]interface{}) (*models.QueryExecution, *models.QueryResults, error) {
 	// Determine query strategy
 	strategy := h.determineQueryStrategy(query, navIndex, hints)
 	
-	// Create index manager for searching
-	indexManager := index.NewManager()
+	// Search the live index of a watched workbook, if any
+	indexManager, watched := h.watcher.Index(filepath)
+	if !watched {
+		indexManager = index.NewManager()
+	}
 	
 	var results []models.DataChunk
 	usedIndex := false
@@ -180,7 +281,7 @@ func (h *ToolHandler) executeQuery(query string, navIndex *models.NavigationInde
 		}, &models.QueryResults{Data: results}, nil
 
 	case "scan":
-		results, chunksScanned, err := h.executeScanQuery(query, navIndex, windowConfig)
+		results, chunksScanned, err := h.executeScanQuery(filepath, opts, query, navIndex, windowConfig)
 		if err != nil {
 			return nil, nil, err
 		}
@@ -196,7 +297,7 @@ func (h *ToolHandler) executeQuery(query string, navIndex *models.NavigationInde
 	case "hybrid":
 		// Combine index and scan approaches
 		indexResults, _ := h.executeIndexQuery(query, indexManager, navIndex, windowConfig)
-		scanResults, chunksScanned, _ := h.executeScanQuery(query, navIndex, windowConfig)
+		scanResults, chunksScanned, _ := h.executeScanQuery(filepath, opts, query, navIndex, windowConfig)
 		
 		// Merge results
 		results = append(indexResults, scanResults...)
@@ -288,7 +389,7 @@ func (h *ToolHandler) executeIndexQuery(query string, indexManager *index.Manage
 	return results, nil
 }
 
-func (h *ToolHandler) executeScanQuery(query string, navIndex *models.NavigationIndex, windowConfig map[string]interface{}) ([]models.DataChunk, []string, error) {
+func (h *ToolHandler) executeScanQuery(filepath string, opts workbook.Options, query string, navIndex *models.NavigationIndex, windowConfig map[string]interface{}) ([]models.DataChunk, []string, error) {
 	var results []models.DataChunk
 	var chunksScanned []string
 
@@ -302,6 +403,8 @@ func (h *ToolHandler) executeScanQuery(query string, navIndex *models.Navigation
 		maxRowsPerSheet = mr
 	}
 
+	propagateMerged, _ := windowConfig["propagate_merged"].(bool)
+
 	// Extract real financial data from Excel sheets
 	for i, sheet := range navIndex.SheetIndex {
 		if i >= maxSheetsPerCall {
@@ -313,7 +416,7 @@ func (h *ToolHandler) executeScanQuery(query string, navIndex *models.Navigation
 		// Check if this is the target sheet (FROUDIS or CHAMDIS)
 		if strings.Contains(strings.ToUpper(sheet.Name), strings.ToUpper(query)) {
 			// Extract real data from the Excel file
-			realData, err := h.extractRealSheetData(sheet.Name, maxRowsPerSheet)
+			realData, err := h.extractRealSheetData(filepath, opts, sheet.Name, maxRowsPerSheet, propagateMerged)
 			if err != nil {
 				continue
 			}
@@ -376,56 +479,366 @@ func (h *ToolHandler) convertLocationsToDataChunks(locations []index.Location, w
 	return chunks
 }
 
-func (h *ToolHandler) calculateStatistics(results *models.QueryResults, query string) *models.Statistics {
-	// Simple statistics calculation
-	return &models.Statistics{
+// calculateStatistics aggregates and scans for outliers the rows the query
+// matched, once per sheet: every row of a sheet matched as a whole, or the
+// rows holding matched cells. Rows keep their sheet numbers, so outliers
+// point at the cells they were found in. A result computed from a chunk
+// alone, when the sheet cannot be read again, is marked truncated if the
+// chunk was.
+func (h *ToolHandler) calculateStatistics(file *excelize.File, results *models.QueryResults, query string, aggregateReq *analytics.AggregateRequest, anomalyReq *analytics.AnomalyRequest, hasHeader, propagateMerged bool) (*models.Statistics, error) {
+	statistics := &models.Statistics{
 		Aggregations:       []interface{}{},
 		Patterns:           []interface{}{},
 		Outliers:           []interface{}{},
 		FormulaEvaluations: []interface{}{},
 	}
+
+	if aggregateReq == nil && anomalyReq == nil {
+		return statistics, nil
+	}
+
+	// Work on each sheet separately, since they have their own headers
+	for _, match := range matchesBySheet(results.Data) {
+		var table *analytics.Table
+		truncated := false
+		if file != nil {
+			rows, numbers, err := sheetRowsNumbered(file, match.sheet, 0, 0, propagateMerged)
+			if err == nil {
+				table = matchedTable(rows, numbers, match, hasHeader)
+			}
+		}
+		if table == nil {
+			if len(match.chunk) == 0 {
+				continue
+			}
+			table = analytics.NewTable(match.chunk, hasHeader)
+			truncated = match.truncated
+		}
+		table.Sheet = match.sheet
+
+		if aggregateReq != nil {
+			result, err := h.aggregator.Aggregate(table, *aggregateReq)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", match.sheet, err)
+			}
+			result.Source = match.sheet
+			result.Truncated = truncated
+
+			statistics.Aggregations = append(statistics.Aggregations, result)
+		}
+
+		if anomalyReq != nil {
+			anomalies, _, err := h.detector.Detect(table, *anomalyReq)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", match.sheet, err)
+			}
+
+			for _, anomaly := range anomalies {
+				statistics.Outliers = append(statistics.Outliers, anomaly)
+			}
+		}
+	}
+
+	return statistics, nil
+}
+
+// sheetMatch gathers the query matches of one sheet
+type sheetMatch struct {
+	sheet string
+	// whole is set when the sheet matched as a whole; rows otherwise
+	// holds the 1-based rows of the matched cells
+	whole bool
+	rows  map[int]bool
+	// chunk is the tabular data returned for a whole-sheet match, used
+	// when the sheet cannot be read again
+	chunk     [][]interface{}
+	truncated bool
+}
+
+// matchesBySheet groups result chunks by sheet, in the order the sheets
+// first appear.
+func matchesBySheet(chunks []models.DataChunk) []*sheetMatch {
+	var matches []*sheetMatch
+	bySheet := make(map[string]*sheetMatch)
+	for _, chunk := range chunks {
+		sheet := chunkSheet(chunk)
+		match, ok := bySheet[sheet]
+		if !ok {
+			match = &sheetMatch{sheet: sheet, rows: make(map[int]bool)}
+			bySheet[sheet] = match
+			matches = append(matches, match)
+		}
+
+		if rows, ok := chunk.DataChunk.([][]interface{}); ok {
+			match.whole = true
+			if len(rows) > 0 && match.chunk == nil {
+				match.chunk, match.truncated = rows, chunk.Metadata.Truncated
+			}
+			continue
+		}
+		if i := strings.LastIndex(chunk.Location, "!"); i >= 0 {
+			if _, row, err := excelize.CellNameToCoordinates(chunk.Location[i+1:]); err == nil {
+				match.rows[row] = true
+			}
+		}
+	}
+	return matches
 }
 
-func (h *ToolHandler) applyAdaptiveResponse(results *models.QueryResults, tokenAware bool) (*models.AdaptiveResponse, error) {
+// matchedTable builds the table of the matched rows of a sheet read with
+// sheetRowsNumbered. With hasHeader the first row gives the headers; it
+// is never a data row, even when a match falls in it. Nil when no row
+// matched.
+func matchedTable(rows [][]interface{}, numbers []int, match *sheetMatch, hasHeader bool) *analytics.Table {
+	var raw [][]interface{}
+	var dataNumbers []int
+	for i, row := range rows {
+		if hasHeader && i == 0 {
+			raw = append(raw, row)
+			continue
+		}
+		if match.whole || match.rows[numbers[i]] {
+			raw = append(raw, row)
+			dataNumbers = append(dataNumbers, numbers[i])
+		}
+	}
+	if len(dataNumbers) == 0 {
+		return nil
+	}
+
+	table := analytics.NewTable(raw, hasHeader)
+	table.RowNumbers = dataNumbers
+	return table
+}
+
+// parseAggregateRequest reads the aggregations, group_by and having
+// parameters. It returns nil when no aggregation was requested.
+func parseAggregateRequest(params map[string]interface{}) (*analytics.AggregateRequest, error) {
+	rawAggs, ok := params["aggregations"].([]interface{})
+	if !ok || len(rawAggs) == 0 {
+		return nil, nil
+	}
+
+	req := &analytics.AggregateRequest{}
+	for i, raw := range rawAggs {
+		aggMap, ok := raw.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("aggregation %d must be an object", i)
+		}
+
+		spec := analytics.AggregateSpec{}
+		if fn, ok := aggMap["function"].(string); ok {
+			spec.Function = analytics.AggregateFunc(strings.ToLower(fn))
+		}
+		if col, ok := aggMap["column"].(string); ok {
+			spec.Column = col
+		}
+		if alias, ok := aggMap["alias"].(string); ok {
+			spec.Alias = alias
+		}
+		if p, ok := aggMap["percentile"].(float64); ok {
+			spec.Percentile = p
+		}
+
+		req.Aggregates = append(req.Aggregates, spec)
+	}
+
+	switch gb := params["group_by"].(type) {
+	case string:
+		if gb != "" {
+			req.GroupBy = []string{gb}
+		}
+	case []interface{}:
+		for _, col := range gb {
+			if name, ok := col.(string); ok {
+				req.GroupBy = append(req.GroupBy, name)
+			}
+		}
+	}
+
+	if having, ok := params["having"].(string); ok {
+		req.Having = having
+	}
+
+	return req, nil
+}
+
+// applyAdaptiveResponse counts the results for the session's model and
+// scales the strategies for each model family to what the session has
+// left of that model's context
+func (h *ToolHandler) applyAdaptiveResponse(ctx context.Context, results *models.QueryResults, tokenAware bool) (*models.AdaptiveResponse, error) {
 	if !tokenAware {
 		return &models.AdaptiveResponse{}, nil
 	}
 
+	session := sessionFrom(ctx)
+	modelName := session.Model()
+
 	// Count tokens in results
-	tokenCount, err := h.tokenCounter.Count(results)
+	tokenCount, err := h.tokenCounter.CountForModel(modelName, results)
 	if err != nil {
 		return nil, err
 	}
 
-	// Get model limits (detect or default)
-	modelName := "sonnet-4"
 	limits := h.tokenCounter.GetModelLimits(modelName)
+	used := session.Used() + tokenCount
 
 	return &models.AdaptiveResponse{
 		ModelContext: models.ModelContext{
 			Detected:     modelName,
 			Limit:        limits.Context,
-			Used:         tokenCount,
+			Used:         used,
+			Remaining:    max(limits.SafeBuffer-used, 0),
 			PreciseCount: tokenCount,
 		},
-		IfSonnetBeta: models.StrategyConfig{
-			MaxResults:  500,
-			WindowRows:  5000,
-			Compression: "light",
-		},
-		IfStandard: models.StrategyConfig{
-			MaxResults:  100,
-			WindowRows:  1000,
-			Compression: "medium",
-		},
-		IfOpus: models.StrategyConfig{
-			MaxResults:  100,
-			WindowRows:  800,
-			Compression: "aggressive",
-		},
+		IfSonnetBeta: h.adaptStrategy("sonnet-4-beta", used, models.StrategyConfig{MaxResults: 500, WindowRows: 5000}),
+		IfStandard:   h.adaptStrategy("sonnet-4", used, models.StrategyConfig{MaxResults: 100, WindowRows: 1000}),
+		IfOpus:       h.adaptStrategy("opus-4-1", used, models.StrategyConfig{MaxResults: 100, WindowRows: 800}),
 	}, nil
 }
 
+// adaptStrategy shrinks a strategy for a model in proportion to the
+// share of its safe buffer still free after used tokens. Compression
+// names how hard the next responses should be shaped: light with more
+// than half the context free, medium above a fifth, aggressive below.
+func (h *ToolHandler) adaptStrategy(modelName string, used int, strategy models.StrategyConfig) models.StrategyConfig {
+	limits := h.tokenCounter.GetModelLimits(modelName)
+	free := float64(max(limits.SafeBuffer-used, 0)) / float64(limits.SafeBuffer)
+
+	strategy.MaxResults = max(int(float64(strategy.MaxResults)*free), 1)
+	strategy.WindowRows = max(int(float64(strategy.WindowRows)*free), 1)
+	switch {
+	case free > 0.5:
+		strategy.Compression = "light"
+	case free > 0.2:
+		strategy.Compression = "medium"
+	default:
+		strategy.Compression = "aggressive"
+	}
+	return strategy
+}
+
+// encodeResults puts the tabular matches in format, headers first and
+// anchored at their top-left cell, and with costs counts the tokens each
+// format would take across them. With a budget, matches are shaped in
+// order to what earlier ones left of it; once it is spent, the remaining
+// matches are returned without their rows.
+func (h *ToolHandler) encodeResults(ctx context.Context, results *models.QueryResults, format string, hasHeader, costs bool, budget int) error {
+	shaper := h.shaper.ForModel(h.detectModel(ctx))
+	remaining := budget
+	totals := make(map[string]int)
+	for i := range results.Data {
+		chunk := &results.Data[i]
+		rows, ok := chunk.DataChunk.([][]interface{})
+		if !ok || len(rows) == 0 {
+			continue
+		}
+
+		top, leftCol := 1, 1
+		if t, l, _, _, ok := chunkBounds(*chunk); ok {
+			top, leftCol = t, l
+		}
+		header, body := tableHeader(rows, hasHeader, leftCol)
+
+		if costs {
+			chunkCosts, err := shaper.FormatCosts(header, body)
+			if err != nil {
+				return err
+			}
+			for f, tokens := range chunkCosts {
+				totals[f] += tokens
+			}
+		}
+
+		chunkFormat := format
+		if budget > 0 {
+			if remaining <= 0 {
+				chunk.DataChunk = nil
+				chunk.Metadata.Truncated = true
+				continue
+			}
+			shaped, report, err := shaper.Shape(compression.Table{Columns: header, Rows: body}, remaining)
+			if err != nil {
+				return err
+			}
+			// Only the first match may run over, with the fewest rows
+			// shaping keeps
+			if report.Tokens > remaining && remaining < budget {
+				chunk.DataChunk = nil
+				chunk.Metadata.Truncated = true
+				remaining = 0
+				continue
+			}
+			remaining -= report.Tokens
+			if len(report.Steps) > 0 {
+				chunk.Shaping = &report
+				chunk.Constants = shaped.Constants
+				chunk.Metadata.Truncated = report.RowsReturned < report.RowsTotal
+				chunk.Anchor, _ = excelize.CoordinatesToCellName(leftCol, top)
+				if shaped.CSV != "" {
+					chunk.Format = compression.FormatCSV
+					chunk.DataChunk = shaped.CSV
+					continue
+				}
+				// Dropped columns no longer line up with the sheet, so
+				// the rows carry their header
+				header, body = shaped.Columns, shaped.Rows
+				if chunkFormat == "" {
+					chunkFormat = compression.FormatJSONRows
+				}
+			}
+		}
+
+		if chunkFormat == "" {
+			continue
+		}
+		encoded, err := compression.Encode(chunkFormat, header, body)
+		if err != nil {
+			return err
+		}
+		chunk.Format = chunkFormat
+		chunk.Anchor, _ = excelize.CoordinatesToCellName(leftCol, top)
+		chunk.DataChunk = encoded
+	}
+
+	if len(totals) > 0 {
+		results.FormatCosts = totals
+	}
+	return nil
+}
+
+// tableHeader splits rows into column names and data rows. Columns
+// without a header, or every column without a header row, are named by
+// their letter counted from the column left starts at.
+func tableHeader(rows [][]interface{}, hasHeader bool, left int) ([]string, [][]interface{}) {
+	width := 0
+	for _, row := range rows {
+		width = max(width, len(row))
+	}
+
+	var first []interface{}
+	if hasHeader {
+		first, rows = rows[0], rows[1:]
+	}
+
+	header := make([]string, width)
+	for col := range header {
+		if col < len(first) && first[col] != nil && first[col] != "" {
+			switch v := first[col].(type) {
+			case string:
+				header[col] = v
+			case float64:
+				header[col] = strconv.FormatFloat(v, 'f', -1, 64)
+			default:
+				header[col] = fmt.Sprint(v)
+			}
+			continue
+		}
+		header[col], _ = excelize.ColumnNumberToName(left + col)
+	}
+	return header, rows
+}
+
 func (h *ToolHandler) createQueryPagination(query string, offset int64, resultCount int, windowConfig map[string]interface{}) *models.Pagination {
 	maxResults := 100
 	if mr, ok := windowConfig["max_results"].(int); ok {
@@ -517,22 +930,143 @@ func parseSpatialBounds(query string) (*index.Rectangle, error) {
 	}, nil
 }
 
+// dropHiddenSheets removes the matches found on hidden or very hidden
+// sheets.
+func dropHiddenSheets(file *excelize.File, data []models.DataChunk) []models.DataChunk {
+	hidden := workbook.HiddenSheets(file)
+	if len(hidden) == 0 {
+		return data
+	}
+	kept := data[:0]
+	for _, chunk := range data {
+		if _, ok := hidden[chunkSheet(chunk)]; !ok {
+			kept = append(kept, chunk)
+		}
+	}
+	return kept
+}
+
+// addMergedContext lists in each match's context the merged regions
+// overlapping its window, so a single cell hit inside a merged header
+// carries the header value and range.
+func addMergedContext(file *excelize.File, data []models.DataChunk) {
+	merges := make(map[string]workbook.Merges)
+	for i := range data {
+		sheet := chunkSheet(data[i])
+		sheetMerges, ok := merges[sheet]
+		if !ok {
+			sheetMerges, _ = workbook.ReadMerges(file, sheet)
+			merges[sheet] = sheetMerges
+		}
+		if len(sheetMerges) == 0 {
+			continue
+		}
+
+		top, left, bottom, right, ok := chunkBounds(data[i])
+		if !ok {
+			continue
+		}
+		if within := sheetMerges.Within(top, left, bottom, right); len(within) > 0 {
+			data[i].Context.Merged = within.Regions()
+		}
+	}
+}
+
+// addCommentContext attaches to each match the comments of the cells in
+// its window.
+func addCommentContext(file *excelize.File, data []models.DataChunk) {
+	comments := make(map[string][]models.CellComment)
+	for i := range data {
+		sheet := chunkSheet(data[i])
+		sheetComments, ok := comments[sheet]
+		if !ok {
+			sheetComments, _ = workbook.Comments(file, sheet)
+			comments[sheet] = sheetComments
+		}
+		if len(sheetComments) == 0 {
+			continue
+		}
+
+		top, left, bottom, right, ok := chunkBounds(data[i])
+		if !ok {
+			continue
+		}
+		for _, comment := range sheetComments {
+			col, row, err := excelize.CellNameToCoordinates(comment.Cell)
+			if err == nil && row >= top && row <= bottom && col >= left && col <= right {
+				data[i].Context.Comments = append(data[i].Context.Comments, comment)
+			}
+		}
+	}
+}
+
+// chunkBounds returns the 1-based rows and columns of a match window
+// such as B4:F20.
+func chunkBounds(chunk models.DataChunk) (top, left, bottom, right int, ok bool) {
+	bounds := strings.SplitN(chunk.Window, ":", 2)
+	if len(bounds) != 2 {
+		return 0, 0, 0, 0, false
+	}
+	left, top, err := excelize.CellNameToCoordinates(bounds[0])
+	if err != nil {
+		return 0, 0, 0, 0, false
+	}
+	right, bottom, err = excelize.CellNameToCoordinates(bounds[1])
+	if err != nil {
+		return 0, 0, 0, 0, false
+	}
+	return top, left, bottom, right, true
+}
+
+// chunkSheet is the sheet named in a match location such as 'Bilan 2025'!B4.
+func chunkSheet(chunk models.DataChunk) string {
+	sheet := chunk.Location
+	if i := strings.LastIndex(sheet, "!"); i >= 0 {
+		sheet = sheet[:i]
+	}
+	return strings.Trim(sheet, "'")
+}
+
 // extractRealSheetData extrait les vraies données financières d'une feuille Excel
-func (h *ToolHandler) extractRealSheetData(sheetName string, maxRows int) ([][]interface{}, error) {
-	// Ouvrir le fichier Excel (en dur pour l'instant)
-	file, err := excelize.OpenFile("/Volumes/SSD/MCP/COMBINE INTERACTIF 02 2025.xlsm")
+// Avec propagateMerged, les cellules fusionnées reprennent la valeur de
+// leur cellule en haut à gauche.
+func (h *ToolHandler) extractRealSheetData(filepath string, opts workbook.Options, sheetName string, maxRows int, propagateMerged bool) ([][]interface{}, error) {
+	file, err := workbook.Open(filepath, opts)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open Excel file: %w", err)
 	}
 	defer file.Close()
 
+	// Limiter à 21 colonnes pour éviter les données vides
+	return sheetRows(file, sheetName, maxRows, 21, propagateMerged)
+}
+
+// sheetRows lit les lignes non vides d'une feuille, les nombres convertis
+// en float64. maxRows et maxCols à 0 lisent toute la feuille.
+func sheetRows(file *excelize.File, sheetName string, maxRows, maxCols int, propagateMerged bool) ([][]interface{}, error) {
+	rows, _, err := sheetRowsNumbered(file, sheetName, maxRows, maxCols, propagateMerged)
+	return rows, err
+}
+
+// sheetRowsNumbered lit les lignes comme sheetRows et renvoie aussi le
+// numéro de ligne (à partir de 1) de chacune dans la feuille.
+func sheetRowsNumbered(file *excelize.File, sheetName string, maxRows, maxCols int, propagateMerged bool) ([][]interface{}, []int, error) {
 	// Obtenir les lignes de la feuille
 	rows, err := file.GetRows(sheetName)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get rows from sheet %s: %w", sheetName, err)
+		return nil, nil, fmt.Errorf("failed to get rows from sheet %s: %w", sheetName, err)
+	}
+
+	if propagateMerged {
+		merges, err := workbook.ReadMerges(file, sheetName)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read merged cells of sheet %s: %w", sheetName, err)
+		}
+		rows = merges.Fill(rows)
 	}
 
 	var financialData [][]interface{}
+	var rowNumbers []int
 	
 	// Limiter le nombre de lignes
 	maxRowsToProcess := len(rows)
@@ -551,7 +1085,7 @@ func (h *ToolHandler) extractRealSheetData(sheetName string, maxRows int) ([][]i
 		
 		// Traiter chaque cellule de la ligne
 		for j, cell := range row {
-			if j > 20 { // Limiter à 20 colonnes pour éviter les données vides
+			if maxCols > 0 && j >= maxCols {
 				break
 			}
 			
@@ -571,10 +1105,11 @@ func (h *ToolHandler) extractRealSheetData(sheetName string, maxRows int) ([][]i
 		// Ajouter seulement les lignes non vides
 		if len(processedRow) > 0 && hasNonEmptyData(processedRow) {
 			financialData = append(financialData, processedRow)
+			rowNumbers = append(rowNumbers, i+1)
 		}
 	}
 
-	return financialData, nil
+	return financialData, rowNumbers, nil
 }
 
 // parseFinancialValue tente de parser une valeur financière
@@ -583,14 +1118,8 @@ func parseFinancialValue(value string) (float64, error) {
 		return 0, fmt.Errorf("empty value")
 	}
 	
-	// Nettoyer la valeur (supprimer espaces, virgules françaises)
-	cleaned := strings.ReplaceAll(value, " ", "")
-	cleaned = strings.ReplaceAll(cleaned, ",", ".")
-	
-	// Essayer de parser
-	var result float64
-	n, err := fmt.Sscanf(cleaned, "%f", &result)
-	if err != nil || n != 1 {
+	result, ok := analytics.ParseNumber(value)
+	if !ok {
 		return 0, fmt.Errorf("not a number: %s", value)
 	}
 	
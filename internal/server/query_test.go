@@ -0,0 +1,78 @@
+package server
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+
+	"mcp-xlsm-server/internal/analytics"
+	"mcp-xlsm-server/internal/models"
+)
+
+func TestCalculateStatistics(t *testing.T) {
+	f := excelize.NewFile()
+	defer f.Close()
+	// Row 2 is left empty so row numbers and data positions differ
+	f.SetSheetRow("Sheet1", "A1", &[]interface{}{"Rayon", "Montant"})
+	amounts := []float64{100, 102, 98, 101, 99, 100, 950, 103}
+	for i, amount := range amounts {
+		cell, _ := excelize.CoordinatesToCellName(1, i+3)
+		f.SetSheetRow("Sheet1", cell, &[]interface{}{"R" + string(rune('A'+i)), amount})
+	}
+	f.NewSheet("Stock")
+	f.SetSheetRow("Stock", "A1", &[]interface{}{"Article", "Qte"})
+	f.SetSheetRow("Stock", "A2", &[]interface{}{"Vis", 10})
+	f.SetSheetRow("Stock", "A3", &[]interface{}{"Clou", 20})
+	f.SetSheetRow("Stock", "A4", &[]interface{}{"Vis", 30})
+
+	whole := func() models.DataChunk {
+		rows, err := sheetRows(f, "Sheet1", 0, 0, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return models.DataChunk{Location: "Sheet1!A1", DataChunk: rows}
+	}
+	cell := func(location string) models.DataChunk {
+		return models.DataChunk{Location: location, DataChunk: "sample_value"}
+	}
+	results := &models.QueryResults{Data: []models.DataChunk{
+		whole(), whole(),
+		cell("Stock!A2"), cell("Stock!A4"), cell("Stock!B4"),
+	}}
+
+	h := newTestToolHandler(t)
+	aggregate := &analytics.AggregateRequest{Aggregates: []analytics.AggregateSpec{{Function: analytics.Count, Column: "B"}, {Function: analytics.Sum, Column: "B"}}}
+	anomaly := &analytics.AnomalyRequest{Columns: []string{"B"}, Methods: []analytics.AnomalyMethod{analytics.ZScore}, Thresholds: map[analytics.AnomalyMethod]float64{analytics.ZScore: 2}}
+
+	statistics, err := h.calculateStatistics(f, results, "", aggregate, anomaly, true, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// One aggregation per sheet; Stock counts its two matched rows only
+	if len(statistics.Aggregations) != 2 {
+		t.Fatalf("%d aggregations, want one per sheet", len(statistics.Aggregations))
+	}
+	tests := []struct {
+		source string
+		want   string
+	}{
+		{"Sheet1", "[8 1653]"},
+		{"Stock", "[2 40]"},
+	}
+	for i, tt := range tests {
+		result := statistics.Aggregations[i].(*analytics.AggregateResult)
+		if got := fmt.Sprint(result.Rows[0]); result.Source != tt.source || got != tt.want {
+			t.Errorf("%s: aggregation from %s = %s, want %s", tt.source, result.Source, got, tt.want)
+		}
+	}
+
+	// The outlier keeps its sheet row despite the empty row above
+	if len(statistics.Outliers) != 1 {
+		t.Fatalf("%d outliers, want 1: %+v", len(statistics.Outliers), statistics.Outliers)
+	}
+	if got := statistics.Outliers[0].(models.Anomaly); got.Location != "Sheet1!B9" || got.Value != 950.0 {
+		t.Errorf("outlier = %+v, want 950 at Sheet1!B9", got)
+	}
+}
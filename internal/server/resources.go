@@ -0,0 +1,478 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/xuri/excelize/v2"
+
+	"mcp-xlsm-server/internal/analytics"
+	"mcp-xlsm-server/internal/compression"
+	"mcp-xlsm-server/internal/models"
+	"mcp-xlsm-server/internal/streaming"
+	"mcp-xlsm-server/internal/watch"
+	"mcp-xlsm-server/internal/workbook"
+)
+
+const (
+	resourceScheme   = "xlsm://"
+	resourceMimeType = "text/csv"
+	// Sheet resources stop here; range URIs reach further down
+	maxResourceRows = 1000
+	maxResourceCols = 16384
+)
+
+// ResourceHandler exposes the sheets, ranges and Excel tables of watched
+// workbooks as MCP resources, and notifies subscribers when the
+// underlying file changes. Subscriptions are kept per session, and only
+// taken once a notifier can reach the client.
+type ResourceHandler struct {
+	watcher *watch.Watcher
+	shaper  *compression.Manager
+	mu      sync.Mutex
+	// Subscribed URIs by session ID
+	subscriptions map[string]map[string]bool
+	notify        func(method string, params interface{})
+}
+
+func NewResourceHandler(watcher *watch.Watcher, shaper *compression.Manager) *ResourceHandler {
+	rh := &ResourceHandler{
+		watcher:       watcher,
+		shaper:        shaper,
+		subscriptions: make(map[string]map[string]bool),
+	}
+	watcher.OnChange(rh.handleChange)
+	return rh
+}
+
+// SetNotifier sets how notifications reach the client; without one they
+// are dropped.
+func (rh *ResourceHandler) SetNotifier(notify func(method string, params interface{})) {
+	rh.mu.Lock()
+	defer rh.mu.Unlock()
+
+	rh.notify = notify
+}
+
+// Notifies tells whether notifications reach the client, and so whether
+// subscriptions and list changes can be offered
+func (rh *ResourceHandler) Notifies() bool {
+	rh.mu.Lock()
+	defer rh.mu.Unlock()
+
+	return rh.notify != nil
+}
+
+// Forget drops the subscriptions of a session
+func (rh *ResourceHandler) Forget(sessionID string) {
+	rh.mu.Lock()
+	defer rh.mu.Unlock()
+
+	delete(rh.subscriptions, sessionID)
+}
+
+// resources/list; encrypted workbooks are only listed to sessions that
+// gave their password
+func (rh *ResourceHandler) List(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	resources := []models.Resource{}
+
+	session := sessionFrom(ctx)
+	for _, path := range rh.watcher.Paths() {
+		file, err := workbook.Open(path, workbook.Options{Password: session.Password(path, "")})
+		if err != nil {
+			continue
+		}
+
+		id := workbookID(path)
+		base := filepath.Base(path)
+		for _, sheetName := range file.GetSheetList() {
+			resources = append(resources, models.Resource{
+				URI:         resourceURI(id, "sheet", sheetName),
+				Name:        fmt.Sprintf("%s - %s", base, sheetName),
+				Description: fmt.Sprintf("First %d rows of sheet %s; use a range URI for more", maxResourceRows, sheetName),
+				MimeType:    resourceMimeType,
+			})
+
+			tables, err := file.GetTables(sheetName)
+			if err != nil {
+				continue
+			}
+			for _, tbl := range tables {
+				resources = append(resources, models.Resource{
+					URI:         resourceURI(id, "table", tbl.Name),
+					Name:        fmt.Sprintf("%s - %s", base, tbl.Name),
+					Description: fmt.Sprintf("Excel table %s (%s!%s)", tbl.Name, sheetName, tbl.Range),
+					MimeType:    resourceMimeType,
+				})
+			}
+		}
+		file.Close()
+	}
+
+	return map[string]interface{}{"resources": resources}, nil
+}
+
+// resources/templates/list
+func (rh *ResourceHandler) ListTemplates(params map[string]interface{}) (interface{}, error) {
+	templates := []models.ResourceTemplate{
+		{
+			URITemplate: resourceScheme + "{workbook_id}/sheet/{sheet}",
+			Name:        "Sheet",
+			Description: fmt.Sprintf("First %d rows of a sheet as CSV", maxResourceRows),
+			MimeType:    resourceMimeType,
+		},
+		{
+			URITemplate: resourceScheme + "{workbook_id}/range/{sheet}!{range}",
+			Name:        "Range",
+			Description: "A cell range such as Bilan!A1:F50 as CSV",
+			MimeType:    resourceMimeType,
+		},
+		{
+			URITemplate: resourceScheme + "{workbook_id}/table/{table}",
+			Name:        "Excel table",
+			Description: "An Excel table (ListObject) as CSV, header included",
+			MimeType:    resourceMimeType,
+		},
+	}
+
+	return map[string]interface{}{"resourceTemplates": templates}, nil
+}
+
+// resources/read
+func (rh *ResourceHandler) Read(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	uri, _ := params["uri"].(string)
+	ref, err := rh.resolve(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := workbook.Open(ref.path, workbook.Options{Password: sessionFrom(ctx).Password(ref.path, "")})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open XLSM file: %w", err)
+	}
+	defer file.Close()
+
+	sheetName, window, err := ref.window(file)
+	if err != nil {
+		return nil, err
+	}
+
+	format, _ := params["format"].(string)
+	if format != "" && !compression.ValidFormat(format) {
+		return nil, fmt.Errorf("unknown format %q, expected one of %s", format, strings.Join(compression.Formats, ", "))
+	}
+
+	tokenBudget := 0
+	if tb, ok := params["token_budget"].(float64); ok && tb > 0 {
+		tokenBudget = int(tb)
+	}
+
+	propagate, _ := params["propagate_merged"].(bool)
+	rows, err := streaming.NewWindowedReader(file, sheetName, window).PropagateMerged(propagate).ReadWindow()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", uri, err)
+	}
+	anchor, _ := excelize.CoordinatesToCellName(window.StartCol+1, window.StartRow+1)
+	contents := models.ResourceContents{URI: uri, MimeType: resourceMimeType, Anchor: anchor}
+
+	// Fit the window to the budget, its first row taken as the header;
+	// rows are only cut from the end
+	if tokenBudget > 0 {
+		header, body := windowTable(rows, window.StartCol)
+		shaped, report, err := rh.shaper.ForModel(sessionFrom(ctx).Model()).Shape(compression.Table{Columns: header, Rows: body}, tokenBudget)
+		if err != nil {
+			return nil, err
+		}
+		if len(report.Steps) > 0 {
+			contents.Constants = shaped.Constants
+			contents.Shaping = &report
+			if shaped.CSV != "" {
+				contents.Text = shaped.CSV
+			} else {
+				if format == "" {
+					format = compression.FormatCSV
+				}
+				contents.MimeType = formatMimeTypes[format]
+				if contents.Text, err = encodeTable(format, shaped.Columns, shaped.Rows); err != nil {
+					return nil, err
+				}
+			}
+			return map[string]interface{}{"contents": []models.ResourceContents{contents}}, nil
+		}
+	}
+
+	if format == "" {
+		var buf bytes.Buffer
+		writer := csv.NewWriter(&buf)
+		if err := writer.WriteAll(rows); err != nil {
+			return nil, err
+		}
+		contents.Text = buf.String()
+	} else {
+		contents.MimeType = formatMimeTypes[format]
+		header, body := windowTable(rows, window.StartCol)
+		if contents.Text, err = encodeTable(format, header, body); err != nil {
+			return nil, err
+		}
+	}
+
+	return map[string]interface{}{"contents": []models.ResourceContents{contents}}, nil
+}
+
+var formatMimeTypes = map[string]string{
+	compression.FormatJSONRows: "application/json",
+	compression.FormatColumnar: "application/json",
+	compression.FormatCSV:      "text/csv",
+	compression.FormatMarkdown: "text/markdown",
+	compression.FormatTSV:      "text/tab-separated-values",
+}
+
+// windowTable splits a window read into its first row, taken as the
+// header and widened to the widest row with column letters counted from
+// the zero-based startCol, and the rows under it
+func windowTable(rows [][]string, startCol int) ([]string, [][]interface{}) {
+	var header []string
+	if len(rows) > 0 {
+		header, rows = rows[0], rows[1:]
+	}
+	body := make([][]interface{}, len(rows))
+	for i, row := range rows {
+		for len(header) < len(row) {
+			name, _ := excelize.ColumnNumberToName(startCol + len(header) + 1)
+			header = append(header, name)
+		}
+		body[i] = make([]interface{}, len(row))
+		for j, value := range row {
+			body[i][j] = value
+		}
+	}
+	return header, body
+}
+
+// encodeTable renders rows under header in format as resource text
+func encodeTable(format string, header []string, rows [][]interface{}) (string, error) {
+	encoded, err := compression.Encode(format, header, rows)
+	if err != nil {
+		return "", err
+	}
+	if text, ok := encoded.(string); ok {
+		return text, nil
+	}
+	data, err := json.Marshal(encoded)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// resources/subscribe
+func (rh *ResourceHandler) Subscribe(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	uri, _ := params["uri"].(string)
+	if _, err := rh.resolve(uri); err != nil {
+		return nil, err
+	}
+
+	session := sessionFrom(ctx)
+	rh.mu.Lock()
+	defer rh.mu.Unlock()
+
+	if rh.notify == nil {
+		return nil, fmt.Errorf("resource subscriptions are only available over stdio")
+	}
+	if rh.subscriptions[session.ID] == nil {
+		rh.subscriptions[session.ID] = make(map[string]bool)
+	}
+	rh.subscriptions[session.ID][uri] = true
+
+	return map[string]interface{}{}, nil
+}
+
+// resources/unsubscribe
+func (rh *ResourceHandler) Unsubscribe(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	uri, _ := params["uri"].(string)
+
+	session := sessionFrom(ctx)
+	rh.mu.Lock()
+	delete(rh.subscriptions[session.ID], uri)
+	if len(rh.subscriptions[session.ID]) == 0 {
+		delete(rh.subscriptions, session.ID)
+	}
+	rh.mu.Unlock()
+
+	return map[string]interface{}{}, nil
+}
+
+// handleChange tells subscribers of the changed workbook that their
+// resource was updated, and every client that the list changed when
+// sheets were added, removed or renamed.
+func (rh *ResourceHandler) handleChange(event watch.Event) {
+	id := workbookID(event.Path)
+
+	changedSheets := make(map[string]bool)
+	listChanged := false
+	for _, delta := range event.Deltas {
+		changedSheets[delta.SheetID] = true
+		switch delta.Type {
+		case models.SheetAdd, models.SheetRemove, models.SheetRename:
+			listChanged = true
+		}
+		if oldName, ok := delta.OldValue.(string); ok && delta.Type == models.SheetRename {
+			changedSheets[oldName] = true
+		}
+	}
+
+	rh.mu.Lock()
+	notify := rh.notify
+	var updated []string
+	seen := make(map[string]bool)
+	for _, uris := range rh.subscriptions {
+		for uri := range uris {
+			if seen[uri] {
+				continue
+			}
+			seen[uri] = true
+			ref, err := parseResourceURI(uri)
+			if err != nil || ref.workbookID != id {
+				continue
+			}
+			// Table names do not tell which sheet they live on
+			if ref.kind == "table" || changedSheets[ref.sheetName()] {
+				updated = append(updated, uri)
+			}
+		}
+	}
+	rh.mu.Unlock()
+
+	if notify == nil {
+		return
+	}
+	for _, uri := range updated {
+		notify("notifications/resources/updated", map[string]interface{}{"uri": uri})
+	}
+	if listChanged {
+		notify("notifications/resources/list_changed", map[string]interface{}{})
+	}
+}
+
+type resourceRef struct {
+	workbookID string
+	path       string
+	kind       string
+	name       string
+}
+
+func (rh *ResourceHandler) resolve(uri string) (*resourceRef, error) {
+	ref, err := parseResourceURI(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, path := range rh.watcher.Paths() {
+		if workbookID(path) == ref.workbookID {
+			ref.path = path
+			return ref, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown workbook %s; build its navigation map first", ref.workbookID)
+}
+
+// parseResourceURI splits xlsm://<workbook_id>/<kind>/<name>.
+func parseResourceURI(uri string) (*resourceRef, error) {
+	if !strings.HasPrefix(uri, resourceScheme) {
+		return nil, fmt.Errorf("invalid resource URI: %s", uri)
+	}
+
+	parts := strings.SplitN(strings.TrimPrefix(uri, resourceScheme), "/", 3)
+	if len(parts) != 3 || parts[0] == "" || parts[2] == "" {
+		return nil, fmt.Errorf("invalid resource URI: %s", uri)
+	}
+
+	name, err := url.PathUnescape(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("invalid resource URI: %s", uri)
+	}
+
+	switch parts[1] {
+	case "sheet", "range", "table":
+	default:
+		return nil, fmt.Errorf("unknown resource kind %q, expected sheet, range or table", parts[1])
+	}
+
+	return &resourceRef{workbookID: parts[0], kind: parts[1], name: name}, nil
+}
+
+// sheetName is the sheet a sheet or range resource reads from.
+func (ref *resourceRef) sheetName() string {
+	if ref.kind == "range" {
+		if i := strings.LastIndex(ref.name, "!"); i >= 0 {
+			return strings.Trim(ref.name[:i], "'")
+		}
+	}
+	return ref.name
+}
+
+// window turns the resource into a sheet and a zero-based window.
+func (ref *resourceRef) window(file *excelize.File) (string, models.Window, error) {
+	switch ref.kind {
+	case "sheet":
+		if idx, _ := file.GetSheetIndex(ref.name); idx < 0 {
+			return "", models.Window{}, fmt.Errorf("unknown sheet: %s", ref.name)
+		}
+		return ref.name, models.Window{EndRow: maxResourceRows - 1, EndCol: maxResourceCols - 1}, nil
+
+	case "range":
+		i := strings.LastIndex(ref.name, "!")
+		if i < 0 {
+			return "", models.Window{}, fmt.Errorf("range must look like Sheet!A1:F50")
+		}
+		window, err := rangeWindow(ref.name[i+1:])
+		return ref.sheetName(), window, err
+
+	default:
+		for _, sheetName := range file.GetSheetList() {
+			tables, err := file.GetTables(sheetName)
+			if err != nil {
+				continue
+			}
+			for _, tbl := range tables {
+				if strings.EqualFold(tbl.Name, ref.name) {
+					window, err := rangeWindow(tbl.Range)
+					return sheetName, window, err
+				}
+			}
+		}
+		return "", models.Window{}, fmt.Errorf("unknown table: %s", ref.name)
+	}
+}
+
+func rangeWindow(rangeRef string) (models.Window, error) {
+	startCol, startRow, endCol, endRow, err := analytics.ParseRange(rangeRef)
+	if err != nil {
+		return models.Window{}, err
+	}
+	return models.Window{
+		StartRow: startRow - 1,
+		EndRow:   endRow - 1,
+		StartCol: startCol - 1,
+		EndCol:   endCol - 1,
+	}, nil
+}
+
+// workbookID is a short stable identifier derived from the file path, so
+// URIs survive edits of the workbook.
+func workbookID(path string) string {
+	sum := sha256.Sum256([]byte(path))
+	return fmt.Sprintf("%x", sum[:6])
+}
+
+func resourceURI(workbookID, kind, name string) string {
+	return fmt.Sprintf("%s%s/%s/%s", resourceScheme, workbookID, kind, url.PathEscape(name))
+}
@@ -0,0 +1,86 @@
+package server
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+
+	"mcp-xlsm-server/internal/diff"
+	"mcp-xlsm-server/internal/models"
+	"mcp-xlsm-server/internal/watch"
+)
+
+func TestResourceSubscriptions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bilan.xlsx")
+	f := excelize.NewFile()
+	f.NewSheet("Bilan")
+	if err := f.SaveAs(path); err != nil {
+		t.Fatal(err)
+	}
+	watcher := watch.NewWatcher(diff.NewStore(4))
+	if _, err := watcher.Register(path); err != nil {
+		t.Fatal(err)
+	}
+	rh := NewResourceHandler(watcher, nil)
+
+	id := workbookID(path)
+	sheet1 := resourceURI(id, "sheet", "Sheet1")
+	bilan := resourceURI(id, "sheet", "Bilan")
+	a := withSession(context.Background(), newSession("a"))
+	b := withSession(context.Background(), newSession("b"))
+
+	// Without a notifier, as over HTTP, nothing would ever be sent
+	if _, err := rh.Subscribe(a, map[string]interface{}{"uri": sheet1}); err == nil {
+		t.Fatal("subscribe accepted without a way to notify")
+	}
+	if rh.Notifies() {
+		t.Error("Notifies() without a notifier")
+	}
+
+	var notified []string
+	rh.SetNotifier(func(method string, params interface{}) {
+		if uri, ok := params.(map[string]interface{})["uri"].(string); ok {
+			notified = append(notified, uri)
+		}
+	})
+
+	subscribe := []struct {
+		ctx context.Context
+		uri string
+	}{{a, sheet1}, {a, bilan}, {b, bilan}}
+	for _, sub := range subscribe {
+		if _, err := rh.Subscribe(sub.ctx, map[string]interface{}{"uri": sub.uri}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	change := watch.Event{Path: path, Deltas: []models.Delta{
+		{Type: models.CellUpdate, SheetID: "Sheet1"},
+		{Type: models.CellUpdate, SheetID: "Bilan"},
+	}}
+
+	tests := []struct {
+		name   string
+		before func()
+		want   []string
+	}{
+		{"shared subscription notified once", func() {}, []string{bilan, sheet1}},
+		{"unsubscribe is per session", func() {
+			rh.Unsubscribe(b, map[string]interface{}{"uri": bilan})
+		}, []string{bilan, sheet1}},
+		{"forgotten session", func() { rh.Forget("a") }, nil},
+	}
+	for _, tt := range tests {
+		tt.before()
+		notified = nil
+		rh.handleChange(change)
+		sort.Strings(notified)
+		if !reflect.DeepEqual(notified, tt.want) {
+			t.Errorf("%s: notified %v, want %v", tt.name, notified, tt.want)
+		}
+	}
+}
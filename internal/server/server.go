@@ -4,15 +4,18 @@ import (
 	"bufio"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
+	"sync"
 	"time"
 
 	"go.uber.org/zap"
 
 	"mcp-xlsm-server/internal/cache"
-	"mcp-xlsm-server/internal/compression"
+	"mcp-xlsm-server/internal/token"
+	"mcp-xlsm-server/internal/workbook"
 	"mcp-xlsm-server/pkg/config"
 )
 
@@ -20,9 +23,14 @@ type Server struct {
 	config      *config.Config
 	logger      *zap.Logger
 	toolHandler *ToolHandler
+	resources   *ResourceHandler
+	prompts     *PromptHandler
 	cache       *cache.SmartCache
-	compressor  *compression.Manager
+	sessions    *SessionStore
 	httpServer  *http.Server
+	// stdoutMu keeps responses and notifications from interleaving in
+	// stdio mode
+	stdoutMu sync.Mutex
 }
 
 type MCPRequest struct {
@@ -38,8 +46,60 @@ type MCPResponse struct {
 }
 
 type MCPError struct {
-	Code    int    `json:"code"`
-	Message string `json:"message"`
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+// Server-defined JSON-RPC error codes for encrypted workbooks and
+// responses too large for the session
+const (
+	errCodePasswordRequired      = -32001
+	errCodeWrongPassword         = -32002
+	errCodeUnsupportedEncryption = -32003
+	errCodeTokenBudget           = -32004
+)
+
+// requestError turns a handler error into an MCP error. Encrypted
+// workbooks get their own codes, with the scheme in data, so that clients
+// can ask for a password instead of showing a generic failure.
+func requestError(err error, code int) *MCPError {
+	var budget *BudgetError
+	if errors.As(err, &budget) {
+		return &MCPError{
+			Code:    errCodeTokenBudget,
+			Message: budget.Error(),
+			Data: map[string]interface{}{
+				"error_code": "TOKEN_BUDGET_EXCEEDED",
+				"tokens":     budget.Tokens,
+				"remaining":  budget.Remaining,
+				"model":      budget.Model,
+			},
+		}
+	}
+
+	var encrypted *workbook.EncryptedError
+	if !errors.As(err, &encrypted) {
+		return &MCPError{Code: code, Message: err.Error()}
+	}
+
+	switch encrypted.Err {
+	case workbook.ErrPasswordRequired:
+		code = errCodePasswordRequired
+	case workbook.ErrWrongPassword:
+		code = errCodeWrongPassword
+	default:
+		code = errCodeUnsupportedEncryption
+	}
+	return &MCPError{
+		Code:    code,
+		Message: encrypted.Error(),
+		Data: map[string]interface{}{
+			"error_code": encrypted.Code(),
+			"encryption": encrypted.Encryption,
+			"filepath":   encrypted.Path,
+		},
+	}
 }
 
 func New(cfg *config.Config) (*Server, error) {
@@ -49,8 +109,24 @@ func New(cfg *config.Config) (*Server, error) {
 		return nil, fmt.Errorf("failed to create logger: %w", err)
 	}
 
+	// Passwords of encrypted workbooks, by path pattern
+	if cfg.Secrets.PasswordsFile != "" {
+		if err := workbook.LoadPasswords(cfg.Secrets.PasswordsFile); err != nil {
+			return nil, err
+		}
+	}
+
+	// Model limits and tokenizers, from the configured file or the
+	// built-in one; nothing is downloaded
+	if cfg.Tokens.ModelsFile != "" {
+		if err := token.LoadModels(cfg.Tokens.ModelsFile); err != nil {
+			return nil, err
+		}
+	}
+	tokenCounter := token.NewCounter()
+
 	// Initialize tool handler
-	toolHandler, err := NewToolHandler()
+	toolHandler, err := NewToolHandler(tokenCounter)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create tool handler: %w", err)
 	}
@@ -62,17 +138,16 @@ func New(cfg *config.Config) (*Server, error) {
 		return nil, fmt.Errorf("failed to create cache: %w", err)
 	}
 
-	// Initialize compression manager
-	compressor := compression.NewManager(toolHandler.tokenCounter)
-
 	// Create HTTP server
 	mux := http.NewServeMux()
 	server := &Server{
 		config:      cfg,
 		logger:      logger,
 		toolHandler: toolHandler,
+		resources:   NewResourceHandler(toolHandler.watcher, toolHandler.shaper),
+		prompts:     NewPromptHandler(toolHandler),
 		cache:       smartCache,
-		compressor:  compressor,
+		sessions:    NewSessionStore(),
 	}
 
 	// Setup routes
@@ -109,6 +184,12 @@ func (s *Server) StartStdio(ctx context.Context) error {
 	
 	// Start background services
 	go s.startBackgroundServices(ctx)
+
+	// Resource updates are pushed as JSON-RPC notifications
+	s.resources.SetNotifier(s.sendStdioNotification)
+
+	// A stdio server talks to a single client, for the life of the process
+	session := newSession("")
 	
 	// Create stdin reader
 	scanner := bufio.NewScanner(os.Stdin)
@@ -136,7 +217,7 @@ func (s *Server) StartStdio(ctx context.Context) error {
 		fmt.Fprintf(os.Stderr, "Handling MCP request: method=%s id=%v\n", mcpReq.Method, mcpReq.ID)
 		
 		// Route to appropriate handler
-		result, err := s.routeRequest(ctx, &mcpReq)
+		result, err := s.routeRequest(ctx, session, &mcpReq)
 		
 		// Send response
 		response := MCPResponse{
@@ -145,16 +226,13 @@ func (s *Server) StartStdio(ctx context.Context) error {
 		}
 		
 		if err != nil {
-			response.Error = &MCPError{
-				Code:    -32000,
-				Message: err.Error(),
-			}
+			response.Error = requestError(err, -32000)
 			response.Result = nil
 		}
 		
 		// Send response to stdout
 		if jsonResp, marshalErr := json.Marshal(response); marshalErr == nil {
-			fmt.Println(string(jsonResp))
+			s.writeStdio(jsonResp)
 		} else {
 			s.sendStdioError(mcpReq.ID, -32603, "Internal error")
 		}
@@ -178,10 +256,29 @@ func (s *Server) sendStdioError(id interface{}, code int, message string) {
 	}
 	
 	if jsonResp, err := json.Marshal(response); err == nil {
-		fmt.Println(string(jsonResp))
+		s.writeStdio(jsonResp)
 	}
 }
 
+func (s *Server) sendStdioNotification(method string, params interface{}) {
+	notification := map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  method,
+		"params":  params,
+	}
+
+	if jsonNotif, err := json.Marshal(notification); err == nil {
+		s.writeStdio(jsonNotif)
+	}
+}
+
+func (s *Server) writeStdio(line []byte) {
+	s.stdoutMu.Lock()
+	defer s.stdoutMu.Unlock()
+
+	fmt.Println(string(line))
+}
+
 func (s *Server) handleMCPRequest(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -201,14 +298,28 @@ func (s *Server) handleMCPRequest(w http.ResponseWriter, r *http.Request) {
 		zap.Any("id", mcpReq.ID),
 	)
 
+	// An initialize without a session id opens a new session
+	session := s.sessions.Get(r.Header.Get(sessionHeader))
+	if mcpReq.Method == "initialize" && r.Header.Get(sessionHeader) == "" {
+		started, err := s.sessions.Start()
+		if err != nil {
+			s.sendError(w, mcpReq.ID, -32603, err.Error())
+			return
+		}
+		session = started
+	}
+	if session.ID != "" {
+		w.Header().Set(sessionHeader, session.ID)
+	}
+
 	// Route to appropriate handler
-	result, err := s.routeRequest(r.Context(), &mcpReq)
+	result, err := s.routeRequest(r.Context(), session, &mcpReq)
 	if err != nil {
 		s.logger.Error("Request failed",
 			zap.String("method", mcpReq.Method),
 			zap.Error(err),
 		)
-		s.sendError(w, mcpReq.ID, -32603, err.Error())
+		s.sendMCPError(w, mcpReq.ID, requestError(err, -32603))
 		return
 	}
 
@@ -224,7 +335,94 @@ func (s *Server) handleMCPRequest(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func (s *Server) routeRequest(ctx context.Context, req *MCPRequest) (interface{}, error) {
+// Methods whose results land in the model's context, and are counted in
+// the session ledger
+var budgetedMethods = map[string]bool{
+	"analyze_file": true, "build_navigation_map": true, "query_data": true,
+	"detect_anomalies": true, "sql_query": true, "join_sheets": true,
+	"diff_workbooks": true, "write_cells": true, "append_rows": true,
+	"add_sheet": true, "insert_rows": true, "begin_edit": true,
+	"preview_edit": true, "commit_edit": true, "rollback_edit": true,
+	"export": true, "list_comments": true, "read_pivot_cache": true,
+	"summarize_workbook": true, "resources/read": true, "prompts/get": true,
+}
+
+// Budgeted methods that write a workbook or file, or open an edit session.
+// Their results are counted but never refused: the change has been made
+// by the time the result is counted, and refusing it would hide it.
+var sideEffectMethods = map[string]bool{
+	"write_cells": true, "append_rows": true, "add_sheet": true,
+	"insert_rows": true, "begin_edit": true, "commit_edit": true,
+	"rollback_edit": true, "export": true,
+}
+
+// Tools that shape their output to a token_budget, with the budget they
+// use when none is given (0 for none). The budget covers the shaped part;
+// shapingOverhead leaves room for the fields around it.
+const shapingOverhead = 200
+
+var shapedMethods = map[string]int{
+	"query_data":         0,
+	"sql_query":          0,
+	"join_sheets":        0,
+	"read_pivot_cache":   0,
+	"summarize_workbook": defaultSummaryBudget,
+	"resources/read":     0,
+}
+
+// routeRequest runs a request for a session. Results of budgeted methods
+// are counted for the session's model: tools that can shape their output
+// get what is left of the context as their budget, and any other read
+// whose result would overflow it is refused. Reads are refused before
+// they run once nothing is left; side-effecting methods are only counted.
+func (s *Server) routeRequest(ctx context.Context, session *Session, req *MCPRequest) (interface{}, error) {
+	if req.Method == "initialize" {
+		session.Initialize(req.Params)
+		s.resources.Forget(session.ID)
+		return s.initialize(req.Params), nil
+	}
+
+	ctx = withSession(ctx, session)
+	if !budgetedMethods[req.Method] {
+		return s.callMethod(ctx, req)
+	}
+
+	model := session.Model()
+	remaining := session.Remaining(s.toolHandler.tokenCounter.GetModelLimits(model))
+	sideEffect := sideEffectMethods[req.Method]
+	if remaining == 0 && !sideEffect {
+		return nil, &BudgetError{Remaining: remaining, Model: model}
+	}
+	if defaultBudget, ok := shapedMethods[req.Method]; ok {
+		if req.Params == nil {
+			req.Params = map[string]interface{}{}
+		}
+		budget := defaultBudget
+		if tb, ok := req.Params["token_budget"].(float64); ok && tb > 0 {
+			budget = int(tb)
+		}
+		if fit := max(remaining-shapingOverhead, 0); budget == 0 || budget > fit {
+			req.Params["token_budget"] = float64(fit)
+		}
+	}
+
+	result, err := s.callMethod(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	tokens, err := s.toolHandler.tokenCounter.CountForModel(model, result)
+	if err != nil {
+		return nil, err
+	}
+	if tokens > remaining && !sideEffect {
+		return nil, &BudgetError{Tokens: tokens, Remaining: remaining, Model: model}
+	}
+	session.Record(tokens)
+	return result, nil
+}
+
+func (s *Server) callMethod(ctx context.Context, req *MCPRequest) (interface{}, error) {
 	switch req.Method {
 	case "analyze_file":
 		return s.toolHandler.AnalyzeFile(ctx, req.Params)
@@ -235,24 +433,99 @@ func (s *Server) routeRequest(ctx context.Context, req *MCPRequest) (interface{}
 	case "query_data":
 		return s.toolHandler.QueryData(ctx, req.Params)
 
+	case "detect_anomalies":
+		return s.toolHandler.DetectAnomalies(ctx, req.Params)
+
+	case "sql_query":
+		return s.toolHandler.SQLQuery(ctx, req.Params)
+
+	case "join_sheets":
+		return s.toolHandler.JoinSheets(ctx, req.Params)
+
+	case "diff_workbooks":
+		return s.toolHandler.DiffWorkbooks(ctx, req.Params)
+
+	case "write_cells":
+		return s.toolHandler.WriteCells(ctx, req.Params)
+
+	case "append_rows":
+		return s.toolHandler.AppendRows(ctx, req.Params)
+
+	case "add_sheet":
+		return s.toolHandler.AddSheet(ctx, req.Params)
+
+	case "insert_rows":
+		return s.toolHandler.InsertRows(ctx, req.Params)
+
+	case "begin_edit":
+		return s.toolHandler.BeginEdit(ctx, req.Params)
+
+	case "preview_edit":
+		return s.toolHandler.PreviewEdit(ctx, req.Params)
+
+	case "commit_edit":
+		return s.toolHandler.CommitEdit(ctx, req.Params)
+
+	case "rollback_edit":
+		return s.toolHandler.RollbackEdit(ctx, req.Params)
+
+	case "export":
+		return s.toolHandler.Export(ctx, req.Params)
+
+	case "list_comments":
+		return s.toolHandler.ListComments(ctx, req.Params)
+
+	case "read_pivot_cache":
+		return s.toolHandler.ReadPivotCache(ctx, req.Params)
+
+	case "summarize_workbook":
+		return s.toolHandler.SummarizeWorkbook(ctx, req.Params)
+
 	case "list_tools":
 		return s.listTools(), nil
 
 	case "get_server_info":
-		return s.getServerInfo(), nil
+		return s.getServerInfo(ctx), nil
+
+	case "resources/list":
+		return s.resources.List(ctx, req.Params)
+
+	case "resources/templates/list":
+		return s.resources.ListTemplates(req.Params)
+
+	case "resources/read":
+		return s.resources.Read(ctx, req.Params)
+
+	case "resources/subscribe":
+		return s.resources.Subscribe(ctx, req.Params)
+
+	case "resources/unsubscribe":
+		return s.resources.Unsubscribe(ctx, req.Params)
+
+	case "prompts/list":
+		return s.prompts.List(req.Params)
+
+	case "prompts/get":
+		return s.prompts.Get(ctx, req.Params)
 
-	case "initialize":
-		return s.initialize(req.Params), nil
 	default:
 		return nil, fmt.Errorf("unknown method: %s", req.Method)
 	}
 }
 
+// initialize offers resource subscriptions and list changes only where
+// notifications reach the client, which is over stdio
 func (s *Server) initialize(params map[string]interface{}) interface{} {
+	notifies := s.resources.Notifies()
 	return map[string]interface{}{
 		"protocolVersion": "2024-11-05",
 		"capabilities": map[string]interface{}{
 			"tools": map[string]interface{}{},
+			"resources": map[string]interface{}{
+				"subscribe":   notifies,
+				"listChanged": notifies,
+			},
+			"prompts": map[string]interface{}{},
 		},
 		"serverInfo": map[string]interface{}{
 			"name":    "mcp-xlsm-server",
@@ -261,6 +534,13 @@ func (s *Server) initialize(params map[string]interface{}) interface{} {
 	}
 }
 
+// Write tools apply to an edit transaction from begin_edit, or save a
+// file at the checksum the caller last read
+var editTargetSchema = []map[string]interface{}{
+	{"required": []string{"edit_id"}},
+	{"required": []string{"filepath", "checksum"}},
+}
+
 func (s *Server) listTools() interface{} {
 	return map[string]interface{}{
 		"tools": []map[string]interface{}{
@@ -274,6 +554,10 @@ func (s *Server) listTools() interface{} {
 							"type":        "string",
 							"description": "Path to the XLSM file",
 						},
+						"password": map[string]interface{}{
+							"type":        "string",
+							"description": "Password of an encrypted workbook, if not in the passwords file",
+						},
 						"chunk_size": map[string]interface{}{
 							"type":        "integer",
 							"description": "Number of sheets per chunk (default: 50)",
@@ -297,6 +581,10 @@ func (s *Server) listTools() interface{} {
 							"type":        "string",
 							"description": "Path to the XLSM file",
 						},
+						"password": map[string]interface{}{
+							"type":        "string",
+							"description": "Password of an encrypted workbook, if not in the passwords file",
+						},
 						"checksum": map[string]interface{}{
 							"type":        "string",
 							"description": "File checksum for validation",
@@ -310,6 +598,11 @@ func (s *Server) listTools() interface{} {
 							"description": "Maximum sheets per call (default: 1000)",
 							"default":     1000,
 						},
+						"watch": map[string]interface{}{
+							"type":        "boolean",
+							"description": "Keep the index in sync with later edits of the file; changes are reported in delta_tracking",
+							"default":     true,
+						},
 					},
 					"required": []string{"filepath", "checksum"},
 				},
@@ -324,6 +617,64 @@ func (s *Server) listTools() interface{} {
 							"type":        "string",
 							"description": "Search query",
 						},
+						"filepath": map[string]interface{}{
+							"type":        "string",
+							"description": "Path to the XLSM file to read matched sheets from",
+						},
+						"password": map[string]interface{}{
+							"type":        "string",
+							"description": "Password of an encrypted workbook, if not in the passwords file",
+						},
+						"aggregations": map[string]interface{}{
+							"type":        "array",
+							"description": "Aggregates computed over matched rows (sum, avg, min, max, count, count_distinct, median, percentile)",
+							"items": map[string]interface{}{
+								"type": "object",
+								"properties": map[string]interface{}{
+									"function":   map[string]interface{}{"type": "string"},
+									"column":     map[string]interface{}{"type": "string", "description": "Header name, column letter, or * for count"},
+									"percentile": map[string]interface{}{"type": "number", "description": "0-100, for percentile"},
+									"alias":      map[string]interface{}{"type": "string"},
+								},
+								"required": []string{"function", "column"},
+							},
+						},
+						"group_by": map[string]interface{}{
+							"type":        "array",
+							"items":       map[string]interface{}{"type": "string"},
+							"description": "Columns to group aggregates by",
+						},
+						"having": map[string]interface{}{
+							"type":        "string",
+							"description": "Filter on aggregate outputs, e.g. \"sum_amount > 1000 AND count >= 3\"",
+						},
+						"include_rows": map[string]interface{}{
+							"type":        "boolean",
+							"description": "Return matched rows alongside aggregates (default: false when aggregating)",
+						},
+						"format": map[string]interface{}{
+							"type":        "string",
+							"enum":        []string{"json_rows", "columnar", "csv", "markdown", "tsv"},
+							"description": "Encoding of matched rows, headers first; results.format_costs gives the tokens each would take",
+						},
+						"token_budget": map[string]interface{}{
+							"type":        "integer",
+							"description": "Fit matched rows into this many tokens, shaping each match like sql_query with what earlier ones left; matches past the budget come back without rows",
+						},
+						"detect_outliers": map[string]interface{}{
+							"type":        "boolean",
+							"description": "Report outliers of matched rows in statistics.outliers (same options as detect_anomalies)",
+						},
+						"include_hidden_sheets": map[string]interface{}{
+							"type":        "boolean",
+							"description": "Also return matches on hidden and very hidden sheets",
+							"default":     false,
+						},
+						"propagate_merged": map[string]interface{}{
+							"type":        "boolean",
+							"description": "Repeat merged cell values in every covered cell and list the merged regions in each result context",
+							"default":     false,
+						},
 						"navigation_index": map[string]interface{}{
 							"type":        "object",
 							"description": "Navigation index from build_navigation_map",
@@ -346,15 +697,577 @@ func (s *Server) listTools() interface{} {
 							},
 						},
 					},
-					"required": []string{"query", "navigation_index"},
+					"required": []string{"filepath", "query", "navigation_index"},
+				},
+			},
+			{
+				"name":        "detect_anomalies",
+				"description": "Detect outliers and period-over-period jumps in the numeric columns of a sheet",
+				"inputSchema": map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"filepath": map[string]interface{}{
+							"type":        "string",
+							"description": "Path to the XLSM file",
+						},
+						"password": map[string]interface{}{
+							"type":        "string",
+							"description": "Password of an encrypted workbook, if not in the passwords file",
+						},
+						"sheet": map[string]interface{}{
+							"type":        "string",
+							"description": "Sheet to analyze",
+						},
+						"columns": map[string]interface{}{
+							"type":        "array",
+							"items":       map[string]interface{}{"type": "string"},
+							"description": "Header names or column letters (default: all numeric columns)",
+						},
+						"methods": map[string]interface{}{
+							"type":        "array",
+							"items":       map[string]interface{}{"type": "string", "enum": []string{"zscore", "iqr", "mad", "mom"}},
+							"description": "Detection methods (default: zscore, iqr)",
+						},
+						"thresholds": map[string]interface{}{
+							"type":        "object",
+							"description": "Per-method thresholds (defaults: zscore 3, iqr 1.5, mad 3.5, mom 0.5)",
+						},
+						"series": map[string]interface{}{
+							"type":        "string",
+							"enum":        []string{"column", "row"},
+							"description": "Direction periods run in for mom (default: column)",
+						},
+						"header_row": map[string]interface{}{
+							"type":        "integer",
+							"description": "1-based header row, 0 for none (default: 1)",
+							"default":     1,
+						},
+						"max_results": map[string]interface{}{
+							"type":    "integer",
+							"default": 100,
+						},
+					},
+					"required": []string{"filepath", "sheet"},
+				},
+			},
+			{
+				"name":        "sql_query",
+				"description": "Run SQL (SELECT/WHERE/GROUP BY/HAVING/ORDER BY/LIMIT, JOINs) over the sheets and Excel tables of a workbook; SHOW TABLES and DESCRIBE list relations and inferred column types",
+				"inputSchema": map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"filepath": map[string]interface{}{
+							"type":        "string",
+							"description": "Path to the XLSM file",
+						},
+						"password": map[string]interface{}{
+							"type":        "string",
+							"description": "Password of an encrypted workbook, if not in the passwords file",
+						},
+						"sql": map[string]interface{}{
+							"type":        "string",
+							"description": "SQL statement; quote sheet names with spaces, e.g. \"Grand Livre\"",
+						},
+						"cursor": map[string]interface{}{
+							"type":        "string",
+							"description": "Cursor from a previous page (sql may then be omitted)",
+						},
+						"page_size": map[string]interface{}{
+							"type":    "integer",
+							"default": 100,
+						},
+						"token_budget": map[string]interface{}{
+							"type":        "integer",
+							"description": "Fit the page into this many tokens by dropping empty and constant columns, switching to CSV, then returning fewer rows; shaping reports what was left out",
+						},
+						"header_row": map[string]interface{}{
+							"type":        "integer",
+							"description": "1-based header row of sheet relations, 0 for none (default: 1)",
+							"default":     1,
+						},
+					},
+					"required": []string{"filepath"},
+				},
+			},
+			{
+				"name":        "join_sheets",
+				"description": "Join two sheets or Excel tables on key columns with VLOOKUP/XLOOKUP semantics (inner, left, or anti to list unmatched keys)",
+				"inputSchema": map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"filepath": map[string]interface{}{
+							"type":        "string",
+							"description": "Path to the XLSM file",
+						},
+						"password": map[string]interface{}{
+							"type":        "string",
+							"description": "Password of an encrypted workbook, if not in the passwords file",
+						},
+						"left": map[string]interface{}{
+							"type":        "string",
+							"description": "Sheet or table whose rows are looked up",
+						},
+						"right": map[string]interface{}{
+							"type":        "string",
+							"description": "Lookup sheet or table",
+						},
+						"left_key": map[string]interface{}{
+							"type":        []string{"string", "array"},
+							"description": "Key column(s) of the left relation, by header or column letter",
+						},
+						"right_key": map[string]interface{}{
+							"type":        []string{"string", "array"},
+							"description": "Key column(s) of the right relation (default: left_key)",
+						},
+						"join_type": map[string]interface{}{
+							"type":    "string",
+							"enum":    []string{"inner", "left", "anti"},
+							"default": "inner",
+						},
+						"match_mode": map[string]interface{}{
+							"type":        "string",
+							"enum":        []string{"first", "all"},
+							"description": "first returns the first lookup match like VLOOKUP, all returns every match",
+							"default":     "first",
+						},
+						"case_sensitive": map[string]interface{}{
+							"type":    "boolean",
+							"default": false,
+						},
+						"columns": map[string]interface{}{
+							"type":        "array",
+							"items":       map[string]interface{}{"type": "string"},
+							"description": "Output columns; clashing right columns are named right.<header>",
+						},
+						"cursor": map[string]interface{}{
+							"type":        "string",
+							"description": "Cursor from a previous page, sent with the same parameters",
+						},
+						"page_size": map[string]interface{}{
+							"type":    "integer",
+							"default": 100,
+						},
+						"token_budget": map[string]interface{}{
+							"type":        "integer",
+							"description": "Fit the page into this many tokens as sql_query does; shaping reports what was left out",
+						},
+						"header_row": map[string]interface{}{
+							"type":    "integer",
+							"default": 1,
+						},
+					},
+					"required": []string{"filepath", "left", "right", "left_key"},
+				},
+			},
+			{
+				"name":        "diff_workbooks",
+				"description": "Compare two versions of a workbook: sheets added/removed/renamed, inserted or deleted rows, changed values and formulas, and changed VBA modules",
+				"inputSchema": map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"filepath": map[string]interface{}{
+							"type":        "string",
+							"description": "Path to the new version of the XLSM file",
+						},
+						"password": map[string]interface{}{
+							"type":        "string",
+							"description": "Password of an encrypted workbook, if not in the passwords file",
+						},
+						"base_filepath": map[string]interface{}{
+							"type":        "string",
+							"description": "Path to the old version",
+						},
+						"base_password": map[string]interface{}{
+							"type":        "string",
+							"description": "Password of the old version, if encrypted",
+						},
+						"base_checksum": map[string]interface{}{
+							"type":        "string",
+							"description": "Checksum of a cached earlier version (from analyze_file); without either base parameter, the last cached version of filepath is used",
+						},
+						"include_recalculated": map[string]interface{}{
+							"type":        "boolean",
+							"description": "List cells whose formula is unchanged but whose value was recalculated",
+							"default":     false,
+						},
+						"cursor": map[string]interface{}{
+							"type":        "string",
+							"description": "Cursor from a previous page of changes",
+						},
+						"page_size": map[string]interface{}{
+							"type":    "integer",
+							"default": 200,
+						},
+					},
+					"required": []string{"filepath"},
+				},
+			},
+			{
+				"name":        "write_cells",
+				"description": "Write values or formulas to cells. Saves atomically with a timestamped backup, keeps the VBA project, and returns the new checksum and deltas",
+				"inputSchema": map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"filepath": map[string]interface{}{
+							"type":        "string",
+							"description": "Path to the XLSM file",
+						},
+						"edit_id": map[string]interface{}{
+							"type":        "string",
+							"description": "Apply inside an edit transaction from begin_edit instead of saving right away; filepath and checksum are then not needed",
+						},
+						"checksum": map[string]interface{}{
+							"type":        "string",
+							"description": "Checksum of the version being edited; the write is refused if the file changed",
+						},
+						"sheet": map[string]interface{}{
+							"type":        "string",
+							"description": "Sheet of cells given without a sheet name",
+						},
+						"cells": map[string]interface{}{
+							"type":        "array",
+							"description": "Cells to write: {\"cell\": \"B4\" or \"Bilan!B4\", \"value\": ..., \"formula\": \"=SUM(B1:B3)\"}; a null value clears the cell",
+							"items": map[string]interface{}{
+								"type": "object",
+							},
+						},
+						"start_cell": map[string]interface{}{
+							"type":        "string",
+							"description": "Top-left cell of a block of values, e.g. D2 to fill a computed column",
+						},
+						"values": map[string]interface{}{
+							"type":        "array",
+							"description": "Rows of values written from start_cell; strings starting with = are formulas",
+						},
+					},
+					"anyOf": editTargetSchema,
+				},
+			},
+			{
+				"name":        "append_rows",
+				"description": "Append rows below the last used row of a sheet, with the same safe save as write_cells",
+				"inputSchema": map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"filepath": map[string]interface{}{
+							"type":        "string",
+							"description": "Path to the XLSM file",
+						},
+						"edit_id": map[string]interface{}{
+							"type":        "string",
+							"description": "Apply inside an edit transaction from begin_edit instead of saving right away; filepath and checksum are then not needed",
+						},
+						"checksum": map[string]interface{}{
+							"type":        "string",
+							"description": "Checksum of the version being edited",
+						},
+						"sheet": map[string]interface{}{
+							"type":        "string",
+							"description": "Sheet to append to",
+						},
+						"rows": map[string]interface{}{
+							"type":        "array",
+							"description": "Rows of values; strings starting with = are formulas",
+						},
+					},
+					"required": []string{"sheet", "rows"},
+					"anyOf":    editTargetSchema,
+				},
+			},
+			{
+				"name":        "add_sheet",
+				"description": "Add a sheet, optionally filled with rows from A1, with the same safe save as write_cells",
+				"inputSchema": map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"filepath": map[string]interface{}{
+							"type":        "string",
+							"description": "Path to the XLSM file",
+						},
+						"edit_id": map[string]interface{}{
+							"type":        "string",
+							"description": "Apply inside an edit transaction from begin_edit instead of saving right away; filepath and checksum are then not needed",
+						},
+						"checksum": map[string]interface{}{
+							"type":        "string",
+							"description": "Checksum of the version being edited",
+						},
+						"name": map[string]interface{}{
+							"type":        "string",
+							"description": "Name of the new sheet",
+						},
+						"rows": map[string]interface{}{
+							"type":        "array",
+							"description": "Optional initial rows; strings starting with = are formulas",
+						},
+					},
+					"required": []string{"name"},
+					"anyOf":    editTargetSchema,
+				},
+			},
+			{
+				"name":        "insert_rows",
+				"description": "Insert rows before a given row, shifting the rows below and adjusting references, with the same safe save as write_cells",
+				"inputSchema": map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"filepath": map[string]interface{}{
+							"type":        "string",
+							"description": "Path to the XLSM file",
+						},
+						"edit_id": map[string]interface{}{
+							"type":        "string",
+							"description": "Apply inside an edit transaction from begin_edit instead of saving right away; filepath and checksum are then not needed",
+						},
+						"checksum": map[string]interface{}{
+							"type":        "string",
+							"description": "Checksum of the version being edited",
+						},
+						"sheet": map[string]interface{}{
+							"type":        "string",
+							"description": "Sheet to insert into",
+						},
+						"row": map[string]interface{}{
+							"type":        "integer",
+							"description": "1-based row the first inserted row takes",
+						},
+						"rows": map[string]interface{}{
+							"type":        "array",
+							"description": "Rows of values; strings starting with = are formulas",
+						},
+					},
+					"required": []string{"sheet", "row", "rows"},
+					"anyOf":    editTargetSchema,
+				},
+			},
+			{
+				"name":        "begin_edit",
+				"description": "Start an edit transaction: write_cells, append_rows, add_sheet and insert_rows with its edit_id change nothing on disk until commit_edit",
+				"inputSchema": map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"filepath": map[string]interface{}{
+							"type":        "string",
+							"description": "Path to the XLSM file",
+						},
+						"checksum": map[string]interface{}{
+							"type":        "string",
+							"description": "Checksum of the version being edited",
+						},
+					},
+					"required": []string{"filepath", "checksum"},
+				},
+			},
+			{
+				"name":        "preview_edit",
+				"description": "Show what an edit transaction would change: diff against the file on disk and the recalculated values of dependent formulas",
+				"inputSchema": map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"edit_id": map[string]interface{}{
+							"type":        "string",
+							"description": "Edit transaction from begin_edit",
+						},
+						"max_changes": map[string]interface{}{
+							"type":    "integer",
+							"default": 200,
+						},
+					},
+					"required": []string{"edit_id"},
+				},
+			},
+			{
+				"name":        "commit_edit",
+				"description": "Save every change of an edit transaction in one atomic write; refused if the file changed on disk since begin_edit",
+				"inputSchema": map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"edit_id": map[string]interface{}{
+							"type":        "string",
+							"description": "Edit transaction from begin_edit",
+						},
+					},
+					"required": []string{"edit_id"},
+				},
+			},
+			{
+				"name":        "rollback_edit",
+				"description": "Discard an edit transaction; the file is left untouched",
+				"inputSchema": map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"edit_id": map[string]interface{}{
+							"type":        "string",
+							"description": "Edit transaction from begin_edit",
+						},
+					},
+					"required": []string{"edit_id"},
+				},
+			},
+			{
+				"name":        "export",
+				"description": "Export a sheet, range, table or query_data result set to CSV, NDJSON or Parquet, streamed to a file",
+				"inputSchema": map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"filepath": map[string]interface{}{
+							"type":        "string",
+							"description": "Path to the workbook",
+						},
+						"password": map[string]interface{}{
+							"type":        "string",
+							"description": "Password of an encrypted workbook, if not in the passwords file",
+						},
+						"output_path": map[string]interface{}{
+							"type":        "string",
+							"description": "File to write; replaced only once the export is complete",
+						},
+						"sheet": map[string]interface{}{
+							"type":        "string",
+							"description": "Sheet to export, whole or limited by range",
+						},
+						"range": map[string]interface{}{
+							"type":        "string",
+							"description": "A1 range within the sheet, e.g. B3:F120",
+						},
+						"table": map[string]interface{}{
+							"type":        "string",
+							"description": "Excel table to export instead of a sheet",
+						},
+						"query": map[string]interface{}{
+							"type":        "string",
+							"description": "Export the rows query_data returns for this query; other query_data parameters apply",
+						},
+						"has_header": map[string]interface{}{
+							"type":        "boolean",
+							"description": "First row holds the column names (default: true)",
+						},
+						"format": map[string]interface{}{
+							"type":        "string",
+							"enum":        []string{"csv", "ndjson", "parquet"},
+							"description": "Output format (default: from the output_path extension, else csv)",
+						},
+						"delimiter": map[string]interface{}{
+							"type":        "string",
+							"description": "CSV delimiter, one character or \"tab\" (default: ';' for decimal-comma locales, ',' otherwise)",
+						},
+						"locale": map[string]interface{}{
+							"type":        "string",
+							"description": "CSV number locale, e.g. fr-FR writes 12,5",
+						},
+						"csv_header": map[string]interface{}{
+							"type":        "boolean",
+							"description": "Write the CSV header line (default: true)",
+						},
+						"row_group_size": map[string]interface{}{
+							"type":        "integer",
+							"description": "Rows per Parquet row group; column types are inferred from the first, and a later value not fitting its column fails the export (default: 50000)",
+						},
+						"overwrite": map[string]interface{}{
+							"type":        "boolean",
+							"description": "Replace output_path if it exists (default: false)",
+						},
+					},
+					"required": []string{"filepath", "output_path"},
+				},
+			},
+			{
+				"name":        "list_comments",
+				"description": "List cell notes and threaded comments with their replies, filtered by sheet and author",
+				"inputSchema": map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"filepath": map[string]interface{}{
+							"type":        "string",
+							"description": "Path to the workbook",
+						},
+						"password": map[string]interface{}{
+							"type":        "string",
+							"description": "Password of an encrypted workbook, if not in the passwords file",
+						},
+						"sheet": map[string]interface{}{
+							"type":        "string",
+							"description": "Only this sheet (default: every visible sheet)",
+						},
+						"author": map[string]interface{}{
+							"type":        "string",
+							"description": "Only comments written or answered by this author, ignoring case",
+						},
+						"include_hidden_sheets": map[string]interface{}{
+							"type":        "boolean",
+							"description": "Also list comments on hidden and very hidden sheets",
+							"default":     false,
+						},
+					},
+					"required": []string{"filepath"},
+				},
+			},
+			{
+				"name":        "read_pivot_cache",
+				"description": "Return the records saved in a pivot cache as a table; sql_query reads them as the relation pivot_cache_<id>",
+				"inputSchema": map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"filepath": map[string]interface{}{
+							"type":        "string",
+							"description": "Path to the workbook",
+						},
+						"password": map[string]interface{}{
+							"type":        "string",
+							"description": "Password of an encrypted workbook, if not in the passwords file",
+						},
+						"cache_id": map[string]interface{}{
+							"type":        "integer",
+							"description": "Pivot cache id, as listed in analyze_file pivot_caches",
+						},
+						"pivot_table": map[string]interface{}{
+							"type":        "string",
+							"description": "Name of a pivot table whose cache to read, instead of cache_id",
+						},
+						"max_rows": map[string]interface{}{
+							"type":        "integer",
+							"description": "Maximum records returned",
+							"default":     1000,
+						},
+						"token_budget": map[string]interface{}{
+							"type":        "integer",
+							"description": "Fit the records into this many tokens, as in sql_query",
+						},
+					},
+					"required": []string{"filepath"},
+				},
+			},
+			{
+				"name":        "summarize_workbook",
+				"description": "Summarize what a workbook holds within a token budget: sheet roles in reading order, Excel tables and headers, key named ranges, top formulas and macros",
+				"inputSchema": map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"filepath": map[string]interface{}{
+							"type":        "string",
+							"description": "Path to the workbook",
+						},
+						"password": map[string]interface{}{
+							"type":        "string",
+							"description": "Password of an encrypted workbook, if not in the passwords file",
+						},
+						"token_budget": map[string]interface{}{
+							"type":        "integer",
+							"description": "Maximum tokens of the summary; detail is reduced level by level to fit (minimum 200)",
+							"default":     2000,
+						},
+					},
+					"required": []string{"filepath"},
 				},
 			},
 		},
 	}
 }
 
-func (s *Server) getServerInfo() interface{} {
+func (s *Server) getServerInfo(ctx context.Context) interface{} {
+	session := sessionFrom(ctx)
 	return map[string]interface{}{
+		"session": session.Info(s.toolHandler.tokenCounter.GetModelLimits(session.Model())),
 		"name":    "MCP XLSM Server",
 		"version": "2.0.0",
 		"capabilities": map[string]interface{}{
@@ -418,12 +1331,13 @@ func (s *Server) getCacheMemoryUsage() map[string]interface{} {
 }
 
 func (s *Server) sendError(w http.ResponseWriter, id interface{}, code int, message string) {
+	s.sendMCPError(w, id, &MCPError{Code: code, Message: message})
+}
+
+func (s *Server) sendMCPError(w http.ResponseWriter, id interface{}, mcpErr *MCPError) {
 	response := MCPResponse{
-		Error: &MCPError{
-			Code:    code,
-			Message: message,
-		},
-		ID: id,
+		Error: mcpErr,
+		ID:    id,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -432,6 +1346,15 @@ func (s *Server) sendError(w http.ResponseWriter, id interface{}, code int, mess
 }
 
 func (s *Server) startBackgroundServices(ctx context.Context) {
+	// Keep registered workbooks in sync with the files on disk
+	if s.config.Watch.Enabled {
+		interval := s.config.Watch.Interval
+		if interval <= 0 {
+			interval = 2 * time.Second
+		}
+		go s.toolHandler.watcher.Run(ctx, interval)
+	}
+
 	// Start cache cleanup
 	ticker := time.NewTicker(s.config.Cache.CleanupInterval)
 	defer ticker.Stop()
@@ -448,7 +1371,16 @@ func (s *Server) startBackgroundServices(ctx context.Context) {
 
 func (s *Server) performMaintenanceTasks() {
 	// Cache cleanup is handled internally by SmartCache
-	// Add other maintenance tasks here
+
+	// Roll back abandoned edit transactions
+	if expired := s.toolHandler.edits.Expire(); expired > 0 {
+		s.logger.Info("Rolled back expired edits", zap.Int("count", expired))
+	}
+
+	// Forget the sessions of clients that went away
+	if expired := s.sessions.Expire(); expired > 0 {
+		s.logger.Info("Expired idle sessions", zap.Int("count", expired))
+	}
 
 	s.logger.Debug("Performed maintenance tasks",
 		zap.Float64("cache_hit_ratio", s.cache.GetHitRatio()),
@@ -0,0 +1,43 @@
+package server
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestToolSchemasRequireTheirTarget(t *testing.T) {
+	tools := (&Server{}).listTools().(map[string]interface{})["tools"].([]map[string]interface{})
+	schemas := make(map[string]map[string]interface{}, len(tools))
+	for _, tool := range tools {
+		schemas[tool["name"].(string)] = tool["inputSchema"].(map[string]interface{})
+	}
+
+	required := map[string][]string{
+		"analyze_file":         {"filepath"},
+		"build_navigation_map": {"filepath", "checksum"},
+		"query_data":           {"filepath", "query", "navigation_index"},
+	}
+	for name, want := range required {
+		if got := schemas[name]["required"]; !reflect.DeepEqual(got, want) {
+			t.Errorf("%s requires %v, want %v", name, got, want)
+		}
+	}
+
+	for _, name := range []string{"write_cells", "append_rows", "add_sheet", "insert_rows"} {
+		if got := schemas[name]["anyOf"]; !reflect.DeepEqual(got, editTargetSchema) {
+			t.Errorf("%s anyOf = %v, want edit_id or filepath and checksum", name, got)
+		}
+	}
+}
+
+func TestInitializeOffersSubscriptionsOnlyWithNotifications(t *testing.T) {
+	srv := &Server{resources: &ResourceHandler{}}
+	for _, notifier := range []func(string, interface{}){nil, func(string, interface{}) {}} {
+		srv.resources.SetNotifier(notifier)
+		capabilities := srv.initialize(nil).(map[string]interface{})["capabilities"].(map[string]interface{})
+		resources := capabilities["resources"].(map[string]interface{})
+		if want := notifier != nil; resources["subscribe"] != want || resources["listChanged"] != want {
+			t.Errorf("with notifier %v, resources capabilities = %v", notifier != nil, resources)
+		}
+	}
+}
@@ -0,0 +1,235 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"mcp-xlsm-server/internal/token"
+)
+
+// sessionHeader carries the session of an HTTP client, as in the MCP
+// streamable HTTP transport; stdio has a single session.
+const sessionHeader = "Mcp-Session-Id"
+
+// Session is one MCP client: what it said about itself at initialize and
+// a ledger of the tokens returned to it, so later responses know how much
+// of the conversation is left.
+type Session struct {
+	ID string
+
+	mu            sync.Mutex
+	clientName    string
+	clientVersion string
+	modelHint     string
+	model         string
+	tokensUsed    int
+	calls         int
+	lastUsed      time.Time
+	// Passwords the client gave, by absolute workbook path
+	passwords map[string]string
+}
+
+func newSession(id string) *Session {
+	return &Session{ID: id, model: token.DefaultModel(), lastUsed: time.Now()}
+}
+
+// Initialize records the clientInfo and model hints of an initialize
+// request and starts the ledger over, since a client initializes again
+// when it begins a new conversation. Clients rarely say which model drives
+// them, so the hint is looked for in params.model, clientInfo.model and
+// capabilities.experimental.model; without one the default model stays.
+func (s *Session) Initialize(params map[string]interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.tokensUsed = 0
+	s.calls = 0
+	s.passwords = nil
+
+	clientInfo, _ := params["clientInfo"].(map[string]interface{})
+	s.clientName, _ = clientInfo["name"].(string)
+	s.clientVersion, _ = clientInfo["version"].(string)
+
+	s.modelHint = ""
+	if hint, ok := params["model"].(string); ok {
+		s.modelHint = hint
+	} else if hint, ok := clientInfo["model"].(string); ok {
+		s.modelHint = hint
+	} else if capabilities, ok := params["capabilities"].(map[string]interface{}); ok {
+		if experimental, ok := capabilities["experimental"].(map[string]interface{}); ok {
+			s.modelHint, _ = experimental["model"].(string)
+		}
+	}
+
+	s.model = token.DefaultModel()
+	if model, ok := token.ResolveModel(s.modelHint); ok {
+		s.model = model
+	}
+}
+
+// Model is the configured model the session's responses are counted for
+func (s *Session) Model() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.model
+}
+
+// Used is the number of tokens returned to the client so far
+func (s *Session) Used() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.tokensUsed
+}
+
+// Remaining is what is left of the model's safe buffer, never negative
+func (s *Session) Remaining(limits token.ModelLimits) int {
+	return max(limits.SafeBuffer-s.Used(), 0)
+}
+
+// Record adds a response to the ledger
+func (s *Session) Record(tokens int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokensUsed += tokens
+	s.calls++
+}
+
+// Password returns explicit when set, keeping it for later calls of the
+// session on the same workbook, and otherwise the password the session
+// last gave for path. Other sessions never see it.
+func (s *Session) Password(path, explicit string) string {
+	if path == "" {
+		return explicit
+	}
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if explicit != "" {
+		if s.passwords == nil {
+			s.passwords = make(map[string]string)
+		}
+		s.passwords[path] = explicit
+		return explicit
+	}
+	return s.passwords[path]
+}
+
+// Info describes the session for get_server_info
+func (s *Session) Info(limits token.ModelLimits) map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return map[string]interface{}{
+		"id":             s.ID,
+		"client_name":    s.clientName,
+		"client_version": s.clientVersion,
+		"model_hint":     s.modelHint,
+		"model":          s.model,
+		"tokens_used":    s.tokensUsed,
+		"tokens_limit":   limits.SafeBuffer,
+		"calls":          s.calls,
+	}
+}
+
+// Sessions unused for this long are forgotten
+const sessionIdleTimeout = 30 * time.Minute
+
+// SessionStore keeps the sessions of HTTP clients by id. Requests without
+// an id get a session of their own that is not kept, so anonymous callers
+// never share a ledger.
+type SessionStore struct {
+	mu       sync.Mutex
+	sessions map[string]*Session
+	ttl      time.Duration
+}
+
+func NewSessionStore() *SessionStore {
+	return &SessionStore{sessions: make(map[string]*Session), ttl: sessionIdleTimeout}
+}
+
+// Get returns the session with id, starting one for an id the server has
+// not seen, e.g. after a restart or once the session expired
+func (ss *SessionStore) Get(id string) *Session {
+	if id == "" {
+		return newSession("")
+	}
+
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	session, ok := ss.sessions[id]
+	if !ok {
+		session = newSession(id)
+		ss.sessions[id] = session
+	}
+	session.mu.Lock()
+	session.lastUsed = time.Now()
+	session.mu.Unlock()
+	return session
+}
+
+// Expire forgets the sessions unused for longer than the TTL and returns
+// how many there were.
+func (ss *SessionStore) Expire() int {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	expired := 0
+	for id, session := range ss.sessions {
+		session.mu.Lock()
+		idle := time.Since(session.lastUsed)
+		session.mu.Unlock()
+		if idle > ss.ttl {
+			delete(ss.sessions, id)
+			expired++
+		}
+	}
+	return expired
+}
+
+// Start opens a session under a new random id
+func (ss *SessionStore) Start() (*Session, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, fmt.Errorf("failed to create session id: %w", err)
+	}
+	return ss.Get(hex.EncodeToString(buf)), nil
+}
+
+type sessionKey struct{}
+
+func withSession(ctx context.Context, session *Session) context.Context {
+	return context.WithValue(ctx, sessionKey{}, session)
+}
+
+// sessionFrom returns the session of a request; calls made outside one,
+// such as prompts building their context, get a fresh default session
+func sessionFrom(ctx context.Context) *Session {
+	if session, ok := ctx.Value(sessionKey{}).(*Session); ok {
+		return session
+	}
+	return newSession("")
+}
+
+// BudgetError refuses a response that would not fit in what is left of
+// the session's context
+type BudgetError struct {
+	Tokens    int
+	Remaining int
+	Model     string
+}
+
+func (e *BudgetError) Error() string {
+	if e.Tokens == 0 {
+		return fmt.Sprintf("no tokens are left for %s in this session; initialize again to start a new conversation", e.Model)
+	}
+	return fmt.Sprintf("response of %d tokens exceeds the %d tokens left for %s in this session; narrow the request or pass a smaller page_size or token_budget", e.Tokens, e.Remaining, e.Model)
+}
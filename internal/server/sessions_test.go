@@ -0,0 +1,184 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+
+	"mcp-xlsm-server/internal/models"
+	"mcp-xlsm-server/internal/token"
+	"mcp-xlsm-server/pkg/config"
+)
+
+func TestSessionLedger(t *testing.T) {
+	limits := token.ModelLimits{SafeBuffer: 1000}
+	session := newSession("a")
+
+	session.Record(300)
+	session.Record(200)
+	if got := session.Used(); got != 500 {
+		t.Fatalf("Used() = %d, want 500", got)
+	}
+	if got := session.Remaining(limits); got != 500 {
+		t.Fatalf("Remaining() = %d, want 500", got)
+	}
+
+	session.Record(900)
+	if got := session.Remaining(limits); got != 0 {
+		t.Fatalf("Remaining() = %d after overflow, want 0", got)
+	}
+
+	session.Initialize(map[string]interface{}{"clientInfo": map[string]interface{}{"name": "client"}})
+	if got := session.Used(); got != 0 {
+		t.Errorf("Used() = %d after initialize, want 0", got)
+	}
+	if info := session.Info(limits); info["calls"] != 0 || info["client_name"] != "client" {
+		t.Errorf("Info() = %v after initialize", info)
+	}
+}
+
+func TestSessionStore(t *testing.T) {
+	store := NewSessionStore()
+
+	// Anonymous callers never share a ledger
+	store.Get("").Record(100)
+	if got := store.Get("").Used(); got != 0 {
+		t.Errorf("anonymous session used %d tokens, want a fresh one", got)
+	}
+
+	store.Get("kept").Record(100)
+	if got := store.Get("kept").Used(); got != 100 {
+		t.Errorf("kept session used %d tokens, want 100", got)
+	}
+
+	idle := store.Get("idle")
+	idle.Record(50)
+	idle.mu.Lock()
+	idle.lastUsed = time.Now().Add(-2 * sessionIdleTimeout)
+	idle.mu.Unlock()
+
+	if expired := store.Expire(); expired != 1 {
+		t.Errorf("Expire() = %d, want 1", expired)
+	}
+	if got := store.Get("idle").Used(); got != 0 {
+		t.Errorf("expired session kept its ledger of %d tokens", got)
+	}
+	if got := store.Get("kept").Used(); got != 100 {
+		t.Errorf("active session lost its ledger, used %d", got)
+	}
+}
+
+func TestRouteRequestBudget(t *testing.T) {
+	// A missing config file gives the defaults
+	cfg, err := config.LoadFromPath(filepath.Join(t.TempDir(), "config.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	session := newSession("spent")
+	session.Record(srv.toolHandler.tokenCounter.GetModelLimits(session.Model()).SafeBuffer)
+
+	// A read is refused before it runs once nothing is left
+	_, err = srv.routeRequest(context.Background(), session, &MCPRequest{Method: "query_data", Params: map[string]interface{}{}})
+	var budget *BudgetError
+	if !errors.As(err, &budget) {
+		t.Errorf("query_data error = %v, want a BudgetError", err)
+	}
+
+	// A write runs and only fails on its own parameters
+	_, err = srv.routeRequest(context.Background(), session, &MCPRequest{Method: "write_cells", Params: map[string]interface{}{}})
+	if err == nil || errors.As(err, &budget) {
+		t.Errorf("write_cells error = %v, want its own validation error", err)
+	}
+}
+
+func TestSessionPasswords(t *testing.T) {
+	a, b := newSession("a"), newSession("b")
+
+	if got := a.Password("/data/budget.xlsx", "secret"); got != "secret" {
+		t.Fatalf("Password() = %q, want the explicit one", got)
+	}
+	if got := a.Password("/data/budget.xlsx", ""); got != "secret" {
+		t.Errorf("session forgot its password, got %q", got)
+	}
+	if got := a.Password("/data/other.xlsx", ""); got != "" {
+		t.Errorf("password leaked to another file: %q", got)
+	}
+	if got := b.Password("/data/budget.xlsx", ""); got != "" {
+		t.Errorf("password leaked to another session: %q", got)
+	}
+
+	a.Initialize(map[string]interface{}{})
+	if got := a.Password("/data/budget.xlsx", ""); got != "" {
+		t.Errorf("password kept across initialize: %q", got)
+	}
+}
+
+func TestEncryptedWorkbookWatched(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bilan.xlsx")
+	save := func(value string) string {
+		f := excelize.NewFile()
+		f.SetCellValue("Sheet1", "A1", value)
+		if err := f.SaveAs(path, excelize.Options{Password: "motdepasse"}); err != nil {
+			t.Fatal(err)
+		}
+		checksum, err := newTestToolHandler(t).calculateFileChecksum(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return checksum
+	}
+	checksum := save("Actif")
+
+	h := newTestToolHandler(t)
+	a := withSession(context.Background(), newSession("a"))
+	b := withSession(context.Background(), newSession("b"))
+
+	// watch defaults to true
+	if _, err := h.BuildNavigationMap(a, map[string]interface{}{
+		"filepath": path,
+		"checksum": checksum,
+		"password": "motdepasse",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	idx, ok := h.watcher.Index(path)
+	if !ok || len(idx.SearchText("Actif")) != 1 {
+		t.Fatal("encrypted workbook not indexed")
+	}
+
+	// Changes are re-read with the password given at registration
+	newChecksum := save("Passif")
+	if err := h.watcher.Refresh(path); err != nil {
+		t.Fatalf("Refresh() = %v", err)
+	}
+	if got, _ := h.watcher.Checksum(path); got != newChecksum {
+		t.Errorf("watched checksum = %s, want %s", got, newChecksum)
+	}
+	if len(idx.SearchText("Passif")) != 1 || len(idx.SearchText("Actif")) != 0 {
+		t.Error("index not updated from the encrypted workbook")
+	}
+
+	// Only the session that gave the password sees its resources
+	rh := NewResourceHandler(h.watcher, nil)
+	for _, tt := range []struct {
+		name string
+		ctx  context.Context
+		want int
+	}{{"with password", a, 1}, {"without password", b, 0}} {
+		listed, err := rh.List(tt.ctx, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := len(listed.(map[string]interface{})["resources"].([]models.Resource)); got != tt.want {
+			t.Errorf("%s: %d resources listed, want %d", tt.name, got, tt.want)
+		}
+	}
+}
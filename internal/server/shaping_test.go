@@ -0,0 +1,205 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+
+	"mcp-xlsm-server/internal/models"
+	"mcp-xlsm-server/internal/token"
+)
+
+func newTestToolHandler(t *testing.T) *ToolHandler {
+	t.Helper()
+	h, err := NewToolHandler(token.NewCounter())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
+
+func ledgerRows(n int) [][]interface{} {
+	rows := [][]interface{}{{"Compte", "Exercice", "Libelle", "Montant"}}
+	for i := 0; i < n; i++ {
+		rows = append(rows, []interface{}{fmt.Sprintf("6%05d", i), "2025", fmt.Sprintf("Ecriture de regularisation numero %d", i), float64(i) * 12.5})
+	}
+	return rows
+}
+
+func TestEncodeResultsBudget(t *testing.T) {
+	h := newTestToolHandler(t)
+
+	tests := []struct {
+		name      string
+		budget    int
+		shaped    []bool
+		truncated []bool
+		dropped   []bool
+	}{
+		{"no budget", 0, []bool{false, false}, []bool{false, false}, []bool{false, false}},
+		{"first match spends it", 300, []bool{true, false}, []bool{true, true}, []bool{false, true}},
+	}
+
+	for _, tt := range tests {
+		results := &models.QueryResults{Data: []models.DataChunk{
+			{Location: "Sheet1!A1", Window: "A1:D101", DataChunk: ledgerRows(100)},
+			{Location: "Sheet2!A1", Window: "A1:D101", DataChunk: ledgerRows(100)},
+		}}
+		if err := h.encodeResults(context.Background(), results, "", true, false, tt.budget); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		for i, chunk := range results.Data {
+			if (chunk.Shaping != nil) != tt.shaped[i] {
+				t.Errorf("%s: match %d shaping = %+v, want shaped %v", tt.name, i, chunk.Shaping, tt.shaped[i])
+			}
+			if chunk.Metadata.Truncated != tt.truncated[i] {
+				t.Errorf("%s: match %d truncated = %v, want %v", tt.name, i, chunk.Metadata.Truncated, tt.truncated[i])
+			}
+			if (chunk.DataChunk == nil) != tt.dropped[i] {
+				t.Errorf("%s: match %d rows = %v, want dropped %v", tt.name, i, chunk.DataChunk, tt.dropped[i])
+			}
+		}
+		if first := results.Data[0]; first.Shaping != nil {
+			if first.Constants["Exercice"] != "2025" {
+				t.Errorf("%s: constants = %v, want Exercice moved there", tt.name, first.Constants)
+			}
+			if first.Format == "" || first.Anchor != "A1" {
+				t.Errorf("%s: shaped match format %q anchor %q", tt.name, first.Format, first.Anchor)
+			}
+		}
+	}
+}
+
+func TestJoinSheetsBudget(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "join.xlsx")
+	f := excelize.NewFile()
+	f.NewSheet("Comptes")
+	for i, row := range ledgerRows(200) {
+		cell, _ := excelize.CoordinatesToCellName(1, i+1)
+		f.SetSheetRow("Sheet1", cell, &row)
+		if i == 0 {
+			f.SetSheetRow("Comptes", cell, &[]interface{}{"Compte", "Classe"})
+		} else {
+			f.SetSheetRow("Comptes", cell, &[]interface{}{row[0], "6"})
+		}
+	}
+	if err := f.SaveAs(path); err != nil {
+		t.Fatal(err)
+	}
+
+	h := newTestToolHandler(t)
+	params := map[string]interface{}{
+		"filepath":  path,
+		"left":      "Sheet1",
+		"right":     "Comptes",
+		"left_key":  "Compte",
+		"page_size": float64(200),
+	}
+
+	whole, err := h.JoinSheets(context.Background(), params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if whole.Shaping != nil || whole.RowCount != 200 {
+		t.Fatalf("unbudgeted join returned %d rows, shaping %+v", whole.RowCount, whole.Shaping)
+	}
+
+	params["token_budget"] = float64(800)
+	shaped, err := h.JoinSheets(context.Background(), params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if shaped.Shaping == nil {
+		t.Fatal("budgeted join was not shaped")
+	}
+	if shaped.RowCount != shaped.Shaping.RowsReturned || shaped.RowCount >= 200 {
+		t.Errorf("row_count %d, rows_returned %d", shaped.RowCount, shaped.Shaping.RowsReturned)
+	}
+	if shaped.Pagination.NextCursor == "" || shaped.Shaping.NextCursor != shaped.Pagination.NextCursor {
+		t.Errorf("next cursor %q, shaping next cursor %q", shaped.Pagination.NextCursor, shaped.Shaping.NextCursor)
+	}
+
+	// Following the cursors returns every row once, even below one row
+	params["token_budget"] = float64(1)
+	seen := 0
+	for page := 0; ; page++ {
+		if page > 200 {
+			t.Fatal("cursor does not advance")
+		}
+		response, err := h.JoinSheets(context.Background(), params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		seen += response.RowCount
+		if response.Pagination.NextCursor == "" {
+			break
+		}
+		params["cursor"] = response.Pagination.NextCursor
+	}
+	if seen != 200 {
+		t.Errorf("paged through %d joined rows, want 200", seen)
+	}
+}
+
+func TestShapedPagesAdvance(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pages.xlsx")
+	f := excelize.NewFile()
+	for i, row := range ledgerRows(60) {
+		cell, _ := excelize.CoordinatesToCellName(1, i+1)
+		f.SetSheetRow("Sheet1", cell, &row)
+	}
+	if err := f.SaveAs(path); err != nil {
+		t.Fatal(err)
+	}
+
+	// A budget below one row still moves the cursor on every page
+	h := newTestToolHandler(t)
+	params := map[string]interface{}{
+		"filepath":     path,
+		"sql":          "SELECT * FROM Sheet1",
+		"token_budget": float64(1),
+	}
+	seen := 0
+	for page := 0; ; page++ {
+		if page > 60 {
+			t.Fatal("cursor does not advance")
+		}
+		response, err := h.SQLQuery(context.Background(), params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if response.RowCount == 0 {
+			t.Fatalf("page %d returned no rows", page)
+		}
+		seen += response.RowCount
+		if response.Pagination.NextCursor == "" {
+			break
+		}
+		params["cursor"] = response.Pagination.NextCursor
+	}
+	if seen != 60 {
+		t.Errorf("paged through %d rows, want 60", seen)
+	}
+
+	tests := []struct {
+		name       string
+		start, end int
+		returned   int
+		want       int
+		fails      bool
+	}{
+		{"cut page", 20, 40, 5, 25, false},
+		{"whole page", 20, 40, 20, 40, false},
+		{"empty page", 40, 40, 0, 40, false},
+		{"no row fits", 20, 40, 0, 0, true},
+	}
+	for _, tt := range tests {
+		got, err := shapedPageEnd(tt.start, tt.end, models.ShapingReport{RowsReturned: tt.returned}, 1)
+		if (err != nil) != tt.fails || got != tt.want {
+			t.Errorf("%s: shapedPageEnd() = %d, %v; want %d, fails %v", tt.name, got, err, tt.want, tt.fails)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"mcp-xlsm-server/internal/compression"
+	"mcp-xlsm-server/internal/models"
+	"mcp-xlsm-server/internal/sqlquery"
+	"mcp-xlsm-server/internal/workbook"
+)
+
+// Tool 5: sql_query
+func (h *ToolHandler) SQLQuery(ctx context.Context, params map[string]interface{}) (*models.SQLQueryResponse, error) {
+	// Extract parameters
+	filepath, ok := params["filepath"].(string)
+	if !ok {
+		return nil, fmt.Errorf("filepath parameter is required")
+	}
+
+	sql, _ := params["sql"].(string)
+
+	pageSize := 100
+	if ps, ok := params["page_size"].(float64); ok && ps > 0 {
+		pageSize = int(ps)
+	}
+
+	tokenBudget := 0
+	if tb, ok := params["token_budget"].(float64); ok && tb > 0 {
+		tokenBudget = int(tb)
+	}
+
+	headerRow := 1
+	if hr, ok := params["header_row"].(float64); ok {
+		headerRow = int(hr)
+	}
+
+	startTime := time.Now()
+
+	checksum, err := h.calculateFileChecksum(filepath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to calculate checksum: %w", err)
+	}
+
+	// A cursor carries the statement and the row offset of the next page
+	var offset int64
+	currentCursor := ""
+	if cc, ok := params["cursor"].(string); ok && cc != "" {
+		cursorData, err := h.cursorManager.ParseCursor(cc)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cursor: %w", err)
+		}
+		if cursorData.Checksum != checksum {
+			return nil, fmt.Errorf("workbook changed since the cursor was issued, run the query again")
+		}
+		if sql != "" && sql != cursorData.ChunkID {
+			return nil, fmt.Errorf("cursor belongs to a different query")
+		}
+		sql = cursorData.ChunkID
+		offset = cursorData.Offset
+		currentCursor = cc
+	}
+
+	if sql == "" {
+		return nil, fmt.Errorf("sql parameter is required")
+	}
+
+	file, err := workbook.Open(filepath, workbookOptions(ctx, params))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open XLSM file: %w", err)
+	}
+	defer file.Close()
+
+	executor := sqlquery.NewExecutor(sqlquery.NewWorkbookCatalog(file, headerRow))
+	result, err := executor.Query(sql)
+	if err != nil {
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+
+	// Paginate the full result
+	totalRows := len(result.Rows)
+	start := int(offset)
+	if start > totalRows {
+		start = totalRows
+	}
+	end := start + pageSize
+	if end > totalRows {
+		end = totalRows
+	}
+
+	columns := make([]models.SQLColumn, len(result.Columns))
+	names := make([]string, len(result.Columns))
+	for i, col := range result.Columns {
+		columns[i] = models.SQLColumn{Name: col.Name, Type: col.Type}
+		names[i] = col.Name
+	}
+
+	response := &models.SQLQueryResponse{
+		Columns:   columns,
+		Rows:      result.Rows[start:end],
+		TotalRows: totalRows,
+		Relations: result.Relations,
+	}
+
+	// Fit the page to the budget; the next page starts after the last
+	// row the shaped page kept
+	if tokenBudget > 0 {
+		shaped, report, err := h.shaper.ForModel(h.detectModel(ctx)).Shape(compression.Table{Columns: names, Rows: response.Rows}, tokenBudget)
+		if err != nil {
+			return nil, err
+		}
+		if len(report.Steps) > 0 {
+			response.Columns = shapedColumns(columns, shaped.Columns)
+			response.Rows = shaped.Rows
+			response.CSV = shaped.CSV
+			response.Constants = shaped.Constants
+			response.Shaping = &report
+		}
+		if end, err = shapedPageEnd(start, end, report, tokenBudget); err != nil {
+			return nil, err
+		}
+	}
+
+	var nextCursor, previousCursor string
+	if end < totalRows {
+		nextCursor = h.cursorManager.CreateQueryCursor(sql, int64(end), checksum, nil)
+	}
+	if start > 0 {
+		prev := start - pageSize
+		if prev < 0 {
+			prev = 0
+		}
+		previousCursor = h.cursorManager.CreateQueryCursor(sql, int64(prev), checksum, nil)
+	}
+	if response.Shaping != nil {
+		response.Shaping.NextCursor = nextCursor
+	}
+
+	response.RowCount = end - start
+	response.Pagination = models.Pagination{
+		CurrentCursor:   currentCursor,
+		NextCursor:      nextCursor,
+		PreviousCursor:  previousCursor,
+		RemainingChunks: (totalRows - end + pageSize - 1) / pageSize,
+	}
+	response.Performance = models.QueryPerformance{
+		QueryTimeMs: time.Since(startTime).Milliseconds(),
+	}
+	return response, nil
+}
+
+// shapedColumns keeps the typed columns a shaped table still holds
+func shapedColumns(columns []models.SQLColumn, kept []string) []models.SQLColumn {
+	result := make([]models.SQLColumn, 0, len(kept))
+	next := 0
+	for _, col := range columns {
+		if next < len(kept) && col.Name == kept[next] {
+			result = append(result, col)
+			next++
+		}
+	}
+	return result
+}
+
+// shapedPageEnd is the end of a page that shaping cut to report's rows.
+// A page that kept no row is an error: its cursor would never advance.
+func shapedPageEnd(start, end int, report models.ShapingReport, tokenBudget int) (int, error) {
+	if report.RowsReturned == 0 && end > start {
+		return 0, fmt.Errorf("token_budget %d is too small for a single row, raise it", tokenBudget)
+	}
+	return start + report.RowsReturned, nil
+}
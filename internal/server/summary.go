@@ -0,0 +1,384 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+
+	"mcp-xlsm-server/internal/analytics"
+	"mcp-xlsm-server/internal/models"
+	"mcp-xlsm-server/internal/vba"
+	"mcp-xlsm-server/internal/workbook"
+)
+
+const (
+	// Rows scanned per sheet for formula shapes and headers
+	maxSummaryRows = 5000
+	// Formula shapes kept per sheet before shaping
+	maxSummaryFormulas = 10
+	// Smallest budget a summary is shaped to, and the one used by default
+	minSummaryBudget     = 200
+	defaultSummaryBudget = 2000
+)
+
+var nameTokenPattern = regexp.MustCompile(`[A-Za-z_\\][\w.\\]*`)
+
+// Detail kept at each level of a workbook summary, from 0 (sheet names
+// and roles) to 4 (full)
+type summaryDetail struct {
+	sizes       bool
+	tables      bool
+	headers     int
+	formulas    int
+	namedRanges int
+}
+
+var summaryLevels = []summaryDetail{
+	{},
+	{sizes: true, tables: true},
+	{sizes: true, tables: true, headers: 5, namedRanges: 10},
+	{sizes: true, tables: true, headers: 10, formulas: 3, namedRanges: 20},
+	{sizes: true, tables: true, headers: 20, formulas: 5, namedRanges: 50},
+}
+
+// Everything known about a sheet, before shaping
+type sheetFacts struct {
+	summary  models.SheetSummary
+	headers  []string
+	tables   []models.TableSummary
+	formulas []models.FormulaSummary
+}
+
+// Tool 19: summarize_workbook
+func (h *ToolHandler) SummarizeWorkbook(ctx context.Context, params map[string]interface{}) (*models.SummarizeWorkbookResponse, error) {
+	filepath, ok := params["filepath"].(string)
+	if !ok {
+		return nil, fmt.Errorf("filepath parameter is required")
+	}
+
+	budget := defaultSummaryBudget
+	if tb, ok := params["token_budget"].(float64); ok && tb > 0 {
+		budget = int(tb)
+	}
+	if budget < minSummaryBudget {
+		budget = minSummaryBudget
+	}
+
+	startTime := time.Now()
+
+	format, err := workbook.Detect(filepath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to detect format: %w", err)
+	}
+	file, err := workbook.Open(filepath, workbookOptions(ctx, params))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open XLSM file: %w", err)
+	}
+	defer file.Close()
+
+	full, sheets, err := h.collectSummary(ctx, file, filepath)
+	if err != nil {
+		return nil, err
+	}
+	full.Format = string(format)
+
+	// Shrink detail level by level, then drop the last sheets in reading
+	// order, until the summary fits
+	var summary models.WorkbookSummary
+	var omitted []string
+	var countTime time.Duration
+	count := func() (int, error) {
+		countStart := time.Now()
+		defer func() { countTime += time.Since(countStart) }()
+		return h.tokenCounter.CountForModel(sessionFrom(ctx).Model(), summary)
+	}
+	level := len(summaryLevels) - 1
+	tokens := 0
+	for ; ; level-- {
+		summary, omitted = shapeSummary(full, sheets, summaryLevels[level], len(sheets))
+		if tokens, err = count(); err != nil {
+			return nil, err
+		}
+		if tokens <= budget || level == 0 {
+			break
+		}
+	}
+	for keep := len(sheets) - 1; tokens > budget && keep > 0; keep-- {
+		summary, omitted = shapeSummary(full, sheets, summaryLevels[0], keep)
+		if tokens, err = count(); err != nil {
+			return nil, err
+		}
+	}
+
+	return &models.SummarizeWorkbookResponse{
+		Filepath:    filepath,
+		Summary:     summary,
+		DetailLevel: level,
+		TokenCount:  tokens,
+		TokenBudget: budget,
+		Omitted:     omitted,
+		Performance: models.QueryPerformance{
+			QueryTimeMs:      time.Since(startTime).Milliseconds(),
+			TokenCountTimeMs: countTime.Milliseconds(),
+		},
+	}, nil
+}
+
+// collectSummary gathers the full detail of a workbook summary: roles,
+// tables, headers, formula shapes, named ranges and macros.
+func (h *ToolHandler) collectSummary(ctx context.Context, file *excelize.File, filepath string) (models.WorkbookSummary, []sheetFacts, error) {
+	sheetList := file.GetSheetList()
+	roles := workbook.SheetRoles(file)
+	hidden := workbook.HiddenSheets(file)
+	caches := workbook.PivotCaches(file)
+
+	full := models.WorkbookSummary{
+		SheetsCount: len(sheetList),
+		Roles:       make(map[string]int),
+	}
+
+	names := make(map[string]*models.NamedRangeSummary)
+	var namedRanges []*models.NamedRangeSummary
+	for _, name := range file.GetDefinedName() {
+		// Print areas, filters and hidden helper names are not key ranges
+		if strings.HasPrefix(name.Name, "_xlnm.") || strings.HasPrefix(name.Name, "_xlfn.") || strings.Contains(name.RefersTo, "#REF!") {
+			continue
+		}
+		entry := &models.NamedRangeSummary{Name: name.Name, RefersTo: name.RefersTo}
+		if name.Scope != "" && name.Scope != "Workbook" {
+			entry.Scope = name.Scope
+		}
+		namedRanges = append(namedRanges, entry)
+		names[strings.ToLower(name.Name)] = entry
+	}
+
+	sheets := make([]sheetFacts, 0, len(sheetList))
+	for _, sheetName := range workbook.ReadingOrder(sheetList, roles) {
+		if err := ctx.Err(); err != nil {
+			return full, nil, err
+		}
+		facts := sheetFacts{summary: models.SheetSummary{
+			Name:        sheetName,
+			Role:        roles[sheetName].Role,
+			Visibility:  hidden[sheetName],
+			Charts:      len(workbook.Charts(file, sheetName)),
+			PivotTables: len(workbook.PivotTables(file, sheetName, caches)),
+		}}
+		full.Roles[facts.summary.Role]++
+
+		rows, err := file.GetRows(sheetName)
+		if err != nil {
+			return full, nil, fmt.Errorf("failed to read sheet %s: %w", sheetName, err)
+		}
+		cols := 0
+		for _, row := range rows {
+			cols = max(cols, len(row))
+		}
+		if len(rows) > 0 {
+			facts.summary.Size = fmt.Sprintf("%dx%d", len(rows), cols)
+		}
+		if len(rows) > maxSummaryRows {
+			rows = rows[:maxSummaryRows]
+		}
+
+		tables, _ := file.GetTables(sheetName)
+		for _, tbl := range tables {
+			facts.tables = append(facts.tables, models.TableSummary{
+				Name:    tbl.Name,
+				Range:   tbl.Range,
+				Headers: rangeHeaders(rows, tbl.Range),
+			})
+		}
+		if len(tables) == 0 {
+			facts.headers = sheetHeaders(rows)
+		}
+		facts.formulas = formulaSummaries(file, sheetName, rows, names)
+		sheets = append(sheets, facts)
+	}
+
+	// Names used most by formulas first
+	sort.SliceStable(namedRanges, func(i, j int) bool {
+		return namedRanges[i].Uses > namedRanges[j].Uses
+	})
+	for _, entry := range namedRanges {
+		full.NamedRanges = append(full.NamedRanges, *entry)
+	}
+	full.NamedRangesTotal = len(full.NamedRanges)
+
+	if project := workbook.VBAProject(file); project != nil {
+		full.Macros = &models.MacroSummary{Modules: []string{}}
+		if modules, err := vba.ParseProject(project); err == nil {
+			for _, module := range modules {
+				full.Macros.Modules = append(full.Macros.Modules, module.Name)
+			}
+		}
+	}
+	if deps, err := workbook.Dependencies(file, filepath); err == nil {
+		full.ExternalLinks = len(deps.Links)
+	}
+
+	return full, sheets, nil
+}
+
+// shapeSummary builds the summary at one detail level with the first
+// keep sheets, and describes what it left out.
+func shapeSummary(full models.WorkbookSummary, sheets []sheetFacts, detail summaryDetail, keep int) (models.WorkbookSummary, []string) {
+	summary := full
+	summary.Sheets = make([]models.SheetSummary, 0, keep)
+	var headersCut, formulasCut, tableHeadersCut int
+
+	for i, facts := range sheets {
+		if i == keep {
+			break
+		}
+		sheet := facts.summary
+		if !detail.sizes {
+			sheet.Size, sheet.Charts, sheet.PivotTables = "", 0, 0
+		}
+		sheet.Headers, headersCut = limitStrings(facts.headers, detail.headers, headersCut)
+		if detail.tables {
+			for _, tbl := range facts.tables {
+				tbl.Headers, tableHeadersCut = limitStrings(tbl.Headers, detail.headers, tableHeadersCut)
+				sheet.Tables = append(sheet.Tables, tbl)
+			}
+		}
+		if len(facts.formulas) > detail.formulas {
+			sheet.TopFormulas = facts.formulas[:detail.formulas]
+			formulasCut += len(facts.formulas) - detail.formulas
+		} else {
+			sheet.TopFormulas = facts.formulas
+		}
+		summary.Sheets = append(summary.Sheets, sheet)
+	}
+
+	if len(summary.NamedRanges) > detail.namedRanges {
+		summary.NamedRanges = summary.NamedRanges[:detail.namedRanges]
+	}
+
+	var omitted []string
+	if !detail.sizes {
+		omitted = append(omitted, "sheet sizes, charts and pivot table counts")
+	}
+	if !detail.tables {
+		tablesCut := 0
+		for _, facts := range sheets {
+			tablesCut += len(facts.tables)
+		}
+		if tablesCut > 0 {
+			omitted = append(omitted, fmt.Sprintf("%d Excel tables", tablesCut))
+		}
+	}
+	if headersCut+tableHeadersCut > 0 {
+		omitted = append(omitted, fmt.Sprintf("%d column headers", headersCut+tableHeadersCut))
+	}
+	if formulasCut > 0 {
+		omitted = append(omitted, fmt.Sprintf("%d formula shapes", formulasCut))
+	}
+	if cut := full.NamedRangesTotal - len(summary.NamedRanges); cut > 0 {
+		omitted = append(omitted, fmt.Sprintf("%d named ranges", cut))
+	}
+	if cut := len(sheets) - keep; cut > 0 {
+		omitted = append(omitted, fmt.Sprintf("%d sheets at the end of the reading order", cut))
+	}
+	return summary, omitted
+}
+
+// limitStrings keeps the first n values and adds the others to cut.
+func limitStrings(values []string, n, cut int) ([]string, int) {
+	if len(values) <= n {
+		return values, cut
+	}
+	return values[:n], cut + len(values) - n
+}
+
+// sheetHeaders takes the first row of the first ten with at least two
+// text cells, and no numbers, as the column titles of a sheet.
+func sheetHeaders(rows [][]string) []string {
+	for i := 0; i < len(rows) && i < 10; i++ {
+		var headers []string
+		for _, value := range rows[i] {
+			value = strings.TrimSpace(value)
+			if _, ok := analytics.ParseNumber(value); ok {
+				headers = nil
+				break
+			}
+			if value != "" {
+				headers = append(headers, value)
+			}
+		}
+		if len(headers) >= 2 {
+			return headers
+		}
+	}
+	return nil
+}
+
+// rangeHeaders reads the header row of an A1 range.
+func rangeHeaders(rows [][]string, ref string) []string {
+	first, last, _ := strings.Cut(strings.ReplaceAll(ref, "$", ""), ":")
+	left, top, err := excelize.CellNameToCoordinates(first)
+	if err != nil || top > len(rows) {
+		return nil
+	}
+	right := left
+	if last != "" {
+		if right, _, err = excelize.CellNameToCoordinates(last); err != nil {
+			return nil
+		}
+	}
+	row := rows[top-1]
+	var headers []string
+	for col := left; col <= right && col <= len(row); col++ {
+		headers = append(headers, row[col-1])
+	}
+	return headers
+}
+
+// formulaSummaries groups the formulas of a sheet by shape, most copied
+// first, and counts the named ranges they use.
+func formulaSummaries(file *excelize.File, sheetName string, rows [][]string, names map[string]*models.NamedRangeSummary) []models.FormulaSummary {
+	shapes := make(map[string]*models.FormulaSummary)
+	var order []string
+	for rowIdx, row := range rows {
+		// Formulas not calculated yet have no value, so empty cells are
+		// looked at too
+		for colIdx := range row {
+			cellRef, _ := excelize.CoordinatesToCellName(colIdx+1, rowIdx+1)
+			formula, err := file.GetCellFormula(sheetName, cellRef)
+			if err != nil || formula == "" {
+				continue
+			}
+			for _, token := range nameTokenPattern.FindAllString(formula, -1) {
+				if entry, ok := names[strings.ToLower(token)]; ok {
+					entry.Uses++
+				}
+			}
+
+			key := relativeShape(formula, colIdx+1, rowIdx+1)
+			s, ok := shapes[key]
+			if !ok {
+				s = &models.FormulaSummary{Formula: "=" + formula, Cell: cellRef}
+				shapes[key] = s
+				order = append(order, key)
+			}
+			s.Count++
+		}
+	}
+
+	summaries := make([]models.FormulaSummary, 0, len(order))
+	for _, key := range order {
+		summaries = append(summaries, *shapes[key])
+	}
+	sort.SliceStable(summaries, func(i, j int) bool {
+		return summaries[i].Count > summaries[j].Count
+	})
+	if len(summaries) > maxSummaryFormulas {
+		summaries = summaries[:maxSummaryFormulas]
+	}
+	return summaries
+}
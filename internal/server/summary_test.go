@@ -0,0 +1,155 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+
+	"mcp-xlsm-server/internal/models"
+)
+
+// writeSummaryWorkbook saves a sales table, the calculation reading it
+// and a hidden parameter sheet.
+func writeSummaryWorkbook(t *testing.T) string {
+	t.Helper()
+	f := excelize.NewFile()
+	defer f.Close()
+	f.SetSheetName("Sheet1", "Ventes")
+	f.NewSheet("Calcul")
+	f.NewSheet("Param")
+
+	f.SetSheetRow("Ventes", "A1", &[]interface{}{"Region", "Mois", "Montant"})
+	f.SetSheetRow("Ventes", "A2", &[]interface{}{"Nord", "Janvier", 100})
+	f.SetSheetRow("Ventes", "A3", &[]interface{}{"Sud", "Janvier", 80})
+	f.SetSheetRow("Ventes", "A4", &[]interface{}{"Nord", "Fevrier", 120})
+	if err := f.AddTable("Ventes", &excelize.Table{Range: "A1:C4", Name: "TableVentes"}); err != nil {
+		t.Fatal(err)
+	}
+
+	f.SetSheetRow("Calcul", "A1", &[]interface{}{"Region", "Total"})
+	for i, region := range []string{"Nord", "Sud", "Est"} {
+		row := i + 2
+		f.SetCellValue("Calcul", fmt.Sprintf("A%d", row), region)
+		f.SetCellValue("Calcul", fmt.Sprintf("B%d", row), 0)
+		f.SetCellFormula("Calcul", fmt.Sprintf("B%d", row), fmt.Sprintf("SUMIFS(TableVentes[Montant],TableVentes[Region],A%d)", row))
+	}
+	f.SetCellValue("Calcul", "A6", "Total TTC")
+	f.SetCellValue("Calcul", "B6", 360)
+	f.SetCellFormula("Calcul", "B6", "SUM(B2:B4)*(1+Taux)")
+
+	f.SetSheetRow("Param", "A1", &[]interface{}{"Taux", 0.2})
+	f.SetSheetRow("Param", "A2", &[]interface{}{"Seuil", 100})
+	f.SetSheetVisible("Param", false)
+	for _, name := range []*excelize.DefinedName{
+		{Name: "Seuil", RefersTo: "Param!$B$2", Scope: "Calcul"},
+		{Name: "Taux", RefersTo: "Param!$B$1"},
+		{Name: "_xlnm.Print_Area", RefersTo: "Calcul!$A$1:$B$6", Scope: "Calcul"},
+	} {
+		if err := f.SetDefinedName(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "ventes.xlsx")
+	if err := f.SaveAs(path); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestCollectSummary(t *testing.T) {
+	path := writeSummaryWorkbook(t)
+	file, err := excelize.OpenFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	full, sheets, err := newTestToolHandler(t).collectSummary(context.Background(), file, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantFull := models.WorkbookSummary{
+		SheetsCount: 3,
+		Roles:       map[string]int{"calculation": 1, "input": 1, "data": 1},
+		// Print areas are left out; Taux is used by one formula
+		NamedRanges: []models.NamedRangeSummary{
+			{Name: "Taux", RefersTo: "Param!$B$1", Uses: 1},
+			{Name: "Seuil", RefersTo: "Param!$B$2", Scope: "Calcul"},
+		},
+		NamedRangesTotal: 2,
+	}
+	if !reflect.DeepEqual(full, wantFull) {
+		t.Errorf("collectSummary() = %+v, want %+v", full, wantFull)
+	}
+
+	// In reading order
+	wantSheets := []sheetFacts{
+		{
+			summary: models.SheetSummary{Name: "Calcul", Role: "calculation", Size: "6x2"},
+			headers: []string{"Region", "Total"},
+			formulas: []models.FormulaSummary{
+				{Formula: "=SUMIFS(TableVentes[Montant],TableVentes[Region],A2)", Cell: "B2", Count: 3},
+				{Formula: "=SUM(B2:B4)*(1+Taux)", Cell: "B6", Count: 1},
+			},
+		},
+		{summary: models.SheetSummary{Name: "Param", Role: "input", Visibility: "hidden", Size: "2x2"}, formulas: []models.FormulaSummary{}},
+		{
+			summary:  models.SheetSummary{Name: "Ventes", Role: "data", Size: "4x3"},
+			tables:   []models.TableSummary{{Name: "TableVentes", Range: "A1:C4", Headers: []string{"Region", "Mois", "Montant"}}},
+			formulas: []models.FormulaSummary{},
+		},
+	}
+	if !reflect.DeepEqual(sheets, wantSheets) {
+		t.Errorf("sheets = %+v, want %+v", sheets, wantSheets)
+	}
+
+	tests := []struct {
+		name    string
+		level   int
+		keep    int
+		sheets  int
+		omitted []string
+	}{
+		{"full", 4, 3, 3, nil},
+		{"headers without formulas", 2, 3, 3, []string{"2 formula shapes"}},
+		{"names and roles", 0, 3, 3, []string{"sheet sizes, charts and pivot table counts", "1 Excel tables", "2 column headers", "2 formula shapes", "2 named ranges"}},
+		{"first sheet only", 0, 1, 1, []string{"sheet sizes, charts and pivot table counts", "1 Excel tables", "2 column headers", "2 formula shapes", "2 named ranges", "2 sheets at the end of the reading order"}},
+	}
+	for _, tt := range tests {
+		summary, omitted := shapeSummary(full, sheets, summaryLevels[tt.level], tt.keep)
+		if len(summary.Sheets) != tt.sheets || !reflect.DeepEqual(omitted, tt.omitted) {
+			t.Errorf("%s: %d sheets, omitted %q; want %d, %q", tt.name, len(summary.Sheets), omitted, tt.sheets, tt.omitted)
+		}
+	}
+}
+
+func TestSummarizeWorkbookBudget(t *testing.T) {
+	path := writeSummaryWorkbook(t)
+	h := newTestToolHandler(t)
+	ctx := withSession(context.Background(), newSession("a"))
+
+	for _, budget := range []float64{5000, 200} {
+		resp, err := h.SummarizeWorkbook(ctx, map[string]interface{}{"filepath": path, "token_budget": budget})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.Summary.Format != "xlsx" || resp.Summary.SheetsCount != 3 || resp.Summary.NamedRangesTotal != 2 {
+			t.Errorf("budget %v: summary = %+v, want 3 sheets and 2 named ranges of an xlsx", budget, resp.Summary)
+		}
+		if resp.TokenCount > resp.TokenBudget {
+			t.Errorf("budget %v: %d tokens over the budget", budget, resp.TokenCount)
+		}
+		if budget == 5000 && (resp.DetailLevel != len(summaryLevels)-1 || resp.Omitted != nil) {
+			t.Errorf("budget %v: level %d omitting %q, want the full summary", budget, resp.DetailLevel, resp.Omitted)
+		}
+		if budget == 200 && (resp.DetailLevel == len(summaryLevels)-1 || len(resp.Omitted) == 0) {
+			t.Errorf("budget %v: level %d omitting %q, want a shaped summary", budget, resp.DetailLevel, resp.Omitted)
+		}
+	}
+}
@@ -10,28 +10,57 @@ import (
 
 	"github.com/xuri/excelize/v2"
 
+	"mcp-xlsm-server/internal/analytics"
+	"mcp-xlsm-server/internal/compression"
 	"mcp-xlsm-server/internal/cursor"
+	"mcp-xlsm-server/internal/diff"
+	"mcp-xlsm-server/internal/edit"
 	"mcp-xlsm-server/internal/models"
 	"mcp-xlsm-server/internal/token"
+	"mcp-xlsm-server/internal/watch"
+	"mcp-xlsm-server/internal/workbook"
 )
 
 type ToolHandler struct {
 	cursorManager *cursor.Manager
 	tokenCounter  *token.Counter
+	shaper        *compression.Manager
+	aggregator    *analytics.Engine
+	detector      *analytics.Detector
+	snapshots     *diff.Store
+	watcher       *watch.Watcher
+	edits         *edit.Manager
 }
 
-func NewToolHandler() (*ToolHandler, error) {
-	tokenCounter, err := token.NewCounter()
-	if err != nil {
-		return nil, fmt.Errorf("failed to create token counter: %w", err)
-	}
+func NewToolHandler(tokenCounter *token.Counter) (*ToolHandler, error) {
+	snapshots := diff.NewStore(16)
 
 	return &ToolHandler{
 		cursorManager: cursor.NewManager(),
 		tokenCounter:  tokenCounter,
+		shaper:        compression.NewManager(tokenCounter),
+		aggregator:    analytics.NewEngine(),
+		detector:      analytics.NewDetector(),
+		snapshots:     snapshots,
+		watcher:       watch.NewWatcher(snapshots),
+		edits:         edit.NewManager(editTTL),
 	}, nil
 }
 
+// NewExportHandler builds a handler for the export subcommand. Exports
+// count no tokens, so the tokenizer is not loaded.
+func NewExportHandler() *ToolHandler {
+	snapshots := diff.NewStore(1)
+	return &ToolHandler{
+		cursorManager: cursor.NewManager(),
+		aggregator:    analytics.NewEngine(),
+		detector:      analytics.NewDetector(),
+		snapshots:     snapshots,
+		watcher:       watch.NewWatcher(snapshots),
+		edits:         edit.NewManager(editTTL),
+	}
+}
+
 // Tool 1: analyze_file
 func (h *ToolHandler) AnalyzeFile(ctx context.Context, params map[string]interface{}) (*models.AnalyzeFileResponse, error) {
 	// Extract parameters
@@ -53,7 +82,7 @@ func (h *ToolHandler) AnalyzeFile(ctx context.Context, params map[string]interfa
 	startTime := time.Now()
 
 	// Open and validate file
-	file, err := excelize.OpenFile(filepath)
+	file, err := workbook.Open(filepath, workbookOptions(ctx, params))
 	if err != nil {
 		return nil, fmt.Errorf("failed to open XLSM file: %w", err)
 	}
@@ -65,6 +94,9 @@ func (h *ToolHandler) AnalyzeFile(ctx context.Context, params map[string]interfa
 		return nil, fmt.Errorf("failed to calculate metadata: %w", err)
 	}
 
+	// Keep this version as a baseline for diff_workbooks
+	go h.recordSnapshot(filepath, metadata.Checksum, workbookOptions(ctx, params))
+
 	// Detect model and configure token management
 	modelDetected := h.detectModel(ctx)
 	tokenMgmt := h.createTokenManagement(modelDetected, chunkSize)
@@ -92,6 +124,12 @@ func (h *ToolHandler) AnalyzeFile(ctx context.Context, params map[string]interfa
 		return nil, fmt.Errorf("failed to create index summary: %w", err)
 	}
 
+	// Linked workbooks and hyperlink targets
+	dependencies, err := workbook.Dependencies(file, filepath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to inventory external links: %w", err)
+	}
+
 	// Generate next cursor if more chunks exist
 	var nextCursor string
 	hasMore := len(chunks) > 1
@@ -112,6 +150,7 @@ func (h *ToolHandler) AnalyzeFile(ctx context.Context, params map[string]interfa
 		PatternsDetected: *patterns,
 		TokenManagement:  *tokenMgmt,
 		IndexSummary:     *indexSummary,
+		ExternalDependencies: *dependencies,
 		NextCursor:       nextCursor,
 		HasMore:          hasMore,
 		Performance: models.PerformanceMetrics{
@@ -123,6 +162,14 @@ func (h *ToolHandler) AnalyzeFile(ctx context.Context, params map[string]interfa
 	return response, nil
 }
 
+// workbookOptions reads the password a tool call may give for the
+// encrypted workbook at filepath, or the one given earlier in the session.
+func workbookOptions(ctx context.Context, params map[string]interface{}) workbook.Options {
+	password, _ := params["password"].(string)
+	path, _ := params["filepath"].(string)
+	return workbook.Options{Password: sessionFrom(ctx).Password(path, password)}
+}
+
 func (h *ToolHandler) calculateFileMetadata(filepath string, file *excelize.File) (*models.FileMetadata, error) {
 	// Get file info
 	fileInfo, err := os.Stat(filepath)
@@ -138,6 +185,15 @@ func (h *ToolHandler) calculateFileMetadata(filepath string, file *excelize.File
 	hash := sha256.Sum256(fileData)
 	checksum := fmt.Sprintf("%x", hash)
 
+	format, err := workbook.Detect(filepath)
+	if err != nil {
+		return nil, err
+	}
+	encryption, err := workbook.DetectEncryption(filepath)
+	if err != nil {
+		return nil, err
+	}
+
 	// Count sheets
 	sheetList := file.GetSheetList()
 	sheetsCount := len(sheetList)
@@ -148,13 +204,35 @@ func (h *ToolHandler) calculateFileMetadata(filepath string, file *excelize.File
 	// Estimate memory usage
 	memoryEstimate := h.estimateMemoryUsage(sheetsCount)
 
+	// Visibility, tab colors and protection
+	workbookProtection, sheets, err := workbook.Properties(file)
+	if err != nil {
+		return nil, err
+	}
+
+	// Charts and pivot tables, with the caches holding the pivot data
+	pivotCaches := workbook.PivotCaches(file)
+	for i := range sheets {
+		sheets[i].Charts = workbook.Charts(file, sheets[i].Name)
+		sheets[i].PivotTables = workbook.PivotTables(file, sheets[i].Name, pivotCaches)
+	}
+	var cacheInfos []models.PivotCacheInfo
+	for _, cache := range pivotCaches {
+		cacheInfos = append(cacheInfos, cache.Info())
+	}
+
 	return &models.FileMetadata{
 		Checksum:         checksum,
+		Format:           string(format),
+		Encryption:       string(encryption),
 		FileSize:         fileInfo.Size(),
 		SheetsCount:      sheetsCount,
 		Timestamp:        fileInfo.ModTime(),
 		ComplexityScore:  complexityScore,
 		MemoryEstimate:   memoryEstimate,
+		WorkbookProtection: workbookProtection,
+		Sheets:           sheets,
+		PivotCaches:      cacheInfos,
 	}, nil
 }
 
@@ -210,10 +288,10 @@ func (h *ToolHandler) estimateMemoryUsage(sheetsCount int) int64 {
 	return (baseMB * 1024 * 1024) + (int64(sheetsCount) * perSheetKB * 1024)
 }
 
+// detectModel is the model of the calling session, as resolved from its
+// initialize request
 func (h *ToolHandler) detectModel(ctx context.Context) string {
-	// Try to detect model from context or headers
-	// Default to sonnet-4 for now
-	return "sonnet-4"
+	return sessionFrom(ctx).Model()
 }
 
 func (h *ToolHandler) createTokenManagement(modelDetected string, chunkSize int) *models.TokenManagement {
@@ -225,7 +303,7 @@ func (h *ToolHandler) createTokenManagement(modelDetected string, chunkSize int)
 
 	return &models.TokenManagement{
 		ModelDetected:  modelDetected,
-		CountingMethod: "tiktoken",
+		CountingMethod: h.tokenCounter.CountingMethod(modelDetected),
 		Limits: models.TokenLimits{
 			Context:    limits.Context,
 			SafeBuffer: limits.SafeBuffer,
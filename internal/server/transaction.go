@@ -0,0 +1,185 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+
+	"mcp-xlsm-server/internal/diff"
+	"mcp-xlsm-server/internal/edit"
+	"mcp-xlsm-server/internal/models"
+)
+
+// Edit transactions left unused this long are rolled back
+const editTTL = 30 * time.Minute
+
+// Tool 12: begin_edit
+func (h *ToolHandler) BeginEdit(ctx context.Context, params map[string]interface{}) (*models.EditStatus, error) {
+	filepath, ok := params["filepath"].(string)
+	if !ok {
+		return nil, fmt.Errorf("filepath parameter is required")
+	}
+	checksum, ok := params["checksum"].(string)
+	if !ok {
+		return nil, fmt.Errorf("checksum parameter is required")
+	}
+
+	tx, err := h.edits.Begin(filepath, checksum)
+	if err != nil {
+		return nil, err
+	}
+
+	return h.editStatus(tx, "open"), nil
+}
+
+// Tool 13: preview_edit
+func (h *ToolHandler) PreviewEdit(ctx context.Context, params map[string]interface{}) (*models.PreviewEditResponse, error) {
+	editID, ok := params["edit_id"].(string)
+	if !ok {
+		return nil, fmt.Errorf("edit_id parameter is required")
+	}
+
+	maxChanges := 200
+	if mc, ok := params["max_changes"].(float64); ok && mc > 0 {
+		maxChanges = int(mc)
+	}
+
+	startTime := time.Now()
+
+	tx, err := h.edits.Get(editID)
+	if err != nil {
+		return nil, err
+	}
+	tx.Lock()
+	defer tx.Unlock()
+
+	session := tx.Session
+	if err := session.Err(); err != nil {
+		return nil, fmt.Errorf("edit is broken by a failed step and can only be rolled back: %w", err)
+	}
+
+	current, err := edit.FileChecksum(session.Path())
+	if err != nil {
+		return nil, fmt.Errorf("failed to calculate checksum: %w", err)
+	}
+	if current != session.Checksum() {
+		return nil, fmt.Errorf("workbook changed on disk since begin_edit, the commit would be refused; roll back and start again")
+	}
+
+	base, err := h.snapshots.Load(session.Path(), session.Checksum())
+	if err != nil {
+		return nil, err
+	}
+
+	recalculated, totalRecalculated, err := session.Recalculate(math.MaxInt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to recalculate: %w", err)
+	}
+
+	// The edited workbook only exists in memory; formulas written in this
+	// edit get the values computed above
+	target, err := diff.SnapshotFile(session.File(), session.Path(), "", base.Modules)
+	if err != nil {
+		return nil, err
+	}
+	for _, cell := range recalculated {
+		if cell.Error != "" {
+			continue
+		}
+		sheet, ref, _ := splitCellRef(cell.Location, "")
+		col, row, err := excelize.CellNameToCoordinates(ref)
+		if err != nil {
+			continue
+		}
+		target.SetCell(sheet, col, row, diff.Cell{Value: cell.NewValue, Formula: cell.Formula[1:]})
+	}
+
+	result := diff.Compare(base, target, diff.Options{})
+
+	changes := result.Changes
+	if len(changes) > maxChanges {
+		changes = changes[:maxChanges]
+	}
+	if len(recalculated) > maxChanges {
+		recalculated = recalculated[:maxChanges]
+	}
+
+	return &models.PreviewEditResponse{
+		EditID:            tx.ID,
+		BaseChecksum:      session.Checksum(),
+		Summary:           result.Summary,
+		Sheets:            result.Sheets,
+		Changes:           changes,
+		TotalChanges:      len(result.Changes),
+		Recalculated:      recalculated,
+		TotalRecalculated: totalRecalculated,
+		Performance: models.QueryPerformance{
+			QueryTimeMs: time.Since(startTime).Milliseconds(),
+		},
+	}, nil
+}
+
+// Tool 14: commit_edit
+func (h *ToolHandler) CommitEdit(ctx context.Context, params map[string]interface{}) (*models.WriteResponse, error) {
+	editID, ok := params["edit_id"].(string)
+	if !ok {
+		return nil, fmt.Errorf("edit_id parameter is required")
+	}
+
+	startTime := time.Now()
+
+	// The transaction ends whatever the outcome: a refused commit leaves
+	// the file as it was, and the edit cannot be retried on a newer version
+	tx, err := h.edits.End(editID)
+	if err != nil {
+		return nil, err
+	}
+	tx.Lock()
+	defer tx.Unlock()
+	defer tx.Session.Close()
+
+	if len(tx.Session.Deltas()) == 0 {
+		return nil, fmt.Errorf("edit %s has no changes to commit", editID)
+	}
+
+	response, err := h.saveEdit(tx.Session, "", startTime)
+	if err != nil {
+		return nil, fmt.Errorf("commit of %s failed: %w", editID, err)
+	}
+	response.EditID = tx.ID
+	return response, nil
+}
+
+// Tool 15: rollback_edit
+func (h *ToolHandler) RollbackEdit(ctx context.Context, params map[string]interface{}) (*models.EditStatus, error) {
+	editID, ok := params["edit_id"].(string)
+	if !ok {
+		return nil, fmt.Errorf("edit_id parameter is required")
+	}
+
+	tx, err := h.edits.End(editID)
+	if err != nil {
+		return nil, err
+	}
+	tx.Lock()
+	defer tx.Unlock()
+
+	status := h.editStatus(tx, "rolled_back")
+	tx.Session.Close()
+	return status, nil
+}
+
+func (h *ToolHandler) editStatus(tx *edit.Transaction, state string) *models.EditStatus {
+	return &models.EditStatus{
+		EditID:       tx.ID,
+		Filepath:     tx.Session.Path(),
+		BaseChecksum: tx.Session.Checksum(),
+		Steps:        tx.Steps,
+		StartedAt:    tx.StartedAt,
+		ExpiresAt:    h.edits.ExpiresAt(tx),
+		State:        state,
+	}
+}
@@ -0,0 +1,274 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+
+	"mcp-xlsm-server/internal/edit"
+	"mcp-xlsm-server/internal/models"
+)
+
+// Tool 8: write_cells
+func (h *ToolHandler) WriteCells(ctx context.Context, params map[string]interface{}) (*models.WriteResponse, error) {
+	defaultSheet, _ := params["sheet"].(string)
+
+	writes, err := parseCellWrites(params, defaultSheet)
+	if err != nil {
+		return nil, err
+	}
+	if len(writes) == 0 {
+		return nil, fmt.Errorf("cells or start_cell with values is required")
+	}
+
+	return h.runEdit(params, func(session *edit.Session) (string, error) {
+		return "", session.SetCells(writes)
+	})
+}
+
+// Tool 9: append_rows
+func (h *ToolHandler) AppendRows(ctx context.Context, params map[string]interface{}) (*models.WriteResponse, error) {
+	sheet, ok := params["sheet"].(string)
+	if !ok || sheet == "" {
+		return nil, fmt.Errorf("sheet parameter is required")
+	}
+	rows, err := parseRows(params["rows"])
+	if err != nil {
+		return nil, err
+	}
+
+	return h.runEdit(params, func(session *edit.Session) (string, error) {
+		return session.AppendRows(sheet, rows)
+	})
+}
+
+// Tool 10: add_sheet
+func (h *ToolHandler) AddSheet(ctx context.Context, params map[string]interface{}) (*models.WriteResponse, error) {
+	name, ok := params["name"].(string)
+	if !ok || name == "" {
+		return nil, fmt.Errorf("name parameter is required")
+	}
+	var rows [][]interface{}
+	if raw, ok := params["rows"]; ok {
+		var err error
+		if rows, err = parseRows(raw); err != nil {
+			return nil, err
+		}
+	}
+
+	return h.runEdit(params, func(session *edit.Session) (string, error) {
+		return name, session.AddSheet(name, rows)
+	})
+}
+
+// Tool 11: insert_rows
+func (h *ToolHandler) InsertRows(ctx context.Context, params map[string]interface{}) (*models.WriteResponse, error) {
+	sheet, ok := params["sheet"].(string)
+	if !ok || sheet == "" {
+		return nil, fmt.Errorf("sheet parameter is required")
+	}
+	row, ok := params["row"].(float64)
+	if !ok {
+		return nil, fmt.Errorf("row parameter is required")
+	}
+	rows, err := parseRows(params["rows"])
+	if err != nil {
+		return nil, err
+	}
+
+	return h.runEdit(params, func(session *edit.Session) (string, error) {
+		return session.InsertRows(sheet, int(row), rows)
+	})
+}
+
+// runEdit applies step inside the transaction named by edit_id, leaving
+// the file untouched until commit_edit. Without edit_id the step is saved
+// on its own.
+func (h *ToolHandler) runEdit(params map[string]interface{}, step func(*edit.Session) (string, error)) (*models.WriteResponse, error) {
+	startTime := time.Now()
+
+	editID, _ := params["edit_id"].(string)
+	if editID == "" {
+		session, err := openEdit(params)
+		if err != nil {
+			return nil, err
+		}
+		defer session.Close()
+
+		written, err := step(session)
+		if err != nil {
+			return nil, err
+		}
+		return h.saveEdit(session, written, startTime)
+	}
+
+	tx, err := h.edits.Get(editID)
+	if err != nil {
+		return nil, err
+	}
+	tx.Lock()
+	defer tx.Unlock()
+
+	before := len(tx.Session.Deltas())
+	written, err := step(tx.Session)
+	if err != nil {
+		if tx.Session.Err() != nil {
+			return nil, fmt.Errorf("%w; the edit can only be rolled back", err)
+		}
+		return nil, err
+	}
+	tx.Steps++
+
+	return &models.WriteResponse{
+		Filepath:    tx.Session.Path(),
+		EditID:      tx.ID,
+		OldChecksum: tx.Session.Checksum(),
+		Written:     written,
+		Deltas:      tx.Session.Deltas()[before:],
+		Performance: models.QueryPerformance{
+			QueryTimeMs: time.Since(startTime).Milliseconds(),
+		},
+	}, nil
+}
+
+// openEdit opens the workbook of a write tool, checking it is still at the
+// checksum the caller read.
+func openEdit(params map[string]interface{}) (*edit.Session, error) {
+	filepath, ok := params["filepath"].(string)
+	if !ok {
+		return nil, fmt.Errorf("filepath parameter is required")
+	}
+	checksum, ok := params["checksum"].(string)
+	if !ok {
+		return nil, fmt.Errorf("checksum parameter is required")
+	}
+
+	return edit.Open(filepath, checksum)
+}
+
+// saveEdit saves the session and brings the live index up to date with its
+// deltas. Once the file is saved the edit stands, so an index that cannot
+// follow is reported as a warning rather than an error.
+func (h *ToolHandler) saveEdit(session *edit.Session, written string, startTime time.Time) (*models.WriteResponse, error) {
+	result, err := session.Save()
+	if err != nil {
+		return nil, err
+	}
+
+	deltas := session.Deltas()
+	indexStart := time.Now()
+	_, watched := h.watcher.Index(session.Path())
+	indexUpdated, warning := watched, ""
+	if watched {
+		if err := h.watcher.Apply(session.Path(), result.OldChecksum, result.NewChecksum, deltas); err != nil {
+			indexUpdated = false
+			warning = fmt.Sprintf("workbook saved but index update failed: %v", err)
+		}
+	} else {
+		go h.recordSnapshot(session.Path(), result.NewChecksum)
+	}
+
+	return &models.WriteResponse{
+		Filepath:     session.Path(),
+		OldChecksum:  result.OldChecksum,
+		NewChecksum:  result.NewChecksum,
+		BackupPath:   result.BackupPath,
+		Written:      written,
+		Deltas:       deltas,
+		IndexUpdated: indexUpdated,
+		Warning:      warning,
+		Performance: models.QueryPerformance{
+			QueryTimeMs: time.Since(startTime).Milliseconds(),
+			IndexTimeMs: time.Since(indexStart).Milliseconds(),
+		},
+	}, nil
+}
+
+// parseCellWrites reads either a cells list of {cell, value, formula} or a
+// block of values starting at start_cell. Cells may name their sheet as
+// in "Bilan!B4".
+func parseCellWrites(params map[string]interface{}, defaultSheet string) ([]edit.CellWrite, error) {
+	var writes []edit.CellWrite
+
+	if raw, ok := params["cells"].([]interface{}); ok {
+		for i, item := range raw {
+			spec, ok := item.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("cells[%d] must be an object", i)
+			}
+			ref, _ := spec["cell"].(string)
+			sheet, cell, err := splitCellRef(ref, defaultSheet)
+			if err != nil {
+				return nil, fmt.Errorf("cells[%d]: %w", i, err)
+			}
+			if s, ok := spec["sheet"].(string); ok && s != "" {
+				sheet = s
+			}
+			formula, _ := spec["formula"].(string)
+			writes = append(writes, edit.CellWrite{
+				Sheet:   sheet,
+				Cell:    cell,
+				Value:   spec["value"],
+				Formula: formula,
+			})
+		}
+	}
+
+	if start, ok := params["start_cell"].(string); ok && start != "" {
+		sheet, cell, err := splitCellRef(start, defaultSheet)
+		if err != nil {
+			return nil, fmt.Errorf("start_cell: %w", err)
+		}
+		col, row, err := excelize.CellNameToCoordinates(cell)
+		if err != nil {
+			return nil, fmt.Errorf("start_cell: %w", err)
+		}
+		rows, err := parseRows(params["values"])
+		if err != nil {
+			return nil, err
+		}
+		for i, values := range rows {
+			for j, value := range values {
+				name, _ := excelize.CoordinatesToCellName(col+j, row+i)
+				writes = append(writes, edit.CellWrite{Sheet: sheet, Cell: name, Value: value})
+			}
+		}
+	}
+
+	return writes, nil
+}
+
+// splitCellRef splits "Sheet!A1" or "'My sheet'!A1"; a bare "A1" uses
+// defaultSheet.
+func splitCellRef(ref, defaultSheet string) (string, string, error) {
+	if ref == "" {
+		return "", "", fmt.Errorf("cell is required")
+	}
+	if i := strings.LastIndex(ref, "!"); i >= 0 {
+		return strings.Trim(ref[:i], "'"), ref[i+1:], nil
+	}
+	if defaultSheet == "" {
+		return "", "", fmt.Errorf("cell %s has no sheet and no sheet parameter was given", ref)
+	}
+	return defaultSheet, ref, nil
+}
+
+func parseRows(raw interface{}) ([][]interface{}, error) {
+	list, ok := raw.([]interface{})
+	if !ok || len(list) == 0 {
+		return nil, fmt.Errorf("rows must be a non-empty array of arrays")
+	}
+
+	rows := make([][]interface{}, len(list))
+	for i, item := range list {
+		row, ok := item.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("row %d must be an array", i)
+		}
+		rows[i] = row
+	}
+	return rows, nil
+}
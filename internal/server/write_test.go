@@ -0,0 +1,71 @@
+package server
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+
+	"mcp-xlsm-server/internal/diff"
+)
+
+func TestSaveEditIndexFailure(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bilan.xlsm")
+	f := excelize.NewFile()
+	f.SetCellValue("Sheet1", "A1", "Actif")
+	// A compound file header with no VBA project behind it: the workbook
+	// opens, but its modules cannot be read for the snapshot
+	vbaProject := append([]byte{0xd0, 0xcf, 0x11, 0xe0, 0xa1, 0xb1, 0x1a, 0xe1}, make([]byte, 504)...)
+	if err := f.AddVBAProject(vbaProject); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.SaveAs(path); err != nil {
+		t.Fatal(err)
+	}
+
+	h := newTestToolHandler(t)
+	checksum, err := h.calculateFileChecksum(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Registration takes its baseline from the cache, so only the snapshot
+	// of the saved version hits the broken project
+	h.snapshots.Put(&diff.Snapshot{Path: path, Checksum: checksum})
+	if _, err := h.watcher.Register(path); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := h.WriteCells(context.Background(), map[string]interface{}{
+		"filepath": path,
+		"checksum": checksum,
+		"sheet":    "Sheet1",
+		"cells":    []interface{}{map[string]interface{}{"cell": "A2", "value": "Passif"}},
+	})
+	if err != nil {
+		t.Fatalf("WriteCells() error = %v, want the saved edit", err)
+	}
+	if resp.IndexUpdated {
+		t.Error("IndexUpdated = true, want false")
+	}
+	if !strings.Contains(resp.Warning, "index update failed") {
+		t.Errorf("Warning = %q, want the index failure", resp.Warning)
+	}
+	if resp.NewChecksum == "" || resp.NewChecksum == checksum {
+		t.Errorf("NewChecksum = %q, want the saved version", resp.NewChecksum)
+	}
+
+	saved, err := excelize.OpenFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer saved.Close()
+	if got, _ := saved.GetCellValue("Sheet1", "A2"); got != "Passif" {
+		t.Errorf("saved A2 = %q, want Passif", got)
+	}
+	if _, err := os.Stat(resp.BackupPath); err != nil {
+		t.Errorf("backup: %v", err)
+	}
+}
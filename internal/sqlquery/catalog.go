@@ -0,0 +1,245 @@
+package sqlquery
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+
+	"mcp-xlsm-server/internal/analytics"
+	"mcp-xlsm-server/internal/workbook"
+)
+
+// Column types inferred from cell values
+const (
+	TypeNumber  = "number"
+	TypeDate    = "date"
+	TypeText    = "text"
+	TypeBoolean = "boolean"
+	TypeEmpty   = "empty"
+)
+
+type Column struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// RelationInfo describes a queryable sheet or Excel table.
+type RelationInfo struct {
+	Name  string `json:"name"`
+	Kind  string `json:"kind"`
+	Sheet string `json:"sheet"`
+	Range string `json:"range,omitempty"`
+}
+
+type Relation struct {
+	RelationInfo
+	Columns []Column
+	Table   *analytics.Table
+}
+
+type Catalog interface {
+	List() []RelationInfo
+	Load(name string) (*Relation, error)
+}
+
+// WorkbookCatalog exposes every sheet of a workbook, every Excel table
+// (ListObject) inside it and the records of every pivot cache as a
+// relation. Relations are loaded lazily and kept for the lifetime of the
+// catalog.
+type WorkbookCatalog struct {
+	file        *excelize.File
+	headerRow   int
+	relations   []RelationInfo
+	pivotCaches map[string]workbook.PivotCache
+	loaded      map[string]*Relation
+}
+
+func NewWorkbookCatalog(file *excelize.File, headerRow int) *WorkbookCatalog {
+	catalog := &WorkbookCatalog{
+		file:        file,
+		headerRow:   headerRow,
+		pivotCaches: make(map[string]workbook.PivotCache),
+		loaded:      make(map[string]*Relation),
+	}
+
+	for _, sheetName := range file.GetSheetList() {
+		catalog.relations = append(catalog.relations, RelationInfo{
+			Name:  sheetName,
+			Kind:  "sheet",
+			Sheet: sheetName,
+		})
+
+		tables, err := file.GetTables(sheetName)
+		if err != nil {
+			continue
+		}
+		for _, tbl := range tables {
+			catalog.relations = append(catalog.relations, RelationInfo{
+				Name:  tbl.Name,
+				Kind:  "table",
+				Sheet: sheetName,
+				Range: tbl.Range,
+			})
+		}
+	}
+
+	for _, cache := range workbook.PivotCaches(file) {
+		if cache.RecordsPart == "" {
+			continue
+		}
+		name := workbook.PivotCacheRelation(cache.ID)
+		catalog.pivotCaches[name] = cache
+		catalog.relations = append(catalog.relations, RelationInfo{
+			Name:  name,
+			Kind:  "pivot_cache",
+			Range: cache.Source,
+		})
+	}
+
+	return catalog
+}
+
+func (c *WorkbookCatalog) List() []RelationInfo {
+	return c.relations
+}
+
+func (c *WorkbookCatalog) Load(name string) (*Relation, error) {
+	info, err := c.lookup(name)
+	if err != nil {
+		return nil, err
+	}
+
+	key := strings.ToLower(info.Name)
+	if rel, ok := c.loaded[key]; ok {
+		return rel, nil
+	}
+
+	var table *analytics.Table
+	switch info.Kind {
+	case "table":
+		table, err = analytics.LoadRangeTable(c.file, info.Sheet, info.Range, true)
+	case "pivot_cache":
+		table = &analytics.Table{}
+		table.Headers, table.Rows, err = workbook.PivotCacheRecords(c.file, c.pivotCaches[info.Name])
+	default:
+		table, err = analytics.LoadSheetTable(c.file, info.Sheet, c.headerRow)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load %s: %w", info.Name, err)
+	}
+
+	rel := &Relation{
+		RelationInfo: info,
+		Columns:      InferColumns(table),
+		Table:        table,
+	}
+	c.loaded[key] = rel
+
+	return rel, nil
+}
+
+// lookup matches a relation name case-insensitively; tables win over
+// sheets of the same name.
+func (c *WorkbookCatalog) lookup(name string) (RelationInfo, error) {
+	var match *RelationInfo
+	for i, info := range c.relations {
+		if strings.EqualFold(info.Name, name) {
+			if match == nil || info.Kind == "table" {
+				match = &c.relations[i]
+			}
+		}
+	}
+	if match == nil {
+		return RelationInfo{}, fmt.Errorf("unknown relation: %s", name)
+	}
+	return *match, nil
+}
+
+// InferColumns assigns each column the type most of its values share.
+// Date columns are rewritten to ISO strings so they sort and compare as
+// text.
+func InferColumns(table *analytics.Table) []Column {
+	columns := make([]Column, len(table.Headers))
+
+	for colIdx, header := range table.Headers {
+		counts := make(map[string]int)
+		nonEmpty := 0
+		for _, row := range table.Rows {
+			value := row[colIdx]
+			if analytics.IsEmpty(value) {
+				continue
+			}
+			nonEmpty++
+			counts[valueType(value)]++
+		}
+
+		colType := TypeEmpty
+		if nonEmpty > 0 {
+			colType = TypeText
+			for _, candidate := range []string{TypeNumber, TypeDate, TypeBoolean} {
+				if float64(counts[candidate]) >= 0.8*float64(nonEmpty) {
+					colType = candidate
+					break
+				}
+			}
+		}
+
+		if colType == TypeDate {
+			for _, row := range table.Rows {
+				if s, ok := row[colIdx].(string); ok {
+					if t, ok := parseDate(s); ok {
+						row[colIdx] = t.Format("2006-01-02")
+					}
+				}
+			}
+		}
+
+		columns[colIdx] = Column{Name: header, Type: colType}
+	}
+
+	return columns
+}
+
+func valueType(value interface{}) string {
+	switch v := value.(type) {
+	case float64, int:
+		return TypeNumber
+	case bool:
+		return TypeBoolean
+	case string:
+		upper := strings.ToUpper(strings.TrimSpace(v))
+		if upper == "TRUE" || upper == "FALSE" || upper == "VRAI" || upper == "FAUX" {
+			return TypeBoolean
+		}
+		if _, ok := parseDate(v); ok {
+			return TypeDate
+		}
+	}
+	return TypeText
+}
+
+// dateLayouts covers ISO dates, French day-first dates and excelize's
+// default mm-dd-yy rendering.
+var dateLayouts = []string{
+	"2006-01-02",
+	"2006-01-02 15:04:05",
+	"02/01/2006",
+	"2/1/2006",
+	"02/01/06",
+	"01-02-06",
+	"1-2-06",
+	"02-01-2006",
+	"2006/01/02",
+}
+
+func parseDate(s string) (time.Time, bool) {
+	s = strings.TrimSpace(s)
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
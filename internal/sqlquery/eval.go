@@ -0,0 +1,584 @@
+package sqlquery
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+
+	"mcp-xlsm-server/internal/analytics"
+)
+
+// evalContext is a single row, plus the rows of its group when the query
+// aggregates.
+type evalContext struct {
+	columns []boundColumn
+	row     []interface{}
+	group   [][]interface{}
+}
+
+var aggregateFuncs = map[string]analytics.AggregateFunc{
+	"SUM":        analytics.Sum,
+	"AVG":        analytics.Avg,
+	"MIN":        analytics.Min,
+	"MAX":        analytics.Max,
+	"COUNT":      analytics.Count,
+	"MEDIAN":     analytics.Median,
+	"PERCENTILE": analytics.Percentile,
+}
+
+func isAggregate(name string) bool {
+	_, ok := aggregateFuncs[name]
+	return ok
+}
+
+func hasAggregate(items []SelectItem) bool {
+	for _, item := range items {
+		if containsAggregate(item.Expr) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsAggregate(expr Expr) bool {
+	switch e := expr.(type) {
+	case *FuncCall:
+		if isAggregate(e.Name) {
+			return true
+		}
+		for _, arg := range e.Args {
+			if containsAggregate(arg) {
+				return true
+			}
+		}
+	case *BinaryExpr:
+		return containsAggregate(e.Left) || containsAggregate(e.Right)
+	case *UnaryExpr:
+		return containsAggregate(e.Expr)
+	}
+	return false
+}
+
+func resolveColumn(ref *ColumnRef, columns []boundColumn) (int, error) {
+	found := -1
+	for i, col := range columns {
+		if !strings.EqualFold(col.name, ref.Name) {
+			continue
+		}
+		if ref.Table != "" && !strings.EqualFold(col.table, ref.Table) {
+			continue
+		}
+		if found >= 0 {
+			return -1, fmt.Errorf("ambiguous column %q, qualify it with a relation name", ref.Name)
+		}
+		found = i
+	}
+	if found < 0 {
+		if ref.Table != "" {
+			return -1, fmt.Errorf("unknown column: %s.%s", ref.Table, ref.Name)
+		}
+		return -1, fmt.Errorf("unknown column: %s", ref.Name)
+	}
+	return found, nil
+}
+
+func evalExpr(expr Expr, ctx *evalContext) (interface{}, error) {
+	switch e := expr.(type) {
+	case *Literal:
+		return e.Value, nil
+
+	case *ColumnRef:
+		idx, err := resolveColumn(e, ctx.columns)
+		if err != nil {
+			return nil, err
+		}
+		if ctx.row == nil {
+			return nil, nil
+		}
+		return ctx.row[idx], nil
+
+	case *UnaryExpr:
+		value, err := evalExpr(e.Expr, ctx)
+		if err != nil {
+			return nil, err
+		}
+		if e.Op == "NOT" {
+			if value == nil {
+				return nil, nil
+			}
+			return !truthy(value), nil
+		}
+		if n, ok := analytics.ToFloat(value); ok {
+			return -n, nil
+		}
+		return nil, nil
+
+	case *BinaryExpr:
+		return evalBinary(e, ctx)
+
+	case *IsNullExpr:
+		value, err := evalExpr(e.Expr, ctx)
+		if err != nil {
+			return nil, err
+		}
+		return analytics.IsEmpty(value) != e.Not, nil
+
+	case *InExpr:
+		value, err := evalExpr(e.Expr, ctx)
+		if err != nil {
+			return nil, err
+		}
+		if analytics.IsEmpty(value) {
+			return nil, nil
+		}
+		for _, item := range e.List {
+			candidate, err := evalExpr(item, ctx)
+			if err != nil {
+				return nil, err
+			}
+			if cmp, ok := compareValues(value, candidate); ok && cmp == 0 {
+				return !e.Not, nil
+			}
+		}
+		return e.Not, nil
+
+	case *BetweenExpr:
+		value, err := evalExpr(e.Expr, ctx)
+		if err != nil {
+			return nil, err
+		}
+		low, err := evalExpr(e.Low, ctx)
+		if err != nil {
+			return nil, err
+		}
+		high, err := evalExpr(e.High, ctx)
+		if err != nil {
+			return nil, err
+		}
+		cmpLow, okLow := compareValues(value, low)
+		cmpHigh, okHigh := compareValues(value, high)
+		if !okLow || !okHigh {
+			return nil, nil
+		}
+		return (cmpLow >= 0 && cmpHigh <= 0) != e.Not, nil
+
+	case *LikeExpr:
+		value, err := evalExpr(e.Expr, ctx)
+		if err != nil {
+			return nil, err
+		}
+		pattern, err := evalExpr(e.Pattern, ctx)
+		if err != nil {
+			return nil, err
+		}
+		if analytics.IsEmpty(value) || pattern == nil {
+			return nil, nil
+		}
+		re, err := likeRegexp(fmt.Sprint(pattern))
+		if err != nil {
+			return nil, err
+		}
+		return re.MatchString(formatValue(value)) != e.Not, nil
+
+	case *FuncCall:
+		if isAggregate(e.Name) {
+			return evalAggregate(e, ctx)
+		}
+		return evalScalar(e, ctx)
+	}
+
+	return nil, fmt.Errorf("unsupported expression %T", expr)
+}
+
+func evalBinary(e *BinaryExpr, ctx *evalContext) (interface{}, error) {
+	left, err := evalExpr(e.Left, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Short-circuit logic, with SQL's NULL handling reduced to false
+	switch e.Op {
+	case "AND":
+		if !truthy(left) {
+			return false, nil
+		}
+		right, err := evalExpr(e.Right, ctx)
+		if err != nil {
+			return nil, err
+		}
+		return truthy(right), nil
+	case "OR":
+		if truthy(left) {
+			return true, nil
+		}
+		right, err := evalExpr(e.Right, ctx)
+		if err != nil {
+			return nil, err
+		}
+		return truthy(right), nil
+	}
+
+	right, err := evalExpr(e.Right, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	switch e.Op {
+	case "=", "<>", "<", "<=", ">", ">=":
+		cmp, ok := compareValues(left, right)
+		if !ok {
+			return nil, nil
+		}
+		switch e.Op {
+		case "=":
+			return cmp == 0, nil
+		case "<>":
+			return cmp != 0, nil
+		case "<":
+			return cmp < 0, nil
+		case "<=":
+			return cmp <= 0, nil
+		case ">":
+			return cmp > 0, nil
+		case ">=":
+			return cmp >= 0, nil
+		}
+
+	case "||":
+		if left == nil || right == nil {
+			return nil, nil
+		}
+		return formatValue(left) + formatValue(right), nil
+
+	case "+", "-", "*", "/", "%":
+		l, lok := analytics.ToFloat(left)
+		r, rok := analytics.ToFloat(right)
+		if !lok || !rok {
+			return nil, nil
+		}
+		switch e.Op {
+		case "+":
+			return l + r, nil
+		case "-":
+			return l - r, nil
+		case "*":
+			return l * r, nil
+		case "/":
+			if r == 0 {
+				return nil, nil
+			}
+			return l / r, nil
+		case "%":
+			if r == 0 {
+				return nil, nil
+			}
+			return math.Mod(l, r), nil
+		}
+	}
+
+	return nil, fmt.Errorf("unsupported operator %s", e.Op)
+}
+
+func evalAggregate(call *FuncCall, ctx *evalContext) (interface{}, error) {
+	if ctx.group == nil && ctx.row != nil {
+		return nil, fmt.Errorf("%s is not allowed outside an aggregate query", call.Name)
+	}
+
+	spec := analytics.AggregateSpec{Function: aggregateFuncs[call.Name], Column: "*"}
+	if call.Name == "COUNT" && call.Distinct {
+		spec.Function = analytics.CountDistinct
+	}
+
+	if call.Star {
+		if call.Name != "COUNT" {
+			return nil, fmt.Errorf("%s(*) is not supported", call.Name)
+		}
+		return len(ctx.group), nil
+	}
+
+	wantArgs := 1
+	if call.Name == "PERCENTILE" {
+		wantArgs = 2
+	}
+	if len(call.Args) != wantArgs {
+		return nil, fmt.Errorf("%s expects %d argument(s)", call.Name, wantArgs)
+	}
+
+	if call.Name == "PERCENTILE" {
+		p, err := evalExpr(call.Args[1], ctx)
+		if err != nil {
+			return nil, err
+		}
+		pct, ok := analytics.ToFloat(p)
+		if !ok {
+			return nil, fmt.Errorf("PERCENTILE expects a numeric percentile")
+		}
+		// Accept both 0.9 (Excel style) and 90
+		if pct <= 1 {
+			pct *= 100
+		}
+		spec.Percentile = pct
+	}
+
+	values := make([]interface{}, len(ctx.group))
+	for i, row := range ctx.group {
+		value, err := evalExpr(call.Args[0], &evalContext{columns: ctx.columns, row: row})
+		if err != nil {
+			return nil, err
+		}
+		values[i] = value
+	}
+
+	// MIN and MAX also work on text and ISO dates
+	if (call.Name == "MIN" || call.Name == "MAX") && len(analytics.NumericValues(values)) == 0 {
+		var best interface{}
+		for _, v := range values {
+			if analytics.IsEmpty(v) {
+				continue
+			}
+			if best == nil {
+				best = v
+				continue
+			}
+			cmp := compareForSort(v, best)
+			if (call.Name == "MIN" && cmp < 0) || (call.Name == "MAX" && cmp > 0) {
+				best = v
+			}
+		}
+		return best, nil
+	}
+
+	return analytics.ComputeAggregate(spec, values), nil
+}
+
+func evalScalar(call *FuncCall, ctx *evalContext) (interface{}, error) {
+	args := make([]interface{}, len(call.Args))
+	for i, arg := range call.Args {
+		value, err := evalExpr(arg, ctx)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = value
+	}
+
+	argCount := func(n int) error {
+		if len(args) != n {
+			return fmt.Errorf("%s expects %d argument(s)", call.Name, n)
+		}
+		return nil
+	}
+
+	switch call.Name {
+	case "UPPER", "LOWER", "TRIM", "LENGTH":
+		if err := argCount(1); err != nil {
+			return nil, err
+		}
+		if args[0] == nil {
+			return nil, nil
+		}
+		s := formatValue(args[0])
+		switch call.Name {
+		case "UPPER":
+			return strings.ToUpper(s), nil
+		case "LOWER":
+			return strings.ToLower(s), nil
+		case "TRIM":
+			return strings.TrimSpace(s), nil
+		default:
+			return float64(len([]rune(s))), nil
+		}
+
+	case "ABS":
+		if err := argCount(1); err != nil {
+			return nil, err
+		}
+		if n, ok := analytics.ToFloat(args[0]); ok {
+			return math.Abs(n), nil
+		}
+		return nil, nil
+
+	case "ROUND":
+		if len(args) != 1 && len(args) != 2 {
+			return nil, fmt.Errorf("ROUND expects 1 or 2 arguments")
+		}
+		n, ok := analytics.ToFloat(args[0])
+		if !ok {
+			return nil, nil
+		}
+		digits := 0.0
+		if len(args) == 2 {
+			digits, _ = analytics.ToFloat(args[1])
+		}
+		scale := math.Pow(10, digits)
+		return math.Round(n*scale) / scale, nil
+
+	case "COALESCE":
+		for _, arg := range args {
+			if !analytics.IsEmpty(arg) {
+				return arg, nil
+			}
+		}
+		return nil, nil
+
+	case "SUBSTR":
+		if len(args) != 2 && len(args) != 3 {
+			return nil, fmt.Errorf("SUBSTR expects 2 or 3 arguments")
+		}
+		if args[0] == nil {
+			return nil, nil
+		}
+		runes := []rune(formatValue(args[0]))
+		start, _ := analytics.ToFloat(args[1])
+		from := int(start) - 1
+		if from < 0 {
+			from = 0
+		}
+		if from > len(runes) {
+			return "", nil
+		}
+		to := len(runes)
+		if len(args) == 3 {
+			length, _ := analytics.ToFloat(args[2])
+			if from+int(length) < to {
+				to = from + int(length)
+			}
+		}
+		return string(runes[from:to]), nil
+
+	case "YEAR", "MONTH":
+		if err := argCount(1); err != nil {
+			return nil, err
+		}
+		s, ok := args[0].(string)
+		if !ok {
+			return nil, nil
+		}
+		t, ok := parseDate(s)
+		if !ok {
+			return nil, nil
+		}
+		if call.Name == "YEAR" {
+			return float64(t.Year()), nil
+		}
+		return float64(t.Month()), nil
+	}
+
+	return nil, fmt.Errorf("unknown function: %s", call.Name)
+}
+
+// compareValues compares numerically when both sides read as numbers and
+// as text otherwise. ok is false when either side is NULL.
+func compareValues(a, b interface{}) (int, bool) {
+	if analytics.IsEmpty(a) || analytics.IsEmpty(b) {
+		return 0, false
+	}
+
+	if ab, ok := a.(bool); ok {
+		if bb, ok := b.(bool); ok {
+			switch {
+			case ab == bb:
+				return 0, true
+			case !ab:
+				return -1, true
+			default:
+				return 1, true
+			}
+		}
+	}
+
+	an, aok := analytics.ToFloat(a)
+	bn, bok := analytics.ToFloat(b)
+	if aok && bok {
+		switch {
+		case an < bn:
+			return -1, true
+		case an > bn:
+			return 1, true
+		}
+		return 0, true
+	}
+
+	return strings.Compare(formatValue(a), formatValue(b)), true
+}
+
+// compareForSort orders NULLs first and otherwise follows compareValues.
+func compareForSort(a, b interface{}) int {
+	aEmpty, bEmpty := analytics.IsEmpty(a), analytics.IsEmpty(b)
+	switch {
+	case aEmpty && bEmpty:
+		return 0
+	case aEmpty:
+		return -1
+	case bEmpty:
+		return 1
+	}
+	cmp, _ := compareValues(a, b)
+	return cmp
+}
+
+func truthy(value interface{}) bool {
+	switch v := value.(type) {
+	case bool:
+		return v
+	case float64:
+		return v != 0
+	case int:
+		return v != 0
+	case string:
+		return v != ""
+	}
+	return false
+}
+
+func formatValue(value interface{}) string {
+	if n, ok := value.(float64); ok {
+		return fmt.Sprintf("%g", n)
+	}
+	return fmt.Sprint(value)
+}
+
+// likeRegexp turns a LIKE pattern into a case-insensitive regexp.
+func likeRegexp(pattern string) (*regexp.Regexp, error) {
+	var sb strings.Builder
+	sb.WriteString("(?is)^")
+	for _, r := range pattern {
+		switch r {
+		case '%':
+			sb.WriteString(".*")
+		case '_':
+			sb.WriteString(".")
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	sb.WriteString("$")
+	return regexp.Compile(sb.String())
+}
+
+func exprName(expr Expr) string {
+	switch e := expr.(type) {
+	case *ColumnRef:
+		return e.Name
+	case *FuncCall:
+		if e.Star {
+			return strings.ToLower(e.Name)
+		}
+		var args []string
+		for _, arg := range e.Args {
+			args = append(args, exprName(arg))
+		}
+		name := strings.ToLower(e.Name)
+		if e.Distinct {
+			name += "_distinct"
+		}
+		return name + "_" + strings.Join(args, "_")
+	case *Literal:
+		return formatValue(e.Value)
+	case *BinaryExpr:
+		return exprName(e.Left) + e.Op + exprName(e.Right)
+	case *UnaryExpr:
+		return strings.ToLower(e.Op) + exprName(e.Expr)
+	}
+	return "expr"
+}
@@ -0,0 +1,535 @@
+package sqlquery
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"mcp-xlsm-server/internal/analytics"
+)
+
+type Result struct {
+	Columns   []Column        `json:"columns"`
+	Rows      [][]interface{} `json:"rows"`
+	Relations []string        `json:"relations"`
+}
+
+// boundColumn is a column of the joined row set, qualified by the alias
+// of the relation it came from.
+type boundColumn struct {
+	table string
+	name  string
+	typ   string
+}
+
+type rowSet struct {
+	columns []boundColumn
+	rows    [][]interface{}
+}
+
+type Executor struct {
+	catalog Catalog
+}
+
+func NewExecutor(catalog Catalog) *Executor {
+	return &Executor{catalog: catalog}
+}
+
+// Query parses and runs a statement against the catalog.
+func (e *Executor) Query(sql string) (*Result, error) {
+	stmt, err := Parse(sql)
+	if err != nil {
+		return nil, err
+	}
+
+	switch s := stmt.(type) {
+	case *ShowTablesStmt:
+		return e.showTables(), nil
+	case *DescribeStmt:
+		return e.describe(s.Table)
+	case *SelectStmt:
+		return e.executeSelect(s)
+	}
+
+	return nil, fmt.Errorf("unsupported statement")
+}
+
+func (e *Executor) showTables() *Result {
+	result := &Result{
+		Columns: []Column{
+			{Name: "name", Type: TypeText},
+			{Name: "kind", Type: TypeText},
+			{Name: "sheet", Type: TypeText},
+			{Name: "range", Type: TypeText},
+		},
+		Rows: [][]interface{}{},
+	}
+	for _, info := range e.catalog.List() {
+		result.Rows = append(result.Rows, []interface{}{info.Name, info.Kind, info.Sheet, info.Range})
+	}
+	return result
+}
+
+func (e *Executor) describe(name string) (*Result, error) {
+	rel, err := e.catalog.Load(name)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Result{
+		Columns: []Column{
+			{Name: "column", Type: TypeText},
+			{Name: "type", Type: TypeText},
+		},
+		Rows:      [][]interface{}{},
+		Relations: []string{rel.Name},
+	}
+	for _, col := range rel.Columns {
+		result.Rows = append(result.Rows, []interface{}{col.Name, col.Type})
+	}
+	return result, nil
+}
+
+func (e *Executor) executeSelect(stmt *SelectStmt) (*Result, error) {
+	set, err := e.loadRelation(stmt.From)
+	if err != nil {
+		return nil, err
+	}
+	relations := []string{stmt.From.Name}
+
+	for _, join := range stmt.Joins {
+		right, err := e.loadRelation(join.Table)
+		if err != nil {
+			return nil, err
+		}
+		if set, err = joinSets(set, right, join); err != nil {
+			return nil, err
+		}
+		relations = append(relations, join.Table.Name)
+	}
+
+	// WHERE
+	if stmt.Where != nil {
+		var filtered [][]interface{}
+		for _, row := range set.rows {
+			value, err := evalExpr(stmt.Where, &evalContext{columns: set.columns, row: row})
+			if err != nil {
+				return nil, err
+			}
+			if truthy(value) {
+				filtered = append(filtered, row)
+			}
+		}
+		set.rows = filtered
+	}
+
+	items, err := expandStars(stmt.Items, set.columns)
+	if err != nil {
+		return nil, err
+	}
+
+	// Each output row keeps the context it was computed from so ORDER BY
+	// can evaluate expressions that are not in the select list
+	type outputRow struct {
+		values []interface{}
+		ctx    *evalContext
+	}
+	var outputs []outputRow
+
+	having := substituteAliases(stmt.Having, items, set.columns)
+
+	grouped := len(stmt.GroupBy) > 0 || stmt.Having != nil || hasAggregate(items)
+	if grouped {
+		groups, err := groupRows(set, stmt.GroupBy)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, group := range groups {
+			ctx := &evalContext{columns: set.columns, group: group}
+			if len(group) > 0 {
+				ctx.row = group[0]
+			}
+
+			if having != nil {
+				keep, err := evalExpr(having, ctx)
+				if err != nil {
+					return nil, err
+				}
+				if !truthy(keep) {
+					continue
+				}
+			}
+
+			values, err := evalItems(items, ctx)
+			if err != nil {
+				return nil, err
+			}
+			outputs = append(outputs, outputRow{values: values, ctx: ctx})
+		}
+	} else {
+		for _, row := range set.rows {
+			ctx := &evalContext{columns: set.columns, row: row}
+			values, err := evalItems(items, ctx)
+			if err != nil {
+				return nil, err
+			}
+			outputs = append(outputs, outputRow{values: values, ctx: ctx})
+		}
+	}
+
+	columns := outputColumns(items, set.columns)
+
+	// ORDER BY, resolving select aliases and 1-based positions first
+	if len(stmt.OrderBy) > 0 {
+		keys := make([][]interface{}, len(outputs))
+		for i, out := range outputs {
+			keys[i] = make([]interface{}, len(stmt.OrderBy))
+			for j, order := range stmt.OrderBy {
+				if pos, ok := orderPosition(order.Expr, columns); ok {
+					keys[i][j] = out.values[pos]
+					continue
+				}
+				value, err := evalExpr(order.Expr, out.ctx)
+				if err != nil {
+					return nil, err
+				}
+				keys[i][j] = value
+			}
+		}
+
+		indexes := make([]int, len(outputs))
+		for i := range indexes {
+			indexes[i] = i
+		}
+		sort.SliceStable(indexes, func(a, b int) bool {
+			for j, order := range stmt.OrderBy {
+				cmp := compareForSort(keys[indexes[a]][j], keys[indexes[b]][j])
+				if cmp == 0 {
+					continue
+				}
+				if order.Desc {
+					return cmp > 0
+				}
+				return cmp < 0
+			}
+			return false
+		})
+
+		sorted := make([]outputRow, len(outputs))
+		for i, idx := range indexes {
+			sorted[i] = outputs[idx]
+		}
+		outputs = sorted
+	}
+
+	rows := make([][]interface{}, 0, len(outputs))
+	seen := make(map[string]bool)
+	for _, out := range outputs {
+		if stmt.Distinct {
+			key := rowKey(out.values)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+		}
+		rows = append(rows, out.values)
+	}
+
+	// OFFSET and LIMIT
+	if stmt.Offset > 0 {
+		if stmt.Offset >= len(rows) {
+			rows = rows[:0]
+		} else {
+			rows = rows[stmt.Offset:]
+		}
+	}
+	if stmt.Limit >= 0 && stmt.Limit < len(rows) {
+		rows = rows[:stmt.Limit]
+	}
+
+	// Computed columns take the type of the values they produced
+	for colIdx := range columns {
+		if columns[colIdx].Type == "" {
+			columns[colIdx].Type = resultType(rows, colIdx)
+		}
+	}
+
+	return &Result{
+		Columns:   columns,
+		Rows:      rows,
+		Relations: relations,
+	}, nil
+}
+
+func resultType(rows [][]interface{}, colIdx int) string {
+	colType := TypeEmpty
+	for _, row := range rows {
+		if analytics.IsEmpty(row[colIdx]) {
+			continue
+		}
+		valType := valueType(row[colIdx])
+		if colType == TypeEmpty {
+			colType = valType
+		} else if colType != valType {
+			return TypeText
+		}
+	}
+	return colType
+}
+
+func (e *Executor) loadRelation(ref TableRef) (*rowSet, error) {
+	rel, err := e.catalog.Load(ref.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	alias := ref.Alias
+	if alias == "" {
+		alias = ref.Name
+	}
+
+	set := &rowSet{rows: rel.Table.Rows}
+	for _, col := range rel.Columns {
+		set.columns = append(set.columns, boundColumn{table: alias, name: col.Name, typ: col.Type})
+	}
+
+	return set, nil
+}
+
+// joinSets hash-joins on equality conditions between the two sides and
+// falls back to a nested loop for other ON clauses.
+func joinSets(left, right *rowSet, join JoinClause) (*rowSet, error) {
+	joined := &rowSet{columns: append(append([]boundColumn{}, left.columns...), right.columns...)}
+
+	leftKey, rightKey, equi := equiJoinKeys(join.On, left.columns, right.columns)
+
+	var index map[string][][]interface{}
+	if equi {
+		index = make(map[string][][]interface{})
+		for _, row := range right.rows {
+			if analytics.IsEmpty(row[rightKey]) {
+				continue
+			}
+			key := analytics.NormalizeKey(row[rightKey], true)
+			index[key] = append(index[key], row)
+		}
+	}
+
+	for _, leftRow := range left.rows {
+		matched := false
+
+		candidates := right.rows
+		if equi {
+			candidates = nil
+			if !analytics.IsEmpty(leftRow[leftKey]) {
+				candidates = index[analytics.NormalizeKey(leftRow[leftKey], true)]
+			}
+		}
+
+		for _, rightRow := range candidates {
+			combined := append(append([]interface{}{}, leftRow...), rightRow...)
+			if !equi {
+				value, err := evalExpr(join.On, &evalContext{columns: joined.columns, row: combined})
+				if err != nil {
+					return nil, err
+				}
+				if !truthy(value) {
+					continue
+				}
+			}
+			joined.rows = append(joined.rows, combined)
+			matched = true
+		}
+
+		if !matched && join.Type == "left" {
+			combined := append(append([]interface{}{}, leftRow...), make([]interface{}, len(right.columns))...)
+			joined.rows = append(joined.rows, combined)
+		}
+	}
+
+	return joined, nil
+}
+
+// equiJoinKeys recognises "a.col = b.col" where each side belongs to a
+// different input and returns the column positions in each input.
+func equiJoinKeys(on Expr, left, right []boundColumn) (int, int, bool) {
+	bin, ok := on.(*BinaryExpr)
+	if !ok || bin.Op != "=" {
+		return 0, 0, false
+	}
+	lref, lok := bin.Left.(*ColumnRef)
+	rref, rok := bin.Right.(*ColumnRef)
+	if !lok || !rok {
+		return 0, 0, false
+	}
+
+	if l, err := resolveColumn(lref, left); err == nil {
+		if r, err := resolveColumn(rref, right); err == nil {
+			return l, r, true
+		}
+	}
+	if l, err := resolveColumn(rref, left); err == nil {
+		if r, err := resolveColumn(lref, right); err == nil {
+			return l, r, true
+		}
+	}
+	return 0, 0, false
+}
+
+func groupRows(set *rowSet, groupBy []Expr) ([][][]interface{}, error) {
+	if len(groupBy) == 0 {
+		return [][][]interface{}{set.rows}, nil
+	}
+
+	var order []string
+	groups := make(map[string][][]interface{})
+	for _, row := range set.rows {
+		ctx := &evalContext{columns: set.columns, row: row}
+		keyValues := make([]interface{}, len(groupBy))
+		for i, expr := range groupBy {
+			value, err := evalExpr(expr, ctx)
+			if err != nil {
+				return nil, err
+			}
+			keyValues[i] = value
+		}
+
+		key := rowKey(keyValues)
+		if _, exists := groups[key]; !exists {
+			order = append(order, key)
+		}
+		groups[key] = append(groups[key], row)
+	}
+
+	result := make([][][]interface{}, len(order))
+	for i, key := range order {
+		result[i] = groups[key]
+	}
+	return result, nil
+}
+
+func expandStars(items []SelectItem, columns []boundColumn) ([]SelectItem, error) {
+	var expanded []SelectItem
+	for _, item := range items {
+		if !item.Star {
+			expanded = append(expanded, item)
+			continue
+		}
+
+		found := false
+		for _, col := range columns {
+			if item.StarTable != "" && !strings.EqualFold(col.table, item.StarTable) {
+				continue
+			}
+			found = true
+			expanded = append(expanded, SelectItem{
+				Expr:  &ColumnRef{Table: col.table, Name: col.name},
+				Alias: col.name,
+			})
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown relation in select: %s", item.StarTable)
+		}
+	}
+	return expanded, nil
+}
+
+func evalItems(items []SelectItem, ctx *evalContext) ([]interface{}, error) {
+	values := make([]interface{}, len(items))
+	for i, item := range items {
+		value, err := evalExpr(item.Expr, ctx)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = value
+	}
+	return values, nil
+}
+
+func outputColumns(items []SelectItem, columns []boundColumn) []Column {
+	result := make([]Column, len(items))
+	for i, item := range items {
+		name := item.Alias
+		if name == "" {
+			name = exprName(item.Expr)
+		}
+
+		typ := ""
+		if ref, ok := item.Expr.(*ColumnRef); ok {
+			if idx, err := resolveColumn(ref, columns); err == nil {
+				typ = columns[idx].typ
+			}
+		}
+
+		result[i] = Column{Name: name, Type: typ}
+	}
+	return result
+}
+
+func orderPosition(expr Expr, columns []Column) (int, bool) {
+	switch e := expr.(type) {
+	case *Literal:
+		if n, ok := e.Value.(float64); ok && n >= 1 && int(n) <= len(columns) {
+			return int(n) - 1, true
+		}
+	case *ColumnRef:
+		if e.Table == "" {
+			for i, col := range columns {
+				if strings.EqualFold(col.Name, e.Name) {
+					return i, true
+				}
+			}
+		}
+	}
+	return 0, false
+}
+
+// substituteAliases replaces references to select aliases, such as
+// "HAVING total > 100", with the aliased expression. Real columns win
+// over aliases of the same name.
+func substituteAliases(expr Expr, items []SelectItem, columns []boundColumn) Expr {
+	switch e := expr.(type) {
+	case *ColumnRef:
+		if e.Table != "" {
+			return e
+		}
+		if _, err := resolveColumn(e, columns); err == nil {
+			return e
+		}
+		for _, item := range items {
+			if item.Alias != "" && strings.EqualFold(item.Alias, e.Name) {
+				return item.Expr
+			}
+		}
+		return e
+	case *BinaryExpr:
+		return &BinaryExpr{Op: e.Op, Left: substituteAliases(e.Left, items, columns), Right: substituteAliases(e.Right, items, columns)}
+	case *UnaryExpr:
+		return &UnaryExpr{Op: e.Op, Expr: substituteAliases(e.Expr, items, columns)}
+	case *IsNullExpr:
+		return &IsNullExpr{Expr: substituteAliases(e.Expr, items, columns), Not: e.Not}
+	case *BetweenExpr:
+		return &BetweenExpr{
+			Expr: substituteAliases(e.Expr, items, columns),
+			Low:  substituteAliases(e.Low, items, columns),
+			High: substituteAliases(e.High, items, columns),
+			Not:  e.Not,
+		}
+	case *InExpr:
+		list := make([]Expr, len(e.List))
+		for i, item := range e.List {
+			list[i] = substituteAliases(item, items, columns)
+		}
+		return &InExpr{Expr: substituteAliases(e.Expr, items, columns), List: list, Not: e.Not}
+	}
+	return expr
+}
+
+func rowKey(values []interface{}) string {
+	parts := make([]string, len(values))
+	for i, v := range values {
+		parts[i] = fmt.Sprintf("%T:%v", v, v)
+	}
+	return strings.Join(parts, "\x00")
+}
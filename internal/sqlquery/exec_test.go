@@ -0,0 +1,132 @@
+package sqlquery
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+)
+
+func newTestExecutor(t *testing.T) *Executor {
+	t.Helper()
+	f := excelize.NewFile()
+	f.SetSheetName("Sheet1", "Ventes")
+	for i, row := range [][]interface{}{
+		{"Code", "Rayon", "Montant", "Date"},
+		{"A1", "Frais", 120.5, "2025-01-15"},
+		{"A2", "Epicerie", 80, "2025-02-01"},
+		{"A3", "Frais", 30, "2025-02-20"},
+		{"A4", "Bazar", nil, "2025-03-05"},
+		{"A5", "Textile", 45, "2025-03-09"},
+	} {
+		cell, _ := excelize.CoordinatesToCellName(1, i+1)
+		f.SetSheetRow("Ventes", cell, &row)
+	}
+	f.NewSheet("Rayons")
+	for i, row := range [][]interface{}{
+		{"Rayon", "Responsable"},
+		{"frais", "Alice"},
+		{"Epicerie", "Bruno"},
+		{"Bazar", "Chloé"},
+	} {
+		cell, _ := excelize.CoordinatesToCellName(1, i+1)
+		f.SetSheetRow("Rayons", cell, &row)
+	}
+	return NewExecutor(NewWorkbookCatalog(f, 1))
+}
+
+func TestExecutorQuery(t *testing.T) {
+	e := newTestExecutor(t)
+
+	tests := []struct {
+		sql     string
+		columns []Column
+		rows    [][]interface{}
+	}{
+		{
+			"SELECT Code, Montant FROM ventes WHERE Montant > 40 ORDER BY Montant DESC",
+			[]Column{{"Code", TypeText}, {"Montant", TypeNumber}},
+			[][]interface{}{{"A1", 120.5}, {"A2", 80.0}, {"A5", 45.0}},
+		},
+		{
+			"SELECT Rayon, SUM(Montant) AS total, COUNT(*) n FROM Ventes GROUP BY Rayon HAVING total >= 80 ORDER BY total",
+			[]Column{{"Rayon", TypeText}, {"total", TypeNumber}, {"n", TypeNumber}},
+			[][]interface{}{{"Epicerie", 80.0, 1}, {"Frais", 150.5, 2}},
+		},
+		{
+			"SELECT DISTINCT Rayon FROM Ventes WHERE Montant IS NULL OR Rayon LIKE 'fr%' ORDER BY 1",
+			[]Column{{"Rayon", TypeText}},
+			[][]interface{}{{"Bazar"}, {"Frais"}},
+		},
+		{
+			"SELECT Code FROM Ventes WHERE Date BETWEEN '2025-02-01' AND '2025-03-05' AND Code NOT IN ('A3') LIMIT 5 OFFSET 1",
+			[]Column{{"Code", TypeText}},
+			[][]interface{}{{"A4"}},
+		},
+		{
+			// Join keys compare case-sensitively, as = does; unmatched
+			// rows keep nulls
+			"SELECT v.Code, r.Responsable FROM Ventes v LEFT JOIN Rayons r ON v.Rayon = r.Rayon ORDER BY v.Code",
+			[]Column{{"Code", TypeText}, {"Responsable", TypeText}},
+			[][]interface{}{{"A1", nil}, {"A2", "Bruno"}, {"A3", nil}, {"A4", "Chloé"}, {"A5", nil}},
+		},
+		{
+			"SELECT COUNT(*) AS n FROM Ventes v JOIN Rayons r ON v.Rayon = r.Rayon",
+			[]Column{{"n", TypeNumber}},
+			[][]interface{}{{2}},
+		},
+		{
+			"DESCRIBE Ventes",
+			[]Column{{"column", TypeText}, {"type", TypeText}},
+			[][]interface{}{{"Code", TypeText}, {"Rayon", TypeText}, {"Montant", TypeNumber}, {"Date", TypeDate}},
+		},
+	}
+
+	for _, tt := range tests {
+		result, err := e.Query(tt.sql)
+		if err != nil {
+			t.Errorf("Query(%q): %v", tt.sql, err)
+			continue
+		}
+		if !reflect.DeepEqual(result.Columns, tt.columns) {
+			t.Errorf("Query(%q) columns = %v, want %v", tt.sql, result.Columns, tt.columns)
+		}
+		if !reflect.DeepEqual(result.Rows, tt.rows) {
+			t.Errorf("Query(%q) rows = %v, want %v", tt.sql, result.Rows, tt.rows)
+		}
+	}
+}
+
+func TestExecutorErrors(t *testing.T) {
+	e := newTestExecutor(t)
+
+	tests := []struct {
+		sql  string
+		want string
+	}{
+		{"SELECT * FROM Clients", "unknown relation"},
+		{"SELECT Inconnue FROM Ventes", "Inconnue"},
+		{"SELECT Rayon FROM Ventes v JOIN Rayons r ON v.Rayon = r.Rayon", "ambiguous"},
+		{"SELECT Code FROM Ventes WHERE SUM(Montant) > 0", "not allowed"},
+		{"SELECT SUM(*) FROM Ventes", "not supported"},
+	}
+
+	for _, tt := range tests {
+		_, err := e.Query(tt.sql)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Query(%q) error = %v, want %q", tt.sql, err, tt.want)
+		}
+	}
+}
+
+func TestShowTables(t *testing.T) {
+	result, err := newTestExecutor(t).Query("SHOW TABLES")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]interface{}{{"Ventes", "sheet", "Ventes", ""}, {"Rayons", "sheet", "Rayons", ""}}
+	if !reflect.DeepEqual(result.Rows, want) {
+		t.Errorf("SHOW TABLES = %v, want %v", result.Rows, want)
+	}
+}
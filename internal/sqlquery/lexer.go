@@ -0,0 +1,148 @@
+package sqlquery
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokQuotedIdent
+	tokString
+	tokNumber
+	tokSymbol
+	tokKeyword
+)
+
+type sqlToken struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+var keywords = map[string]bool{
+	"SELECT": true, "DISTINCT": true, "FROM": true, "WHERE": true, "GROUP": true,
+	"BY": true, "HAVING": true, "ORDER": true, "ASC": true, "DESC": true,
+	"LIMIT": true, "OFFSET": true, "AS": true, "JOIN": true, "INNER": true,
+	"LEFT": true, "OUTER": true, "ON": true, "AND": true, "OR": true,
+	"NOT": true, "IN": true, "IS": true, "NULL": true, "LIKE": true,
+	"BETWEEN": true, "TRUE": true, "FALSE": true, "SHOW": true, "TABLES": true,
+	"DESCRIBE": true,
+}
+
+func tokenize(input string) ([]sqlToken, error) {
+	var tokens []sqlToken
+	runes := []rune(input)
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+
+		switch {
+		case unicode.IsSpace(r):
+			i++
+
+		case r == '-' && i+1 < len(runes) && runes[i+1] == '-':
+			// Line comment
+			for i < len(runes) && runes[i] != '\n' {
+				i++
+			}
+
+		case r == '\'':
+			text, next, err := readQuoted(runes, i, '\'')
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, sqlToken{kind: tokString, text: text, pos: i})
+			i = next
+
+		case r == '"' || r == '`':
+			text, next, err := readQuoted(runes, i, r)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, sqlToken{kind: tokQuotedIdent, text: text, pos: i})
+			i = next
+
+		case r == '[':
+			end := i + 1
+			for end < len(runes) && runes[end] != ']' {
+				end++
+			}
+			if end >= len(runes) {
+				return nil, fmt.Errorf("unterminated identifier at position %d", i)
+			}
+			tokens = append(tokens, sqlToken{kind: tokQuotedIdent, text: string(runes[i+1 : end]), pos: i})
+			i = end + 1
+
+		case unicode.IsDigit(r) || (r == '.' && i+1 < len(runes) && unicode.IsDigit(runes[i+1])):
+			start := i
+			for i < len(runes) && (unicode.IsDigit(runes[i]) || runes[i] == '.') {
+				i++
+			}
+			if i < len(runes) && (runes[i] == 'e' || runes[i] == 'E') {
+				i++
+				if i < len(runes) && (runes[i] == '+' || runes[i] == '-') {
+					i++
+				}
+				for i < len(runes) && unicode.IsDigit(runes[i]) {
+					i++
+				}
+			}
+			tokens = append(tokens, sqlToken{kind: tokNumber, text: string(runes[start:i]), pos: start})
+
+		case unicode.IsLetter(r) || r == '_':
+			start := i
+			for i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) || runes[i] == '_') {
+				i++
+			}
+			text := string(runes[start:i])
+			if keywords[strings.ToUpper(text)] {
+				tokens = append(tokens, sqlToken{kind: tokKeyword, text: strings.ToUpper(text), pos: start})
+			} else {
+				tokens = append(tokens, sqlToken{kind: tokIdent, text: text, pos: start})
+			}
+
+		default:
+			// Two-character operators first
+			if i+1 < len(runes) {
+				pair := string(runes[i : i+2])
+				if pair == "<=" || pair == ">=" || pair == "<>" || pair == "!=" || pair == "||" {
+					tokens = append(tokens, sqlToken{kind: tokSymbol, text: pair, pos: i})
+					i += 2
+					continue
+				}
+			}
+			if strings.ContainsRune("=<>+-*/%(),.;", r) {
+				tokens = append(tokens, sqlToken{kind: tokSymbol, text: string(r), pos: i})
+				i++
+				continue
+			}
+			return nil, fmt.Errorf("unexpected character %q at position %d", r, i)
+		}
+	}
+
+	tokens = append(tokens, sqlToken{kind: tokEOF, pos: len(runes)})
+	return tokens, nil
+}
+
+// readQuoted reads a quoted string where a doubled quote is an escaped
+// quote, and returns the text and the index after the closing quote.
+func readQuoted(runes []rune, start int, quote rune) (string, int, error) {
+	var sb strings.Builder
+	for i := start + 1; i < len(runes); i++ {
+		if runes[i] == quote {
+			if i+1 < len(runes) && runes[i+1] == quote {
+				sb.WriteRune(quote)
+				i++
+				continue
+			}
+			return sb.String(), i + 1, nil
+		}
+		sb.WriteRune(runes[i])
+	}
+	return "", 0, fmt.Errorf("unterminated quote at position %d", start)
+}
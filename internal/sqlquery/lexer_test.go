@@ -0,0 +1,66 @@
+package sqlquery
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    []sqlToken
+		wantErr string
+	}{
+		{
+			input: "select Montant from Ventes",
+			want: []sqlToken{
+				{tokKeyword, "SELECT", 0}, {tokIdent, "Montant", 7},
+				{tokKeyword, "FROM", 15}, {tokIdent, "Ventes", 20}, {tokEOF, "", 26},
+			},
+		},
+		{
+			input: `"Grand Livre" [Code TVA] ` + "`Année`",
+			want: []sqlToken{
+				{tokQuotedIdent, "Grand Livre", 0}, {tokQuotedIdent, "Code TVA", 14},
+				{tokQuotedIdent, "Année", 25}, {tokEOF, "", 32},
+			},
+		},
+		{
+			input: "'l''été' 12.5 .5 1e-3",
+			want: []sqlToken{
+				{tokString, "l'été", 0}, {tokNumber, "12.5", 9},
+				{tokNumber, ".5", 14}, {tokNumber, "1e-3", 17}, {tokEOF, "", 21},
+			},
+		},
+		{
+			input: "a<=b<>c!=d||e -- fin\n;",
+			want: []sqlToken{
+				{tokIdent, "a", 0}, {tokSymbol, "<=", 1}, {tokIdent, "b", 3},
+				{tokSymbol, "<>", 4}, {tokIdent, "c", 6}, {tokSymbol, "!=", 7},
+				{tokIdent, "d", 9}, {tokSymbol, "||", 10}, {tokIdent, "e", 12},
+				{tokSymbol, ";", 21}, {tokEOF, "", 22},
+			},
+		},
+		{input: "'ouvert", wantErr: "unterminated quote"},
+		{input: "[Code", wantErr: "unterminated identifier"},
+		{input: "a ? b", wantErr: "unexpected character"},
+	}
+
+	for _, tt := range tests {
+		got, err := tokenize(tt.input)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("tokenize(%q) error = %v, want %q", tt.input, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("tokenize(%q): %v", tt.input, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("tokenize(%q) = %v, want %v", tt.input, got, tt.want)
+		}
+	}
+}
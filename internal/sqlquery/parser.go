@@ -0,0 +1,676 @@
+package sqlquery
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// AST
+type Expr interface{}
+
+type ColumnRef struct {
+	Table string
+	Name  string
+}
+
+type Literal struct {
+	Value interface{}
+}
+
+type BinaryExpr struct {
+	Op    string
+	Left  Expr
+	Right Expr
+}
+
+type UnaryExpr struct {
+	Op   string
+	Expr Expr
+}
+
+type FuncCall struct {
+	Name     string
+	Args     []Expr
+	Star     bool
+	Distinct bool
+}
+
+type InExpr struct {
+	Expr Expr
+	List []Expr
+	Not  bool
+}
+
+type BetweenExpr struct {
+	Expr Expr
+	Low  Expr
+	High Expr
+	Not  bool
+}
+
+type IsNullExpr struct {
+	Expr Expr
+	Not  bool
+}
+
+type LikeExpr struct {
+	Expr    Expr
+	Pattern Expr
+	Not     bool
+}
+
+type SelectItem struct {
+	Expr      Expr
+	Alias     string
+	Star      bool
+	StarTable string
+}
+
+type TableRef struct {
+	Name  string
+	Alias string
+}
+
+type JoinClause struct {
+	Type  string // "inner" or "left"
+	Table TableRef
+	On    Expr
+}
+
+type OrderItem struct {
+	Expr Expr
+	Desc bool
+}
+
+type SelectStmt struct {
+	Distinct bool
+	Items    []SelectItem
+	From     TableRef
+	Joins    []JoinClause
+	Where    Expr
+	GroupBy  []Expr
+	Having   Expr
+	OrderBy  []OrderItem
+	Limit    int
+	Offset   int
+}
+
+type ShowTablesStmt struct{}
+
+type DescribeStmt struct {
+	Table string
+}
+
+type parser struct {
+	tokens []sqlToken
+	pos    int
+}
+
+// Parse parses a single SELECT, SHOW TABLES or DESCRIBE statement.
+func Parse(input string) (interface{}, error) {
+	tokens, err := tokenize(input)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+
+	var stmt interface{}
+	switch {
+	case p.acceptKeyword("SHOW"):
+		if err := p.expectKeyword("TABLES"); err != nil {
+			return nil, err
+		}
+		stmt = &ShowTablesStmt{}
+
+	case p.acceptKeyword("DESCRIBE"):
+		name, err := p.parseName()
+		if err != nil {
+			return nil, err
+		}
+		stmt = &DescribeStmt{Table: name}
+
+	default:
+		stmt, err = p.parseSelect()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	p.acceptSymbol(";")
+	if p.peek().kind != tokEOF {
+		return nil, p.errorf("unexpected %q", p.peek().text)
+	}
+
+	return stmt, nil
+}
+
+func (p *parser) parseSelect() (*SelectStmt, error) {
+	if err := p.expectKeyword("SELECT"); err != nil {
+		return nil, err
+	}
+
+	stmt := &SelectStmt{Limit: -1}
+	stmt.Distinct = p.acceptKeyword("DISTINCT")
+
+	for {
+		item, err := p.parseSelectItem()
+		if err != nil {
+			return nil, err
+		}
+		stmt.Items = append(stmt.Items, item)
+		if !p.acceptSymbol(",") {
+			break
+		}
+	}
+
+	if err := p.expectKeyword("FROM"); err != nil {
+		return nil, err
+	}
+	from, err := p.parseTableRef()
+	if err != nil {
+		return nil, err
+	}
+	stmt.From = from
+
+	for {
+		joinType := ""
+		switch {
+		case p.acceptKeyword("JOIN"):
+			joinType = "inner"
+		case p.acceptKeyword("INNER"):
+			if err := p.expectKeyword("JOIN"); err != nil {
+				return nil, err
+			}
+			joinType = "inner"
+		case p.acceptKeyword("LEFT"):
+			p.acceptKeyword("OUTER")
+			if err := p.expectKeyword("JOIN"); err != nil {
+				return nil, err
+			}
+			joinType = "left"
+		}
+		if joinType == "" {
+			break
+		}
+
+		table, err := p.parseTableRef()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectKeyword("ON"); err != nil {
+			return nil, err
+		}
+		on, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		stmt.Joins = append(stmt.Joins, JoinClause{Type: joinType, Table: table, On: on})
+	}
+
+	if p.acceptKeyword("WHERE") {
+		if stmt.Where, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+	}
+
+	if p.acceptKeyword("GROUP") {
+		if err := p.expectKeyword("BY"); err != nil {
+			return nil, err
+		}
+		for {
+			expr, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			stmt.GroupBy = append(stmt.GroupBy, expr)
+			if !p.acceptSymbol(",") {
+				break
+			}
+		}
+	}
+
+	if p.acceptKeyword("HAVING") {
+		if stmt.Having, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+	}
+
+	if p.acceptKeyword("ORDER") {
+		if err := p.expectKeyword("BY"); err != nil {
+			return nil, err
+		}
+		for {
+			expr, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			item := OrderItem{Expr: expr}
+			if p.acceptKeyword("DESC") {
+				item.Desc = true
+			} else {
+				p.acceptKeyword("ASC")
+			}
+			stmt.OrderBy = append(stmt.OrderBy, item)
+			if !p.acceptSymbol(",") {
+				break
+			}
+		}
+	}
+
+	if p.acceptKeyword("LIMIT") {
+		if stmt.Limit, err = p.parseInt(); err != nil {
+			return nil, err
+		}
+	}
+
+	if p.acceptKeyword("OFFSET") {
+		if stmt.Offset, err = p.parseInt(); err != nil {
+			return nil, err
+		}
+	}
+
+	return stmt, nil
+}
+
+func (p *parser) parseSelectItem() (SelectItem, error) {
+	if p.acceptSymbol("*") {
+		return SelectItem{Star: true}, nil
+	}
+
+	// table.* form
+	if (p.peek().kind == tokIdent || p.peek().kind == tokQuotedIdent) &&
+		p.peekAt(1).text == "." && p.peekAt(2).text == "*" {
+		table := p.next().text
+		p.next()
+		p.next()
+		return SelectItem{Star: true, StarTable: table}, nil
+	}
+
+	expr, err := p.parseExpr()
+	if err != nil {
+		return SelectItem{}, err
+	}
+
+	item := SelectItem{Expr: expr}
+	if p.acceptKeyword("AS") {
+		if item.Alias, err = p.parseName(); err != nil {
+			return SelectItem{}, err
+		}
+	} else if p.peek().kind == tokIdent || p.peek().kind == tokQuotedIdent {
+		item.Alias = p.next().text
+	}
+
+	return item, nil
+}
+
+func (p *parser) parseTableRef() (TableRef, error) {
+	name, err := p.parseName()
+	if err != nil {
+		return TableRef{}, err
+	}
+
+	ref := TableRef{Name: name}
+	if p.acceptKeyword("AS") {
+		if ref.Alias, err = p.parseName(); err != nil {
+			return TableRef{}, err
+		}
+	} else if p.peek().kind == tokIdent || p.peek().kind == tokQuotedIdent {
+		ref.Alias = p.next().text
+	}
+
+	return ref, nil
+}
+
+// Expression grammar, lowest precedence first:
+// OR, AND, NOT, comparison/IN/LIKE/BETWEEN/IS, + - ||, * / %, unary -
+func (p *parser) parseExpr() (Expr, error) {
+	return p.parseOr()
+}
+
+func (p *parser) parseOr() (Expr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptKeyword("OR") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &BinaryExpr{Op: "OR", Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (Expr, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptKeyword("AND") {
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &BinaryExpr{Op: "AND", Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseNot() (Expr, error) {
+	if p.acceptKeyword("NOT") {
+		expr, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &UnaryExpr{Op: "NOT", Expr: expr}, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *parser) parseComparison() (Expr, error) {
+	left, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+
+	if tok := p.peek(); tok.kind == tokSymbol {
+		switch tok.text {
+		case "=", "<>", "!=", "<", "<=", ">", ">=":
+			p.next()
+			right, err := p.parseAdditive()
+			if err != nil {
+				return nil, err
+			}
+			op := tok.text
+			if op == "!=" {
+				op = "<>"
+			}
+			return &BinaryExpr{Op: op, Left: left, Right: right}, nil
+		}
+	}
+
+	if p.acceptKeyword("IS") {
+		not := p.acceptKeyword("NOT")
+		if err := p.expectKeyword("NULL"); err != nil {
+			return nil, err
+		}
+		return &IsNullExpr{Expr: left, Not: not}, nil
+	}
+
+	not := p.acceptKeyword("NOT")
+
+	switch {
+	case p.acceptKeyword("IN"):
+		if err := p.expectSymbol("("); err != nil {
+			return nil, err
+		}
+		var list []Expr
+		for {
+			item, err := p.parseAdditive()
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, item)
+			if !p.acceptSymbol(",") {
+				break
+			}
+		}
+		if err := p.expectSymbol(")"); err != nil {
+			return nil, err
+		}
+		return &InExpr{Expr: left, List: list, Not: not}, nil
+
+	case p.acceptKeyword("LIKE"):
+		pattern, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		return &LikeExpr{Expr: left, Pattern: pattern, Not: not}, nil
+
+	case p.acceptKeyword("BETWEEN"):
+		low, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectKeyword("AND"); err != nil {
+			return nil, err
+		}
+		high, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		return &BetweenExpr{Expr: left, Low: low, High: high, Not: not}, nil
+	}
+
+	if not {
+		return nil, p.errorf("expected IN, LIKE or BETWEEN after NOT")
+	}
+
+	return left, nil
+}
+
+func (p *parser) parseAdditive() (Expr, error) {
+	left, err := p.parseMultiplicative()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		tok := p.peek()
+		if tok.kind != tokSymbol || (tok.text != "+" && tok.text != "-" && tok.text != "||") {
+			return left, nil
+		}
+		p.next()
+		right, err := p.parseMultiplicative()
+		if err != nil {
+			return nil, err
+		}
+		left = &BinaryExpr{Op: tok.text, Left: left, Right: right}
+	}
+}
+
+func (p *parser) parseMultiplicative() (Expr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		tok := p.peek()
+		if tok.kind != tokSymbol || (tok.text != "*" && tok.text != "/" && tok.text != "%") {
+			return left, nil
+		}
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &BinaryExpr{Op: tok.text, Left: left, Right: right}
+	}
+}
+
+func (p *parser) parseUnary() (Expr, error) {
+	if p.acceptSymbol("-") {
+		expr, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &UnaryExpr{Op: "-", Expr: expr}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (Expr, error) {
+	tok := p.peek()
+
+	switch tok.kind {
+	case tokNumber:
+		p.next()
+		value, err := strconv.ParseFloat(tok.text, 64)
+		if err != nil {
+			return nil, p.errorf("invalid number %q", tok.text)
+		}
+		return &Literal{Value: value}, nil
+
+	case tokString:
+		p.next()
+		return &Literal{Value: tok.text}, nil
+
+	case tokKeyword:
+		switch tok.text {
+		case "NULL":
+			p.next()
+			return &Literal{Value: nil}, nil
+		case "TRUE":
+			p.next()
+			return &Literal{Value: true}, nil
+		case "FALSE":
+			p.next()
+			return &Literal{Value: false}, nil
+		}
+
+	case tokSymbol:
+		if tok.text == "(" {
+			p.next()
+			expr, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expectSymbol(")"); err != nil {
+				return nil, err
+			}
+			return expr, nil
+		}
+
+	case tokIdent, tokQuotedIdent:
+		p.next()
+
+		// Function call
+		if tok.kind == tokIdent && p.acceptSymbol("(") {
+			return p.parseFuncCall(tok.text)
+		}
+
+		// Qualified column
+		if p.acceptSymbol(".") {
+			name, err := p.parseName()
+			if err != nil {
+				return nil, err
+			}
+			return &ColumnRef{Table: tok.text, Name: name}, nil
+		}
+
+		return &ColumnRef{Name: tok.text}, nil
+	}
+
+	return nil, p.errorf("unexpected %q", tok.text)
+}
+
+func (p *parser) parseFuncCall(name string) (Expr, error) {
+	call := &FuncCall{Name: strings.ToUpper(name)}
+
+	if p.acceptSymbol("*") {
+		call.Star = true
+		return call, p.expectSymbol(")")
+	}
+
+	call.Distinct = p.acceptKeyword("DISTINCT")
+
+	if p.acceptSymbol(")") {
+		return call, nil
+	}
+
+	for {
+		arg, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		call.Args = append(call.Args, arg)
+		if !p.acceptSymbol(",") {
+			break
+		}
+	}
+
+	return call, p.expectSymbol(")")
+}
+
+// Token helpers
+func (p *parser) peek() sqlToken {
+	return p.peekAt(0)
+}
+
+func (p *parser) peekAt(offset int) sqlToken {
+	if p.pos+offset >= len(p.tokens) {
+		return p.tokens[len(p.tokens)-1]
+	}
+	return p.tokens[p.pos+offset]
+}
+
+func (p *parser) next() sqlToken {
+	tok := p.peek()
+	if p.pos < len(p.tokens)-1 {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *parser) acceptKeyword(keyword string) bool {
+	if tok := p.peek(); tok.kind == tokKeyword && tok.text == keyword {
+		p.next()
+		return true
+	}
+	return false
+}
+
+func (p *parser) expectKeyword(keyword string) error {
+	if !p.acceptKeyword(keyword) {
+		return p.errorf("expected %s", keyword)
+	}
+	return nil
+}
+
+func (p *parser) acceptSymbol(symbol string) bool {
+	if tok := p.peek(); tok.kind == tokSymbol && tok.text == symbol {
+		p.next()
+		return true
+	}
+	return false
+}
+
+func (p *parser) expectSymbol(symbol string) error {
+	if !p.acceptSymbol(symbol) {
+		return p.errorf("expected %q", symbol)
+	}
+	return nil
+}
+
+func (p *parser) parseName() (string, error) {
+	tok := p.peek()
+	if tok.kind != tokIdent && tok.kind != tokQuotedIdent {
+		return "", p.errorf("expected a name")
+	}
+	p.next()
+	return tok.text, nil
+}
+
+func (p *parser) parseInt() (int, error) {
+	tok := p.peek()
+	if tok.kind != tokNumber {
+		return 0, p.errorf("expected a number")
+	}
+	p.next()
+	value, err := strconv.Atoi(tok.text)
+	if err != nil || value < 0 {
+		return 0, p.errorf("invalid count %q", tok.text)
+	}
+	return value, nil
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	tok := p.peek()
+	where := fmt.Sprintf("at position %d", tok.pos)
+	if tok.kind == tokEOF {
+		where = "at end of query"
+	}
+	return fmt.Errorf("syntax error %s: %s", where, fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,132 @@
+package sqlquery
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	col := func(name string) *ColumnRef { return &ColumnRef{Name: name} }
+	num := func(v float64) *Literal { return &Literal{Value: v} }
+
+	tests := []struct {
+		input string
+		want  interface{}
+	}{
+		{"SHOW TABLES;", &ShowTablesStmt{}},
+		{`DESCRIBE "Grand Livre"`, &DescribeStmt{Table: "Grand Livre"}},
+		{
+			"SELECT * FROM Ventes",
+			&SelectStmt{Items: []SelectItem{{Star: true}}, From: TableRef{Name: "Ventes"}, Limit: -1},
+		},
+		{
+			"SELECT DISTINCT v.Rayon r, SUM(Montant) AS total FROM Ventes v GROUP BY v.Rayon HAVING total > 10 ORDER BY 2 DESC, r LIMIT 5 OFFSET 1",
+			&SelectStmt{
+				Distinct: true,
+				Items: []SelectItem{
+					{Expr: &ColumnRef{Table: "v", Name: "Rayon"}, Alias: "r"},
+					{Expr: &FuncCall{Name: "SUM", Args: []Expr{col("Montant")}}, Alias: "total"},
+				},
+				From:    TableRef{Name: "Ventes", Alias: "v"},
+				GroupBy: []Expr{&ColumnRef{Table: "v", Name: "Rayon"}},
+				Having:  &BinaryExpr{Op: ">", Left: col("total"), Right: num(10)},
+				OrderBy: []OrderItem{{Expr: num(2), Desc: true}, {Expr: col("r")}},
+				Limit:   5,
+				Offset:  1,
+			},
+		},
+		{
+			"SELECT a.*, COUNT(DISTINCT b.Code) FROM A a LEFT OUTER JOIN B b ON a.Id = b.Id JOIN C ON C.Id = a.Id",
+			&SelectStmt{
+				Items: []SelectItem{
+					{Star: true, StarTable: "a"},
+					{Expr: &FuncCall{Name: "COUNT", Args: []Expr{&ColumnRef{Table: "b", Name: "Code"}}, Distinct: true}},
+				},
+				From: TableRef{Name: "A", Alias: "a"},
+				Joins: []JoinClause{
+					{Type: "left", Table: TableRef{Name: "B", Alias: "b"}, On: &BinaryExpr{Op: "=", Left: &ColumnRef{Table: "a", Name: "Id"}, Right: &ColumnRef{Table: "b", Name: "Id"}}},
+					{Type: "inner", Table: TableRef{Name: "C"}, On: &BinaryExpr{Op: "=", Left: &ColumnRef{Table: "C", Name: "Id"}, Right: &ColumnRef{Table: "a", Name: "Id"}}},
+				},
+				Limit: -1,
+			},
+		},
+		{
+			// AND binds tighter than OR, * tighter than +
+			"SELECT x FROM T WHERE a = 1 OR b = 2 AND c + 2 * 3 > 4",
+			&SelectStmt{
+				Items: []SelectItem{{Expr: col("x")}},
+				From:  TableRef{Name: "T"},
+				Where: &BinaryExpr{
+					Op:   "OR",
+					Left: &BinaryExpr{Op: "=", Left: col("a"), Right: num(1)},
+					Right: &BinaryExpr{
+						Op:   "AND",
+						Left: &BinaryExpr{Op: "=", Left: col("b"), Right: num(2)},
+						Right: &BinaryExpr{
+							Op:    ">",
+							Left:  &BinaryExpr{Op: "+", Left: col("c"), Right: &BinaryExpr{Op: "*", Left: num(2), Right: num(3)}},
+							Right: num(4),
+						},
+					},
+				},
+				Limit: -1,
+			},
+		},
+		{
+			"SELECT x FROM T WHERE a NOT IN (1, 'b') AND c NOT BETWEEN 1 AND 2 AND d IS NOT NULL AND e NOT LIKE 'x%'",
+			&SelectStmt{
+				Items: []SelectItem{{Expr: col("x")}},
+				From:  TableRef{Name: "T"},
+				Where: &BinaryExpr{
+					Op: "AND",
+					Left: &BinaryExpr{
+						Op: "AND",
+						Left: &BinaryExpr{
+							Op:    "AND",
+							Left:  &InExpr{Expr: col("a"), List: []Expr{num(1), &Literal{Value: "b"}}, Not: true},
+							Right: &BetweenExpr{Expr: col("c"), Low: num(1), High: num(2), Not: true},
+						},
+						Right: &IsNullExpr{Expr: col("d"), Not: true},
+					},
+					Right: &LikeExpr{Expr: col("e"), Pattern: &Literal{Value: "x%"}, Not: true},
+				},
+				Limit: -1,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		got, err := Parse(tt.input)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.input, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Parse(%q) = %#v, want %#v", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"SELECT", "at end of query"},
+		{"SELECT a", "at end of query"},
+		{"SELECT a FROM T WHERE", "at end of query"},
+		{"SELECT a FROM T LIMIT x", "at position 22: expected a number"},
+		{"SELECT a FROM T extra junk", `unexpected "junk"`},
+		{"SELECT a FROM T LEFT T2", "at position 21"},
+		{"SELECT (a FROM T", "at position 10"},
+		{"SHOW", "at end of query"},
+	}
+
+	for _, tt := range tests {
+		_, err := Parse(tt.input)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Parse(%q) error = %v, want %q", tt.input, err, tt.want)
+		}
+	}
+}
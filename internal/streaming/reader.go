@@ -10,6 +10,7 @@ import (
 	"github.com/xuri/excelize/v2"
 
 	"mcp-xlsm-server/internal/models"
+	"mcp-xlsm-server/internal/workbook"
 )
 
 type ChunkReader struct {
@@ -192,6 +193,7 @@ type WindowedReader struct {
 	file     *excelize.File
 	window   models.Window
 	sheetName string
+	propagateMerged bool
 }
 
 func NewWindowedReader(file *excelize.File, sheetName string, window models.Window) *WindowedReader {
@@ -202,11 +204,26 @@ func NewWindowedReader(file *excelize.File, sheetName string, window models.Wind
 	}
 }
 
+// PropagateMerged makes ReadWindow repeat the value of a merged region
+// in every cell it covers instead of leaving them blank.
+func (wr *WindowedReader) PropagateMerged(propagate bool) *WindowedReader {
+	wr.propagateMerged = propagate
+	return wr
+}
+
 func (wr *WindowedReader) ReadWindow() ([][]string, error) {
 	rows, err := wr.file.GetRows(wr.sheetName)
 	if err != nil {
 		return nil, err
 	}
+
+	if wr.propagateMerged {
+		merges, err := workbook.ReadMerges(wr.file, wr.sheetName)
+		if err != nil {
+			return nil, err
+		}
+		rows = merges.Fill(rows)
+	}
 	
 	// Extract the specified window
 	var windowData [][]string
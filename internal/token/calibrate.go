@@ -0,0 +1,102 @@
+package token
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// CountTokensURL is the Messages API endpoint reporting the input tokens
+// of a request without running it
+const CountTokensURL = "https://api.anthropic.com/v1/messages/count_tokens"
+
+// Calibrator measures the token_scale of the claude estimator for one
+// model, against the counts the API reports for sample texts.
+type Calibrator struct {
+	Client *http.Client
+	URL    string
+	APIKey string
+	// Model is the API name, such as claude-sonnet-4-20250514
+	Model string
+}
+
+// Calibrate returns the ratio of the API count to the unscaled estimate,
+// over all samples. The tokens the API adds around any message are
+// measured on a one-letter message and taken off each count.
+func (c *Calibrator) Calibrate(ctx context.Context, samples []string) (float64, error) {
+	if len(samples) == 0 {
+		return 0, fmt.Errorf("no samples")
+	}
+	estimator := NewClaudeEstimator(1)
+
+	base, err := c.count(ctx, "a")
+	if err != nil {
+		return 0, err
+	}
+	overhead := base - estimator.CountString("a")
+
+	measured, estimated := 0, 0
+	for i, sample := range samples {
+		if sample == "" {
+			return 0, fmt.Errorf("sample %d is empty", i+1)
+		}
+		n, err := c.count(ctx, sample)
+		if err != nil {
+			return 0, fmt.Errorf("sample %d: %w", i+1, err)
+		}
+		measured += n - overhead
+		estimated += estimator.CountString(sample)
+	}
+	return float64(measured) / float64(estimated), nil
+}
+
+// count asks the API for the input tokens of one user message
+func (c *Calibrator) count(ctx context.Context, text string) (int, error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"model":    c.Model,
+		"messages": []map[string]string{{"role": "user", "content": text}},
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	url := c.URL
+	if url == "" {
+		url = CountTokensURL
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("content-type", "application/json")
+	req.Header.Set("x-api-key", c.APIKey)
+	req.Header.Set("anthropic-version", "2023-06-01")
+
+	client := c.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return 0, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("count_tokens returned %s: %s", resp.Status, bytes.TrimSpace(data))
+	}
+	var result struct {
+		InputTokens int `json:"input_tokens"`
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return 0, fmt.Errorf("failed to parse count_tokens response: %w", err)
+	}
+	return result.InputTokens, nil
+}
@@ -0,0 +1,69 @@
+package token
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCalibrate(t *testing.T) {
+	// The fake API adds 7 tokens to every message and counts twice the
+	// estimate for the text
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("x-api-key") != "cle" || r.Header.Get("anthropic-version") == "" {
+			http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+			return
+		}
+		var req struct {
+			Model    string `json:"model"`
+			Messages []struct {
+				Content string `json:"content"`
+			} `json:"messages"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Model != "claude-test" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		n := 7 + 2*NewClaudeEstimator(1).CountString(req.Messages[0].Content)
+		json.NewEncoder(w).Encode(map[string]int{"input_tokens": n})
+	}))
+	defer server.Close()
+
+	samples := []string{`{"rows":[["Compte",512000]]}`, "Total des ventes"}
+	estimated := 0
+	for _, sample := range samples {
+		estimated += NewClaudeEstimator(1).CountString(sample)
+	}
+
+	c := &Calibrator{URL: server.URL, APIKey: "cle", Model: "claude-test"}
+	scale, err := c.Calibrate(context.Background(), samples)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The one-letter probe counts 9 and is taken as one token of text, so
+	// each sample loses one token more than the real overhead
+	want := float64(2*estimated-len(samples)) / float64(estimated)
+	if math.Abs(scale-want) > 1e-9 {
+		t.Errorf("Calibrate() = %g, want %g", scale, want)
+	}
+
+	for _, tt := range []struct {
+		name    string
+		c       *Calibrator
+		samples []string
+		want    string
+	}{
+		{"no samples", c, nil, "no samples"},
+		{"empty sample", c, []string{"x", ""}, "sample 2 is empty"},
+		{"rejected key", &Calibrator{URL: server.URL, APIKey: "autre", Model: "claude-test"}, []string{"x"}, "401"},
+	} {
+		_, err := tt.c.Calibrate(context.Background(), tt.samples)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: err = %v, want %q", tt.name, err, tt.want)
+		}
+	}
+}
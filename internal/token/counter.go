@@ -4,158 +4,133 @@ import (
 	"encoding/json"
 	"fmt"
 	"sync"
-
-	"github.com/pkoukk/tiktoken-go"
 )
 
+// Counter counts tokens with the tokenizer each model is configured
+// with; Count and CountString use the default model's.
 type Counter struct {
-	encoder *tiktoken.Tiktoken
-	cache   sync.Map
-	mu      sync.RWMutex
+	tokenizers sync.Map // tokenizer name and settings -> Tokenizer
+	cache      sync.Map
+	mu         sync.RWMutex
 }
 
-type ModelLimits struct {
-	Context   int
-	SafeBuffer int
-	OutputMax int
+func NewCounter() *Counter {
+	return &Counter{}
 }
 
-var ModelConfigs = map[string]ModelLimits{
-	"sonnet-4": {
-		Context:   200_000,
-		SafeBuffer: 180_000,
-		OutputMax: 64_000,
-	},
-	"sonnet-4-beta": {
-		Context:   1_000_000,
-		SafeBuffer: 950_000,
-		OutputMax: 64_000,
-	},
-	"opus-4-1": {
-		Context:   200_000,
-		SafeBuffer: 180_000,
-		OutputMax: 32_000,
-	},
-}
+// Tokenizer returns the tokenizer of a model
+func (tc *Counter) Tokenizer(modelName string) Tokenizer {
+	_, limits := lookupModel(modelName)
 
-func NewCounter() (*Counter, error) {
-	// Use Claude's tokenizer encoding
-	enc, err := tiktoken.GetEncoding("cl100k_base")
-	if err != nil {
-		return nil, fmt.Errorf("failed to get tiktoken encoding: %w", err)
+	name := limits.Tokenizer
+	if name == "" {
+		name = TokenizerClaude
 	}
-	
-	return &Counter{
-		encoder: enc,
-	}, nil
+
+	key := fmt.Sprintf("%s_%g_%g", name, limits.TokenScale, limits.CharsPerToken)
+	if tokenizer, ok := tc.tokenizers.Load(key); ok {
+		return tokenizer.(Tokenizer)
+	}
+
+	var tokenizer Tokenizer
+	switch name {
+	case TokenizerClaude:
+		tokenizer = NewClaudeEstimator(limits.TokenScale)
+	default:
+		tokenizer = NewRatioTokenizer(limits.CharsPerToken)
+	}
+	actual, _ := tc.tokenizers.LoadOrStore(key, tokenizer)
+	return actual.(Tokenizer)
+}
+
+// CountingMethod names the tokenizer used for a model
+func (tc *Counter) CountingMethod(modelName string) string {
+	return tc.Tokenizer(modelName).Name()
 }
 
 func (tc *Counter) Count(data interface{}) (int, error) {
+	return tc.CountForModel(DefaultModel(), data)
+}
+
+// CountForModel counts data as the JSON a model would read
+func (tc *Counter) CountForModel(modelName string, data interface{}) (int, error) {
+	tokenizer := tc.Tokenizer(modelName)
+
 	// Generate cache key
-	key := fmt.Sprintf("%T_%v", data, data)
-	
+	key := fmt.Sprintf("%p_%T_%v", tokenizer, data, data)
+
 	// Check cache first
 	if cached, ok := tc.cache.Load(key); ok {
 		return cached.(int), nil
 	}
-	
+
 	// Convert to JSON for accurate counting
 	jsonBytes, err := json.Marshal(data)
 	if err != nil {
 		return 0, fmt.Errorf("failed to marshal data: %w", err)
 	}
-	
-	// Tokenize
-	tokens := tc.encoder.Encode(string(jsonBytes), nil, nil)
-	count := len(tokens)
-	
+
+	count := tokenizer.CountString(string(jsonBytes))
+
 	// Cache result with size limit
 	tc.cache.Store(key, count)
-	
+
 	return count, nil
 }
 
 func (tc *Counter) CountString(text string) int {
+	return tc.CountStringForModel(DefaultModel(), text)
+}
+
+func (tc *Counter) CountStringForModel(modelName string, text string) int {
+	tokenizer := tc.Tokenizer(modelName)
+
 	// Check cache first
-	if cached, ok := tc.cache.Load(text); ok {
+	key := fmt.Sprintf("%p_%s", tokenizer, text)
+	if cached, ok := tc.cache.Load(key); ok {
 		return cached.(int)
 	}
-	
-	tokens := tc.encoder.Encode(text, nil, nil)
-	count := len(tokens)
-	
+
+	count := tokenizer.CountString(text)
+
 	// Cache result
-	tc.cache.Store(text, count)
-	
-	return count
-}
+	tc.cache.Store(key, count)
 
-func (tc *Counter) EstimateCompressed(data interface{}, method string) (int, error) {
-	baseCount, err := tc.Count(data)
-	if err != nil {
-		return 0, err
-	}
-	
-	switch method {
-	case "gzip":
-		return int(float64(baseCount) * 0.7), nil
-	case "brotli":
-		return int(float64(baseCount) * 0.6), nil
-	case "brotli-aggressive":
-		return int(float64(baseCount) * 0.5), nil
-	default:
-		return baseCount, nil
-	}
+	return count
 }
 
+// GetModelLimits returns the limits of a model, or of the default model
+// when it is unknown
 func (tc *Counter) GetModelLimits(modelName string) ModelLimits {
-	if limits, exists := ModelConfigs[modelName]; exists {
-		return limits
-	}
-	
-	// Default to standard limits
-	return ModelConfigs["sonnet-4"]
+	_, limits := lookupModel(modelName)
+	return limits
 }
 
 func (tc *Counter) CalculateOptimalChunkSize(modelName string, targetUtilization float64) int {
 	limits := tc.GetModelLimits(modelName)
-	
+
 	// Calculate optimal tokens per chunk based on target utilization
 	targetTokens := int(float64(limits.SafeBuffer) * targetUtilization)
-	
+
 	return targetTokens
 }
 
+// ValidateTokenLimit checks that data fits the safe buffer of modelName,
+// counted with that model's tokenizer
 func (tc *Counter) ValidateTokenLimit(data interface{}, modelName string) error {
-	count, err := tc.Count(data)
+	count, err := tc.CountForModel(modelName, data)
 	if err != nil {
 		return err
 	}
-	
+
 	limits := tc.GetModelLimits(modelName)
-	
+
 	if count > limits.SafeBuffer {
-		return fmt.Errorf("token count %d exceeds safe buffer %d for model %s", 
+		return fmt.Errorf("token count %d exceeds safe buffer %d for model %s",
 			count, limits.SafeBuffer, modelName)
 	}
-	
-	return nil
-}
 
-func (tc *Counter) GetCompressionStrategy(tokenCount int, modelName string) string {
-	limits := tc.GetModelLimits(modelName)
-	ratio := float64(tokenCount) / float64(limits.SafeBuffer)
-	
-	switch {
-	case ratio < 0.5:
-		return "none"
-	case ratio < 0.7:
-		return "gzip"
-	case ratio < 0.9:
-		return "brotli"
-	default:
-		return "brotli-aggressive"
-	}
+	return nil
 }
 
 func (tc *Counter) CleanCache() {
@@ -169,7 +144,7 @@ func (tc *Counter) CleanCache() {
 // Advanced token management
 func (tc *Counter) BatchCount(items []interface{}) ([]int, error) {
 	counts := make([]int, len(items))
-	
+
 	for i, item := range items {
 		count, err := tc.Count(item)
 		if err != nil {
@@ -177,24 +152,26 @@ func (tc *Counter) BatchCount(items []interface{}) ([]int, error) {
 		}
 		counts[i] = count
 	}
-	
+
 	return counts, nil
 }
 
+// EstimateChunkingNeeded tells whether data must be split to fit the safe
+// buffer of modelName, and into how many chunks
 func (tc *Counter) EstimateChunkingNeeded(data interface{}, modelName string) (bool, int, error) {
-	count, err := tc.Count(data)
+	count, err := tc.CountForModel(modelName, data)
 	if err != nil {
 		return false, 0, err
 	}
-	
+
 	limits := tc.GetModelLimits(modelName)
-	
+
 	if count <= limits.SafeBuffer {
 		return false, 1, nil
 	}
-	
+
 	// Calculate number of chunks needed
 	chunksNeeded := (count + limits.SafeBuffer - 1) / limits.SafeBuffer
-	
+
 	return true, chunksNeeded, nil
-}
\ No newline at end of file
+}
@@ -0,0 +1,108 @@
+package token
+
+import (
+	"strings"
+	"testing"
+)
+
+const testModels = `
+default_model: wide
+models:
+  wide:
+    context: 1000
+    safe_buffer: 100
+    tokenizer: ratio
+    chars_per_token: 100
+  narrow:
+    context: 1000
+    safe_buffer: 100
+    tokenizer: ratio
+    chars_per_token: 1
+  claude-sonnet:
+    context: 1000
+    safe_buffer: 100
+    tokenizer: claude
+`
+
+func useTestModels(t *testing.T) {
+	t.Helper()
+	if err := setModels([]byte(testModels)); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := setModels(builtinModels); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestCounterUsesTheModelsTokenizer(t *testing.T) {
+	useTestModels(t)
+	tc := NewCounter()
+	data := strings.Repeat("x", 500)
+
+	tests := []struct {
+		model    string
+		fits     bool
+		chunks   int
+		tokenize string
+	}{
+		{"wide", true, 1, TokenizerRatio},
+		{"narrow", false, 6, TokenizerRatio},
+		{"claude-sonnet", true, 1, TokenizerClaude},
+		{"unknown", true, 1, TokenizerRatio},
+	}
+	for _, tt := range tests {
+		err := tc.ValidateTokenLimit(data, tt.model)
+		if (err == nil) != tt.fits {
+			t.Errorf("ValidateTokenLimit for %s: %v, want fits %v", tt.model, err, tt.fits)
+		}
+		needed, chunks, err := tc.EstimateChunkingNeeded(data, tt.model)
+		if err != nil || needed == tt.fits || chunks != tt.chunks {
+			t.Errorf("EstimateChunkingNeeded for %s = %v, %d, %v; want %d chunks", tt.model, needed, chunks, err, tt.chunks)
+		}
+		if got := tc.CountingMethod(tt.model); got != tt.tokenize {
+			t.Errorf("CountingMethod(%s) = %s, want %s", tt.model, got, tt.tokenize)
+		}
+	}
+}
+
+func TestResolveModel(t *testing.T) {
+	useTestModels(t)
+
+	tests := []struct {
+		hint string
+		want string
+		ok   bool
+	}{
+		{"narrow", "narrow", true},
+		{"Claude_Sonnet 20250514", "claude-sonnet", true},
+		{"gpt-4o", "", false},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := ResolveModel(tt.hint)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("ResolveModel(%q) = %q, %v; want %q, %v", tt.hint, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestSetModelsRejectsBadFiles(t *testing.T) {
+	bad := []string{
+		"models: {}",
+		"default_model: a\nmodels:\n  a: {context: 10, safe_buffer: 20}",
+		"default_model: a\nmodels:\n  a: {context: 10, safe_buffer: 5, tokenizer: word}",
+		"default_model: a\nmodels:\n  a: {context: 10, safe_buffer: 5, tokenizer: cl100k}",
+		"default_model: b\nmodels:\n  a: {context: 10, safe_buffer: 5}",
+	}
+	for _, data := range bad {
+		if err := setModels([]byte(data)); err == nil {
+			setModels(builtinModels)
+			t.Errorf("setModels accepted %q", data)
+		}
+	}
+	if DefaultModel() != "sonnet-4" {
+		t.Errorf("a rejected file replaced the models, default is %s", DefaultModel())
+	}
+}
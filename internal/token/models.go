@@ -0,0 +1,124 @@
+package token
+
+import (
+	_ "embed"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ModelLimits gives the context of a model and how to count its tokens.
+// TokenScale tunes the claude estimator, CharsPerToken the ratio one.
+type ModelLimits struct {
+	Context       int     `yaml:"context"`
+	SafeBuffer    int     `yaml:"safe_buffer"`
+	OutputMax     int     `yaml:"output_max"`
+	Tokenizer     string  `yaml:"tokenizer"`
+	TokenScale    float64 `yaml:"token_scale"`
+	CharsPerToken float64 `yaml:"chars_per_token"`
+}
+
+// ModelsFile is the layout of models.yaml
+type ModelsFile struct {
+	DefaultModel string                 `yaml:"default_model"`
+	Models       map[string]ModelLimits `yaml:"models"`
+}
+
+//go:embed models.yaml
+var builtinModels []byte
+
+var (
+	modelsMu     sync.RWMutex
+	ModelConfigs map[string]ModelLimits
+	defaultModel string
+)
+
+func init() {
+	if err := setModels(builtinModels); err != nil {
+		panic(fmt.Sprintf("built-in models.yaml: %v", err))
+	}
+}
+
+// LoadModels reads a models file and replaces the built-in models.
+func LoadModels(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read models file: %w", err)
+	}
+	if err := setModels(data); err != nil {
+		return fmt.Errorf("models file %s: %w", path, err)
+	}
+	return nil
+}
+
+func setModels(data []byte) error {
+	var file ModelsFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("failed to parse models: %w", err)
+	}
+	if len(file.Models) == 0 {
+		return fmt.Errorf("no models defined")
+	}
+	for name, limits := range file.Models {
+		if limits.Context <= 0 || limits.SafeBuffer <= 0 || limits.SafeBuffer > limits.Context {
+			return fmt.Errorf("model %s: safe_buffer must be positive and within context", name)
+		}
+		switch limits.Tokenizer {
+		case "", TokenizerClaude, TokenizerRatio:
+		case "cl100k":
+			return fmt.Errorf("model %s: the cl100k tokenizer was removed, use ratio", name)
+		default:
+			return fmt.Errorf("model %s: unknown tokenizer %q", name, limits.Tokenizer)
+		}
+	}
+	if _, ok := file.Models[file.DefaultModel]; !ok {
+		return fmt.Errorf("default_model %q is not defined", file.DefaultModel)
+	}
+
+	modelsMu.Lock()
+	defer modelsMu.Unlock()
+	ModelConfigs = file.Models
+	defaultModel = file.DefaultModel
+	return nil
+}
+
+// DefaultModel is the model assumed when the client's is unknown
+func DefaultModel() string {
+	modelsMu.RLock()
+	defer modelsMu.RUnlock()
+	return defaultModel
+}
+
+// lookupModel returns the limits of model, or of the default model when
+// it is unknown, and the name of the model used
+func lookupModel(model string) (string, ModelLimits) {
+	modelsMu.RLock()
+	defer modelsMu.RUnlock()
+	if limits, ok := ModelConfigs[model]; ok {
+		return model, limits
+	}
+	return defaultModel, ModelConfigs[defaultModel]
+}
+
+// ResolveModel maps a model name reported by a client, such as
+// claude-sonnet-4-20250514, to the configured model named inside it; the
+// longest configured name wins. Dots and underscores count as dashes.
+func ResolveModel(hint string) (string, bool) {
+	normalized := strings.NewReplacer(".", "-", "_", "-", " ", "-").Replace(strings.ToLower(strings.TrimSpace(hint)))
+	if normalized == "" {
+		return "", false
+	}
+
+	modelsMu.RLock()
+	defer modelsMu.RUnlock()
+	best := ""
+	for name := range ModelConfigs {
+		if strings.Contains(normalized, strings.ToLower(name)) && len(name) > len(best) {
+			best = name
+		}
+	}
+	return best, best != ""
+}
@@ -0,0 +1,123 @@
+package token
+
+import (
+	"math"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Tokenizer names used by the models file
+const (
+	TokenizerClaude = "claude"
+	TokenizerRatio  = "ratio"
+)
+
+// Tokenizer counts the tokens of a text the way one family of models
+// would read it
+type Tokenizer interface {
+	Name() string
+	CountString(text string) int
+}
+
+// claudeEstimator approximates Claude's tokenizer, whose vocabulary is
+// not published. It splits text the way BPE vocabularies tend to: short
+// words are one token and long ones one more per six letters, digits go
+// by threes, punctuation by pairs, and letters of non-Latin scripts by
+// one each. Scale corrects the total, measured against the token counts
+// the API reports for a model.
+type claudeEstimator struct {
+	scale float64
+}
+
+func NewClaudeEstimator(scale float64) Tokenizer {
+	if scale <= 0 {
+		scale = 1
+	}
+	return &claudeEstimator{scale: scale}
+}
+
+func (t *claudeEstimator) Name() string { return TokenizerClaude }
+
+func (t *claudeEstimator) CountString(text string) int {
+	tokens := 0
+	for i := 0; i < len(text); {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		run := runLength(text[i:], runClass(r))
+		switch runClass(r) {
+		case classWord:
+			tokens += 1 + (run-1)/6
+		case classDigit:
+			tokens += (run + 2) / 3
+		case classPunct:
+			tokens += (run + 1) / 2
+		case classSpace:
+			// A single space belongs to the word after it
+			if run > 1 || r == '\n' || i+size == len(text) {
+				tokens++
+			}
+		default:
+			tokens += run
+		}
+		for ; run > 0; run-- {
+			_, size := utf8.DecodeRuneInString(text[i:])
+			i += size
+		}
+	}
+	return int(math.Ceil(float64(tokens) * t.scale))
+}
+
+const (
+	classWord = iota
+	classDigit
+	classPunct
+	classSpace
+	classOther
+)
+
+func runClass(r rune) int {
+	switch {
+	case unicode.IsSpace(r):
+		return classSpace
+	case unicode.IsDigit(r):
+		return classDigit
+	case unicode.Is(unicode.Latin, r):
+		return classWord
+	case unicode.IsLetter(r):
+		return classOther
+	default:
+		return classPunct
+	}
+}
+
+// runLength counts the runes at the start of text in class
+func runLength(text string, class int) int {
+	n := 0
+	for _, r := range text {
+		if runClass(r) != class {
+			break
+		}
+		n++
+	}
+	return n
+}
+
+// ratioTokenizer divides the length of a text by an average number of
+// characters per token; it needs nothing and is never far off for prose
+type ratioTokenizer struct {
+	charsPerToken float64
+}
+
+const defaultCharsPerToken = 3.5
+
+func NewRatioTokenizer(charsPerToken float64) Tokenizer {
+	if charsPerToken <= 0 {
+		charsPerToken = defaultCharsPerToken
+	}
+	return &ratioTokenizer{charsPerToken: charsPerToken}
+}
+
+func (t *ratioTokenizer) Name() string { return TokenizerRatio }
+
+func (t *ratioTokenizer) CountString(text string) int {
+	return int(math.Ceil(float64(utf8.RuneCountInString(text)) / t.charsPerToken))
+}
@@ -0,0 +1,46 @@
+package token
+
+import "testing"
+
+func TestClaudeEstimator(t *testing.T) {
+	tests := []struct {
+		text  string
+		scale float64
+		want  int
+	}{
+		{"", 1, 0},
+		{"hello", 1, 1},
+		{"hello world", 1, 2},
+		{"internationalization", 1, 4},
+		{"123456", 1, 2},
+		{"1234567", 1, 3},
+		{`{"a":1}`, 1, 5},
+		{"été", 1, 1},
+		{"日本語", 1, 3},
+		{"hello world", 1.5, 3},
+	}
+	for _, tt := range tests {
+		if got := NewClaudeEstimator(tt.scale).CountString(tt.text); got != tt.want {
+			t.Errorf("CountString(%q) at scale %g = %d, want %d", tt.text, tt.scale, got, tt.want)
+		}
+	}
+}
+
+func TestRatioTokenizer(t *testing.T) {
+	tests := []struct {
+		text          string
+		charsPerToken float64
+		want          int
+	}{
+		{"", 4, 0},
+		{"abcd", 4, 1},
+		{"abcde", 4, 2},
+		{"abcdefg", 0, 2},
+		{"éééé", 2, 2},
+	}
+	for _, tt := range tests {
+		if got := NewRatioTokenizer(tt.charsPerToken).CountString(tt.text); got != tt.want {
+			t.Errorf("CountString(%q) at %g chars per token = %d, want %d", tt.text, tt.charsPerToken, got, tt.want)
+		}
+	}
+}
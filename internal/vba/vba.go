@@ -0,0 +1,294 @@
+package vba
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/richardlehane/mscfb"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/korean"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/traditionalchinese"
+	"golang.org/x/text/encoding/unicode"
+)
+
+type Module struct {
+	Name   string `json:"name"`
+	Stream string `json:"stream"`
+	Source string `json:"source"`
+}
+
+// ExtractModules reads the VBA source of every module in a macro-enabled
+// workbook. Workbooks without a VBA project return no modules and no error.
+func ExtractModules(path string) ([]Module, error) {
+	archive, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open workbook archive: %w", err)
+	}
+	defer archive.Close()
+
+	for _, entry := range archive.File {
+		if !strings.EqualFold(entry.Name, "xl/vbaProject.bin") {
+			continue
+		}
+		rc, err := entry.Open()
+		if err != nil {
+			return nil, err
+		}
+		data, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return nil, err
+		}
+		return ParseProject(data)
+	}
+
+	return nil, nil
+}
+
+// ParseProject decodes a vbaProject.bin compound file (MS-OVBA): the dir
+// stream lists the modules, and each module stream holds its compressed
+// source after the p-code.
+func ParseProject(data []byte) ([]Module, error) {
+	doc, err := mscfb.New(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("invalid VBA project: %w", err)
+	}
+
+	streams := make(map[string][]byte)
+	for entry, err := doc.Next(); err == nil; entry, err = doc.Next() {
+		if len(entry.Path) == 0 || !strings.EqualFold(entry.Path[len(entry.Path)-1], "VBA") {
+			continue
+		}
+		buf := make([]byte, entry.Size)
+		if _, err := io.ReadFull(entry, buf); err != nil {
+			return nil, fmt.Errorf("failed to read stream %s: %w", entry.Name, err)
+		}
+		streams[strings.ToLower(entry.Name)] = buf
+	}
+
+	dirStream, ok := streams["dir"]
+	if !ok {
+		return nil, fmt.Errorf("VBA project has no dir stream")
+	}
+	dir, err := Decompress(dirStream)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress dir stream: %w", err)
+	}
+
+	entries, codePage, err := parseDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	modules := make([]Module, 0, len(entries))
+	for _, entry := range entries {
+		stream, ok := streams[strings.ToLower(entry.stream)]
+		if !ok || int(entry.offset) > len(stream) {
+			continue
+		}
+		source, err := Decompress(stream[entry.offset:])
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress module %s: %w", entry.name, err)
+		}
+		modules = append(modules, Module{
+			Name:   entry.name,
+			Stream: entry.stream,
+			Source: strings.ReplaceAll(decodeCodePage(source, codePage), "\r\n", "\n"),
+		})
+	}
+
+	return modules, nil
+}
+
+type moduleEntry struct {
+	name   string
+	stream string
+	offset uint32
+}
+
+// Record ids of the dir stream used here
+const (
+	recProjectCodePage = 0x0003
+	recProjectVersion  = 0x0009
+	recModuleName      = 0x0019
+	recModuleStream    = 0x001A
+	recModuleOffset    = 0x0031
+)
+
+// parseDir lists the modules of a dir stream and the code page their
+// names and source are written in. PROJECTCODEPAGE comes before the
+// modules, so their names are decoded as they are read.
+func parseDir(dir []byte) ([]moduleEntry, uint16, error) {
+	var modules []moduleEntry
+	var current *moduleEntry
+	codePage := uint16(defaultCodePage)
+
+	pos := 0
+	for pos+6 <= len(dir) {
+		id := binary.LittleEndian.Uint16(dir[pos:])
+		size := int(binary.LittleEndian.Uint32(dir[pos+2:]))
+		pos += 6
+
+		// PROJECTVERSION declares 4 bytes but carries 6
+		if id == recProjectVersion {
+			size = 6
+		}
+		if pos+size > len(dir) {
+			return nil, 0, fmt.Errorf("truncated dir stream record 0x%04X", id)
+		}
+		payload := dir[pos : pos+size]
+		pos += size
+
+		switch id {
+		case recProjectCodePage:
+			if len(payload) >= 2 {
+				codePage = binary.LittleEndian.Uint16(payload)
+			}
+		case recModuleName:
+			name := decodeCodePage(payload, codePage)
+			modules = append(modules, moduleEntry{name: name, stream: name})
+			current = &modules[len(modules)-1]
+		case recModuleStream:
+			if current != nil {
+				current.stream = decodeCodePage(payload, codePage)
+			}
+		case recModuleOffset:
+			if current != nil && len(payload) >= 4 {
+				current.offset = binary.LittleEndian.Uint32(payload)
+			}
+		}
+	}
+
+	return modules, codePage, nil
+}
+
+// Decompress implements the MS-OVBA run-length compression used by the
+// dir and module streams.
+func Decompress(data []byte) ([]byte, error) {
+	if len(data) == 0 || data[0] != 0x01 {
+		return nil, fmt.Errorf("invalid compressed container signature")
+	}
+
+	var out []byte
+	pos := 1
+	for pos+2 <= len(data) {
+		header := binary.LittleEndian.Uint16(data[pos:])
+		chunkEnd := pos + int(header&0x0FFF) + 3
+		if chunkEnd > len(data) {
+			chunkEnd = len(data)
+		}
+		pos += 2
+
+		// Raw chunks hold 4096 literal bytes
+		if header&0x8000 == 0 {
+			end := pos + 4096
+			if end > len(data) {
+				end = len(data)
+			}
+			out = append(out, data[pos:end]...)
+			pos = end
+			continue
+		}
+
+		chunkStart := len(out)
+		for pos < chunkEnd {
+			flags := data[pos]
+			pos++
+			for bit := 0; bit < 8 && pos < chunkEnd; bit++ {
+				if flags&(1<<bit) == 0 {
+					out = append(out, data[pos])
+					pos++
+					continue
+				}
+
+				if pos+2 > chunkEnd {
+					return nil, fmt.Errorf("truncated copy token")
+				}
+				token := binary.LittleEndian.Uint16(data[pos:])
+				pos += 2
+
+				bitCount := uint(4)
+				for (1 << bitCount) < len(out)-chunkStart {
+					bitCount++
+				}
+				lengthMask := uint16(0xFFFF) >> bitCount
+				length := int(token&lengthMask) + 3
+				offset := int(token>>(16-bitCount)) + 1
+
+				src := len(out) - offset
+				if src < chunkStart {
+					return nil, fmt.Errorf("copy token points before chunk start")
+				}
+				for i := 0; i < length; i++ {
+					out = append(out, out[src+i])
+				}
+			}
+		}
+		pos = chunkEnd
+	}
+
+	return out, nil
+}
+
+// Western European projects, and those that do not declare a code page,
+// are read as Windows-1252
+const defaultCodePage = 1252
+
+// Encodings of the Windows code pages a VBA project can declare
+var codePages = map[uint16]encoding.Encoding{
+	437:   charmap.CodePage437,
+	850:   charmap.CodePage850,
+	852:   charmap.CodePage852,
+	855:   charmap.CodePage855,
+	858:   charmap.CodePage858,
+	860:   charmap.CodePage860,
+	862:   charmap.CodePage862,
+	863:   charmap.CodePage863,
+	865:   charmap.CodePage865,
+	866:   charmap.CodePage866,
+	874:   charmap.Windows874,
+	932:   japanese.ShiftJIS,
+	936:   simplifiedchinese.GBK,
+	949:   korean.EUCKR,
+	950:   traditionalchinese.Big5,
+	1250:  charmap.Windows1250,
+	1251:  charmap.Windows1251,
+	1252:  charmap.Windows1252,
+	1253:  charmap.Windows1253,
+	1254:  charmap.Windows1254,
+	1255:  charmap.Windows1255,
+	1256:  charmap.Windows1256,
+	1257:  charmap.Windows1257,
+	1258:  charmap.Windows1258,
+	10000: charmap.Macintosh,
+	10007: charmap.MacintoshCyrillic,
+	20866: charmap.KOI8R,
+	21866: charmap.KOI8U,
+	28591: charmap.ISO8859_1,
+	28592: charmap.ISO8859_2,
+	28595: charmap.ISO8859_5,
+	28597: charmap.ISO8859_7,
+	28605: charmap.ISO8859_15,
+	65001: unicode.UTF8,
+}
+
+// decodeCodePage reads text of the dir and module streams in the code page
+// the project declares; an unknown one falls back to Windows-1252
+func decodeCodePage(text []byte, codePage uint16) string {
+	enc, ok := codePages[codePage]
+	if !ok {
+		enc = codePages[defaultCodePage]
+	}
+	decoded, err := enc.NewDecoder().Bytes(text)
+	if err != nil {
+		decoded, _ = codePages[defaultCodePage].NewDecoder().Bytes(text)
+	}
+	return string(decoded)
+}
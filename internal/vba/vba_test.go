@@ -0,0 +1,127 @@
+package vba
+
+import (
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+func TestDecompress(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []byte
+		want    string
+		wantErr bool
+	}{
+		{
+			// MS-OVBA 3.2, examples 1 to 3
+			name: "mixed literals and copies",
+			data: []byte{
+				0x01, 0x2F, 0xB0, 0x00, 0x23, 0x61, 0x61, 0x61, 0x62, 0x63, 0x64, 0x65, 0x82, 0x66, 0x00, 0x70,
+				0x61, 0x67, 0x68, 0x69, 0x6A, 0x01, 0x38, 0x08, 0x61, 0x6B, 0x6C, 0x00, 0x30, 0x6D, 0x6E, 0x6F,
+				0x70, 0x06, 0x71, 0x02, 0x70, 0x04, 0x10, 0x72, 0x73, 0x74, 0x75, 0x76, 0x10, 0x77, 0x78, 0x79,
+				0x7A, 0x00, 0x3C,
+			},
+			want: "#aaabcdefaaaaghijaaaaaklaaamnopqaaaaaaaaaaaarstuvwxyzaaa",
+		},
+		{
+			name: "literals only",
+			data: []byte{
+				0x01, 0x19, 0xB0, 0x00, 0x61, 0x62, 0x63, 0x64, 0x65, 0x66, 0x67, 0x68, 0x00, 0x69, 0x6A, 0x6B,
+				0x6C, 0x6D, 0x6E, 0x6F, 0x70, 0x00, 0x71, 0x72, 0x73, 0x74, 0x75, 0x76, 0x2E,
+			},
+			want: "abcdefghijklmnopqrstuv.",
+		},
+		{
+			name: "overlapping copy",
+			data: []byte{0x01, 0x03, 0xB0, 0x02, 0x61, 0x45, 0x00},
+			want: strings.Repeat("a", 73),
+		},
+		{name: "empty", data: nil, wantErr: true},
+		{name: "bad signature", data: []byte{0x02, 0x03, 0xB0, 0x00, 0x61}, wantErr: true},
+		{name: "truncated copy token", data: []byte{0x01, 0x01, 0xB0, 0x01, 0x00}, wantErr: true},
+		{name: "copy before the first byte", data: []byte{0x01, 0x02, 0xB0, 0x01, 0x00, 0x00}, wantErr: true},
+		{
+			// A copy token only reaches back within its own chunk
+			name:    "copy into the previous chunk",
+			data:    []byte{0x01, 0x03, 0xB0, 0x00, 0x61, 0x62, 0x63, 0x02, 0xB0, 0x01, 0x00, 0x00},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		got, err := Decompress(tt.data)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: error = %v, want error %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && string(got) != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDecodeCodePage(t *testing.T) {
+	tests := []struct {
+		text     []byte
+		codePage uint16
+		want     string
+	}{
+		{[]byte("Sub Total()"), 1252, "Sub Total()"},
+		{[]byte{'D', 0xE9, 'b', 'i', 't'}, 1252, "Débit"},
+		{[]byte{0xD1, 0xF3, 0xEC, 0xEC, 0xE0}, 1251, "Сумма"},
+		{[]byte{0x82, 0xA0}, 932, "あ"},
+		{[]byte{0xC5, 0x82}, 65001, "ł"},
+		{[]byte{'D', 0xE9, 'b', 'i', 't'}, 999, "Débit"},
+	}
+
+	for _, tt := range tests {
+		if got := decodeCodePage(tt.text, tt.codePage); got != tt.want {
+			t.Errorf("decodeCodePage(% x, %d) = %q, want %q", tt.text, tt.codePage, got, tt.want)
+		}
+	}
+}
+
+func TestParseDir(t *testing.T) {
+	record := func(id uint16, payload []byte) []byte {
+		b := make([]byte, 6, 6+len(payload))
+		binary.LittleEndian.PutUint16(b, id)
+		binary.LittleEndian.PutUint32(b[2:], uint32(len(payload)))
+		return append(b, payload...)
+	}
+	u16 := func(v uint16) []byte { return binary.LittleEndian.AppendUint16(nil, v) }
+	u32 := func(v uint32) []byte { return binary.LittleEndian.AppendUint32(nil, v) }
+	// "Сумма" in Windows-1251
+	cyrillic := []byte{0xD1, 0xF3, 0xEC, 0xEC, 0xE0}
+
+	var dir []byte
+	dir = append(dir, record(recProjectCodePage, u16(1251))...)
+	dir = append(dir, record(recModuleName, cyrillic)...)
+	dir = append(dir, record(recModuleStream, cyrillic)...)
+	dir = append(dir, record(recModuleOffset, u32(1234))...)
+	dir = append(dir, record(recModuleName, []byte("Module1"))...)
+
+	modules, codePage, err := parseDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if codePage != 1251 {
+		t.Errorf("code page = %d, want 1251", codePage)
+	}
+	want := []moduleEntry{
+		{name: "Сумма", stream: "Сумма", offset: 1234},
+		{name: "Module1", stream: "Module1"},
+	}
+	if len(modules) != len(want) {
+		t.Fatalf("modules = %+v, want %+v", modules, want)
+	}
+	for i := range want {
+		if modules[i] != want[i] {
+			t.Errorf("module %d = %+v, want %+v", i, modules[i], want[i])
+		}
+	}
+
+	if _, _, err := parseDir(record(recModuleName, []byte("Module1"))[:8]); err == nil {
+		t.Error("truncated record accepted")
+	}
+}
@@ -0,0 +1,418 @@
+package watch
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"mcp-xlsm-server/internal/diff"
+	"mcp-xlsm-server/internal/index"
+	"mcp-xlsm-server/internal/models"
+	"mcp-xlsm-server/internal/workbook"
+)
+
+// Sheets with more changed cells than this are re-read as a whole
+// instead of being patched cell by cell.
+const bulkThreshold = 200
+
+// ChangedCells keeps at most this many of the latest locations.
+const maxChangedCells = 1000
+
+// Event is published after a registered workbook changed on disk and its
+// index was updated.
+type Event struct {
+	Path        string
+	OldChecksum string
+	NewChecksum string
+	Deltas      []models.Delta
+	Summary     models.DiffSummary
+}
+
+type entry struct {
+	path string
+	// options open the workbook again on each refresh
+	options  workbook.Options
+	modTime  time.Time
+	size     int64
+	checksum string
+	index    *index.Manager
+	tracking models.DeltaTracking
+}
+
+// Watcher polls registered workbooks. Polling rather than file system
+// notifications survives Excel's save-by-rename and network volumes. When
+// a file changes it is diffed against the indexed snapshot and the
+// resulting deltas are applied to the live index.
+type Watcher struct {
+	mu sync.Mutex
+	// refreshMu serializes refreshes so a change is applied once
+	refreshMu sync.Mutex
+	store     *diff.Store
+	entries   map[string]*entry
+	listeners []func(Event)
+}
+
+func NewWatcher(store *diff.Store) *Watcher {
+	return &Watcher{
+		store:   store,
+		entries: make(map[string]*entry),
+	}
+}
+
+// Register indexes a workbook and starts tracking it. Registering a path
+// twice returns the existing index. opts, such as the password of an
+// encrypted workbook, are kept to re-read the file when it changes.
+func (w *Watcher) Register(path string, opts ...workbook.Options) (*index.Manager, error) {
+	var options workbook.Options
+	if len(opts) > 0 {
+		options = opts[0]
+	}
+
+	w.mu.Lock()
+	if e, ok := w.entries[path]; ok {
+		w.mu.Unlock()
+		return e.index, nil
+	}
+	w.mu.Unlock()
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	checksum, err := fileChecksum(path)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.store.Load(path, checksum, options); err != nil {
+		return nil, err
+	}
+
+	idx, err := buildIndex(path, options)
+	if err != nil {
+		return nil, err
+	}
+
+	e := &entry{
+		path:     path,
+		options:  options,
+		modTime:  info.ModTime(),
+		size:     info.Size(),
+		checksum: checksum,
+		index:    idx,
+		tracking: models.DeltaTracking{
+			LastUpdate:   time.Now(),
+			ChangedCells: []string{},
+		},
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if existing, ok := w.entries[path]; ok {
+		return existing.index, nil
+	}
+	w.entries[path] = e
+	return idx, nil
+}
+
+func (w *Watcher) Unregister(path string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	delete(w.entries, path)
+}
+
+// Index returns the live index of a registered workbook.
+func (w *Watcher) Index(path string) (*index.Manager, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	e, ok := w.entries[path]
+	if !ok {
+		return nil, false
+	}
+	return e.index, true
+}
+
+// Tracking returns the delta tracking of a registered workbook.
+func (w *Watcher) Tracking(path string) (models.DeltaTracking, bool) {
+	w.mu.Lock()
+	e, ok := w.entries[path]
+	if !ok {
+		w.mu.Unlock()
+		return models.DeltaTracking{}, false
+	}
+	tracking := e.tracking
+	tracking.ChangedCells = append([]string{}, e.tracking.ChangedCells...)
+	idx := e.index
+	w.mu.Unlock()
+
+	tracking.RebuildRequired = tracking.RebuildRequired || idx.RebuildPending()
+	return tracking, true
+}
+
+// Paths lists the registered workbooks.
+func (w *Watcher) Paths() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	paths := make([]string, 0, len(w.entries))
+	for path := range w.entries {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// Checksum returns the checksum the index of path was last updated to.
+func (w *Watcher) Checksum(path string) (string, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	e, ok := w.entries[path]
+	if !ok {
+		return "", false
+	}
+	return e.checksum, true
+}
+
+// OnChange adds a listener called after each applied change.
+func (w *Watcher) OnChange(listener func(Event)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.listeners = append(w.listeners, listener)
+}
+
+// Run polls the registered workbooks until ctx is done.
+func (w *Watcher) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			w.Poll()
+		}
+	}
+}
+
+// Poll checks every registered workbook once.
+func (w *Watcher) Poll() {
+	w.mu.Lock()
+	paths := make([]string, 0, len(w.entries))
+	for path := range w.entries {
+		paths = append(paths, path)
+	}
+	w.mu.Unlock()
+
+	for _, path := range paths {
+		// A file caught mid-save fails to open; the next poll retries
+		_ = w.Refresh(path)
+	}
+}
+
+// Refresh applies the changes made to path since it was last indexed.
+func (w *Watcher) Refresh(path string) error {
+	w.refreshMu.Lock()
+	defer w.refreshMu.Unlock()
+
+	return w.refresh(path)
+}
+
+func (w *Watcher) refresh(path string) error {
+	w.mu.Lock()
+	e, ok := w.entries[path]
+	if !ok {
+		w.mu.Unlock()
+		return fmt.Errorf("workbook not registered: %s", path)
+	}
+	lastMod, lastSize, oldChecksum, options := e.modTime, e.size, e.checksum, e.options
+	w.mu.Unlock()
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if info.ModTime().Equal(lastMod) && info.Size() == lastSize {
+		return nil
+	}
+
+	checksum, err := fileChecksum(path)
+	if err != nil {
+		return err
+	}
+	if checksum == oldChecksum {
+		w.mu.Lock()
+		e.modTime, e.size = info.ModTime(), info.Size()
+		w.mu.Unlock()
+		return nil
+	}
+
+	target, err := w.store.Load(path, checksum, options)
+	if err != nil {
+		return err
+	}
+
+	var deltas []models.Delta
+	var summary models.DiffSummary
+	rebuildRequired := false
+	if base, ok := w.store.Get(oldChecksum); ok {
+		result := diff.Compare(base, target, diff.Options{IncludeRecalculated: true})
+		deltas = coalesce(result.Changes)
+		summary = result.Summary
+	} else {
+		// The old snapshot was evicted: re-read every sheet
+		rebuildRequired = true
+		for _, sheet := range target.Sheets {
+			deltas = append(deltas, models.Delta{Type: models.BulkChange, SheetID: sheet.Name})
+		}
+	}
+
+	return w.apply(e, info, oldChecksum, checksum, deltas, summary, rebuildRequired)
+}
+
+// Apply records a change the server made itself, from baseChecksum to
+// checksum: the deltas are applied to the index directly instead of being
+// recomputed from the file. If the index is not at baseChecksum it falls
+// back to a full refresh. Unwatched paths are ignored.
+func (w *Watcher) Apply(path, baseChecksum, checksum string, deltas []models.Delta) error {
+	w.refreshMu.Lock()
+	defer w.refreshMu.Unlock()
+
+	w.mu.Lock()
+	e, ok := w.entries[path]
+	var oldChecksum string
+	var options workbook.Options
+	if ok {
+		oldChecksum, options = e.checksum, e.options
+	}
+	w.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	if oldChecksum != baseChecksum {
+		return w.refresh(path)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	// Keep a snapshot of the new version as the baseline of the next diff
+	if _, err := w.store.Load(path, checksum, options); err != nil {
+		return err
+	}
+
+	return w.apply(e, info, oldChecksum, checksum, deltas, models.DiffSummary{}, false)
+}
+
+func (w *Watcher) apply(e *entry, info os.FileInfo, oldChecksum, checksum string, deltas []models.Delta, summary models.DiffSummary, rebuildRequired bool) error {
+	if err := e.index.UpdateDelta(deltas); err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	e.modTime, e.size, e.checksum = info.ModTime(), info.Size(), checksum
+	e.tracking.LastUpdate = time.Now()
+	e.tracking.RebuildRequired = rebuildRequired
+	for _, delta := range deltas {
+		if delta.Location != "" {
+			e.tracking.ChangedCells = append(e.tracking.ChangedCells, delta.Location)
+		}
+	}
+	if overflow := len(e.tracking.ChangedCells) - maxChangedCells; overflow > 0 {
+		e.tracking.ChangedCells = e.tracking.ChangedCells[overflow:]
+	}
+	listeners := append([]func(Event){}, w.listeners...)
+	w.mu.Unlock()
+
+	event := Event{
+		Path:        e.path,
+		OldChecksum: oldChecksum,
+		NewChecksum: checksum,
+		Deltas:      deltas,
+		Summary:     summary,
+	}
+	for _, listener := range listeners {
+		listener(event)
+	}
+
+	return nil
+}
+
+// coalesce replaces the cell deltas of heavily changed sheets, and of
+// sheets whose rows shifted, by one bulk change per sheet.
+func coalesce(changes []models.Delta) []models.Delta {
+	cellCounts := make(map[string]int)
+	shifted := make(map[string]bool)
+	for _, change := range changes {
+		switch change.Type {
+		case models.CellUpdate, models.FormulaChange:
+			cellCounts[change.SheetID]++
+		case models.RowInsert, models.RowDelete:
+			shifted[change.SheetID] = true
+		}
+	}
+
+	var deltas []models.Delta
+	bulkAdded := make(map[string]bool)
+	for _, change := range changes {
+		sheet := change.SheetID
+		bulk := shifted[sheet] || cellCounts[sheet] > bulkThreshold
+		switch change.Type {
+		case models.CellUpdate, models.FormulaChange, models.RowInsert, models.RowDelete:
+			if !bulk {
+				deltas = append(deltas, change)
+				continue
+			}
+			if !bulkAdded[sheet] {
+				bulkAdded[sheet] = true
+				deltas = append(deltas, models.Delta{
+					Type:          models.BulkChange,
+					SheetID:       sheet,
+					AffectedCells: cellCounts[sheet],
+				})
+			}
+		default:
+			deltas = append(deltas, change)
+		}
+	}
+
+	return deltas
+}
+
+func buildIndex(path string, options workbook.Options) (*index.Manager, error) {
+	file, err := workbook.Open(path, options)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open XLSM file: %w", err)
+	}
+	defer file.Close()
+
+	idx := index.NewManager()
+	if err := idx.BuildFromFile(file, file.GetSheetList()); err != nil {
+		return nil, err
+	}
+	idx.SetSource(path, options)
+	return idx, nil
+}
+
+func fileChecksum(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", hash.Sum(nil)), nil
+}
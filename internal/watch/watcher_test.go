@@ -0,0 +1,313 @@
+package watch
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+
+	"mcp-xlsm-server/internal/diff"
+	"mcp-xlsm-server/internal/models"
+)
+
+// testWorkbook writes workbooks to one path, each save stamped a second
+// after the previous one so the watcher sees it whatever the file system
+// resolution.
+type testWorkbook struct {
+	t     *testing.T
+	path  string
+	mtime time.Time
+}
+
+func newTestWorkbook(t *testing.T) *testWorkbook {
+	return &testWorkbook{
+		t:     t,
+		path:  filepath.Join(t.TempDir(), "bilan.xlsx"),
+		mtime: time.Now().Add(-time.Hour),
+	}
+}
+
+func (wb *testWorkbook) save(values map[string]interface{}) string {
+	wb.t.Helper()
+	f := excelize.NewFile()
+	defer f.Close()
+	for cell, value := range values {
+		f.SetCellValue("Sheet1", cell, value)
+	}
+	if err := f.SaveAs(wb.path); err != nil {
+		wb.t.Fatal(err)
+	}
+	wb.touch()
+
+	checksum, err := fileChecksum(wb.path)
+	if err != nil {
+		wb.t.Fatal(err)
+	}
+	return checksum
+}
+
+func (wb *testWorkbook) touch() {
+	wb.t.Helper()
+	wb.mtime = wb.mtime.Add(time.Second)
+	if err := os.Chtimes(wb.path, wb.mtime, wb.mtime); err != nil {
+		wb.t.Fatal(err)
+	}
+}
+
+func newTestWatcher(t *testing.T, path string) (*Watcher, *[]Event) {
+	t.Helper()
+	w := NewWatcher(diff.NewStore(4))
+	if _, err := w.Register(path); err != nil {
+		t.Fatal(err)
+	}
+	var events []Event
+	w.OnChange(func(e Event) { events = append(events, e) })
+	return w, &events
+}
+
+func TestRefreshAppliesChanges(t *testing.T) {
+	wb := newTestWorkbook(t)
+	oldChecksum := wb.save(map[string]interface{}{"A1": "Actif", "B1": 100})
+	w, events := newTestWatcher(t, wb.path)
+
+	newChecksum := wb.save(map[string]interface{}{"A1": "Passif", "B1": 100})
+	if err := w.Refresh(wb.path); err != nil {
+		t.Fatalf("Refresh() = %v", err)
+	}
+
+	if len(*events) != 1 {
+		t.Fatalf("got %d events, want 1", len(*events))
+	}
+	event := (*events)[0]
+	if event.OldChecksum != oldChecksum || event.NewChecksum != newChecksum {
+		t.Errorf("event checksums = %s -> %s, want %s -> %s", event.OldChecksum, event.NewChecksum, oldChecksum, newChecksum)
+	}
+	if len(event.Deltas) != 1 || event.Deltas[0].Type != models.CellUpdate || event.Deltas[0].Location != "Sheet1!A1" {
+		t.Errorf("event deltas = %+v, want one update of Sheet1!A1", event.Deltas)
+	}
+
+	if got, _ := w.Checksum(wb.path); got != newChecksum {
+		t.Errorf("Checksum() = %s, want %s", got, newChecksum)
+	}
+	idx, _ := w.Index(wb.path)
+	if len(idx.SearchText("Passif")) != 1 || len(idx.SearchText("Actif")) != 0 {
+		t.Error("index not updated to the saved values")
+	}
+	tracking, _ := w.Tracking(wb.path)
+	if !reflect.DeepEqual(tracking.ChangedCells, []string{"Sheet1!A1"}) || tracking.RebuildRequired {
+		t.Errorf("Tracking() = %+v, want Sheet1!A1 changed without rebuild", tracking)
+	}
+}
+
+func TestRefreshSkipsUnchangedContent(t *testing.T) {
+	wb := newTestWorkbook(t)
+	checksum := wb.save(map[string]interface{}{"A1": "Actif"})
+	w, events := newTestWatcher(t, wb.path)
+
+	tests := []struct {
+		name   string
+		change func()
+	}{
+		{"untouched file", func() {}},
+		// A new modification time alone makes the watcher read the file,
+		// but the checksum shows nothing to apply
+		{"touched file", wb.touch},
+		{"same values saved again", func() { wb.save(map[string]interface{}{"A1": "Actif"}) }},
+	}
+
+	for _, tt := range tests {
+		tt.change()
+		if err := w.Refresh(wb.path); err != nil {
+			t.Errorf("%s: Refresh() = %v", tt.name, err)
+		}
+		if len(*events) != 0 {
+			t.Errorf("%s: got %d events, want none", tt.name, len(*events))
+		}
+		if got, _ := w.Checksum(wb.path); got != checksum {
+			t.Errorf("%s: Checksum() = %s, want %s", tt.name, got, checksum)
+		}
+	}
+}
+
+func TestPollCoalescesSaves(t *testing.T) {
+	wb := newTestWorkbook(t)
+	oldChecksum := wb.save(map[string]interface{}{"A1": 1})
+	w, events := newTestWatcher(t, wb.path)
+
+	// Saves between two polls are seen as one change to the last version
+	wb.save(map[string]interface{}{"A1": 2})
+	wb.save(map[string]interface{}{"A1": 3})
+	lastChecksum := wb.save(map[string]interface{}{"A1": 4})
+	w.Poll()
+
+	if len(*events) != 1 {
+		t.Fatalf("got %d events, want 1", len(*events))
+	}
+	event := (*events)[0]
+	if event.OldChecksum != oldChecksum || event.NewChecksum != lastChecksum {
+		t.Errorf("event checksums = %s -> %s, want %s -> %s", event.OldChecksum, event.NewChecksum, oldChecksum, lastChecksum)
+	}
+	if len(event.Deltas) != 1 || event.Deltas[0].OldValue != "1" || event.Deltas[0].NewValue != "4" {
+		t.Errorf("event deltas = %+v, want A1 from 1 to 4", event.Deltas)
+	}
+
+	w.Poll()
+	if len(*events) != 1 {
+		t.Errorf("got %d events after a second poll, want 1", len(*events))
+	}
+}
+
+func TestRunPollsUntilCancelled(t *testing.T) {
+	wb := newTestWorkbook(t)
+	wb.save(map[string]interface{}{"A1": "Actif"})
+	w := NewWatcher(diff.NewStore(4))
+	if _, err := w.Register(wb.path); err != nil {
+		t.Fatal(err)
+	}
+	changes := make(chan Event, 1)
+	w.OnChange(func(e Event) { changes <- e })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		w.Run(ctx, 10*time.Millisecond)
+		close(done)
+	}()
+
+	newChecksum := wb.save(map[string]interface{}{"A1": "Passif"})
+	select {
+	case event := <-changes:
+		if event.NewChecksum != newChecksum {
+			t.Errorf("event checksum = %s, want %s", event.NewChecksum, newChecksum)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no change event")
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return after cancel")
+	}
+}
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name string
+		// base is the checksum the server edited from; empty for the
+		// registered one
+		base       string
+		wantDeltas int
+	}{
+		// The given delta is applied as is, without reading the diff
+		{"index at the base", "", 0},
+		// An unrelated change came first: the file is diffed instead
+		{"index behind the base", "stale", 1},
+	}
+
+	for _, tt := range tests {
+		wb := newTestWorkbook(t)
+		oldChecksum := wb.save(map[string]interface{}{"A1": "Actif"})
+		w, events := newTestWatcher(t, wb.path)
+		newChecksum := wb.save(map[string]interface{}{"A1": "Passif"})
+
+		base := tt.base
+		if base == "" {
+			base = oldChecksum
+		}
+		if err := w.Apply(wb.path, base, newChecksum, nil); err != nil {
+			t.Errorf("%s: Apply() = %v", tt.name, err)
+			continue
+		}
+		if len(*events) != 1 || len((*events)[0].Deltas) != tt.wantDeltas {
+			t.Errorf("%s: events = %+v, want one with %d deltas", tt.name, *events, tt.wantDeltas)
+		}
+		if got, _ := w.Checksum(wb.path); got != newChecksum {
+			t.Errorf("%s: Checksum() = %s, want %s", tt.name, got, newChecksum)
+		}
+	}
+}
+
+func TestUnregister(t *testing.T) {
+	wb := newTestWorkbook(t)
+	oldChecksum := wb.save(map[string]interface{}{"A1": "Actif"})
+	w, events := newTestWatcher(t, wb.path)
+
+	w.Unregister(wb.path)
+	newChecksum := wb.save(map[string]interface{}{"A1": "Passif"})
+
+	if _, ok := w.Index(wb.path); ok {
+		t.Error("Index() found an unregistered workbook")
+	}
+	if paths := w.Paths(); len(paths) != 0 {
+		t.Errorf("Paths() = %v, want none", paths)
+	}
+	if err := w.Refresh(wb.path); err == nil {
+		t.Error("Refresh() of an unregistered workbook succeeded")
+	}
+	w.Poll()
+	if err := w.Apply(wb.path, oldChecksum, newChecksum, nil); err != nil {
+		t.Errorf("Apply() = %v, want unwatched paths ignored", err)
+	}
+	if len(*events) != 0 {
+		t.Errorf("got %d events, want none", len(*events))
+	}
+
+	// Registering again indexes the current version
+	if _, err := w.Register(wb.path); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := w.Checksum(wb.path); got != newChecksum {
+		t.Errorf("Checksum() = %s, want %s", got, newChecksum)
+	}
+}
+
+func TestCoalesce(t *testing.T) {
+	updates := func(sheet string, n int) []models.Delta {
+		deltas := make([]models.Delta, n)
+		for i := range deltas {
+			deltas[i] = models.Delta{Type: models.CellUpdate, SheetID: sheet}
+		}
+		return deltas
+	}
+
+	tests := []struct {
+		name    string
+		changes []models.Delta
+		want    []models.Delta
+	}{
+		{
+			name:    "few updates kept",
+			changes: updates("Bilan", 2),
+			want:    updates("Bilan", 2),
+		},
+		{
+			name:    "heavy sheet bulked",
+			changes: append(updates("Bilan", bulkThreshold+1), updates("Actif", 1)...),
+			want: append([]models.Delta{
+				{Type: models.BulkChange, SheetID: "Bilan", AffectedCells: bulkThreshold + 1},
+			}, updates("Actif", 1)...),
+		},
+		{
+			name: "shifted rows bulk the sheet",
+			changes: append(updates("Bilan", 1),
+				models.Delta{Type: models.RowInsert, SheetID: "Bilan"},
+				models.Delta{Type: models.SheetAdd, SheetID: "Notes"}),
+			want: []models.Delta{
+				{Type: models.BulkChange, SheetID: "Bilan", AffectedCells: 1},
+				{Type: models.SheetAdd, SheetID: "Notes"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		if got := coalesce(tt.changes); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: coalesce() = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
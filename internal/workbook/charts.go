@@ -0,0 +1,167 @@
+package workbook
+
+import (
+	"bytes"
+	"encoding/xml"
+	"path"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+
+	"mcp-xlsm-server/internal/models"
+)
+
+const drawingRel = "/relationships/drawing"
+
+// Drawing anchor holding a chart frame; absolute anchors have no cell
+type rawAnchor struct {
+	From *struct {
+		Col int `xml:"col"`
+		Row int `xml:"row"`
+	} `xml:"from"`
+	Frame struct {
+		Props struct {
+			Name string `xml:"name,attr"`
+		} `xml:"nvGraphicFramePr>cNvPr"`
+		Chart struct {
+			ID string `xml:"id,attr"`
+		} `xml:"graphic>graphicData>chart"`
+	} `xml:"graphicFrame"`
+}
+
+type rawChartRef struct {
+	Num   string `xml:"numRef>f"`
+	Str   string `xml:"strRef>f"`
+	Multi string `xml:"multiLvlStrRef>f"`
+}
+
+func (r rawChartRef) value() string {
+	for _, ref := range []string{r.Num, r.Str, r.Multi} {
+		if ref != "" {
+			return ref
+		}
+	}
+	return ""
+}
+
+type rawSeries struct {
+	Tx struct {
+		Ref    string `xml:"strRef>f"`
+		Cached string `xml:"strRef>strCache>pt>v"`
+		V      string `xml:"v"`
+	} `xml:"tx"`
+	Cat  rawChartRef `xml:"cat"`
+	Val  rawChartRef `xml:"val"`
+	XVal rawChartRef `xml:"xVal"`
+	YVal rawChartRef `xml:"yVal"`
+}
+
+type rawTitle struct {
+	Ref  string   `xml:"tx>strRef>f"`
+	Runs []string `xml:"tx>rich>p>r>t"`
+}
+
+// Charts lists the charts drawn on a worksheet or chartsheet, in drawing
+// order, with the ranges their series read.
+func Charts(file *excelize.File, sheet string) []models.ChartInfo {
+	sheetPart := sheetPartPath(file, sheet)
+	if sheetPart == "" {
+		return nil
+	}
+
+	var charts []models.ChartInfo
+	drawings := relationshipsOfType(partBytes(file, relsPath(sheetPart)), path.Dir(sheetPart), drawingRel)
+	for _, drawing := range drawings {
+		targets := relationshipTargets(partBytes(file, relsPath(drawing)), path.Dir(drawing))
+		decoder := xml.NewDecoder(bytes.NewReader(partBytes(file, drawing)))
+		for {
+			token, err := decoder.Token()
+			if err != nil {
+				break
+			}
+			start, ok := token.(xml.StartElement)
+			if !ok || !strings.HasSuffix(start.Name.Local, "Anchor") {
+				continue
+			}
+			var anchor rawAnchor
+			if err := decoder.DecodeElement(&anchor, &start); err != nil {
+				break
+			}
+			chartPart := targets[anchor.Frame.Chart.ID]
+			if anchor.Frame.Chart.ID == "" || chartPart == "" {
+				continue
+			}
+
+			chart := readChart(partBytes(file, chartPart))
+			chart.Name = anchor.Frame.Props.Name
+			if anchor.From != nil {
+				chart.Anchor, _ = excelize.CoordinatesToCellName(anchor.From.Col+1, anchor.From.Row+1)
+			}
+			charts = append(charts, chart)
+		}
+	}
+	return charts
+}
+
+// readChart reads the plot types, title and series of a chart part.
+func readChart(data []byte) models.ChartInfo {
+	chart := models.ChartInfo{Series: []models.ChartSeries{}}
+	var types []string
+	inPlotArea := false
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			break
+		}
+		switch t := token.(type) {
+		case xml.EndElement:
+			if t.Name.Local == "plotArea" {
+				inPlotArea = false
+			}
+		case xml.StartElement:
+			local := t.Name.Local
+			switch {
+			case local == "plotArea":
+				inPlotArea = true
+			case local == "title" && !inPlotArea:
+				// Axis titles are inside the plot area
+				var title rawTitle
+				if err := decoder.DecodeElement(&title, &t); err == nil {
+					chart.Title = strings.Join(title.Runs, "")
+					if chart.Title == "" {
+						chart.Title = title.Ref
+					}
+				}
+			case inPlotArea && strings.HasSuffix(local, "Chart"):
+				types = append(types, strings.TrimSuffix(local, "Chart"))
+			case local == "barDir" && len(types) > 0 && attr(t, "val") == "col":
+				// Vertical bars are what Excel calls a column chart
+				types[len(types)-1] = strings.Replace(types[len(types)-1], "bar", "column", 1)
+			case local == "ser":
+				var raw rawSeries
+				if err := decoder.DecodeElement(&raw, &t); err != nil {
+					continue
+				}
+				series := models.ChartSeries{
+					Name:       raw.Tx.V,
+					NameRef:    raw.Tx.Ref,
+					Categories: raw.Cat.value(),
+					Values:     raw.Val.value(),
+				}
+				if series.Name == "" {
+					series.Name = raw.Tx.Cached
+				}
+				if series.Categories == "" {
+					series.Categories = raw.XVal.value()
+				}
+				if series.Values == "" {
+					series.Values = raw.YVal.value()
+				}
+				chart.Series = append(chart.Series, series)
+			}
+		}
+	}
+	chart.Type = strings.Join(types, "+")
+	return chart
+}
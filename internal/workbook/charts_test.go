@@ -0,0 +1,84 @@
+package workbook
+
+import (
+	"reflect"
+	"testing"
+
+	"mcp-xlsm-server/internal/models"
+)
+
+const (
+	drawingNS = "http://schemas.openxmlformats.org/drawingml/2006/spreadsheetDrawing"
+	dmlNS     = "http://schemas.openxmlformats.org/drawingml/2006/main"
+	chartNS   = "http://schemas.openxmlformats.org/drawingml/2006/chart"
+)
+
+func TestCharts(t *testing.T) {
+	frame := func(name, id string) string {
+		return `<xdr:graphicFrame macro=""><xdr:nvGraphicFramePr><xdr:cNvPr id="2" name="` + name + `"/><xdr:cNvGraphicFramePr/></xdr:nvGraphicFramePr>` +
+			`<a:graphic><a:graphicData uri="` + chartNS + `"><c:chart r:id="` + id + `"/></a:graphicData></a:graphic></xdr:graphicFrame>`
+	}
+	file := fixture{
+		sheets: []fixtureSheet{
+			{name: "Ventes", body: `<sheetData/><drawing r:id="rId1"/>`},
+			{name: "Notes", body: `<sheetData/>`},
+		},
+		parts: map[string]string{
+			"xl/worksheets/_rels/sheet1.xml.rels": `<Relationships xmlns="` + packageNS + `">` +
+				`<Relationship Id="rId1" Type="` + relTypeDir + `drawing" Target="../drawings/drawing1.xml"/></Relationships>`,
+			"xl/drawings/drawing1.xml": `<xdr:wsDr xmlns:xdr="` + drawingNS + `" xmlns:a="` + dmlNS + `" xmlns:c="` + chartNS + `" xmlns:r="` + relNS + `">` +
+				`<xdr:twoCellAnchor><xdr:from><xdr:col>4</xdr:col><xdr:colOff>0</xdr:colOff><xdr:row>1</xdr:row><xdr:rowOff>0</xdr:rowOff></xdr:from>` +
+				`<xdr:to><xdr:col>10</xdr:col><xdr:colOff>0</xdr:colOff><xdr:row>15</xdr:row><xdr:rowOff>0</xdr:rowOff></xdr:to>` +
+				frame("Graphique 1", "rId1") + `<xdr:clientData/></xdr:twoCellAnchor>` +
+				// A picture is not a chart
+				`<xdr:oneCellAnchor><xdr:from><xdr:col>0</xdr:col><xdr:colOff>0</xdr:colOff><xdr:row>20</xdr:row><xdr:rowOff>0</xdr:rowOff></xdr:from>` +
+				`<xdr:ext cx="100" cy="100"/><xdr:pic><xdr:nvPicPr><xdr:cNvPr id="3" name="Logo"/><xdr:cNvPicPr/></xdr:nvPicPr></xdr:pic><xdr:clientData/></xdr:oneCellAnchor>` +
+				`<xdr:absoluteAnchor><xdr:pos x="0" y="0"/><xdr:ext cx="100" cy="100"/>` + frame("Graphique 2", "rId2") + `<xdr:clientData/></xdr:absoluteAnchor>` +
+				`</xdr:wsDr>`,
+			"xl/drawings/_rels/drawing1.xml.rels": `<Relationships xmlns="` + packageNS + `">` +
+				`<Relationship Id="rId1" Type="` + relTypeDir + `chart" Target="../charts/chart1.xml"/>` +
+				`<Relationship Id="rId2" Type="` + relTypeDir + `chart" Target="../charts/chart2.xml"/></Relationships>`,
+			"xl/charts/chart1.xml": `<c:chartSpace xmlns:c="` + chartNS + `" xmlns:a="` + dmlNS + `"><c:chart>` +
+				`<c:title><c:tx><c:rich><a:p><a:r><a:t>Ventes </a:t></a:r><a:r><a:t>2025</a:t></a:r></a:p></c:rich></c:tx></c:title>` +
+				`<c:plotArea><c:barChart><c:barDir val="col"/><c:grouping val="clustered"/>` +
+				`<c:ser><c:idx val="0"/><c:tx><c:strRef><c:f>Ventes!$B$1</c:f><c:strCache><c:ptCount val="1"/><c:pt idx="0"><c:v>CA</c:v></c:pt></c:strCache></c:strRef></c:tx>` +
+				`<c:cat><c:strRef><c:f>Ventes!$A$2:$A$13</c:f></c:strRef></c:cat><c:val><c:numRef><c:f>Ventes!$B$2:$B$13</c:f></c:numRef></c:val></c:ser>` +
+				`</c:barChart><c:lineChart><c:grouping val="standard"/>` +
+				`<c:ser><c:idx val="1"/><c:tx><c:v>Objectif</c:v></c:tx><c:val><c:numRef><c:f>Ventes!$C$2:$C$13</c:f></c:numRef></c:val></c:ser>` +
+				`</c:lineChart><c:valAx><c:title><c:tx><c:rich><a:p><a:r><a:t>Montant</a:t></a:r></a:p></c:rich></c:tx></c:title></c:valAx></c:plotArea>` +
+				`</c:chart></c:chartSpace>`,
+			"xl/charts/chart2.xml": `<c:chartSpace xmlns:c="` + chartNS + `"><c:chart>` +
+				`<c:title><c:tx><c:strRef><c:f>Ventes!$D$1</c:f></c:strRef></c:tx></c:title>` +
+				`<c:plotArea><c:scatterChart><c:ser><c:idx val="0"/>` +
+				`<c:xVal><c:numRef><c:f>Ventes!$A$2:$A$13</c:f></c:numRef></c:xVal><c:yVal><c:numRef><c:f>Ventes!$D$2:$D$13</c:f></c:numRef></c:yVal>` +
+				`</c:ser></c:scatterChart></c:plotArea></c:chart></c:chartSpace>`,
+		},
+	}.open(t)
+
+	want := []models.ChartInfo{
+		{
+			Name:   "Graphique 1",
+			Type:   "column+line",
+			Title:  "Ventes 2025",
+			Anchor: "E2",
+			Series: []models.ChartSeries{
+				{Name: "CA", NameRef: "Ventes!$B$1", Categories: "Ventes!$A$2:$A$13", Values: "Ventes!$B$2:$B$13"},
+				{Name: "Objectif", Values: "Ventes!$C$2:$C$13"},
+			},
+		},
+		{
+			Name:  "Graphique 2",
+			Type:  "scatter",
+			Title: "Ventes!$D$1",
+			Series: []models.ChartSeries{
+				{Categories: "Ventes!$A$2:$A$13", Values: "Ventes!$D$2:$D$13"},
+			},
+		},
+	}
+	if got := Charts(file, "Ventes"); !reflect.DeepEqual(got, want) {
+		t.Errorf("Charts(Ventes) = %+v, want %+v", got, want)
+	}
+	if got := Charts(file, "Notes"); got != nil {
+		t.Errorf("Charts(Notes) = %+v, want none", got)
+	}
+}
@@ -0,0 +1,198 @@
+package workbook
+
+import (
+	"bytes"
+	"encoding/xml"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+
+	"mcp-xlsm-server/internal/models"
+)
+
+const (
+	// Legacy comment, shown as a yellow note
+	CommentNote = "note"
+	// Threaded comment with replies, Excel 365 and later
+	CommentThreaded = "threaded"
+)
+
+// Relationship types ending the Type URI of threaded comment parts
+const (
+	threadedCommentRel = "/relationships/threadedComment"
+	personRel          = "/relationships/person"
+)
+
+// Comments reads the notes and threaded comments of a sheet, in row then
+// column order. Excel keeps a placeholder note under every threaded
+// comment for older versions; the threaded comment replaces it.
+func Comments(file *excelize.File, sheet string) ([]models.CellComment, error) {
+	notes, err := file.GetComments(sheet)
+	if err != nil {
+		return nil, err
+	}
+
+	threaded := threadedComments(file, sheet)
+	comments := make([]models.CellComment, 0, len(notes)+len(threaded))
+	covered := make(map[string]bool, len(threaded))
+	for _, comment := range threaded {
+		comment.Sheet = sheet
+		comments = append(comments, comment)
+		covered[comment.Cell] = true
+	}
+	for _, note := range notes {
+		if covered[note.Cell] {
+			continue
+		}
+		comments = append(comments, models.CellComment{
+			Sheet:  sheet,
+			Cell:   note.Cell,
+			Kind:   CommentNote,
+			Author: note.Author,
+			Text:   noteText(note),
+		})
+	}
+
+	sort.SliceStable(comments, func(i, j int) bool {
+		ci, ri, _ := excelize.CellNameToCoordinates(comments[i].Cell)
+		cj, rj, _ := excelize.CellNameToCoordinates(comments[j].Cell)
+		if ri != rj {
+			return ri < rj
+		}
+		return ci < cj
+	})
+	return comments, nil
+}
+
+// noteText joins the runs of a note and drops the "Author:" line Excel
+// starts notes with.
+func noteText(note excelize.Comment) string {
+	var text strings.Builder
+	text.WriteString(note.Text)
+	for _, run := range note.Paragraph {
+		text.WriteString(run.Text)
+	}
+	body := text.String()
+	if note.Author != "" {
+		if rest, ok := strings.CutPrefix(body, note.Author+":"); ok {
+			body = rest
+		}
+	}
+	return strings.TrimSpace(body)
+}
+
+// threadedComments reads the threaded comments part of a sheet, if any,
+// with replies attached to the comment they answer.
+func threadedComments(file *excelize.File, sheet string) []models.CellComment {
+	sheetPart := sheetPartPath(file, sheet)
+	if sheetPart == "" {
+		return nil
+	}
+	parts := relationshipsOfType(partBytes(file, relsPath(sheetPart)), path.Dir(sheetPart), threadedCommentRel)
+	if len(parts) == 0 {
+		return nil
+	}
+
+	people := persons(file)
+	var comments []models.CellComment
+	index := make(map[string]int)
+	for _, part := range parts {
+		decoder := xml.NewDecoder(bytes.NewReader(partBytes(file, part)))
+		for {
+			token, err := decoder.Token()
+			if err != nil {
+				break
+			}
+			start, ok := token.(xml.StartElement)
+			if !ok || start.Name.Local != "threadedComment" {
+				continue
+			}
+			var entry struct {
+				Text string `xml:"text"`
+			}
+			if err := decoder.DecodeElement(&entry, &start); err != nil {
+				break
+			}
+
+			author := people[attr(start, "personId")]
+			if parent, ok := index[attr(start, "parentId")]; ok {
+				comments[parent].Replies = append(comments[parent].Replies, models.CommentReply{
+					Author: author,
+					Text:   strings.TrimSpace(entry.Text),
+					Date:   attr(start, "dT"),
+				})
+				continue
+			}
+			index[attr(start, "id")] = len(comments)
+			comments = append(comments, models.CellComment{
+				Cell:     attr(start, "ref"),
+				Kind:     CommentThreaded,
+				Author:   author,
+				Text:     strings.TrimSpace(entry.Text),
+				Date:     attr(start, "dT"),
+				Resolved: xmlBool(attr(start, "done"), false),
+			})
+		}
+	}
+	return comments
+}
+
+// persons maps the person ids of threaded comments to display names.
+func persons(file *excelize.File) map[string]string {
+	people := make(map[string]string)
+	for _, part := range relationshipsOfType(partBytes(file, "xl/_rels/workbook.xml.rels"), "xl", personRel) {
+		decoder := xml.NewDecoder(bytes.NewReader(partBytes(file, part)))
+		for {
+			token, err := decoder.Token()
+			if err != nil {
+				break
+			}
+			if start, ok := token.(xml.StartElement); ok && start.Name.Local == "person" {
+				people[attr(start, "id")] = attr(start, "displayName")
+			}
+		}
+	}
+	return people
+}
+
+// sheetPartPath is the package part holding a sheet, e.g.
+// xl/worksheets/sheet2.xml.
+func sheetPartPath(file *excelize.File, sheet string) string {
+	file.GetSheetList()
+	if file.WorkBook == nil {
+		return ""
+	}
+	targets := relationshipTargets(partBytes(file, "xl/_rels/workbook.xml.rels"), "xl")
+	for _, entry := range file.WorkBook.Sheets.Sheet {
+		if entry.Name == sheet {
+			return targets[entry.ID]
+		}
+	}
+	return ""
+}
+
+// relationshipsOfType lists the internal parts a relationships part
+// points to with a Type ending in typeSuffix.
+func relationshipsOfType(data []byte, dir, typeSuffix string) []string {
+	var parts []string
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return parts
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != "Relationship" || !strings.HasSuffix(attr(start, "Type"), typeSuffix) {
+			continue
+		}
+		target := attr(start, "Target")
+		if strings.HasPrefix(target, "/") {
+			target = strings.TrimPrefix(target, "/")
+		} else {
+			target = path.Join(dir, target)
+		}
+		parts = append(parts, path.Clean(target))
+	}
+}
@@ -0,0 +1,63 @@
+package workbook
+
+import (
+	"reflect"
+	"testing"
+
+	"mcp-xlsm-server/internal/models"
+)
+
+func TestComments(t *testing.T) {
+	file := fixture{
+		workbookRels: `<Relationship Id="rId90" Type="http://schemas.microsoft.com/office/2017/10/relationships/person" Target="persons/person.xml"/>`,
+		sheets: []fixtureSheet{{name: "Bilan", body: `<sheetData>` +
+			`<row r="1"><c r="A1"><v>1</v></c><c r="C1"><v>3</v></c></row>` +
+			`<row r="2"><c r="B2"><v>5</v></c></row>` +
+			`</sheetData>`}},
+		parts: map[string]string{
+			"xl/worksheets/_rels/sheet1.xml.rels": `<Relationships xmlns="` + packageNS + `">` +
+				`<Relationship Id="rId1" Type="` + relTypeDir + `comments" Target="../comments1.xml"/>` +
+				`<Relationship Id="rId2" Type="http://schemas.microsoft.com/office/2017/10/relationships/threadedComment" Target="../threadedComments/threadedComment1.xml"/>` +
+				`</Relationships>`,
+			// B2 is the placeholder Excel writes under a threaded comment
+			"xl/comments1.xml": `<comments xmlns="` + mainNS + `"><authors><author>Marie Curie</author><author>tc={6A0D1B3E-0001}</author></authors><commentList>` +
+				`<comment ref="C1" authorId="0"><text><t>Arrondi</t></text></comment>` +
+				`<comment ref="A1" authorId="0"><text><r><t>Marie Curie:</t></r><r><t xml:space="preserve">` + "\n" + `Vérifier le total</t></r></text></comment>` +
+				`<comment ref="B2" authorId="1"><text><t>[Threaded comment] Source ?</t></text></comment>` +
+				`</commentList></comments>`,
+			"xl/threadedComments/threadedComment1.xml": `<ThreadedComments xmlns="http://schemas.microsoft.com/office/spreadsheetml/2018/threadedcomments">` +
+				`<threadedComment ref="B2" dT="2025-03-01T09:30:00.00" personId="{P1}" id="{T1}" done="1"><text>Source ?</text></threadedComment>` +
+				`<threadedComment ref="B2" dT="2025-03-02T14:00:00.00" personId="{P2}" id="{T2}" parentId="{T1}"><text> Balance de mars </text></threadedComment>` +
+				`</ThreadedComments>`,
+			"xl/persons/person.xml": `<personList xmlns="http://schemas.microsoft.com/office/spreadsheetml/2018/threadedcomments">` +
+				`<person displayName="Jean Dupont" id="{P1}" userId="jean" providerId="None"/>` +
+				`<person displayName="Awa Diallo" id="{P2}" userId="awa" providerId="None"/>` +
+				`</personList>`,
+		},
+		contentTypes: `<Override PartName="/xl/comments1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.comments+xml"/>`,
+	}.open(t)
+
+	comments, err := Comments(file, "Bilan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []models.CellComment{
+		{Sheet: "Bilan", Cell: "A1", Kind: CommentNote, Author: "Marie Curie", Text: "Vérifier le total"},
+		{Sheet: "Bilan", Cell: "C1", Kind: CommentNote, Author: "Marie Curie", Text: "Arrondi"},
+		{
+			Sheet:    "Bilan",
+			Cell:     "B2",
+			Kind:     CommentThreaded,
+			Author:   "Jean Dupont",
+			Text:     "Source ?",
+			Date:     "2025-03-01T09:30:00.00",
+			Resolved: true,
+			Replies: []models.CommentReply{
+				{Author: "Awa Diallo", Text: "Balance de mars", Date: "2025-03-02T14:00:00.00"},
+			},
+		},
+	}
+	if !reflect.DeepEqual(comments, want) {
+		t.Errorf("Comments() = %+v, want %+v", comments, want)
+	}
+}
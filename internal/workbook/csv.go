@@ -0,0 +1,189 @@
+package workbook
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/xuri/excelize/v2"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+
+	"mcp-xlsm-server/internal/analytics"
+)
+
+// Bytes read to sniff the encoding and the delimiter
+const sniffSize = 64 * 1024
+
+// Delimiters tried when sniffing, in order of preference on a tie
+var candidateDelimiters = []rune{',', ';', '\t', '|'}
+
+// openCSV reads delimited text into a one-sheet workbook named after the
+// file. The encoding (UTF-8, UTF-16 with a byte order mark, or Windows-1252
+// otherwise) and the delimiter are sniffed from the start of the file.
+func openCSV(path string) (*excelize.File, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	buffered := bufio.NewReaderSize(f, sniffSize)
+	sample, err := buffered.Peek(sniffSize)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return nil, err
+	}
+
+	text := decodeText(buffered, sample)
+	decodedSample, _ := io.ReadAll(decodeText(bytes.NewReader(sample), sample))
+
+	delimiter := '\t'
+	if strings.ToLower(filepath.Ext(path)) != ".tsv" {
+		delimiter = sniffDelimiter(string(decodedSample))
+	}
+
+	name := sheetName(strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)))
+	file, err := newWorkbook(name)
+	if err != nil {
+		return nil, err
+	}
+	writer, err := newSheetWriter(file, name)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	reader := csv.NewReader(text)
+	reader.Comma = delimiter
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	reader.ReuseRecord = true
+
+	for row := 1; ; row++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+
+		values := make([]interface{}, len(record))
+		for i, field := range record {
+			values[i] = csvValue(field)
+		}
+		if err := writer.writeRow(row, values); err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+
+	if err := writer.flush(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return file, nil
+}
+
+// decodeText wraps r, whose content starts with sample, in a decoder to
+// UTF-8 and drops any byte order mark.
+func decodeText(r io.Reader, sample []byte) io.Reader {
+	switch {
+	case bytes.HasPrefix(sample, []byte{0xef, 0xbb, 0xbf}):
+		return transform.NewReader(r, unicode.UTF8BOM.NewDecoder())
+	case bytes.HasPrefix(sample, []byte{0xff, 0xfe}), bytes.HasPrefix(sample, []byte{0xfe, 0xff}):
+		return transform.NewReader(r, unicode.UTF16(unicode.LittleEndian, unicode.ExpectBOM).NewDecoder())
+	case validUTF8Prefix(sample):
+		return r
+	}
+	return transform.NewReader(r, charmap.Windows1252.NewDecoder())
+}
+
+// validUTF8Prefix checks sample, allowing for a character cut at the end.
+func validUTF8Prefix(sample []byte) bool {
+	for i := 0; i < utf8.UTFMax && len(sample) > 0; i++ {
+		if utf8.Valid(sample) {
+			return true
+		}
+		sample = sample[:len(sample)-1]
+	}
+	return utf8.Valid(sample)
+}
+
+// sniffDelimiter picks the candidate found the same number of times, and
+// most often, on each of the first lines. Quoted text is ignored.
+func sniffDelimiter(sample string) rune {
+	lines := strings.Split(strings.ReplaceAll(sample, "\r\n", "\n"), "\n")
+	if len(lines) > 1 {
+		// The last line may be cut short
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) > 20 {
+		lines = lines[:20]
+	}
+
+	best, bestScore := ',', 0
+	for _, delimiter := range candidateDelimiters {
+		counts := make([]int, 0, len(lines))
+		for _, line := range lines {
+			if strings.TrimSpace(line) != "" {
+				counts = append(counts, countUnquoted(line, delimiter))
+			}
+		}
+		if len(counts) == 0 || counts[0] == 0 {
+			continue
+		}
+
+		consistent := true
+		for _, count := range counts[1:] {
+			if count != counts[0] {
+				consistent = false
+				break
+			}
+		}
+		score := counts[0]
+		if consistent {
+			score += 1000
+		}
+		if score > bestScore {
+			best, bestScore = delimiter, score
+		}
+	}
+	return best
+}
+
+func countUnquoted(line string, delimiter rune) int {
+	count, quoted := 0, false
+	for _, r := range line {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case r == delimiter && !quoted:
+			count++
+		}
+	}
+	return count
+}
+
+// csvValue reads a field as a number when it is one, with either decimal
+// separator. Codes with a leading zero or too many digits stay text.
+func csvValue(field string) interface{} {
+	text := strings.TrimSpace(field)
+	if text == "" {
+		return nil
+	}
+	if analytics.IsCode(text) {
+		return field
+	}
+	if num, ok := analytics.ParseNumber(text); ok {
+		return num
+	}
+	return field
+}
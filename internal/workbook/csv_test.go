@@ -0,0 +1,128 @@
+package workbook
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+	"golang.org/x/text/encoding/unicode"
+)
+
+func TestSniffDelimiter(t *testing.T) {
+	tests := []struct {
+		name   string
+		sample string
+		want   rune
+	}{
+		{"comma", "a,b,c\n1,2,3\n", ','},
+		{"semicolon with decimal commas", "Compte;Montant\n411;12,50\n512;3,00\n", ';'},
+		{"tab", "a\tb\n1\t2\n", '\t'},
+		{"pipe", "a|b|c\n1|2|3\n", '|'},
+		{"quoted delimiters ignored", "\"a;b\",c\n\"1;2\",3\n", ','},
+		{"consistent beats frequent", "a;b,c,d\n1;2\n", ';'},
+		{"last line cut short", "a;b;c\n1;2;3\n4;5", ';'},
+		{"no delimiter", "seule\ncolonne\n", ','},
+	}
+
+	for _, tt := range tests {
+		if got := sniffDelimiter(tt.sample); got != tt.want {
+			t.Errorf("%s: sniffDelimiter() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCSVValue(t *testing.T) {
+	tests := []struct {
+		field string
+		want  interface{}
+	}{
+		{"", nil},
+		{"  ", nil},
+		{"12.5", 12.5},
+		{"12,5", 12.5},
+		{"-3", -3.0},
+		{"007", "007"},
+		{"0", 0.0},
+		{"0.5", 0.5},
+		{"Frais", "Frais"},
+	}
+
+	for _, tt := range tests {
+		if got := csvValue(tt.field); got != tt.want {
+			t.Errorf("csvValue(%q) = %#v, want %#v", tt.field, got, tt.want)
+		}
+	}
+}
+
+func TestOpenCSV(t *testing.T) {
+	utf16, err := unicode.UTF16(unicode.LittleEndian, unicode.UseBOM).NewEncoder().String("Nom,Prix\nCafé,2.5\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		content string
+		sheet   string
+		want    [][]string
+	}{
+		{"ventes.csv", "Rayon;Montant\nFrais;12,5\nEpicerie;007\n", "ventes", [][]string{{"Rayon", "Montant"}, {"Frais", "12.5"}, {"Epicerie", "007"}}},
+		{"bom.csv", "\xef\xbb\xbfNom,Prix\nCafé,2.5\n", "bom", [][]string{{"Nom", "Prix"}, {"Café", "2.5"}}},
+		{"utf16.csv", utf16, "utf16", [][]string{{"Nom", "Prix"}, {"Café", "2.5"}}},
+		{"ansi.csv", "Nom,Prix\nCaf\xe9,2.5\n", "ansi", [][]string{{"Nom", "Prix"}, {"Café", "2.5"}}},
+		{"export.tsv", "a;b\tc\n1;2\t3\n", "export", [][]string{{"a;b", "c"}, {"1;2", "3"}}},
+		{"ragged.txt", "a,b,c\n1\n\"x, y\",\"dit \"\"oui\"\"\"\n", "ragged", [][]string{{"a", "b", "c"}, {"1"}, {"x, y", `dit "oui"`}}},
+		{"[bad]name.csv", "a\n", "_bad_name", [][]string{{"a"}}},
+	}
+
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), tt.name)
+		if err := os.WriteFile(path, []byte(tt.content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		file, err := Open(path)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if sheets := file.GetSheetList(); !reflect.DeepEqual(sheets, []string{tt.sheet}) {
+			t.Errorf("%s: sheets = %v, want [%s]", tt.name, sheets, tt.sheet)
+		}
+		rows, err := file.GetRows(tt.sheet, excelize.Options{RawCellValue: true})
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		} else if !reflect.DeepEqual(rows, tt.want) {
+			t.Errorf("%s: rows = %q, want %q", tt.name, rows, tt.want)
+		}
+		file.Close()
+	}
+}
+
+func TestOpenCSVTypes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ventes.csv")
+	if err := os.WriteFile(path, []byte("Rayon;Montant\nFrais;12,5\nEpicerie;007\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	file, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	// Numbers are written without a type attribute
+	tests := []struct {
+		cell string
+		want excelize.CellType
+	}{
+		{"A2", excelize.CellTypeInlineString},
+		{"B2", excelize.CellTypeUnset},
+		{"B3", excelize.CellTypeInlineString},
+	}
+	for _, tt := range tests {
+		if got, err := file.GetCellType("ventes", tt.cell); err != nil || got != tt.want {
+			t.Errorf("%s type = %v, %v; want %v", tt.cell, got, err, tt.want)
+		}
+	}
+}
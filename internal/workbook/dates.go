@@ -0,0 +1,209 @@
+package workbook
+
+import (
+	"encoding/xml"
+	"io"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// DateKind is what a number format shows of a date serial
+type DateKind int
+
+const (
+	NotDate DateKind = iota
+	// A calendar day, such as dd/mm/yyyy
+	DateOnly
+	// A day and a time of day, such as dd/mm/yyyy hh:mm
+	DateTime
+	// A time of day only, such as hh:mm:ss
+	TimeOnly
+)
+
+// DateFormat tells what number format id, or its custom code, shows of a
+// date serial. Elapsed times such as [h]:mm are durations, not dates.
+func DateFormat(id int, code string) DateKind {
+	switch {
+	case id >= 14 && id <= 17:
+		return DateOnly
+	case id == 22:
+		return DateTime
+	case (id >= 18 && id <= 21) || (id >= 45 && id <= 47):
+		return TimeOnly
+	case code == "":
+		return NotDate
+	}
+
+	// Date and time tokens outside quoted text, escapes and [brackets];
+	// only the first section, for positive numbers, is read. A lone m is
+	// a month unless the code also has hours or seconds.
+	var day, month, clock bool
+	quoted, bracket := false, false
+scan:
+	for i := 0; i < len(code); i++ {
+		c := code[i]
+		switch {
+		case c == '"':
+			quoted = !quoted
+		case quoted:
+		case c == '\\' || c == '_' || c == '*':
+			i++
+		case c == '[':
+			bracket = true
+			if end := strings.IndexByte(code[i:], ']'); end > 1 && isElapsed(code[i+1:i+end]) {
+				return NotDate
+			}
+		case c == ']':
+			bracket = false
+		case bracket:
+		case c == ';':
+			break scan
+		case strings.IndexByte("dyDY", c) >= 0:
+			day = true
+		case c == 'm' || c == 'M':
+			month = true
+		case strings.IndexByte("hsHS", c) >= 0:
+			clock = true
+		}
+	}
+
+	switch {
+	case day && clock:
+		return DateTime
+	case day || (month && !clock):
+		return DateOnly
+	case clock:
+		return TimeOnly
+	}
+	return NotDate
+}
+
+// isElapsed reports whether a bracketed token, such as [hh] or [m], is an
+// elapsed time unit rather than a colour or locale.
+func isElapsed(token string) bool {
+	unit := strings.ToLower(token)
+	return strings.Trim(unit, unit[:1]) == "" && strings.IndexByte("hms", unit[0]) >= 0
+}
+
+// CellDates streams the date formats of a sheet's cells in step with the
+// excelize row iterator, so values read raw can be told apart from the
+// dates they show. The sheet part is streamed and only one row is held
+// at a time; Close releases it.
+type CellDates struct {
+	file     *excelize.File
+	part     io.ReadCloser
+	decoder  *xml.Decoder
+	kinds    map[int]DateKind
+	next     *styledRow
+	lastRow  int
+	Date1904 bool
+}
+
+type styledRow struct {
+	R     int `xml:"r,attr"`
+	Cells []struct {
+		R string `xml:"r,attr"`
+		S int    `xml:"s,attr"`
+	} `xml:"c"`
+}
+
+// NewCellDates reads the cell styles of sheet. A sheet whose part cannot
+// be found has no dates.
+func NewCellDates(file *excelize.File, sheet string) *CellDates {
+	cd := &CellDates{file: file, kinds: make(map[int]DateKind)}
+	if props, err := file.GetWorkbookProps(); err == nil && props.Date1904 != nil {
+		cd.Date1904 = *props.Date1904
+	}
+	if part := partReader(file, sheetPartPath(file, sheet)); part != nil {
+		cd.part = part
+		cd.decoder = xml.NewDecoder(part)
+	}
+	return cd
+}
+
+// Close releases the sheet part
+func (cd *CellDates) Close() error {
+	cd.decoder = nil
+	if cd.part == nil {
+		return nil
+	}
+	err := cd.part.Close()
+	cd.part = nil
+	return err
+}
+
+// Row returns the date kinds of the cells of row, 1-based, by 0-based
+// column; nil when none shows a date. Rows must be asked in order.
+func (cd *CellDates) Row(row int) []DateKind {
+	for cd.decoder != nil && (cd.next == nil || cd.next.R < row) {
+		cd.next = cd.readRow()
+	}
+	if cd.next == nil || cd.next.R != row {
+		return nil
+	}
+
+	var kinds []DateKind
+	col := 0
+	for _, cell := range cd.next.Cells {
+		col++
+		if cell.R != "" {
+			if c, _, err := excelize.CellNameToCoordinates(cell.R); err == nil {
+				col = c
+			}
+		}
+		kind := cd.styleKind(cell.S)
+		if kind == NotDate {
+			continue
+		}
+		for len(kinds) < col {
+			kinds = append(kinds, NotDate)
+		}
+		kinds[col-1] = kind
+	}
+	return kinds
+}
+
+// readRow decodes the next row element, or returns nil at the end
+func (cd *CellDates) readRow() *styledRow {
+	for {
+		token, err := cd.decoder.Token()
+		if err != nil {
+			cd.decoder = nil
+			return nil
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != "row" {
+			continue
+		}
+		var row styledRow
+		if err := cd.decoder.DecodeElement(&row, &start); err != nil {
+			cd.decoder = nil
+			return nil
+		}
+		if row.R == 0 {
+			row.R = cd.lastRow + 1
+		}
+		cd.lastRow = row.R
+		return &row
+	}
+}
+
+func (cd *CellDates) styleKind(style int) DateKind {
+	if style == 0 {
+		return NotDate
+	}
+	if kind, ok := cd.kinds[style]; ok {
+		return kind
+	}
+	kind := NotDate
+	if s, err := cd.file.GetStyle(style); err == nil {
+		code := ""
+		if s.CustomNumFmt != nil {
+			code = *s.CustomNumFmt
+		}
+		kind = DateFormat(s.NumFmt, code)
+	}
+	cd.kinds[style] = kind
+	return kind
+}
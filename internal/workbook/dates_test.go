@@ -0,0 +1,112 @@
+package workbook
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+)
+
+func TestDateFormat(t *testing.T) {
+	tests := []struct {
+		id   int
+		code string
+		want DateKind
+	}{
+		{0, "", NotDate},
+		{2, "", NotDate},
+		{14, "", DateOnly},
+		{17, "", DateOnly},
+		{22, "", DateTime},
+		{20, "", TimeOnly},
+		{46, "", TimeOnly},
+		{164, "dd/mm/yyyy", DateOnly},
+		{164, "mmm-yy", DateOnly},
+		{164, "dd/mm/yyyy hh:mm", DateTime},
+		{164, "hh:mm", TimeOnly},
+		{164, "mm:ss", TimeOnly},
+		{164, "[h]:mm", NotDate},
+		{164, "[mm]:ss", NotDate},
+		{164, "[Magenta]dd/mm/yyyy", DateOnly},
+		{164, "[$-40C]d mmmm yyyy", DateOnly},
+		{164, `#,##0.00 "days"`, NotDate},
+		{164, `0.00\d`, NotDate},
+		{164, "#,##0;[Red]-#,##0", NotDate},
+		{164, "0;dd/mm/yyyy", NotDate},
+		{164, "General", NotDate},
+	}
+
+	for _, tt := range tests {
+		if got := DateFormat(tt.id, tt.code); got != tt.want {
+			t.Errorf("DateFormat(%d, %q) = %v, want %v", tt.id, tt.code, got, tt.want)
+		}
+	}
+}
+
+func TestCellDates(t *testing.T) {
+	f := excelize.NewFile()
+	style := func(numFmt int, custom string) int {
+		s := &excelize.Style{NumFmt: numFmt}
+		if custom != "" {
+			s.CustomNumFmt = &custom
+		}
+		id, err := f.NewStyle(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+	date, stamp, custom, elapsed := style(14, ""), style(22, ""), style(0, "dd/mm/yyyy"), style(0, "[h]:mm")
+
+	f.SetSheetRow("Sheet1", "A1", &[]interface{}{"Jour", "Saisie", "Echeance", "Duree"})
+	f.SetSheetRow("Sheet1", "A2", &[]interface{}{45747, 45747.6, 45747, 1.5})
+	f.SetSheetRow("Sheet1", "B4", &[]interface{}{45748})
+	f.SetCellStyle("Sheet1", "A2", "A2", date)
+	f.SetCellStyle("Sheet1", "B2", "B2", stamp)
+	f.SetCellStyle("Sheet1", "C2", "C2", custom)
+	f.SetCellStyle("Sheet1", "D2", "D2", elapsed)
+	f.SetCellStyle("Sheet1", "C4", "C4", date)
+	path := filepath.Join(t.TempDir(), "dates.xlsx")
+	if err := f.SaveAs(path); err != nil {
+		t.Fatal(err)
+	}
+
+	// Sheets past UnzipXMLSizeLimit stay in the archive and are streamed
+	for _, opts := range []excelize.Options{{}, {UnzipXMLSizeLimit: 1}} {
+		saved, err := excelize.OpenFile(path, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer saved.Close()
+
+		dates := NewCellDates(saved, "Sheet1")
+		tests := []struct {
+			row  int
+			want []DateKind
+		}{
+			{1, nil},
+			{2, []DateKind{DateOnly, DateTime, DateOnly}},
+			{3, nil},
+			{4, []DateKind{NotDate, NotDate, DateOnly}},
+			{5, nil},
+		}
+		for _, tt := range tests {
+			if got := dates.Row(tt.row); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Row(%d) with XML limit %d = %v, want %v", tt.row, opts.UnzipXMLSizeLimit, got, tt.want)
+			}
+		}
+		if err := dates.Close(); err != nil {
+			t.Errorf("Close() = %v", err)
+		}
+	}
+
+	saved, err := excelize.OpenFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer saved.Close()
+	if missing := NewCellDates(saved, "Absente"); missing.Row(1) != nil {
+		t.Error("unknown sheet has dates")
+	}
+}
@@ -0,0 +1,200 @@
+package workbook
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/richardlehane/mscfb"
+	"github.com/xuri/excelize/v2"
+)
+
+// Encryption names the scheme protecting a workbook.
+type Encryption string
+
+const (
+	EncryptionNone Encryption = ""
+	// ECMA-376 encryption wraps the OOXML package in a compound file
+	EncryptionAgile      Encryption = "ooxml-agile"
+	EncryptionStandard   Encryption = "ooxml-standard"
+	EncryptionExtensible Encryption = "ooxml-extensible"
+	// Legacy .xls encryption, declared by the FILEPASS record
+	EncryptionXLSXOR       Encryption = "xls-xor"
+	EncryptionXLSRC4       Encryption = "xls-rc4"
+	EncryptionXLSCryptoAPI Encryption = "xls-rc4-cryptoapi"
+)
+
+// isXLS reports whether the scheme is the legacy .xls one.
+func (e Encryption) isXLS() bool {
+	switch e {
+	case EncryptionXLSXOR, EncryptionXLSRC4, EncryptionXLSCryptoAPI:
+		return true
+	}
+	return false
+}
+
+var (
+	ErrPasswordRequired      = errors.New("password required")
+	ErrWrongPassword         = errors.New("wrong password")
+	ErrUnsupportedEncryption = errors.New("unsupported encryption")
+)
+
+// EncryptedError reports a workbook that could not be decrypted. Err is
+// one of ErrPasswordRequired, ErrWrongPassword or ErrUnsupportedEncryption.
+type EncryptedError struct {
+	Path       string
+	Encryption Encryption
+	Err        error
+}
+
+func (e *EncryptedError) Error() string {
+	msg := fmt.Sprintf("%s is encrypted (%s): %v", filepath.Base(e.Path), e.Encryption, e.Err)
+	switch e.Err {
+	case ErrPasswordRequired:
+		msg += ", pass it with the password parameter or add the file to the passwords file"
+	case ErrUnsupportedEncryption:
+		msg += ", remove the password in Excel or save the file as .xlsx"
+	}
+	return msg
+}
+
+func (e *EncryptedError) Unwrap() error {
+	return e.Err
+}
+
+// Code is a stable identifier for the failure, for clients to branch on.
+func (e *EncryptedError) Code() string {
+	switch e.Err {
+	case ErrPasswordRequired:
+		return "PASSWORD_REQUIRED"
+	case ErrWrongPassword:
+		return "WRONG_PASSWORD"
+	}
+	return "UNSUPPORTED_ENCRYPTION"
+}
+
+// DetectEncryption tells whether path is encrypted and how. Only compound
+// files can be: an encrypted OOXML package, or an .xls with a FILEPASS
+// record.
+func DetectEncryption(path string) (Encryption, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return EncryptionNone, err
+	}
+	defer f.Close()
+
+	header := make([]byte, len(oleMagic))
+	if _, err := io.ReadFull(f, header); err != nil || string(header) != string(oleMagic) {
+		return EncryptionNone, nil
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return EncryptionNone, err
+	}
+
+	doc, err := mscfb.New(f)
+	if err != nil {
+		return EncryptionNone, nil
+	}
+	for entry, err := doc.Next(); err == nil; entry, err = doc.Next() {
+		if len(entry.Path) > 0 {
+			continue
+		}
+		switch entry.Name {
+		case "EncryptionInfo":
+			return encryptionInfoScheme(entry), nil
+		case "Workbook":
+			return filePassScheme(entry), nil
+		}
+	}
+	return EncryptionNone, nil
+}
+
+// encryptionInfoScheme reads the version at the start of the
+// EncryptionInfo stream (MS-OFFCRYPTO 2.3.4).
+func encryptionInfoScheme(r io.Reader) Encryption {
+	version := make([]byte, 4)
+	if _, err := io.ReadFull(r, version); err != nil {
+		return EncryptionExtensible
+	}
+	major, minor := binary.LittleEndian.Uint16(version), binary.LittleEndian.Uint16(version[2:])
+	switch {
+	case major == 4 && minor == 4:
+		return EncryptionAgile
+	case major >= 2 && major <= 4 && minor == 2:
+		return EncryptionStandard
+	}
+	return EncryptionExtensible
+}
+
+// filePassScheme scans the workbook globals for a FILEPASS record, which
+// comes before any sheet is declared.
+func filePassScheme(r io.Reader) Encryption {
+	header := make([]byte, 4)
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			return EncryptionNone
+		}
+		typ := binary.LittleEndian.Uint16(header)
+		data := make([]byte, binary.LittleEndian.Uint16(header[2:]))
+		if _, err := io.ReadFull(r, data); err != nil {
+			return EncryptionNone
+		}
+		switch typ {
+		case biffFilePass:
+			return filePassEncryption(data)
+		case biffBoundSheet, biffSST, biffEOF:
+			return EncryptionNone
+		}
+	}
+}
+
+// filePassEncryption decodes a FILEPASS record (MS-XLS 2.4.117).
+func filePassEncryption(data []byte) Encryption {
+	if len(data) < 2 || binary.LittleEndian.Uint16(data) == 0 {
+		return EncryptionXLSXOR
+	}
+	if len(data) >= 4 && binary.LittleEndian.Uint16(data[2:]) == 1 {
+		return EncryptionXLSRC4
+	}
+	return EncryptionXLSCryptoAPI
+}
+
+// Unlock checks that an encrypted workbook opens with password, or with
+// the one configured for path, to report a missing or wrong password
+// before any reading starts. Unencrypted workbooks are left alone.
+func Unlock(path, password string) error {
+	encryption, err := DetectEncryption(path)
+	if err != nil || encryption == EncryptionNone {
+		return err
+	}
+	file, err := openEncrypted(path, encryption, password)
+	if err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// openEncrypted decrypts an OOXML package with the given password, or the
+// one configured for path. Legacy .xls encryption is detected but not
+// decrypted.
+func openEncrypted(path string, encryption Encryption, password string) (*excelize.File, error) {
+	if encryption != EncryptionAgile && encryption != EncryptionStandard {
+		return nil, &EncryptedError{Path: path, Encryption: encryption, Err: ErrUnsupportedEncryption}
+	}
+
+	if password == "" {
+		password = lookupPassword(path)
+	}
+	if password == "" {
+		return nil, &EncryptedError{Path: path, Encryption: encryption, Err: ErrPasswordRequired}
+	}
+
+	file, err := excelize.OpenFile(path, excelize.Options{Password: password})
+	if err != nil {
+		return nil, &EncryptedError{Path: path, Encryption: encryption, Err: ErrWrongPassword}
+	}
+	return file, nil
+}
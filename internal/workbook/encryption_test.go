@@ -0,0 +1,204 @@
+package workbook
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"unicode/utf16"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// writeCompoundFile writes a version 3 compound file holding streams at
+// its root. Streams are padded to the mini stream cutoff so they all live
+// in regular sectors.
+func writeCompoundFile(t *testing.T, name string, streams []string, data [][]byte) string {
+	t.Helper()
+	const (
+		sectorSize = 512
+		streamSize = 4096
+		endOfChain = 0xfffffffe
+		freeSect   = 0xffffffff
+		noStream   = 0xffffffff
+	)
+	le := binary.LittleEndian
+
+	header := make([]byte, sectorSize)
+	copy(header, oleMagic)
+	le.PutUint16(header[24:], 0x003e)
+	le.PutUint16(header[26:], 3)
+	le.PutUint16(header[28:], 0xfffe)
+	le.PutUint16(header[30:], 9)
+	le.PutUint16(header[32:], 6)
+	le.PutUint32(header[44:], 1)
+	le.PutUint32(header[48:], 1)
+	le.PutUint32(header[56:], streamSize)
+	le.PutUint32(header[60:], endOfChain)
+	le.PutUint32(header[68:], endOfChain)
+	for i := 0; i < 109; i++ {
+		le.PutUint32(header[76+4*i:], freeSect)
+	}
+	le.PutUint32(header[76:], 0)
+
+	// Sector 0 is the FAT, sector 1 the directory, then the streams
+	fat := make([]byte, sectorSize)
+	for i := 0; i < sectorSize/4; i++ {
+		le.PutUint32(fat[4*i:], freeSect)
+	}
+	le.PutUint32(fat, 0xfffffffd)
+	le.PutUint32(fat[4:], endOfChain)
+
+	directory := make([]byte, sectorSize)
+	entry := func(i int, name string, typ byte, right, child, start uint32, size int) {
+		e := directory[128*i : 128*(i+1)]
+		units := utf16.Encode([]rune(name))
+		for j, u := range units {
+			le.PutUint16(e[2*j:], u)
+		}
+		le.PutUint16(e[64:], uint16(2*len(units)+2))
+		e[66], e[67] = typ, 1
+		le.PutUint32(e[68:], noStream)
+		le.PutUint32(e[72:], right)
+		le.PutUint32(e[76:], child)
+		le.PutUint32(e[116:], start)
+		le.PutUint32(e[120:], uint32(size))
+	}
+	for i := len(streams) + 1; i < 4; i++ {
+		le.PutUint32(directory[128*i+68:], noStream)
+		le.PutUint32(directory[128*i+72:], noStream)
+		le.PutUint32(directory[128*i+76:], noStream)
+	}
+	entry(0, "Root Entry", 5, noStream, 1, endOfChain, 0)
+
+	body := []byte{}
+	sector := uint32(2)
+	for i, stream := range streams {
+		right := uint32(i + 2)
+		if i == len(streams)-1 {
+			right = noStream
+		}
+		entry(i+1, stream, 2, right, noStream, sector, streamSize)
+		for j := uint32(0); j < streamSize/sectorSize; j++ {
+			next := sector + j + 1
+			if j == streamSize/sectorSize-1 {
+				next = endOfChain
+			}
+			le.PutUint32(fat[4*(sector+j):], next)
+		}
+		padded := make([]byte, streamSize)
+		copy(padded, data[i])
+		body = append(body, padded...)
+		sector += streamSize / sectorSize
+	}
+
+	path := filepath.Join(t.TempDir(), name)
+	content := append(append(append(header, fat...), directory...), body...)
+	if err := os.WriteFile(path, content, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// record encodes one BIFF record
+func record(typ uint16, data ...byte) []byte {
+	b := make([]byte, 4, 4+len(data))
+	binary.LittleEndian.PutUint16(b, typ)
+	binary.LittleEndian.PutUint16(b[2:], uint16(len(data)))
+	return append(b, data...)
+}
+
+func concat(parts ...[]byte) []byte {
+	var b []byte
+	for _, part := range parts {
+		b = append(b, part...)
+	}
+	return b
+}
+
+func TestDetectEncryption(t *testing.T) {
+	bof := record(0x0809, make([]byte, 16)...)
+	tests := []struct {
+		name    string
+		streams []string
+		data    [][]byte
+		want    Encryption
+	}{
+		{"agile.xlsx", []string{"EncryptionInfo", "EncryptedPackage"}, [][]byte{{4, 0, 4, 0}, nil}, EncryptionAgile},
+		{"standard.xlsx", []string{"EncryptionInfo", "EncryptedPackage"}, [][]byte{{3, 0, 2, 0}, nil}, EncryptionStandard},
+		{"extensible.xlsx", []string{"EncryptionInfo", "EncryptedPackage"}, [][]byte{{4, 0, 3, 0}, nil}, EncryptionExtensible},
+		{"xor.xls", []string{"Workbook"}, [][]byte{concat(bof, record(biffFilePass, 0, 0, 1, 2, 3, 4))}, EncryptionXLSXOR},
+		{"rc4.xls", []string{"Workbook"}, [][]byte{concat(bof, record(biffFilePass, 1, 0, 1, 0, 1, 0))}, EncryptionXLSRC4},
+		{"cryptoapi.xls", []string{"Workbook"}, [][]byte{concat(bof, record(biffFilePass, 1, 0, 2, 0, 2, 0))}, EncryptionXLSCryptoAPI},
+		{"plain.xls", []string{"Workbook"}, [][]byte{concat(bof, record(biffBoundSheet, make([]byte, 8)...), record(biffFilePass, 1, 0))}, EncryptionNone},
+		{"other.doc", []string{"WordDocument"}, [][]byte{nil}, EncryptionNone},
+	}
+
+	for _, tt := range tests {
+		got, err := DetectEncryption(writeCompoundFile(t, tt.name, tt.streams, tt.data))
+		if err != nil || got != tt.want {
+			t.Errorf("%s: DetectEncryption() = %q, %v; want %q", tt.name, got, err, tt.want)
+		}
+	}
+
+	text := filepath.Join(t.TempDir(), "notes.csv")
+	os.WriteFile(text, []byte("a,b\n"), 0o644)
+	if got, err := DetectEncryption(text); err != nil || got != EncryptionNone {
+		t.Errorf("text file: DetectEncryption() = %q, %v", got, err)
+	}
+	if _, err := DetectEncryption(filepath.Join(t.TempDir(), "absent.xlsx")); err == nil {
+		t.Error("missing file: expected an error")
+	}
+}
+
+func TestOpenEncrypted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bilan.xlsx")
+	f := excelize.NewFile()
+	f.SetCellValue("Sheet1", "A1", "secret")
+	if err := f.SaveAs(path, excelize.Options{Password: "motdepasse"}); err != nil {
+		t.Fatal(err)
+	}
+	if format, err := Detect(path); err != nil || format != FormatXLSX {
+		t.Errorf("Detect() = %q, %v; want xlsx", format, err)
+	}
+	xls := writeCompoundFile(t, "ancien.xls", []string{"Workbook"}, [][]byte{record(biffFilePass, 1, 0, 1, 0)})
+	if format, err := Detect(xls); err != nil || format != FormatXLS {
+		t.Errorf("Detect() = %q, %v; want xls", format, err)
+	}
+
+	tests := []struct {
+		name     string
+		path     string
+		password string
+		want     error
+		code     string
+	}{
+		{"no password", path, "", ErrPasswordRequired, "PASSWORD_REQUIRED"},
+		{"wrong password", path, "faux", ErrWrongPassword, "WRONG_PASSWORD"},
+		{"right password", path, "motdepasse", nil, ""},
+		{"legacy xls", xls, "motdepasse", ErrUnsupportedEncryption, "UNSUPPORTED_ENCRYPTION"},
+	}
+
+	for _, tt := range tests {
+		file, err := Open(tt.path, Options{Password: tt.password})
+		if tt.want == nil {
+			if err != nil {
+				t.Errorf("%s: %v", tt.name, err)
+				continue
+			}
+			if value, _ := file.GetCellValue("Sheet1", "A1"); value != "secret" {
+				t.Errorf("%s: A1 = %q", tt.name, value)
+			}
+			file.Close()
+			continue
+		}
+		var encrypted *EncryptedError
+		if !errors.As(err, &encrypted) || !errors.Is(err, tt.want) || encrypted.Code() != tt.code {
+			t.Errorf("%s: error = %v, want %v", tt.name, err, tt.want)
+		}
+		if err := Unlock(tt.path, tt.password); !errors.Is(err, tt.want) {
+			t.Errorf("%s: Unlock() = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
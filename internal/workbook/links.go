@@ -0,0 +1,343 @@
+package workbook
+
+import (
+	"bytes"
+	"encoding/xml"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+
+	"mcp-xlsm-server/internal/models"
+)
+
+const (
+	// Formula cells listed per external link
+	maxLinkReferences = 100
+	// Hyperlinks listed per workbook
+	maxHyperlinks = 500
+)
+
+// External link kinds
+const (
+	LinkWorkbook = "workbook"
+	LinkDDE      = "dde"
+	LinkOLE      = "ole"
+)
+
+// Status of a linked file, checked against the local filesystem
+const (
+	LinkFound   = "found"
+	LinkMissing = "missing"
+	LinkRemote  = "remote"
+)
+
+var (
+	// [n] not preceded by a name, so Table1[2020] is not taken for a link
+	externalRefPattern = regexp.MustCompile(`(?:^|[^\w.\]])'?\[(\d+)\]`)
+	stringLiteral      = regexp.MustCompile(`"(?:[^"]|"")*"`)
+)
+
+// Dependencies inventories the external links of a workbook, with the
+// formulas and defined names using each, and the hyperlinks of its
+// sheets. File targets are looked up as given, then next to the workbook
+// at workbookPath as Excel does. Converted formats have no such parts and return
+// an empty inventory.
+func Dependencies(file *excelize.File, workbookPath string) (*models.ExternalDependencies, error) {
+	deps := &models.ExternalDependencies{
+		Links:      []models.ExternalLink{},
+		Hyperlinks: []models.Hyperlink{},
+	}
+	file.GetSheetList()
+	if file.WorkBook == nil {
+		return deps, nil
+	}
+	dir := filepath.Dir(workbookPath)
+	targets := relationshipTargets(partBytes(file, "xl/_rels/workbook.xml.rels"), "xl")
+
+	if refs := file.WorkBook.ExternalReferences; refs != nil {
+		for i, ref := range refs.ExternalReference {
+			link := readExternalLink(file, targets[ref.RID], dir)
+			link.Index = i + 1
+			deps.Links = append(deps.Links, link)
+		}
+	}
+	if len(deps.Links) > 0 {
+		for _, name := range file.GetDefinedName() {
+			for _, n := range externalIndexes(name.RefersTo) {
+				if n <= len(deps.Links) {
+					deps.Links[n-1].DefinedNames = append(deps.Links[n-1].DefinedNames, name.Name)
+				}
+			}
+		}
+	}
+
+	for _, sheet := range file.WorkBook.Sheets.Sheet {
+		part := targets[sheet.ID]
+		data := partBytes(file, part)
+		if data == nil {
+			continue
+		}
+		if len(deps.Links) > 0 {
+			scanLinkFormulas(data, sheet.Name, deps.Links)
+		}
+		readHyperlinks(file, part, data, sheet.Name, dir, deps)
+	}
+
+	for _, link := range deps.Links {
+		if link.Status == LinkMissing {
+			deps.BrokenLinks++
+		}
+	}
+	return deps, nil
+}
+
+// readExternalLink reads the target and cached sheet names of an
+// external link part.
+func readExternalLink(file *excelize.File, part, dir string) models.ExternalLink {
+	link := models.ExternalLink{Part: part, Cells: []models.LinkReference{}}
+	external := externalTargets(partBytes(file, relsPath(part)))
+
+	decoder := xml.NewDecoder(bytes.NewReader(partBytes(file, part)))
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			break
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		switch start.Name.Local {
+		case "externalBook":
+			link.Kind = LinkWorkbook
+			link.Target = external[attr(start, "id")]
+		case "oleLink":
+			link.Kind = LinkOLE
+			link.Target = external[attr(start, "id")]
+		case "ddeLink":
+			link.Kind = LinkDDE
+			link.Target = attr(start, "ddeService") + "|" + attr(start, "ddeTopic")
+		case "sheetName":
+			link.Sheets = append(link.Sheets, attr(start, "val"))
+		}
+	}
+
+	if link.Kind != LinkDDE && link.Target != "" {
+		link.ResolvedPath, link.Status = resolveLinkTarget(link.Target, dir)
+	}
+	return link
+}
+
+// scanLinkFormulas records the formulas of a sheet part using external
+// links. A shared formula counts once per cell it covers.
+func scanLinkFormulas(data []byte, sheet string, links []models.ExternalLink) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	cell := ""
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		switch start.Name.Local {
+		case "c":
+			cell = attr(start, "r")
+		case "f":
+			var formula struct {
+				Text string `xml:",chardata"`
+			}
+			if err := decoder.DecodeElement(&formula, &start); err != nil {
+				return
+			}
+			indexes := externalIndexes(formula.Text)
+			if len(indexes) == 0 {
+				continue
+			}
+
+			ref, count := cell, 1
+			if attr(start, "t") == "shared" && attr(start, "ref") != "" {
+				ref = attr(start, "ref")
+				count = rangeSize(ref)
+			}
+			for _, n := range indexes {
+				if n > len(links) {
+					continue
+				}
+				link := &links[n-1]
+				link.References += count
+				if len(link.Cells) >= maxLinkReferences {
+					link.CellsTruncated = true
+					continue
+				}
+				link.Cells = append(link.Cells, models.LinkReference{
+					Cell:    sheet + "!" + ref,
+					Formula: "=" + formula.Text,
+				})
+			}
+		}
+	}
+}
+
+// readHyperlinks adds the hyperlinks of a sheet part, which follow
+// sheetData.
+func readHyperlinks(file *excelize.File, part string, data []byte, sheet, dir string, deps *models.ExternalDependencies) {
+	i := bytes.LastIndex(data, []byte("sheetData"))
+	if i < 0 || !bytes.Contains(data[i:], []byte("hyperlink")) {
+		return
+	}
+	external := externalTargets(partBytes(file, relsPath(part)))
+
+	decoder := xml.NewDecoder(bytes.NewReader(data[i:]))
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != "hyperlink" {
+			continue
+		}
+
+		deps.HyperlinksTotal++
+		link := models.Hyperlink{
+			Cell:     sheet + "!" + attr(start, "ref"),
+			Target:   external[attr(start, "id")],
+			Location: attr(start, "location"),
+			Display:  attr(start, "display"),
+		}
+		if link.Target != "" {
+			if _, status := resolveLinkTarget(link.Target, dir); status != LinkRemote {
+				link.Status = status
+			}
+		}
+		if link.Status == LinkMissing {
+			deps.BrokenLinks++
+		}
+		if len(deps.Hyperlinks) >= maxHyperlinks {
+			deps.HyperlinksTruncated = true
+			continue
+		}
+		deps.Hyperlinks = append(deps.Hyperlinks, link)
+	}
+}
+
+// resolveLinkTarget looks for a linked file. Targets are URLs, Windows
+// or UNC paths, or paths relative to the workbook; a file of the same
+// name next to the workbook is accepted too. Windows paths are only
+// checked as such on Windows.
+func resolveLinkTarget(target, dir string) (string, string) {
+	lower := strings.ToLower(target)
+	if strings.HasPrefix(lower, "mailto:") || (strings.Contains(lower, "://") && !strings.HasPrefix(lower, "file:")) {
+		return "", LinkRemote
+	}
+
+	name := target
+	if strings.HasPrefix(lower, "file:") {
+		// file:///C:/Data/x.xlsx or file:///home/x.xlsx; file://server/share
+		// stays a UNC path
+		name = name[len("file:"):]
+		if strings.HasPrefix(name, "///") {
+			name = name[2:]
+			if isDrivePath(name[1:]) {
+				name = name[1:]
+			}
+		}
+	}
+	name = strings.ReplaceAll(name, `\`, "/")
+	if unescaped, err := url.PathUnescape(name); err == nil {
+		name = unescaped
+	}
+
+	var candidates []string
+	switch {
+	case isDrivePath(name) || strings.HasPrefix(name, "//"):
+		if runtime.GOOS == "windows" {
+			candidates = append(candidates, filepath.FromSlash(name))
+		}
+	case strings.HasPrefix(name, "/"):
+		candidates = append(candidates, name)
+	default:
+		candidates = append(candidates, filepath.Join(dir, filepath.FromSlash(name)))
+	}
+	candidates = append(candidates, filepath.Join(dir, path.Base(name)))
+
+	for _, candidate := range candidates {
+		if info, err := os.Stat(candidate); err == nil && !info.IsDir() {
+			return candidate, LinkFound
+		}
+	}
+	return "", LinkMissing
+}
+
+// isDrivePath reports a Windows path such as C:/Data or C:\Data.
+func isDrivePath(name string) bool {
+	return len(name) >= 3 && name[1] == ':' && (name[2] == '/' || name[2] == '\\') &&
+		(name[0] >= 'A' && name[0] <= 'Z' || name[0] >= 'a' && name[0] <= 'z')
+}
+
+// externalIndexes returns the external link numbers a formula refers to,
+// once each, ignoring text in string literals.
+func externalIndexes(formula string) []int {
+	if !strings.Contains(formula, "[") {
+		return nil
+	}
+	formula = stringLiteral.ReplaceAllString(formula, `""`)
+
+	var indexes []int
+	seen := make(map[int]bool)
+	for _, match := range externalRefPattern.FindAllStringSubmatch(formula, -1) {
+		n, err := strconv.Atoi(match[1])
+		if err != nil || n < 1 || seen[n] {
+			continue
+		}
+		seen[n] = true
+		indexes = append(indexes, n)
+	}
+	return indexes
+}
+
+// rangeSize counts the cells of an A1 range.
+func rangeSize(ref string) int {
+	first, last, ok := strings.Cut(ref, ":")
+	if !ok {
+		return 1
+	}
+	left, top, err1 := excelize.CellNameToCoordinates(first)
+	right, bottom, err2 := excelize.CellNameToCoordinates(last)
+	if err1 != nil || err2 != nil {
+		return 1
+	}
+	return (right - left + 1) * (bottom - top + 1)
+}
+
+// relsPath is the relationships part of a package part.
+func relsPath(part string) string {
+	dir, name := path.Split(part)
+	return path.Join(dir, "_rels", name+".rels")
+}
+
+// externalTargets maps relationship ids to their external targets.
+func externalTargets(data []byte) map[string]string {
+	targets := make(map[string]string)
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return targets
+		}
+		start, ok := token.(xml.StartElement)
+		if ok && start.Name.Local == "Relationship" && attr(start, "TargetMode") == "External" {
+			targets[attr(start, "Id")] = attr(start, "Target")
+		}
+	}
+}
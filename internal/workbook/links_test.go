@@ -0,0 +1,118 @@
+package workbook
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"mcp-xlsm-server/internal/models"
+)
+
+func TestExternalIndexes(t *testing.T) {
+	tests := []struct {
+		formula string
+		want    []int
+	}{
+		{"[1]Param!B2*2", []int{1}},
+		{"'[2]Grand Livre'!A1+[1]Param!B2+[2]X!A1", []int{2, 1}},
+		{`[1]Param!A1&"[3]"`, []int{1}},
+		{"SUM(Table1[2020])", nil},
+		{"A1*2", nil},
+	}
+
+	for _, tt := range tests {
+		if got := externalIndexes(tt.formula); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("externalIndexes(%q) = %v, want %v", tt.formula, got, tt.want)
+		}
+	}
+}
+
+func TestDependencies(t *testing.T) {
+	file := fixture{
+		workbookEnd: `<definedNames><definedName name="Taux">[1]Param!$B$2</definedName><definedName name="Origine">Bilan!$A$1</definedName></definedNames>` +
+			`<externalReferences><externalReference r:id="rId91"/><externalReference r:id="rId92"/><externalReference r:id="rId93"/></externalReferences>`,
+		workbookRels: `<Relationship Id="rId91" Type="` + relTypeDir + `externalLink" Target="externalLinks/externalLink1.xml"/>` +
+			`<Relationship Id="rId92" Type="` + relTypeDir + `externalLink" Target="externalLinks/externalLink2.xml"/>` +
+			`<Relationship Id="rId93" Type="` + relTypeDir + `externalLink" Target="externalLinks/externalLink3.xml"/>`,
+		sheets: []fixtureSheet{{name: "Bilan", body: `<sheetData>` +
+			`<row r="1"><c r="A1"><f>[1]Param!B2*2</f><v>4</v></c><c r="B1"><f>SUM(Table1[2020])</f><v>0</v></c><c r="C1" t="inlineStr"><is><t>Site</t></is></c></row>` +
+			`<row r="2"><c r="A2"><f t="shared" ref="A2:A4" si="0">[2]Feuil1!A1&amp;"[3]"</f><v>0</v></c></row>` +
+			`<row r="3"><c r="A3"><f t="shared" si="0"/><v>0</v></c></row>` +
+			`<row r="4"><c r="A4"><f t="shared" si="0"/><v>0</v></c></row>` +
+			`</sheetData><hyperlinks>` +
+			`<hyperlink ref="C1" r:id="rId1" display="Site"/>` +
+			`<hyperlink ref="C2" location="Bilan!A1" display="Haut"/>` +
+			`<hyperlink ref="C3" r:id="rId2"/>` +
+			`</hyperlinks>`}},
+		parts: map[string]string{
+			"xl/worksheets/_rels/sheet1.xml.rels": `<Relationships xmlns="` + packageNS + `">` +
+				`<Relationship Id="rId1" Type="` + relTypeDir + `hyperlink" Target="https://example.com/" TargetMode="External"/>` +
+				`<Relationship Id="rId2" Type="` + relTypeDir + `hyperlink" Target="notes.docx" TargetMode="External"/>` +
+				`</Relationships>`,
+			"xl/externalLinks/externalLink1.xml": `<externalLink xmlns="` + mainNS + `" xmlns:r="` + relNS + `"><externalBook r:id="rId1">` +
+				`<sheetNames><sheetName val="Param"/><sheetName val="Taux"/></sheetNames></externalBook></externalLink>`,
+			"xl/externalLinks/_rels/externalLink1.xml.rels": `<Relationships xmlns="` + packageNS + `">` +
+				`<Relationship Id="rId1" Type="` + relTypeDir + `externalLinkPath" Target="budget%202024.xlsx" TargetMode="External"/></Relationships>`,
+			"xl/externalLinks/externalLink2.xml": `<externalLink xmlns="` + mainNS + `" xmlns:r="` + relNS + `"><externalBook r:id="rId1">` +
+				`<sheetNames><sheetName val="Feuil1"/></sheetNames></externalBook></externalLink>`,
+			"xl/externalLinks/_rels/externalLink2.xml.rels": `<Relationships xmlns="` + packageNS + `">` +
+				`<Relationship Id="rId1" Type="` + relTypeDir + `externalLinkPath" Target="file:///C:/Archives/absent.xlsx" TargetMode="External"/></Relationships>`,
+			"xl/externalLinks/externalLink3.xml": `<externalLink xmlns="` + mainNS + `"><ddeLink ddeService="Reuters" ddeTopic="IDN"/></externalLink>`,
+		},
+	}.open(t)
+	dir := filepath.Dir(file.Path)
+	if err := os.WriteFile(filepath.Join(dir, "budget 2024.xlsx"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	deps, err := Dependencies(file, file.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &models.ExternalDependencies{
+		Links: []models.ExternalLink{
+			{
+				Index:        1,
+				Part:         "xl/externalLinks/externalLink1.xml",
+				Kind:         LinkWorkbook,
+				Target:       "budget%202024.xlsx",
+				ResolvedPath: filepath.Join(dir, "budget 2024.xlsx"),
+				Status:       LinkFound,
+				Sheets:       []string{"Param", "Taux"},
+				DefinedNames: []string{"Taux"},
+				References:   1,
+				Cells:        []models.LinkReference{{Cell: "Bilan!A1", Formula: "=[1]Param!B2*2"}},
+			},
+			{
+				// Drive paths are only looked up as such on Windows; the
+				// file name next to the workbook is tried everywhere
+				Index:      2,
+				Part:       "xl/externalLinks/externalLink2.xml",
+				Kind:       LinkWorkbook,
+				Target:     "file:///C:/Archives/absent.xlsx",
+				Status:     LinkMissing,
+				Sheets:     []string{"Feuil1"},
+				References: 3,
+				Cells:      []models.LinkReference{{Cell: "Bilan!A2:A4", Formula: `=[2]Feuil1!A1&"[3]"`}},
+			},
+			{
+				Index:  3,
+				Part:   "xl/externalLinks/externalLink3.xml",
+				Kind:   LinkDDE,
+				Target: "Reuters|IDN",
+				Cells:  []models.LinkReference{},
+			},
+		},
+		Hyperlinks: []models.Hyperlink{
+			{Cell: "Bilan!C1", Target: "https://example.com/", Display: "Site"},
+			{Cell: "Bilan!C2", Location: "Bilan!A1", Display: "Haut"},
+			{Cell: "Bilan!C3", Target: "notes.docx", Status: LinkMissing},
+		},
+		HyperlinksTotal: 3,
+		BrokenLinks:     2,
+	}
+	if !reflect.DeepEqual(deps, want) {
+		t.Errorf("Dependencies() = %+v, want %+v", deps, want)
+	}
+}
@@ -0,0 +1,117 @@
+package workbook
+
+import (
+	"sort"
+
+	"github.com/xuri/excelize/v2"
+
+	"mcp-xlsm-server/internal/models"
+)
+
+// Merge is a merged region of a sheet. Only its top-left cell holds a
+// value; Excel shows it across the whole region.
+type Merge struct {
+	Range string
+	Value string
+	// 1-based bounds
+	Top, Left, Bottom, Right int
+}
+
+// Merges are the merged regions of one sheet, in row then column order.
+type Merges []Merge
+
+// ReadMerges lists the merged regions of a sheet.
+func ReadMerges(file *excelize.File, sheet string) (Merges, error) {
+	cells, err := file.GetMergeCells(sheet)
+	if err != nil {
+		return nil, err
+	}
+
+	merges := make(Merges, 0, len(cells))
+	for _, cell := range cells {
+		left, top, err := excelize.CellNameToCoordinates(cell.GetStartAxis())
+		if err != nil {
+			continue
+		}
+		right, bottom, err := excelize.CellNameToCoordinates(cell.GetEndAxis())
+		if err != nil {
+			continue
+		}
+		merges = append(merges, Merge{
+			Range:  cell.GetStartAxis() + ":" + cell.GetEndAxis(),
+			Value:  cell.GetCellValue(),
+			Top:    top,
+			Left:   left,
+			Bottom: bottom,
+			Right:  right,
+		})
+	}
+	sort.Slice(merges, func(i, j int) bool {
+		if merges[i].Top != merges[j].Top {
+			return merges[i].Top < merges[j].Top
+		}
+		return merges[i].Left < merges[j].Left
+	})
+	return merges, nil
+}
+
+// At returns the region covering a cell.
+func (m Merges) At(col, row int) (Merge, bool) {
+	for _, merge := range m {
+		if merge.Top > row {
+			break
+		}
+		if row <= merge.Bottom && col >= merge.Left && col <= merge.Right {
+			return merge, true
+		}
+	}
+	return Merge{}, false
+}
+
+// Within returns the regions overlapping a block of cells.
+func (m Merges) Within(top, left, bottom, right int) Merges {
+	var within Merges
+	for _, merge := range m {
+		if merge.Top > bottom {
+			break
+		}
+		if merge.Bottom >= top && merge.Right >= left && merge.Left <= right {
+			within = append(within, merge)
+		}
+	}
+	return within
+}
+
+// Regions converts the merges for responses.
+func (m Merges) Regions() []models.MergedRegion {
+	regions := make([]models.MergedRegion, len(m))
+	for i, merge := range m {
+		regions[i] = models.MergedRegion{Range: merge.Range, Value: merge.Value}
+	}
+	return regions
+}
+
+// Fill copies the value of each region into the cells it covers. rows
+// are the sheet rows from A1, as GetRows returns them; rows and short
+// rows are added where a region reaches past their end.
+func (m Merges) Fill(rows [][]string) [][]string {
+	for _, merge := range m {
+		if merge.Value == "" {
+			continue
+		}
+		for len(rows) < merge.Bottom {
+			rows = append(rows, nil)
+		}
+		for row := merge.Top; row <= merge.Bottom; row++ {
+			cells := rows[row-1]
+			for len(cells) < merge.Right {
+				cells = append(cells, "")
+			}
+			for col := merge.Left; col <= merge.Right; col++ {
+				cells[col-1] = merge.Value
+			}
+			rows[row-1] = cells
+		}
+	}
+	return rows
+}
@@ -0,0 +1,69 @@
+package workbook
+
+import (
+	"reflect"
+	"testing"
+
+	"mcp-xlsm-server/internal/models"
+)
+
+func TestReadMerges(t *testing.T) {
+	file := fixture{sheets: []fixtureSheet{{name: "Bilan", body: `<sheetData>` +
+		`<row r="1"><c r="A1" t="inlineStr"><is><t>Actif</t></is></c></row>` +
+		`<row r="2"><c r="A2"><v>1</v></c><c r="D2" t="inlineStr"><is><t>Total</t></is></c></row>` +
+		`<row r="3"><c r="B3"><v>42</v></c></row>` +
+		`</sheetData>` +
+		// Listed out of order; E5:F6 has no value
+		`<mergeCells count="4"><mergeCell ref="E5:F6"/><mergeCell ref="B3:B4"/><mergeCell ref="D2:E2"/><mergeCell ref="A1:C1"/></mergeCells>`}}}.open(t)
+
+	merges, err := ReadMerges(file, "Bilan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Merges{
+		{Range: "A1:C1", Value: "Actif", Top: 1, Left: 1, Bottom: 1, Right: 3},
+		{Range: "D2:E2", Value: "Total", Top: 2, Left: 4, Bottom: 2, Right: 5},
+		{Range: "B3:B4", Value: "42", Top: 3, Left: 2, Bottom: 4, Right: 2},
+		{Range: "E5:F6", Top: 5, Left: 5, Bottom: 6, Right: 6},
+	}
+	if !reflect.DeepEqual(merges, want) {
+		t.Fatalf("ReadMerges() = %+v, want %+v", merges, want)
+	}
+
+	at := []struct {
+		col, row int
+		want     string
+	}{
+		{1, 1, "A1:C1"},
+		{3, 1, "A1:C1"},
+		{2, 4, "B3:B4"},
+		{1, 2, ""},
+		{6, 6, "E5:F6"},
+		{7, 6, ""},
+	}
+	for _, tt := range at {
+		merge, ok := merges.At(tt.col, tt.row)
+		if merge.Range != tt.want || ok != (tt.want != "") {
+			t.Errorf("At(%d, %d) = %q, %v; want %q", tt.col, tt.row, merge.Range, ok, tt.want)
+		}
+	}
+
+	within := merges.Within(2, 2, 3, 4)
+	if got := within.Regions(); !reflect.DeepEqual(got, []models.MergedRegion{{Range: "D2:E2", Value: "Total"}, {Range: "B3:B4", Value: "42"}}) {
+		t.Errorf("Within(2, 2, 3, 4) = %+v, want D2:E2 and B3:B4", got)
+	}
+
+	rows, err := file.GetRows("Bilan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantRows := [][]string{
+		{"Actif", "Actif", "Actif"},
+		{"1", "", "", "Total", "Total"},
+		{"", "42"},
+		{"", "42"},
+	}
+	if got := merges.Fill(rows); !reflect.DeepEqual(got, wantRows) {
+		t.Errorf("Fill() = %q, want %q", got, wantRows)
+	}
+}
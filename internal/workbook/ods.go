@@ -0,0 +1,333 @@
+package workbook
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// Runs of repeated empty rows or cells longer than this only pad the end
+// of a sheet and are dropped
+const maxEmptyRepeat = 1024
+
+// openODS reads an OpenDocument spreadsheet: content.xml is streamed sheet
+// by sheet, keeping the values LibreOffice stored and the formulas
+// translated to Excel syntax.
+func openODS(path string) (*excelize.File, error) {
+	archive, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, err
+	}
+	defer archive.Close()
+
+	var content *zip.File
+	for _, entry := range archive.File {
+		if entry.Name == "content.xml" {
+			content = entry
+			break
+		}
+	}
+	if content == nil {
+		return nil, fmt.Errorf("content.xml not found")
+	}
+	rc, err := content.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	reader := &odsReader{decoder: xml.NewDecoder(rc)}
+	err = reader.read()
+	if err == nil && reader.sheet != nil {
+		err = reader.sheet.flush()
+	}
+	if err != nil {
+		if reader.file != nil {
+			reader.file.Close()
+		}
+		return nil, err
+	}
+	if reader.file == nil {
+		return nil, fmt.Errorf("no sheet found")
+	}
+	return reader.file, nil
+}
+
+type odsReader struct {
+	decoder *xml.Decoder
+	file    *excelize.File
+	sheet   *sheetWriter
+	row     int
+	// emptyRows counts empty rows not written yet
+	emptyRows int
+}
+
+func (r *odsReader) read() error {
+	for {
+		token, err := r.decoder.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+
+		switch start.Name.Local {
+		case "table":
+			if err := r.startSheet(attr(start, "name")); err != nil {
+				return err
+			}
+		case "table-row":
+			if r.sheet == nil {
+				continue
+			}
+			if err := r.readRow(start); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (r *odsReader) startSheet(name string) error {
+	if r.sheet != nil {
+		if err := r.sheet.flush(); err != nil {
+			return err
+		}
+	}
+
+	name = sheetName(name)
+	if r.file == nil {
+		file, err := newWorkbook(name)
+		if err != nil {
+			return err
+		}
+		r.file = file
+	}
+	sheet, err := newSheetWriter(r.file, name)
+	if err != nil {
+		return err
+	}
+	r.sheet, r.row, r.emptyRows = sheet, 0, 0
+	return nil
+}
+
+// readRow reads a table-row element up to its end and writes it, once per
+// repetition.
+func (r *odsReader) readRow(start xml.StartElement) error {
+	repeat := repeatAttr(start, "number-rows-repeated")
+
+	var values []interface{}
+	empty := true
+	for {
+		token, err := r.decoder.Token()
+		if err != nil {
+			return err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			if t.Name.Local != "table-cell" && t.Name.Local != "covered-table-cell" {
+				if err := r.decoder.Skip(); err != nil {
+					return err
+				}
+				continue
+			}
+			value, err := r.readCell(t)
+			if err != nil {
+				return err
+			}
+			cellRepeat := repeatAttr(t, "number-columns-repeated")
+			if value == nil && cellRepeat > maxEmptyRepeat {
+				continue
+			}
+			for i := 0; i < cellRepeat; i++ {
+				values = append(values, value)
+			}
+			if value != nil {
+				empty = false
+			}
+
+		case xml.EndElement:
+			if t.Name.Local != "table-row" {
+				continue
+			}
+			if empty {
+				r.emptyRows += repeat
+				return nil
+			}
+			if len(values) > excelize.MaxColumns {
+				values = values[:excelize.MaxColumns]
+			}
+			if r.row+r.emptyRows+repeat > excelize.TotalRows {
+				return fmt.Errorf("sheet has more than %d rows", excelize.TotalRows)
+			}
+			r.row += r.emptyRows
+			r.emptyRows = 0
+			for i := 0; i < repeat; i++ {
+				r.row++
+				if err := r.sheet.writeRow(r.row, values); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	}
+}
+
+// readCell reads a table-cell element up to its end.
+func (r *odsReader) readCell(start xml.StartElement) (interface{}, error) {
+	var text strings.Builder
+	paragraphs := 0
+	depth := 1
+	for depth > 0 {
+		token, err := r.decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			depth++
+			switch t.Name.Local {
+			case "p":
+				if paragraphs > 0 {
+					text.WriteByte('\n')
+				}
+				paragraphs++
+			case "s":
+				text.WriteString(strings.Repeat(" ", repeatAttr(t, "c")))
+			case "tab":
+				text.WriteByte('\t')
+			case "line-break":
+				text.WriteByte('\n')
+			case "annotation":
+				// Comments are not cell content
+				if err := r.decoder.Skip(); err != nil {
+					return nil, err
+				}
+				depth--
+			}
+		case xml.EndElement:
+			depth--
+		case xml.CharData:
+			if depth > 1 {
+				text.Write(t)
+			}
+		}
+	}
+
+	value := odsValue(start, text.String())
+	if formula := attr(start, "formula"); formula != "" {
+		return formulaCell{formula: odsFormula(formula), value: value}, nil
+	}
+	return value, nil
+}
+
+// odsValue types a cell from its office:value-type, falling back to the
+// displayed text.
+func odsValue(cell xml.StartElement, text string) interface{} {
+	switch attr(cell, "value-type") {
+	case "float", "percentage", "currency":
+		if num, err := strconv.ParseFloat(attr(cell, "value"), 64); err == nil {
+			return num
+		}
+	case "boolean":
+		return attr(cell, "boolean-value") == "true"
+	case "date":
+		value := attr(cell, "date-value")
+		for _, layout := range []string{"2006-01-02T15:04:05.999999999", "2006-01-02T15:04:05", "2006-01-02"} {
+			if date, err := time.Parse(layout, value); err == nil {
+				return date
+			}
+		}
+	case "string":
+		if value := attr(cell, "string-value"); value != "" {
+			return value
+		}
+	}
+	if text == "" {
+		return nil
+	}
+	return text
+}
+
+// odsFormula translates OpenFormula ("of:=SUM([.A1:.A3];[Data.B2])") to
+// Excel syntax ("SUM(A1:A3,Data!B2)").
+func odsFormula(formula string) string {
+	if i := strings.Index(formula, "="); i >= 0 {
+		formula = formula[i+1:]
+	}
+
+	var out strings.Builder
+	quoted := false
+	for i := 0; i < len(formula); i++ {
+		c := formula[i]
+		switch {
+		case c == '"':
+			quoted = !quoted
+			out.WriteByte(c)
+		case !quoted && c == '[':
+			end := strings.IndexByte(formula[i:], ']')
+			if end < 0 {
+				out.WriteString(formula[i:])
+				return out.String()
+			}
+			out.WriteString(odsReference(formula[i+1 : i+end]))
+			i += end
+		case !quoted && c == ';':
+			out.WriteByte(',')
+		default:
+			out.WriteByte(c)
+		}
+	}
+	return out.String()
+}
+
+// odsReference converts "Sheet.A1:.B2" or ".A1" to "Sheet!A1:B2" or "A1".
+func odsReference(ref string) string {
+	parts := strings.Split(ref, ":")
+	sheet := ""
+	for i, part := range parts {
+		dot := strings.LastIndex(part, ".")
+		if dot < 0 {
+			continue
+		}
+		if dot > 0 && i == 0 {
+			sheet = strings.TrimPrefix(part[:dot], "$")
+		}
+		parts[i] = part[dot+1:]
+	}
+
+	result := strings.Join(parts, ":")
+	if sheet == "" {
+		return result
+	}
+	if strings.HasPrefix(sheet, "'") || strings.ContainsAny(sheet, " -+()&,;") {
+		sheet = "'" + strings.Trim(sheet, "'") + "'"
+	}
+	return sheet + "!" + result
+}
+
+func attr(element xml.StartElement, local string) string {
+	for _, a := range element.Attr {
+		if a.Name.Local == local {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+func repeatAttr(element xml.StartElement, local string) int {
+	if n, err := strconv.Atoi(attr(element, local)); err == nil && n > 0 {
+		return n
+	}
+	return 1
+}
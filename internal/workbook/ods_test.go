@@ -0,0 +1,153 @@
+package workbook
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+)
+
+func TestODSFormula(t *testing.T) {
+	tests := []struct {
+		formula string
+		want    string
+	}{
+		{"of:=SUM([.A1:.A3])", "SUM(A1:A3)"},
+		{"of:=SUM([.A1:.A3];[Data.B2])", "SUM(A1:A3,Data!B2)"},
+		{"of:=[$'Grand Livre'.$C$4]*2", "'Grand Livre'!$C$4*2"},
+		{"of:=[Vente-Mars.A1:.B2]", "'Vente-Mars'!A1:B2"},
+		{`of:=IF([.A1]>0;"a;[b]";"")`, `IF(A1>0,"a;[b]","")`},
+		{"of:=[.A1", "[.A1"},
+	}
+
+	for _, tt := range tests {
+		if got := odsFormula(tt.formula); got != tt.want {
+			t.Errorf("odsFormula(%q) = %q, want %q", tt.formula, got, tt.want)
+		}
+	}
+}
+
+// writeODS packages content as a minimal OpenDocument spreadsheet
+func writeODS(t *testing.T, body string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "classeur.ods")
+	out, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	archive := zip.NewWriter(out)
+	for name, data := range map[string]string{
+		"mimetype": "application/vnd.oasis.opendocument.spreadsheet",
+		"content.xml": `<?xml version="1.0" encoding="UTF-8"?>
+<office:document-content xmlns:office="urn:oasis:names:tc:opendocument:xmlns:office:1.0" xmlns:table="urn:oasis:names:tc:opendocument:xmlns:table:1.0" xmlns:text="urn:oasis:names:tc:opendocument:xmlns:text:1.0"><office:body><office:spreadsheet>` +
+			body + `</office:spreadsheet></office:body></office:document-content>`,
+	} {
+		w, err := archive.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(data))
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatal(err)
+	}
+	out.Close()
+	return path
+}
+
+func TestOpenODS(t *testing.T) {
+	path := writeODS(t, `
+<table:table table:name="Ventes">
+  <table:table-row>
+    <table:table-cell office:value-type="string"><text:p>Rayon</text:p></table:table-cell>
+    <table:table-cell office:value-type="string"><text:p>Montant</text:p></table:table-cell>
+    <table:table-cell office:value-type="string"><text:p>Date</text:p></table:table-cell>
+  </table:table-row>
+  <table:table-row table:number-rows-repeated="2">
+    <table:table-cell office:value-type="string"><text:p>Frais</text:p><text:p>bio<text:s text:c="2"/>local</text:p></table:table-cell>
+    <table:table-cell office:value-type="float" office:value="12.5"><text:p>12,50</text:p></table:table-cell>
+    <table:table-cell office:value-type="date" office:date-value="2025-03-31"><text:p>31/03/2025</text:p></table:table-cell>
+  </table:table-row>
+  <table:table-row table:number-rows-repeated="3"><table:table-cell table:number-columns-repeated="16384"/></table:table-row>
+  <table:table-row>
+    <table:table-cell table:number-columns-repeated="2"/>
+    <table:table-cell table:formula="of:=SUM([.B2:.B3])" office:value-type="float" office:value="25"><text:p>25</text:p><office:annotation><text:p>note</text:p></office:annotation></table:table-cell>
+  </table:table-row>
+  <table:table-row table:number-rows-repeated="1048000"><table:table-cell/></table:table-row>
+</table:table>
+<table:table table:name="Param/2025">
+  <table:table-row>
+    <table:table-cell office:value-type="boolean" office:boolean-value="true"><text:p>VRAI</text:p></table:table-cell>
+    <table:table-cell office:value-type="percentage" office:value="0.2"><text:p>20 %</text:p></table:table-cell>
+  </table:table-row>
+</table:table>`)
+
+	if format, err := Detect(path); err != nil || format != FormatODS {
+		t.Fatalf("Detect() = %v, %v; want ods", format, err)
+	}
+	file, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	if sheets := file.GetSheetList(); !reflect.DeepEqual(sheets, []string{"Ventes", "Param_2025"}) {
+		t.Errorf("sheets = %v", sheets)
+	}
+
+	tests := []struct {
+		sheet, cell string
+		want        string
+		formula     string
+	}{
+		{"Ventes", "A1", "Rayon", ""},
+		{"Ventes", "A2", "Frais\nbio  local", ""},
+		{"Ventes", "A3", "Frais\nbio  local", ""},
+		{"Ventes", "B3", "12.5", ""},
+		{"Ventes", "C2", "45747", ""},
+		{"Ventes", "A4", "", ""},
+		{"Ventes", "C7", "25", "SUM(B2:B3)"},
+		{"Param_2025", "A1", "1", ""},
+		{"Param_2025", "B1", "0.2", ""},
+	}
+	for _, tt := range tests {
+		got, err := file.GetCellValue(tt.sheet, tt.cell, excelize.Options{RawCellValue: true})
+		if err != nil || got != tt.want {
+			t.Errorf("%s!%s = %q, %v; want %q", tt.sheet, tt.cell, got, err, tt.want)
+		}
+		if formula, _ := file.GetCellFormula(tt.sheet, tt.cell); formula != tt.formula {
+			t.Errorf("%s!%s formula = %q, want %q", tt.sheet, tt.cell, formula, tt.formula)
+		}
+	}
+
+	// Trailing padding rows are not written
+	if rows, _ := file.GetRows("Ventes"); len(rows) != 7 {
+		t.Errorf("Ventes has %d rows, want 7", len(rows))
+	}
+	if style, _ := file.GetCellStyle("Ventes", "C2"); NewCellDates(file, "Ventes").styleKind(style) != DateOnly {
+		t.Error("ODS date not styled as a date")
+	}
+}
+
+func TestOpenODSErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{"no sheet", "", "no sheet found"},
+		{"too many rows", `<table:table table:name="A"><table:table-row table:number-rows-repeated="1048577"><table:table-cell office:value-type="float" office:value="1"/></table:table-row></table:table>`, "more than"},
+		{"malformed", `<table:table table:name="A"><table:table-row>`, "XML syntax error"},
+	}
+
+	for _, tt := range tests {
+		_, err := Open(writeODS(t, tt.body))
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: error = %v, want %q", tt.name, err, tt.want)
+		}
+	}
+}
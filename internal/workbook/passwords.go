@@ -0,0 +1,104 @@
+package workbook
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// PasswordRule gives the password of the workbooks whose path matches
+// Pattern. Patterns use filepath.Match syntax against the absolute path;
+// a pattern without a separator matches the file name alone, and a
+// trailing "/**" matches everything below a directory.
+type PasswordRule struct {
+	Pattern  string `yaml:"pattern"`
+	Password string `yaml:"password"`
+	// PasswordEnv names an environment variable holding the password, to
+	// keep it out of the file
+	PasswordEnv string `yaml:"password_env"`
+}
+
+// PasswordsFile is the layout of the secret file referenced by the
+// configuration.
+type PasswordsFile struct {
+	Passwords []PasswordRule `yaml:"passwords"`
+}
+
+var (
+	passwordsMu sync.RWMutex
+	rules       []PasswordRule
+)
+
+// LoadPasswords reads a passwords file and replaces the configured rules.
+func LoadPasswords(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read passwords file: %w", err)
+	}
+
+	var file PasswordsFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("failed to parse passwords file: %w", err)
+	}
+	for i, rule := range file.Passwords {
+		if rule.Pattern == "" {
+			return fmt.Errorf("passwords file: rule %d has no pattern", i+1)
+		}
+		if _, err := filepath.Match(rule.Pattern, ""); err != nil {
+			return fmt.Errorf("passwords file: invalid pattern %q: %w", rule.Pattern, err)
+		}
+		if rule.Password == "" && rule.PasswordEnv == "" {
+			return fmt.Errorf("passwords file: rule %q has neither password nor password_env", rule.Pattern)
+		}
+	}
+
+	SetPasswordRules(file.Passwords)
+	return nil
+}
+
+// SetPasswordRules replaces the configured rules. The first matching rule
+// wins.
+func SetPasswordRules(newRules []PasswordRule) {
+	passwordsMu.Lock()
+	defer passwordsMu.Unlock()
+	rules = append([]PasswordRule(nil), newRules...)
+}
+
+// lookupPassword returns the password of the first rule matching path.
+// Passwords given by a caller are never kept here, where every client
+// of the server would reach them.
+func lookupPassword(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		abs = path
+	}
+
+	passwordsMu.RLock()
+	defer passwordsMu.RUnlock()
+
+	for _, rule := range rules {
+		if !matchPattern(rule.Pattern, abs) {
+			continue
+		}
+		if rule.PasswordEnv != "" {
+			return os.Getenv(rule.PasswordEnv)
+		}
+		return rule.Password
+	}
+	return ""
+}
+
+func matchPattern(pattern, path string) bool {
+	if dir, ok := strings.CutSuffix(pattern, string(filepath.Separator)+"**"); ok {
+		return strings.HasPrefix(path, dir+string(filepath.Separator))
+	}
+	if !strings.ContainsRune(pattern, filepath.Separator) {
+		path = filepath.Base(path)
+	}
+	matched, _ := filepath.Match(pattern, path)
+	return matched
+}
@@ -0,0 +1,29 @@
+package workbook
+
+import "testing"
+
+func TestLookupPassword(t *testing.T) {
+	t.Setenv("TEST_XLSM_PASSWORD", "from-env")
+	SetPasswordRules([]PasswordRule{
+		{Pattern: "/data/finance/**", PasswordEnv: "TEST_XLSM_PASSWORD"},
+		{Pattern: "Paie_*.xlsx", Password: "paie"},
+		{Pattern: "/data/*.xlsx", Password: "data"},
+	})
+	defer SetPasswordRules(nil)
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/data/finance/2025/bilan.xlsx", "from-env"},
+		{"/home/rh/Paie_03.xlsx", "paie"},
+		{"/data/budget.xlsx", "data"},
+		{"/data/sub/budget.xlsx", ""},
+		{"/tmp/other.xlsx", ""},
+	}
+	for _, tt := range tests {
+		if got := lookupPassword(tt.path); got != tt.want {
+			t.Errorf("lookupPassword(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,331 @@
+package workbook
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+
+	"mcp-xlsm-server/internal/models"
+)
+
+const (
+	pivotTableRel = "/relationships/pivotTable"
+	pivotCacheRel = "/relationships/pivotCacheDefinition"
+)
+
+// Field index standing for the data (Σ Values) field in row and column
+// fields
+const pivotValuesField = -2
+
+// PivotCache is a pivot cache definition of the workbook. Fields lists
+// every cache field; RecordFields the ones stored in each record, as
+// calculated fields are not.
+type PivotCache struct {
+	ID           int
+	Part         string
+	RecordsPart  string
+	SourceType   string
+	Source       string
+	Fields       []string
+	RecordFields []int
+	RecordCount  int
+	sharedItems  [][]interface{}
+}
+
+// Info describes the cache for responses.
+func (c PivotCache) Info() models.PivotCacheInfo {
+	info := models.PivotCacheInfo{
+		ID:          c.ID,
+		SourceType:  c.SourceType,
+		Source:      c.Source,
+		Fields:      c.Fields,
+		RecordCount: c.RecordCount,
+		HasRecords:  c.RecordsPart != "",
+	}
+	if info.HasRecords {
+		info.Relation = PivotCacheRelation(c.ID)
+	}
+	return info
+}
+
+// PivotCacheRelation is the name sql_query knows a pivot cache by.
+func PivotCacheRelation(id int) string {
+	return fmt.Sprintf("pivot_cache_%d", id)
+}
+
+type rawCacheItem struct {
+	XMLName xml.Name
+	V       string `xml:"v,attr"`
+}
+
+type rawCacheDefinition struct {
+	RecordCount int    `xml:"recordCount,attr"`
+	RecordsID   string `xml:"id,attr"`
+	Source      struct {
+		Type      string `xml:"type,attr"`
+		Worksheet *struct {
+			Ref   string `xml:"ref,attr"`
+			Sheet string `xml:"sheet,attr"`
+			Name  string `xml:"name,attr"`
+			ID    string `xml:"id,attr"`
+		} `xml:"worksheetSource"`
+	} `xml:"cacheSource"`
+	Fields []struct {
+		Name          string `xml:"name,attr"`
+		Formula       string `xml:"formula,attr"`
+		DatabaseField string `xml:"databaseField,attr"`
+		SharedItems   struct {
+			Items []rawCacheItem `xml:",any"`
+		} `xml:"sharedItems"`
+	} `xml:"cacheFields>cacheField"`
+}
+
+type rawPivotTable struct {
+	Name     string `xml:"name,attr"`
+	CacheID  int    `xml:"cacheId,attr"`
+	Location struct {
+		Ref string `xml:"ref,attr"`
+	} `xml:"location"`
+	RowFields []struct {
+		X int `xml:"x,attr"`
+	} `xml:"rowFields>field"`
+	ColFields []struct {
+		X int `xml:"x,attr"`
+	} `xml:"colFields>field"`
+	PageFields []struct {
+		Fld int `xml:"fld,attr"`
+	} `xml:"pageFields>pageField"`
+	DataFields []struct {
+		Name     string `xml:"name,attr"`
+		Fld      int    `xml:"fld,attr"`
+		Subtotal string `xml:"subtotal,attr"`
+	} `xml:"dataFields>dataField"`
+}
+
+// PivotCaches reads the pivot cache definitions listed by the workbook.
+func PivotCaches(file *excelize.File) []PivotCache {
+	file.GetSheetList()
+	if file.WorkBook == nil || file.WorkBook.PivotCaches == nil {
+		return nil
+	}
+	targets := relationshipTargets(partBytes(file, "xl/_rels/workbook.xml.rels"), "xl")
+
+	var caches []PivotCache
+	for _, ref := range file.WorkBook.PivotCaches.PivotCache {
+		part := targets[ref.RID]
+		if cache, ok := readPivotCache(file, part); ok {
+			cache.ID = ref.CacheID
+			caches = append(caches, cache)
+		}
+	}
+	return caches
+}
+
+func readPivotCache(file *excelize.File, part string) (PivotCache, bool) {
+	data := partBytes(file, part)
+	if data == nil {
+		return PivotCache{}, false
+	}
+	var raw rawCacheDefinition
+	if err := xml.Unmarshal(data, &raw); err != nil {
+		return PivotCache{}, false
+	}
+
+	cache := PivotCache{
+		Part:        part,
+		SourceType:  raw.Source.Type,
+		RecordCount: raw.RecordCount,
+	}
+	if source := raw.Source.Worksheet; source != nil {
+		switch {
+		case source.ID != "":
+			// Range of another workbook
+			cache.SourceType = "external"
+			cache.Source = source.Ref
+		case source.Name != "":
+			// Excel table or defined name
+			cache.Source = source.Name
+		case source.Sheet != "":
+			cache.Source = quoteSheet(source.Sheet) + "!" + source.Ref
+		default:
+			cache.Source = source.Ref
+		}
+	}
+	if raw.RecordsID != "" {
+		cache.RecordsPart = relationshipTargets(partBytes(file, relsPath(part)), path.Dir(part))[raw.RecordsID]
+	}
+
+	for i, field := range raw.Fields {
+		cache.Fields = append(cache.Fields, field.Name)
+		if field.Formula == "" && field.DatabaseField != "0" && field.DatabaseField != "false" {
+			cache.RecordFields = append(cache.RecordFields, i)
+		}
+		items := make([]interface{}, len(field.SharedItems.Items))
+		for j, item := range field.SharedItems.Items {
+			items[j] = cacheValue(item)
+		}
+		cache.sharedItems = append(cache.sharedItems, items)
+	}
+	return cache, true
+}
+
+// PivotCacheRecords returns the records saved with a pivot cache, one
+// column per record field. Caches saved without their records (an
+// option of the pivot table) have none.
+func PivotCacheRecords(file *excelize.File, cache PivotCache) ([]string, [][]interface{}, error) {
+	headers := make([]string, len(cache.RecordFields))
+	for i, field := range cache.RecordFields {
+		headers[i] = cache.Fields[field]
+	}
+	if cache.RecordsPart == "" {
+		return headers, nil, fmt.Errorf("pivot cache %d was saved without its records", cache.ID)
+	}
+	data := partBytes(file, cache.RecordsPart)
+	if data == nil {
+		return headers, nil, fmt.Errorf("pivot cache %d records part %s not found", cache.ID, cache.RecordsPart)
+	}
+
+	rows := make([][]interface{}, 0, cache.RecordCount)
+	var row []interface{}
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			break
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			if t.Name.Local == "r" {
+				row = make([]interface{}, 0, len(headers))
+				continue
+			}
+			if row == nil || len(row) >= len(headers) {
+				continue
+			}
+			item := rawCacheItem{XMLName: t.Name, V: attr(t, "v")}
+			if t.Name.Local == "x" {
+				// Index into the shared items of the field
+				field := cache.RecordFields[len(row)]
+				index, err := strconv.Atoi(item.V)
+				if err != nil || index < 0 || index >= len(cache.sharedItems[field]) {
+					row = append(row, nil)
+				} else {
+					row = append(row, cache.sharedItems[field][index])
+				}
+				continue
+			}
+			row = append(row, cacheValue(item))
+		case xml.EndElement:
+			if t.Name.Local == "r" && row != nil {
+				for len(row) < len(headers) {
+					row = append(row, nil)
+				}
+				rows = append(rows, row)
+				row = nil
+			}
+		}
+	}
+	return headers, rows, nil
+}
+
+// cacheValue converts a cache item: n number, b boolean, m missing, and
+// s, d (ISO date) and e (error) kept as text.
+func cacheValue(item rawCacheItem) interface{} {
+	switch item.XMLName.Local {
+	case "n":
+		if n, err := strconv.ParseFloat(item.V, 64); err == nil {
+			return n
+		}
+	case "b":
+		return xmlBool(item.V, false)
+	case "m":
+		return nil
+	}
+	return item.V
+}
+
+// PivotTables lists the pivot tables of a sheet with their fields named
+// from the cache they summarize.
+func PivotTables(file *excelize.File, sheet string, caches []PivotCache) []models.PivotTableInfo {
+	sheetPart := sheetPartPath(file, sheet)
+	if sheetPart == "" {
+		return nil
+	}
+
+	var tables []models.PivotTableInfo
+	for _, part := range relationshipsOfType(partBytes(file, relsPath(sheetPart)), path.Dir(sheetPart), pivotTableRel) {
+		var raw rawPivotTable
+		if err := xml.Unmarshal(partBytes(file, part), &raw); err != nil {
+			continue
+		}
+
+		// The table's own relationship names its cache; cacheId is the
+		// fallback
+		var cache PivotCache
+		cacheParts := relationshipsOfType(partBytes(file, relsPath(part)), path.Dir(part), pivotCacheRel)
+		for _, candidate := range caches {
+			if (len(cacheParts) > 0 && candidate.Part == cacheParts[0]) || (len(cacheParts) == 0 && candidate.ID == raw.CacheID) {
+				cache = candidate
+				break
+			}
+		}
+		fieldName := func(index int) string {
+			if index == pivotValuesField {
+				return "Values"
+			}
+			if index >= 0 && index < len(cache.Fields) {
+				return cache.Fields[index]
+			}
+			return strconv.Itoa(index)
+		}
+
+		table := models.PivotTableInfo{
+			Name:         raw.Name,
+			Location:     raw.Location.Ref,
+			CacheID:      raw.CacheID,
+			SourceType:   cache.SourceType,
+			Source:       cache.Source,
+			RowFields:    []string{},
+			ColumnFields: []string{},
+			ValueFields:  []models.PivotValueField{},
+			RecordCount:  cache.RecordCount,
+		}
+		for _, field := range raw.RowFields {
+			table.RowFields = append(table.RowFields, fieldName(field.X))
+		}
+		for _, field := range raw.ColFields {
+			table.ColumnFields = append(table.ColumnFields, fieldName(field.X))
+		}
+		for _, field := range raw.PageFields {
+			table.FilterFields = append(table.FilterFields, fieldName(field.Fld))
+		}
+		for _, field := range raw.DataFields {
+			function := field.Subtotal
+			if function == "" {
+				function = "sum"
+			}
+			table.ValueFields = append(table.ValueFields, models.PivotValueField{
+				Name:     field.Name,
+				Field:    fieldName(field.Fld),
+				Function: function,
+			})
+		}
+		tables = append(tables, table)
+	}
+	return tables
+}
+
+// quoteSheet quotes a sheet name for a reference when Excel would.
+func quoteSheet(sheet string) string {
+	for _, r := range sheet {
+		if !(r == '_' || r == '.' || r >= '0' && r <= '9' || r >= 'A' && r <= 'Z' || r >= 'a' && r <= 'z' || r > 127) {
+			return "'" + strings.ReplaceAll(sheet, "'", "''") + "'"
+		}
+	}
+	return sheet
+}
@@ -0,0 +1,119 @@
+package workbook
+
+import (
+	"reflect"
+	"testing"
+
+	"mcp-xlsm-server/internal/models"
+)
+
+func TestPivots(t *testing.T) {
+	file := fixture{
+		workbookEnd: `<pivotCaches><pivotCache cacheId="3" r:id="rId80"/><pivotCache cacheId="4" r:id="rId81"/></pivotCaches>`,
+		workbookRels: `<Relationship Id="rId80" Type="` + relTypeDir + `pivotCacheDefinition" Target="pivotCache/pivotCacheDefinition1.xml"/>` +
+			`<Relationship Id="rId81" Type="` + relTypeDir + `pivotCacheDefinition" Target="pivotCache/pivotCacheDefinition2.xml"/>`,
+		sheets: []fixtureSheet{
+			{name: "Grand Livre", body: `<sheetData/>`},
+			{name: "Synthese", body: `<sheetData/>`},
+		},
+		parts: map[string]string{
+			"xl/pivotCache/pivotCacheDefinition1.xml": `<pivotCacheDefinition xmlns="` + mainNS + `" xmlns:r="` + relNS + `" r:id="rId1" recordCount="2">` +
+				`<cacheSource type="worksheet"><worksheetSource ref="A1:C3" sheet="Grand Livre"/></cacheSource><cacheFields count="4">` +
+				`<cacheField name="Compte" numFmtId="0"><sharedItems><s v="601"/><s v="706"/></sharedItems></cacheField>` +
+				`<cacheField name="Mois" numFmtId="0"><sharedItems containsBlank="1"/></cacheField>` +
+				`<cacheField name="Montant" numFmtId="0"><sharedItems containsNumber="1"/></cacheField>` +
+				`<cacheField name="TVA" numFmtId="0" formula="Montant*0.2" databaseField="0"/>` +
+				`</cacheFields></pivotCacheDefinition>`,
+			"xl/pivotCache/_rels/pivotCacheDefinition1.xml.rels": `<Relationships xmlns="` + packageNS + `">` +
+				`<Relationship Id="rId1" Type="` + relTypeDir + `pivotCacheRecords" Target="pivotCacheRecords1.xml"/></Relationships>`,
+			"xl/pivotCache/pivotCacheRecords1.xml": `<pivotCacheRecords xmlns="` + mainNS + `" count="2">` +
+				`<r><x v="0"/><s v="Janvier"/><n v="120.5"/></r>` +
+				`<r><x v="1"/><m/><n v="-40"/></r>` +
+				`</pivotCacheRecords>`,
+			"xl/pivotCache/pivotCacheDefinition2.xml": `<pivotCacheDefinition xmlns="` + mainNS + `" recordCount="12" saveData="0">` +
+				`<cacheSource type="worksheet"><worksheetSource name="TableVentes"/></cacheSource>` +
+				`<cacheFields count="1"><cacheField name="Region" numFmtId="0"><sharedItems/></cacheField></cacheFields></pivotCacheDefinition>`,
+			"xl/worksheets/_rels/sheet2.xml.rels": `<Relationships xmlns="` + packageNS + `">` +
+				`<Relationship Id="rId1" Type="` + relTypeDir + `pivotTable" Target="../pivotTables/pivotTable1.xml"/>` +
+				`<Relationship Id="rId2" Type="` + relTypeDir + `pivotTable" Target="../pivotTables/pivotTable2.xml"/></Relationships>`,
+			"xl/pivotTables/pivotTable1.xml": `<pivotTableDefinition xmlns="` + mainNS + `" name="TCD1" cacheId="3" dataCaption="Valeurs">` +
+				`<location ref="A3:C10" firstHeaderRow="1" firstDataRow="2" firstDataCol="1"/>` +
+				`<rowFields count="1"><field x="0"/></rowFields><colFields count="1"><field x="-2"/></colFields>` +
+				`<pageFields count="1"><pageField fld="1" hier="-1"/></pageFields>` +
+				`<dataFields count="2"><dataField name="Somme de Montant" fld="2" baseField="0" baseItem="0"/><dataField name="Nombre de Montant" fld="2" subtotal="count" baseField="0" baseItem="0"/></dataFields>` +
+				`</pivotTableDefinition>`,
+			"xl/pivotTables/_rels/pivotTable1.xml.rels": `<Relationships xmlns="` + packageNS + `">` +
+				`<Relationship Id="rId1" Type="` + relTypeDir + `pivotCacheDefinition" Target="../pivotCache/pivotCacheDefinition1.xml"/></Relationships>`,
+			// Without its own relationship the table is matched by cacheId
+			"xl/pivotTables/pivotTable2.xml": `<pivotTableDefinition xmlns="` + mainNS + `" name="TCD2" cacheId="4">` +
+				`<location ref="E3:F5" firstHeaderRow="1" firstDataRow="1" firstDataCol="1"/>` +
+				`<rowFields count="1"><field x="7"/></rowFields></pivotTableDefinition>`,
+		},
+	}.open(t)
+
+	caches := PivotCaches(file)
+	wantInfo := []models.PivotCacheInfo{
+		{
+			ID:          3,
+			SourceType:  "worksheet",
+			Source:      "'Grand Livre'!A1:C3",
+			Fields:      []string{"Compte", "Mois", "Montant", "TVA"},
+			RecordCount: 2,
+			HasRecords:  true,
+			Relation:    "pivot_cache_3",
+		},
+		{ID: 4, SourceType: "worksheet", Source: "TableVentes", Fields: []string{"Region"}, RecordCount: 12},
+	}
+	var info []models.PivotCacheInfo
+	for _, cache := range caches {
+		info = append(info, cache.Info())
+	}
+	if !reflect.DeepEqual(info, wantInfo) {
+		t.Fatalf("PivotCaches() = %+v, want %+v", info, wantInfo)
+	}
+
+	// The calculated TVA field has no column in the records
+	headers, rows, err := PivotCacheRecords(file, caches[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantRows := [][]interface{}{{"601", "Janvier", 120.5}, {"706", nil, -40.0}}
+	if !reflect.DeepEqual(headers, []string{"Compte", "Mois", "Montant"}) || !reflect.DeepEqual(rows, wantRows) {
+		t.Errorf("PivotCacheRecords() = %v, %v; want %v", headers, rows, wantRows)
+	}
+	if _, _, err := PivotCacheRecords(file, caches[1]); err == nil {
+		t.Error("PivotCacheRecords() of a cache saved without records succeeded")
+	}
+
+	want := []models.PivotTableInfo{
+		{
+			Name:         "TCD1",
+			Location:     "A3:C10",
+			CacheID:      3,
+			SourceType:   "worksheet",
+			Source:       "'Grand Livre'!A1:C3",
+			RowFields:    []string{"Compte"},
+			ColumnFields: []string{"Values"},
+			FilterFields: []string{"Mois"},
+			ValueFields: []models.PivotValueField{
+				{Name: "Somme de Montant", Field: "Montant", Function: "sum"},
+				{Name: "Nombre de Montant", Field: "Montant", Function: "count"},
+			},
+			RecordCount: 2,
+		},
+		{
+			Name:         "TCD2",
+			Location:     "E3:F5",
+			CacheID:      4,
+			SourceType:   "worksheet",
+			Source:       "TableVentes",
+			RowFields:    []string{"7"},
+			ColumnFields: []string{},
+			ValueFields:  []models.PivotValueField{},
+			RecordCount:  12,
+		},
+	}
+	if got := PivotTables(file, "Synthese", caches); !reflect.DeepEqual(got, want) {
+		t.Errorf("PivotTables(Synthese) = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,554 @@
+package workbook
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+
+	"mcp-xlsm-server/internal/models"
+)
+
+// Ranges reported per sheet and per kind before truncating
+const maxProtectionRanges = 50
+
+const (
+	VisibilityVisible    = "visible"
+	VisibilityHidden     = "hidden"
+	VisibilityVeryHidden = "veryHidden"
+)
+
+// sheetProtection attributes that lock an action when set, with the name
+// the action is reported under. Their default is given by lockedByDefault.
+var protectionActions = []struct {
+	attr            string
+	action          string
+	lockedByDefault bool
+}{
+	{"selectLockedCells", "select_locked_cells", false},
+	{"selectUnlockedCells", "select_unlocked_cells", false},
+	{"formatCells", "format_cells", true},
+	{"formatColumns", "format_columns", true},
+	{"formatRows", "format_rows", true},
+	{"insertColumns", "insert_columns", true},
+	{"insertRows", "insert_rows", true},
+	{"insertHyperlinks", "insert_hyperlinks", true},
+	{"deleteColumns", "delete_columns", true},
+	{"deleteRows", "delete_rows", true},
+	{"sort", "sort", true},
+	{"autoFilter", "auto_filter", true},
+	{"pivotTables", "pivot_tables", true},
+	{"objects", "edit_objects", false},
+	{"scenarios", "edit_scenarios", false},
+}
+
+// Properties reads the workbook structure protection and, for each sheet
+// in tab order, its visibility, tab color and protection. Converted
+// formats only carry visibility.
+func Properties(file *excelize.File) (*models.WorkbookProtection, []models.SheetProperties, error) {
+	sheetList := file.GetSheetList()
+	if file.WorkBook == nil {
+		return nil, nil, fmt.Errorf("workbook part not found")
+	}
+
+	protection := workbookProtection(partBytes(file, "xl/workbook.xml"))
+	targets := relationshipTargets(partBytes(file, "xl/_rels/workbook.xml.rels"), "xl")
+	unlocked := unlockedStyles(partBytes(file, "xl/styles.xml"))
+
+	sheets := make([]models.SheetProperties, 0, len(sheetList))
+	for _, sheet := range file.WorkBook.Sheets.Sheet {
+		props := models.SheetProperties{Name: sheet.Name, Visibility: VisibilityVisible}
+		switch sheet.State {
+		case "hidden":
+			props.Visibility = VisibilityHidden
+		case "veryHidden":
+			props.Visibility = VisibilityVeryHidden
+		}
+		if data := partBytes(file, targets[sheet.ID]); data != nil {
+			readSheetPart(data, unlocked, &props)
+		}
+		sheets = append(sheets, props)
+	}
+	return protection, sheets, nil
+}
+
+// HiddenSheets returns the visibility of the sheets that are not visible.
+func HiddenSheets(file *excelize.File) map[string]string {
+	hidden := make(map[string]string)
+	file.GetSheetList()
+	if file.WorkBook == nil {
+		return hidden
+	}
+	for _, sheet := range file.WorkBook.Sheets.Sheet {
+		switch sheet.State {
+		case "hidden":
+			hidden[sheet.Name] = VisibilityHidden
+		case "veryHidden":
+			hidden[sheet.Name] = VisibilityVeryHidden
+		}
+	}
+	return hidden
+}
+
+// partBytes returns a package part as excelize loaded it, falling back to
+// the file on disk for parts it keeps in temporary files. Nil when the
+// part does not exist.
+func partBytes(file *excelize.File, name string) []byte {
+	rc := partReader(file, name)
+	if rc == nil {
+		return nil
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
+// partReader opens a package part like partBytes, streaming it from the
+// archive on disk instead of reading it whole. Nil when the part does not
+// exist; the caller closes it.
+func partReader(file *excelize.File, name string) io.ReadCloser {
+	if name == "" {
+		return nil
+	}
+	if content, ok := file.Pkg.Load(name); ok {
+		if data, ok := content.([]byte); ok {
+			return io.NopCloser(bytes.NewReader(data))
+		}
+	}
+	if file.Path == "" {
+		return nil
+	}
+
+	archive, err := zip.OpenReader(file.Path)
+	if err != nil {
+		return nil
+	}
+	for _, entry := range archive.File {
+		if !strings.EqualFold(entry.Name, name) {
+			continue
+		}
+		rc, err := entry.Open()
+		if err != nil {
+			break
+		}
+		return &archivePart{ReadCloser: rc, archive: archive}
+	}
+	archive.Close()
+	return nil
+}
+
+// archivePart closes the archive along with the entry read from it
+type archivePart struct {
+	io.ReadCloser
+	archive *zip.ReadCloser
+}
+
+func (p *archivePart) Close() error {
+	err := p.ReadCloser.Close()
+	if cerr := p.archive.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// VBAProject returns the vbaProject.bin part of a macro-enabled workbook,
+// decrypted workbooks included. Nil when there is none.
+func VBAProject(file *excelize.File) []byte {
+	return partBytes(file, "xl/vbaProject.bin")
+}
+
+func workbookProtection(data []byte) *models.WorkbookProtection {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		switch start.Name.Local {
+		case "workbookProtection":
+			protection := &models.WorkbookProtection{
+				LockStructure: xmlBool(attr(start, "lockStructure"), false),
+				LockWindows:   xmlBool(attr(start, "lockWindows"), false),
+				HasPassword:   attr(start, "workbookPassword") != "" || attr(start, "workbookHashValue") != "",
+			}
+			if !protection.LockStructure && !protection.LockWindows {
+				return nil
+			}
+			return protection
+		case "bookViews", "sheets":
+			// workbookProtection comes before them
+			return nil
+		}
+	}
+}
+
+// relationshipTargets maps relationship ids to part names, resolving
+// targets relative to dir.
+func relationshipTargets(data []byte, dir string) map[string]string {
+	targets := make(map[string]string)
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return targets
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != "Relationship" || attr(start, "TargetMode") == "External" {
+			continue
+		}
+		target := attr(start, "Target")
+		if strings.HasPrefix(target, "/") {
+			target = strings.TrimPrefix(target, "/")
+		} else {
+			target = path.Join(dir, target)
+		}
+		targets[attr(start, "Id")] = path.Clean(target)
+	}
+}
+
+// unlockedStyles lists the cell formats (cellXfs) whose protection
+// unlocks the cell. Cells are locked unless their format says otherwise.
+func unlockedStyles(data []byte) map[int]bool {
+	unlocked := make(map[int]bool)
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	inCellXfs := false
+	xf := -1
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return unlocked
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "cellXfs":
+				inCellXfs = true
+			case "xf":
+				if inCellXfs {
+					xf++
+				}
+			case "protection":
+				if inCellXfs && !xmlBool(attr(t, "locked"), true) {
+					unlocked[xf] = true
+				}
+			}
+		case xml.EndElement:
+			if t.Name.Local == "cellXfs" {
+				return unlocked
+			}
+		}
+	}
+}
+
+// readSheetPart fills the tab color and protection of a worksheet or
+// chartsheet part. Cells are only scanned for protected sheets.
+func readSheetPart(data []byte, unlocked map[int]bool, props *models.SheetProperties) {
+	// sheetPr and cols come before sheetData, protection after it
+	head, tail := data, []byte(nil)
+	if i := bytes.Index(data, []byte("sheetData")); i >= 0 {
+		head = data[:i]
+		if j := bytes.LastIndex(data, []byte("sheetData")); j >= 0 {
+			if k := bytes.IndexByte(data[j:], '>'); k >= 0 {
+				tail = data[j+k+1:]
+			}
+		}
+	}
+
+	unlockedCols := readSheetHead(head, unlocked, props)
+	protection := readSheetTail(tail)
+	if tail == nil {
+		// Chartsheets have no sheetData
+		protection = readSheetTail(data)
+	}
+	if protection == nil {
+		return
+	}
+
+	var columns []string
+	for _, span := range unlockedCols {
+		first, _ := excelize.ColumnNumberToName(span[0])
+		last, _ := excelize.ColumnNumberToName(span[1])
+		columns = append(columns, first+":"+last)
+	}
+
+	cells := scanCells(data, unlocked, unlockedCols)
+	protection.LockedRanges, protection.RangesTruncated = cells.locked.ranges(maxProtectionRanges)
+	unlockedRanges, truncated := cells.unlocked.ranges(maxProtectionRanges)
+	protection.UnlockedRanges = append(append(columns, cells.unlockedRows...), unlockedRanges...)
+	if len(protection.UnlockedRanges) > maxProtectionRanges {
+		protection.UnlockedRanges = protection.UnlockedRanges[:maxProtectionRanges]
+		truncated = true
+	}
+	protection.RangesTruncated = protection.RangesTruncated || truncated
+	props.Protection = protection
+}
+
+// readSheetHead reads the tab color, and returns the spans of columns
+// whose default format unlocks them.
+func readSheetHead(head []byte, unlocked map[int]bool, props *models.SheetProperties) [][2]int {
+	var columns [][2]int
+	decoder := xml.NewDecoder(bytes.NewReader(head))
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return columns
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		switch start.Name.Local {
+		case "tabColor":
+			props.TabColor = tabColor(start)
+		case "col":
+			style, err := strconv.Atoi(attr(start, "style"))
+			if err != nil || !unlocked[style] {
+				continue
+			}
+			first, err1 := strconv.Atoi(attr(start, "min"))
+			last, err2 := strconv.Atoi(attr(start, "max"))
+			if err1 != nil || err2 != nil {
+				continue
+			}
+			columns = append(columns, [2]int{first, last})
+		}
+	}
+}
+
+// tabColor gives an RGB color as #RRGGBB, otherwise the theme or indexed
+// color it refers to.
+func tabColor(element xml.StartElement) string {
+	if rgb := attr(element, "rgb"); len(rgb) == 8 {
+		return "#" + strings.ToUpper(rgb[2:])
+	} else if rgb != "" {
+		return "#" + strings.ToUpper(rgb)
+	}
+	if theme := attr(element, "theme"); theme != "" {
+		if tint := attr(element, "tint"); tint != "" {
+			return "theme:" + theme + " tint:" + tint
+		}
+		return "theme:" + theme
+	}
+	if indexed := attr(element, "indexed"); indexed != "" {
+		return "indexed:" + indexed
+	}
+	return ""
+}
+
+// readSheetTail reads sheetProtection and protectedRanges. Nil when the
+// sheet is not protected.
+func readSheetTail(tail []byte) *models.SheetProtection {
+	var protection *models.SheetProtection
+	var ranges []models.ProtectedRange
+	decoder := xml.NewDecoder(bytes.NewReader(tail))
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			break
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		switch start.Name.Local {
+		case "sheetProtection":
+			if !xmlBool(attr(start, "sheet"), false) && !xmlBool(attr(start, "content"), false) {
+				continue
+			}
+			protection = &models.SheetProtection{
+				HasPassword:    attr(start, "password") != "" || attr(start, "hashValue") != "",
+				AllowedActions: []string{},
+			}
+			for _, action := range protectionActions {
+				if !xmlBool(attr(start, action.attr), action.lockedByDefault) {
+					protection.AllowedActions = append(protection.AllowedActions, action.action)
+				}
+			}
+		case "protectedRange":
+			ranges = append(ranges, models.ProtectedRange{
+				Name:        attr(start, "name"),
+				Range:       strings.ReplaceAll(attr(start, "sqref"), " ", ","),
+				HasPassword: attr(start, "password") != "" || attr(start, "hashValue") != "",
+			})
+		}
+	}
+	if protection != nil {
+		protection.ProtectedRanges = ranges
+	}
+	return protection
+}
+
+type cellScan struct {
+	locked       cellGrid
+	unlocked     cellGrid
+	unlockedRows []string
+}
+
+// scanCells sorts the cells of sheetData by lock state: locked cells
+// holding a value or formula, and unlocked cells whether empty or not.
+// Unlocked cells of unlocked columns are already covered by the column.
+func scanCells(data []byte, unlocked map[int]bool, unlockedCols [][2]int) cellScan {
+	inUnlockedCol := func(col int) bool {
+		for _, span := range unlockedCols {
+			if col >= span[0] && col <= span[1] {
+				return true
+			}
+		}
+		return false
+	}
+
+	var scan cellScan
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	row, col := 0, 0
+	var cellStyle int
+	var cellContent, inCell bool
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return scan
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "row":
+				if r, err := strconv.Atoi(attr(t, "r")); err == nil {
+					row = r
+				} else {
+					row++
+				}
+				col = 0
+				if style, err := strconv.Atoi(attr(t, "s")); err == nil && unlocked[style] && xmlBool(attr(t, "customFormat"), false) {
+					scan.unlockedRows = append(scan.unlockedRows, fmt.Sprintf("%d:%d", row, row))
+				}
+			case "c":
+				if c, r, err := excelize.CellNameToCoordinates(attr(t, "r")); err == nil {
+					col, row = c, r
+				} else {
+					col++
+				}
+				cellStyle, _ = strconv.Atoi(attr(t, "s"))
+				cellContent, inCell = false, true
+			case "v", "f", "is":
+				if inCell {
+					cellContent = true
+				}
+			}
+		case xml.EndElement:
+			if t.Name.Local != "c" || !inCell {
+				continue
+			}
+			inCell = false
+			switch {
+			case unlocked[cellStyle]:
+				if !inUnlockedCol(col) {
+					scan.unlocked.add(row, col)
+				}
+			case cellContent:
+				scan.locked.add(row, col)
+			}
+		}
+	}
+}
+
+// cellGrid collects cells row by row, in sheet order, and merges them
+// into rectangles.
+type cellGrid struct {
+	rows []int
+	runs map[int][][2]int
+}
+
+func (g *cellGrid) add(row, col int) {
+	if g.runs == nil {
+		g.runs = make(map[int][][2]int)
+	}
+	runs := g.runs[row]
+	if len(runs) == 0 {
+		g.rows = append(g.rows, row)
+	}
+	if n := len(runs); n > 0 && runs[n-1][1] == col-1 {
+		runs[n-1][1] = col
+	} else {
+		runs = append(runs, [2]int{col, col})
+	}
+	g.runs[row] = runs
+}
+
+// ranges merges runs of columns repeated on consecutive rows into
+// rectangles, at most limit of them.
+func (g *cellGrid) ranges(limit int) ([]string, bool) {
+	type rect struct{ top, bottom, left, right int }
+	var done []rect
+	open := make(map[[2]int]*rect)
+
+	for _, row := range g.rows {
+		seen := make(map[[2]int]bool)
+		for _, run := range g.runs[row] {
+			seen[run] = true
+			if r, ok := open[run]; ok && r.bottom == row-1 {
+				r.bottom = row
+				continue
+			}
+			if r, ok := open[run]; ok {
+				done = append(done, *r)
+			}
+			open[run] = &rect{top: row, bottom: row, left: run[0], right: run[1]}
+		}
+		for run, r := range open {
+			if !seen[run] {
+				done = append(done, *r)
+				delete(open, run)
+			}
+		}
+	}
+	for _, r := range open {
+		done = append(done, *r)
+	}
+
+	sort.Slice(done, func(i, j int) bool {
+		if done[i].top != done[j].top {
+			return done[i].top < done[j].top
+		}
+		return done[i].left < done[j].left
+	})
+
+	truncated := len(done) > limit
+	if truncated {
+		done = done[:limit]
+	}
+	ranges := make([]string, len(done))
+	for i, r := range done {
+		topLeft, _ := excelize.CoordinatesToCellName(r.left, r.top)
+		bottomRight, _ := excelize.CoordinatesToCellName(r.right, r.bottom)
+		if topLeft == bottomRight {
+			ranges[i] = topLeft
+		} else {
+			ranges[i] = topLeft + ":" + bottomRight
+		}
+	}
+	return ranges, truncated
+}
+
+// xmlBool reads an xsd:boolean attribute, def when absent.
+func xmlBool(value string, def bool) bool {
+	switch value {
+	case "1", "true":
+		return true
+	case "0", "false":
+		return false
+	}
+	return def
+}
@@ -0,0 +1,196 @@
+package workbook
+
+import (
+	"archive/zip"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+
+	"mcp-xlsm-server/internal/models"
+)
+
+const (
+	mainNS     = "http://schemas.openxmlformats.org/spreadsheetml/2006/main"
+	relNS      = "http://schemas.openxmlformats.org/officeDocument/2006/relationships"
+	packageNS  = "http://schemas.openxmlformats.org/package/2006/relationships"
+	relTypeDir = "http://schemas.openxmlformats.org/officeDocument/2006/relationships/"
+)
+
+// fixture describes an OOXML package written part by part, for the
+// markup excelize cannot produce itself.
+type fixture struct {
+	// workbook and workbookEnd are inserted before and after the sheets
+	// of xl/workbook.xml, workbookRels after the relationships to them
+	workbook     string
+	workbookEnd  string
+	workbookRels string
+	sheets       []fixtureSheet
+	// parts are added as given, such as xl/styles.xml or the rels of a
+	// sheet; contentTypes are Override elements for them
+	parts        map[string]string
+	contentTypes string
+}
+
+type fixtureSheet struct {
+	name, state string
+	// body is the content of the worksheet element
+	body string
+}
+
+// open writes the package and opens it as the server would
+func (fx fixture) open(t *testing.T) *excelize.File {
+	t.Helper()
+	var sheets, rels, overrides strings.Builder
+	for i, sheet := range fx.sheets {
+		state := ""
+		if sheet.state != "" {
+			state = fmt.Sprintf(` state="%s"`, sheet.state)
+		}
+		fmt.Fprintf(&sheets, `<sheet name="%s" sheetId="%d"%s r:id="rId%d"/>`, sheet.name, i+1, state, i+1)
+		fmt.Fprintf(&rels, `<Relationship Id="rId%d" Type="%sworksheet" Target="worksheets/sheet%d.xml"/>`, i+1, relTypeDir, i+1)
+		fmt.Fprintf(&overrides, `<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`, i+1)
+	}
+	if _, ok := fx.parts["xl/styles.xml"]; ok {
+		fmt.Fprintf(&rels, `<Relationship Id="rId%d" Type="%sstyles" Target="styles.xml"/>`, len(fx.sheets)+1, relTypeDir)
+	}
+
+	parts := map[string]string{
+		"[Content_Types].xml": `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+			`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+			`<Default Extension="xml" ContentType="application/xml"/>` +
+			`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+			overrides.String() + fx.contentTypes + `</Types>`,
+		"_rels/.rels": `<Relationships xmlns="` + packageNS + `">` +
+			`<Relationship Id="rId1" Type="` + relTypeDir + `officeDocument" Target="xl/workbook.xml"/></Relationships>`,
+		"xl/workbook.xml": `<workbook xmlns="` + mainNS + `" xmlns:r="` + relNS + `">` +
+			fx.workbook + `<sheets>` + sheets.String() + `</sheets>` + fx.workbookEnd + `</workbook>`,
+		"xl/_rels/workbook.xml.rels": `<Relationships xmlns="` + packageNS + `">` + rels.String() + fx.workbookRels + `</Relationships>`,
+	}
+	for i, sheet := range fx.sheets {
+		parts[fmt.Sprintf("xl/worksheets/sheet%d.xml", i+1)] = `<worksheet xmlns="` + mainNS + `" xmlns:r="` + relNS + `">` + sheet.body + `</worksheet>`
+	}
+	for name, data := range fx.parts {
+		parts[name] = data
+	}
+
+	path := filepath.Join(t.TempDir(), "classeur.xlsx")
+	out, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	archive := zip.NewWriter(out)
+	for name, data := range parts {
+		w, err := archive.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(data))
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatal(err)
+	}
+	out.Close()
+
+	file, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { file.Close() })
+	return file
+}
+
+func TestProperties(t *testing.T) {
+	file := fixture{
+		workbook: `<workbookProtection lockStructure="1" workbookPassword="CC1A"/>`,
+		sheets: []fixtureSheet{
+			{name: "Bilan", body: `<sheetPr><tabColor rgb="FF00B050"/></sheetPr>` +
+				`<cols><col min="5" max="6" width="12" style="1" customWidth="1"/></cols>` +
+				`<sheetData>` +
+				`<row r="1"><c r="A1"><v>1</v></c><c r="B1"><f>A1*2</f><v>2</v></c><c r="C1" s="1"/></row>` +
+				`<row r="2"><c r="A2"><v>3</v></c><c r="B2"><v>4</v></c><c r="C2" s="1"><v>5</v></c><c r="D2"/></row>` +
+				`<row r="4" s="1" customFormat="1"/>` +
+				`</sheetData>` +
+				`<sheetProtection password="CC1A" sheet="1" formatCells="0" sort="0"/>` +
+				`<protectedRanges><protectedRange name="Saisie" sqref="C1:C2 E1" password="83AF"/></protectedRanges>`},
+			{name: "Calculs", state: "hidden", body: `<sheetData/>`},
+			{name: "Macros", state: "veryHidden", body: `<sheetPr><tabColor theme="4" tint="0.4"/></sheetPr><sheetData/>`},
+		},
+		parts: map[string]string{
+			"xl/styles.xml": `<styleSheet xmlns="` + mainNS + `"><cellXfs count="2">` +
+				`<xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>` +
+				`<xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0" applyProtection="1"><protection locked="0"/></xf>` +
+				`</cellXfs></styleSheet>`,
+		},
+	}.open(t)
+
+	protection, sheets, err := Properties(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantProtection := &models.WorkbookProtection{LockStructure: true, HasPassword: true}
+	if !reflect.DeepEqual(protection, wantProtection) {
+		t.Errorf("workbook protection = %+v, want %+v", protection, wantProtection)
+	}
+	want := []models.SheetProperties{
+		{
+			Name:       "Bilan",
+			Visibility: VisibilityVisible,
+			TabColor:   "#00B050",
+			Protection: &models.SheetProtection{
+				HasPassword: true,
+				// Selecting, objects and scenarios stay allowed unless
+				// locked; formatCells and sort are unlocked explicitly
+				AllowedActions: []string{"select_locked_cells", "select_unlocked_cells", "format_cells", "sort", "edit_objects", "edit_scenarios"},
+				// Empty locked cells such as D2 are left out
+				LockedRanges:   []string{"A1:B2"},
+				UnlockedRanges: []string{"E:F", "4:4", "C1:C2"},
+				ProtectedRanges: []models.ProtectedRange{
+					{Name: "Saisie", Range: "C1:C2,E1", HasPassword: true},
+				},
+			},
+		},
+		{Name: "Calculs", Visibility: VisibilityHidden},
+		{Name: "Macros", Visibility: VisibilityVeryHidden, TabColor: "theme:4 tint:0.4"},
+	}
+	if !reflect.DeepEqual(sheets, want) {
+		t.Errorf("Properties() = %+v, want %+v", sheets, want)
+	}
+
+	wantHidden := map[string]string{"Calculs": VisibilityHidden, "Macros": VisibilityVeryHidden}
+	if got := HiddenSheets(file); !reflect.DeepEqual(got, wantHidden) {
+		t.Errorf("HiddenSheets() = %v, want %v", got, wantHidden)
+	}
+}
+
+func TestProtectionRanges(t *testing.T) {
+	tests := []struct {
+		name      string
+		cells     [][2]int
+		limit     int
+		want      []string
+		truncated bool
+	}{
+		{"single cell", [][2]int{{3, 2}}, 10, []string{"B3"}, false},
+		{"rows merged into a rectangle", [][2]int{{1, 1}, {1, 2}, {2, 1}, {2, 2}}, 10, []string{"A1:B2"}, false},
+		{"gap splits the runs", [][2]int{{1, 1}, {1, 3}, {2, 1}, {2, 3}}, 10, []string{"A1:A2", "C1:C2"}, false},
+		{"skipped row ends the rectangle", [][2]int{{1, 1}, {3, 1}}, 10, []string{"A1", "A3"}, false},
+		{"limit", [][2]int{{1, 1}, {1, 3}, {1, 5}}, 2, []string{"A1", "C1"}, true},
+	}
+
+	for _, tt := range tests {
+		var grid cellGrid
+		for _, cell := range tt.cells {
+			grid.add(cell[0], cell[1])
+		}
+		got, truncated := grid.ranges(tt.limit)
+		if !reflect.DeepEqual(got, tt.want) || truncated != tt.truncated {
+			t.Errorf("%s: ranges() = %v, %v; want %v, %v", tt.name, got, truncated, tt.want, tt.truncated)
+		}
+	}
+}
@@ -0,0 +1,374 @@
+package workbook
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+
+	"mcp-xlsm-server/internal/models"
+)
+
+// Sheet roles, from what a sheet holds and how other sheets use it
+const (
+	// Assumptions users type in, often under data validation
+	RoleInput = "input"
+	// Intermediate formulas read by other sheets
+	RoleCalculation = "calculation"
+	// Output read by people: formulas over other sheets, charts, pivots
+	RoleReport = "report"
+	// Raw records, tables and pivot sources
+	RoleData = "data"
+	// Code lists and parameters read by lookups and list validations
+	RoleLookup = "lookup"
+	// Empty, unused or leftover sheets
+	RoleScratch = "scratch"
+)
+
+// Order in which an agent is best served reading the sheets of a workbook
+var roleReadingOrder = []string{RoleReport, RoleCalculation, RoleInput, RoleData, RoleLookup, RoleScratch}
+
+var (
+	// Sheet!A1 or 'Sheet name'!A1; external references ([1]Sheet!A1) are
+	// told apart by the bracket before the name
+	sheetRefPattern = regexp.MustCompile(`(^|[^\]\w.])(?:'((?:[^']|'')+)'|([^\s'!(),;:=+\-*/&<>^"\[\]{}]+))!(\$?[A-Za-z]*\$?[0-9]*(?::\$?[A-Za-z]*\$?[0-9]*)?)`)
+	namePattern     = regexp.MustCompile(`[A-Za-z_\\][\w.\\]*`)
+	lookupPattern   = regexp.MustCompile(`(?i)\b(?:_xlfn\.)?(?:VLOOKUP|HLOOKUP|XLOOKUP|LOOKUP|INDEX|MATCH|XMATCH)\(`)
+)
+
+// Words in sheet names hinting at a role, in English and French
+var roleNameHints = map[string][]string{
+	RoleInput:       {"input", "hypoth", "assumption", "saisie", "param", "settings", "réglage"},
+	RoleCalculation: {"calc", "model", "modèle", "work", "travail", "engine"},
+	RoleReport:      {"report", "rapport", "dashboard", "synth", "summary", "résumé", "tdb", "tableau de bord", "kpi", "output", "sortie", "bilan", "p&l"},
+	RoleData:        {"data", "donnée", "export", "raw", "extract", "base", "journal", "ledger", "grand livre", "import"},
+	RoleLookup:      {"list", "liste", "lookup", "ref", "mapping", "code", "correspondance", "nomenclature"},
+	RoleScratch:     {"tmp", "test", "brouillon", "scratch", "draft", "ancien", "copy", "copie", "backup"},
+}
+
+// Names Excel gives new sheets, left over when nobody renamed them
+var defaultSheetName = regexp.MustCompile(`(?i)^(sheet|feuil|feuille|tabelle|hoja|foglio|planilha)\s*\d+$`)
+
+type sheetStats struct {
+	cells     int
+	formulas  int
+	constants int
+	area      int
+	// Distinct sheets read by formulas, and those read through lookups
+	refsOut    map[string]bool
+	lookupsOut map[string]bool
+}
+
+// SheetRoles classifies every sheet of the workbook as input, calculation,
+// report, data, lookup or scratch. Each role is scored from the share of
+// formulas and constants, the references between sheets (directly, through
+// defined names and table names), lookups and list validations reading a
+// sheet, validation rules, tables, charts and pivot tables, and hints in
+// the sheet name; Confidence shrinks when a second role scores close.
+func SheetRoles(file *excelize.File) map[string]models.SheetRole {
+	sheetList := file.GetSheetList()
+	sheetNames := make(map[string]string, len(sheetList))
+	for _, sheet := range sheetList {
+		sheetNames[strings.ToLower(sheet)] = sheet
+	}
+
+	// Names and tables standing for a range of a sheet
+	names := make(map[string]string)
+	for _, name := range file.GetDefinedName() {
+		for _, sheet := range referencedSheets(name.RefersTo, sheetNames) {
+			names[strings.ToLower(name.Name)] = sheet
+		}
+	}
+	tableCount := make(map[string]int)
+	for _, sheet := range sheetList {
+		tables, _ := file.GetTables(sheet)
+		for _, table := range tables {
+			names[strings.ToLower(table.Name)] = sheet
+			tableCount[sheet]++
+		}
+	}
+
+	// Sheets pivot caches were built from
+	pivotSources := make(map[string]bool)
+	caches := PivotCaches(file)
+	for _, cache := range caches {
+		for _, sheet := range referencedSheets(cache.Source, sheetNames) {
+			pivotSources[sheet] = true
+		}
+		if sheet, ok := names[strings.ToLower(cache.Source)]; ok {
+			pivotSources[sheet] = true
+		}
+	}
+
+	stats := make(map[string]*sheetStats, len(sheetList))
+	validations := make(map[string][]models.DataValidationRule, len(sheetList))
+	for _, sheet := range sheetList {
+		stats[sheet] = scanSheetStats(file, sheet, sheetNames, names)
+		validations[sheet], _, _ = SheetRules(file, sheet)
+	}
+
+	// List validations read their allowed values from lookup sheets
+	for sheet, rules := range validations {
+		for _, rule := range rules {
+			if rule.Type != "list" {
+				continue
+			}
+			for _, target := range referencedSheets(rule.Source, sheetNames) {
+				stats[sheet].lookupsOut[target] = true
+			}
+			if target, ok := names[strings.ToLower(rule.Source)]; ok {
+				stats[sheet].lookupsOut[target] = true
+			}
+		}
+	}
+
+	refsIn := make(map[string][]string)
+	lookupsIn := make(map[string]int)
+	for _, sheet := range sheetList {
+		for target := range stats[sheet].refsOut {
+			refsIn[target] = append(refsIn[target], sheet)
+		}
+		for target := range stats[sheet].lookupsOut {
+			if target != sheet {
+				lookupsIn[target]++
+			}
+		}
+	}
+
+	roles := make(map[string]models.SheetRole, len(sheetList))
+	for _, sheet := range sheetList {
+		s := stats[sheet]
+		scores := make(map[string]float64)
+		signals := make(map[string][]string)
+		add := func(role string, score float64, signal string) {
+			scores[role] += score
+			signals[role] = append(signals[role], signal)
+		}
+
+		inbound, outbound := len(refsIn[sheet]), len(s.refsOut)
+		charts := len(Charts(file, sheet))
+		pivots := len(PivotTables(file, sheet, caches))
+		formulaShare, constantShare := 0.0, 0.0
+		if s.cells > 0 {
+			formulaShare = float64(s.formulas) / float64(s.cells)
+			constantShare = float64(s.constants) / float64(s.cells)
+		}
+
+		if s.cells == 0 && charts == 0 && pivots == 0 {
+			add(RoleScratch, 1, "empty")
+		} else if s.cells < 20 && inbound == 0 && outbound == 0 && charts == 0 && pivots == 0 {
+			add(RoleScratch, 0.6, fmt.Sprintf("%d cells, not linked to other sheets", s.cells))
+		}
+		if defaultSheetName.MatchString(sheet) && inbound == 0 {
+			add(RoleScratch, 0.2, "default sheet name")
+		}
+
+		if lookupsIn[sheet] > 0 {
+			add(RoleLookup, 0.5+math.Min(0.1*float64(lookupsIn[sheet]), 0.3), fmt.Sprintf("read by lookups or list validations of %d sheets", lookupsIn[sheet]))
+			if formulaShare < 0.2 {
+				add(RoleLookup, 0.1, "few formulas")
+			}
+		}
+
+		if len(validations[sheet]) > 0 {
+			add(RoleInput, 0.4, fmt.Sprintf("%d data validation rules", len(validations[sheet])))
+		}
+		if s.cells > 0 && s.cells < 2000 && constantShare > 0.3 && formulaShare < 0.5 && inbound > 0 {
+			add(RoleInput, 0.3, fmt.Sprintf("%.0f%% constants read by %d sheets", constantShare*100, inbound))
+		}
+
+		if s.formulas > 0 && formulaShare >= 0.3 {
+			add(RoleCalculation, 0.5*formulaShare, fmt.Sprintf("%.0f%% formulas", formulaShare*100))
+			if inbound > 0 {
+				add(RoleCalculation, 0.3, fmt.Sprintf("referenced by %d sheets", inbound))
+			}
+			if outbound > 0 {
+				add(RoleCalculation, 0.1, fmt.Sprintf("reads %d sheets", outbound))
+			}
+		}
+
+		if outbound > 0 && inbound == 0 && s.formulas > 0 {
+			add(RoleReport, 0.4, fmt.Sprintf("reads %d sheets, read by none", outbound))
+		}
+		if charts > 0 {
+			add(RoleReport, 0.3, fmt.Sprintf("%d charts", charts))
+		}
+		if pivots > 0 {
+			add(RoleReport, 0.3, fmt.Sprintf("%d pivot tables", pivots))
+		}
+
+		if s.cells >= 200 && formulaShare < 0.1 {
+			add(RoleData, 0.4, fmt.Sprintf("%d cells, %.0f%% formulas", s.cells, formulaShare*100))
+			if s.area > 0 && float64(s.cells)/float64(s.area) > 0.6 {
+				add(RoleData, 0.15, "dense")
+			}
+		}
+		if tableCount[sheet] > 0 && formulaShare < 0.3 {
+			add(RoleData, 0.2, fmt.Sprintf("%d Excel tables", tableCount[sheet]))
+		}
+		if pivotSources[sheet] {
+			add(RoleData, 0.4, "source of a pivot table")
+		}
+
+		lower := strings.ToLower(sheet)
+		for role, hints := range roleNameHints {
+			for _, hint := range hints {
+				if strings.Contains(lower, hint) {
+					add(role, 0.2, "name suggests "+role)
+					break
+				}
+			}
+		}
+
+		role := models.SheetRole{Role: RoleScratch, Signals: []string{}}
+		best, second := 0.0, 0.0
+		for _, candidate := range roleReadingOrder {
+			switch score := scores[candidate]; {
+			case score > best:
+				best, second = score, best
+				role.Role = candidate
+			case score > second:
+				second = score
+			}
+		}
+		if best > 0 {
+			role.Confidence = math.Round(math.Min(best, 1)*(0.5+0.5*(best-second)/best)*100) / 100
+			role.Signals = signals[role.Role]
+		}
+		for target := range s.refsOut {
+			role.References = append(role.References, target)
+		}
+		sort.Strings(role.References)
+		role.ReferencedBy = refsIn[sheet]
+		sort.Strings(role.ReferencedBy)
+		roles[sheet] = role
+	}
+	return roles
+}
+
+// ReadingOrder lists the sheets by role, reports first, and by confidence
+// within a role, so agents start with what the workbook is for.
+func ReadingOrder(sheetList []string, roles map[string]models.SheetRole) []string {
+	rank := make(map[string]int, len(roleReadingOrder))
+	for i, role := range roleReadingOrder {
+		rank[role] = i
+	}
+	order := append([]string(nil), sheetList...)
+	sort.SliceStable(order, func(i, j int) bool {
+		ri, rj := roles[order[i]], roles[order[j]]
+		if rank[ri.Role] != rank[rj.Role] {
+			return rank[ri.Role] < rank[rj.Role]
+		}
+		return ri.Confidence > rj.Confidence
+	})
+	return order
+}
+
+// scanSheetStats counts the cells of a sheet part by kind and collects
+// the sheets its formulas read.
+func scanSheetStats(file *excelize.File, sheet string, sheetNames, names map[string]string) *sheetStats {
+	s := &sheetStats{refsOut: make(map[string]bool), lookupsOut: make(map[string]bool)}
+	// Opening a row iterator writes a sheet loaded in memory, such as a
+	// converted workbook's, back to its part
+	if rows, err := file.Rows(sheet); err == nil {
+		rows.Close()
+	}
+	data := partBytes(file, sheetPartPath(file, sheet))
+	if data == nil {
+		return s
+	}
+
+	maxCol, maxRow := 0, 0
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			break
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != "c" {
+			continue
+		}
+		var cell struct {
+			T  string    `xml:"t,attr"`
+			F  *string   `xml:"f"`
+			V  string    `xml:"v"`
+			Is *struct{} `xml:"is"`
+		}
+		if err := decoder.DecodeElement(&cell, &start); err != nil {
+			break
+		}
+		if cell.F == nil && cell.V == "" && cell.Is == nil {
+			// Formatted but empty
+			continue
+		}
+
+		s.cells++
+		if col, row, err := excelize.CellNameToCoordinates(attr(start, "r")); err == nil {
+			maxCol, maxRow = max(maxCol, col), max(maxRow, row)
+		}
+		switch {
+		case cell.F != nil:
+			s.formulas++
+			formula := *cell.F
+			var named []string
+			for _, token := range namePattern.FindAllString(stringLiteral.ReplaceAllString(formula, `""`), -1) {
+				if target, ok := names[strings.ToLower(token)]; ok {
+					named = append(named, target)
+				}
+			}
+			for _, target := range append(referencedSheets(formula, sheetNames), named...) {
+				if target != sheet {
+					s.refsOut[target] = true
+				}
+			}
+			if lookupPattern.MatchString(formula) {
+				// Names and tables in a lookup are mostly the searched table
+				for _, target := range append(sheetReferences(formula, sheetNames, true), named...) {
+					s.lookupsOut[target] = true
+				}
+			}
+		case cell.T != "s" && cell.T != "str" && cell.T != "inlineStr":
+			// Numbers, dates and booleans typed in
+			s.constants++
+		}
+	}
+	s.area = maxCol * maxRow
+	return s
+}
+
+// referencedSheets returns the sheets of the workbook a formula or range
+// refers to, ignoring external workbooks and text in string literals.
+func referencedSheets(formula string, sheetNames map[string]string) []string {
+	return sheetReferences(formula, sheetNames, false)
+}
+
+// sheetReferences returns the sheets a formula refers to, only through
+// multi-cell ranges when rangesOnly is set: the table a lookup searches,
+// not the single value it looks up.
+func sheetReferences(formula string, sheetNames map[string]string, rangesOnly bool) []string {
+	if !strings.Contains(formula, "!") {
+		return nil
+	}
+	formula = stringLiteral.ReplaceAllString(formula, `""`)
+
+	var sheets []string
+	for _, match := range sheetRefPattern.FindAllStringSubmatch(formula, -1) {
+		if rangesOnly && !strings.Contains(match[4], ":") {
+			continue
+		}
+		name := match[3]
+		if match[2] != "" {
+			name = strings.ReplaceAll(match[2], "''", "'")
+		}
+		if sheet, ok := sheetNames[strings.ToLower(name)]; ok {
+			sheets = append(sheets, sheet)
+		}
+	}
+	return sheets
+}
@@ -0,0 +1,146 @@
+package workbook
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+
+	"mcp-xlsm-server/internal/models"
+)
+
+func TestSheetRoles(t *testing.T) {
+	f := excelize.NewFile()
+	f.SetSheetName("Sheet1", "Hypotheses")
+	for _, sheet := range []string{"Codes", "Calcul", "Synthese", "Journal", "Feuil6"} {
+		f.NewSheet(sheet)
+	}
+	cells := []struct {
+		sheet, cell string
+		value       interface{}
+		formula     string
+	}{
+		{"Hypotheses", "A1", "Taux", ""},
+		{"Hypotheses", "B1", 0.2, ""},
+		{"Hypotheses", "A2", "Base", ""},
+		{"Hypotheses", "B2", 1000, ""},
+		{"Hypotheses", "A3", "Mois", ""},
+		{"Hypotheses", "B3", 12, ""},
+		{"Codes", "A1", "TVA", ""},
+		{"Codes", "B1", 0.2, ""},
+		{"Codes", "A2", "RED", ""},
+		{"Codes", "B2", 0.055, ""},
+		{"Codes", "A3", "EXO", ""},
+		{"Codes", "B3", 0, ""},
+		{"Calcul", "A1", "TVA", ""},
+		{"Calcul", "A2", "Total", ""},
+		{"Calcul", "B1", nil, "VLOOKUP(A1,Codes!$A$1:$B$3,2,FALSE)"},
+		{"Calcul", "B2", nil, "Hypotheses!B2*(1+B1)"},
+		{"Calcul", "B3", nil, "B2*Hypotheses!B3"},
+		{"Synthese", "A1", "Total", ""},
+		{"Synthese", "B1", nil, "Calcul!B3"},
+		{"Synthese", "B2", nil, "Calcul!B2-Calcul!B3"},
+	}
+	for _, c := range cells {
+		if c.formula != "" {
+			f.SetCellFormula(c.sheet, c.cell, c.formula)
+		} else {
+			f.SetCellValue(c.sheet, c.cell, c.value)
+		}
+	}
+	for row := 1; row <= 100; row++ {
+		cell, _ := excelize.CoordinatesToCellName(1, row)
+		f.SetSheetRow("Journal", cell, &[]interface{}{row, 601000 + row, float64(row) * 10.5})
+	}
+	dv := excelize.NewDataValidation(true)
+	dv.Sqref = "B1:B3"
+	if err := dv.SetRange(0, 100000, excelize.DataValidationTypeDecimal, excelize.DataValidationOperatorBetween); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.AddDataValidation("Hypotheses", dv); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "budget.xlsx")
+	if err := f.SaveAs(path); err != nil {
+		t.Fatal(err)
+	}
+	file, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	roles := SheetRoles(file)
+	want := map[string]models.SheetRole{
+		"Hypotheses": {
+			Role:         RoleInput,
+			Confidence:   0.9,
+			Signals:      []string{"1 data validation rules", "50% constants read by 1 sheets", "name suggests input"},
+			ReferencedBy: []string{"Calcul"},
+		},
+		// The constants read by Calcul also look like an input (0.3)
+		"Codes": {
+			Role:         RoleLookup,
+			Confidence:   0.75,
+			Signals:      []string{"read by lookups or list validations of 1 sheets", "few formulas", "name suggests lookup"},
+			ReferencedBy: []string{"Calcul"},
+		},
+		"Calcul": {
+			Role:         RoleCalculation,
+			Confidence:   0.9,
+			Signals:      []string{"60% formulas", "referenced by 1 sheets", "reads 2 sheets", "name suggests calculation"},
+			References:   []string{"Codes", "Hypotheses"},
+			ReferencedBy: []string{"Synthese"},
+		},
+		// Its formulas also score as a calculation (0.43)
+		"Synthese": {
+			Role:       RoleReport,
+			Confidence: 0.38,
+			Signals:    []string{"reads 1 sheets, read by none", "name suggests report"},
+			References: []string{"Calcul"},
+		},
+		"Journal": {
+			Role:       RoleData,
+			Confidence: 0.75,
+			Signals:    []string{"300 cells, 0% formulas", "dense", "name suggests data"},
+		},
+		"Feuil6": {
+			Role:       RoleScratch,
+			Confidence: 1,
+			Signals:    []string{"empty", "default sheet name"},
+		},
+	}
+	for sheet, wantRole := range want {
+		if got := roles[sheet]; !reflect.DeepEqual(got, wantRole) {
+			t.Errorf("role of %s = %+v, want %+v", sheet, got, wantRole)
+		}
+	}
+
+	wantOrder := []string{"Synthese", "Calcul", "Hypotheses", "Journal", "Codes", "Feuil6"}
+	if got := ReadingOrder(file.GetSheetList(), roles); !reflect.DeepEqual(got, wantOrder) {
+		t.Errorf("ReadingOrder() = %v, want %v", got, wantOrder)
+	}
+}
+
+func TestSheetReferences(t *testing.T) {
+	sheetNames := map[string]string{"bilan": "Bilan", "grand livre": "Grand Livre", "l'an": "l'an"}
+	tests := []struct {
+		formula    string
+		rangesOnly bool
+		want       []string
+	}{
+		{"Bilan!A1+'Grand Livre'!B2:B9", false, []string{"Bilan", "Grand Livre"}},
+		{"Bilan!A1+'Grand Livre'!B2:B9", true, []string{"Grand Livre"}},
+		{"'l''an'!A1*2", false, []string{"l'an"}},
+		// External workbooks, unknown sheets and text are ignored
+		{"[1]Bilan!A1+Autre!A1", false, nil},
+		{`"Bilan!A1"&A1`, false, nil},
+	}
+
+	for _, tt := range tests {
+		if got := sheetReferences(tt.formula, sheetNames, tt.rangesOnly); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("sheetReferences(%q, %v) = %v, want %v", tt.formula, tt.rangesOnly, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package workbook
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+
+	"mcp-xlsm-server/internal/models"
+)
+
+// Rule elements as stored in a worksheet part, main and x14 extension
+// forms alike. Extension rules keep their formulas and ranges in xm:f and
+// xm:sqref children instead of attributes.
+type rawFormula struct {
+	Text string `xml:",chardata"`
+	F    string `xml:"f"`
+}
+
+func (f rawFormula) value() string {
+	if f.F != "" {
+		return strings.TrimSpace(f.F)
+	}
+	return strings.TrimSpace(f.Text)
+}
+
+type rawValidation struct {
+	Type       string     `xml:"type,attr"`
+	Operator   string     `xml:"operator,attr"`
+	Sqref      string     `xml:"sqref,attr"`
+	AllowBlank bool       `xml:"allowBlank,attr"`
+	Prompt     string     `xml:"prompt,attr"`
+	Formula1   rawFormula `xml:"formula1"`
+	Formula2   rawFormula `xml:"formula2"`
+	SqrefElem  string     `xml:"sqref"`
+}
+
+type rawConditionalFormatting struct {
+	Sqref     string      `xml:"sqref,attr"`
+	SqrefElem string      `xml:"sqref"`
+	Rules     []rawCfRule `xml:"cfRule"`
+}
+
+type rawCfRule struct {
+	Type       string   `xml:"type,attr"`
+	Operator   string   `xml:"operator,attr"`
+	Priority   int      `xml:"priority,attr"`
+	StopIfTrue bool     `xml:"stopIfTrue,attr"`
+	Text       string   `xml:"text,attr"`
+	ID         string   `xml:"id,attr"`
+	Formulas   []string `xml:"formula"`
+	F          []string `xml:"f"`
+	ExtID      string   `xml:"extLst>ext>id"`
+}
+
+// SheetRules reads the data validation and conditional formatting rules
+// of a worksheet, including those Excel 2010 and later keep in the
+// worksheet extension list (list sources on other sheets, data bars).
+// Identical rules applied to several ranges are reported once.
+func SheetRules(file *excelize.File, sheet string) ([]models.DataValidationRule, []models.ConditionalFormatRule, error) {
+	sheetPart := sheetPartPath(file, sheet)
+	if sheetPart == "" {
+		if idx, err := file.GetSheetIndex(sheet); err != nil || idx < 0 {
+			return nil, nil, excelize.ErrSheetNotExist{SheetName: sheet}
+		}
+		return nil, nil, nil
+	}
+	data := partBytes(file, sheetPart)
+	// Both follow sheetData
+	if i := bytes.LastIndex(data, []byte("sheetData")); i >= 0 {
+		data = data[i:]
+	}
+	if !bytes.Contains(data, []byte("dataValidation")) && !bytes.Contains(data, []byte("conditionalFormatting")) {
+		return nil, nil, nil
+	}
+
+	var validations []models.DataValidationRule
+	var formats []models.ConditionalFormatRule
+	extended := make(map[string]bool)
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			break
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		switch start.Name.Local {
+		case "dataValidation":
+			var raw rawValidation
+			if err := decoder.DecodeElement(&raw, &start); err != nil {
+				return validations, formats, nil
+			}
+			validations = addValidation(validations, validationRule(raw))
+		case "conditionalFormatting":
+			var raw rawConditionalFormatting
+			if err := decoder.DecodeElement(&raw, &start); err != nil {
+				return validations, formats, nil
+			}
+			ranges := strings.Fields(raw.Sqref + " " + raw.SqrefElem)
+			for _, rule := range raw.Rules {
+				// Extension rules completing a main rule (data bar
+				// colors) are not rules of their own
+				if rule.ExtID != "" {
+					extended[rule.ExtID] = true
+				}
+				if rule.ID != "" && extended[rule.ID] {
+					continue
+				}
+				formats = addFormat(formats, formatRule(rule, ranges))
+			}
+		}
+	}
+	return validations, formats, nil
+}
+
+// InputZones lists the ranges restricted by data validation, which mark
+// the cells users are expected to fill in.
+func InputZones(validations []models.DataValidationRule) []string {
+	var zones []string
+	seen := make(map[string]bool)
+	for _, rule := range validations {
+		for _, ref := range rule.Ranges {
+			if !seen[ref] {
+				seen[ref] = true
+				zones = append(zones, ref)
+			}
+		}
+	}
+	return zones
+}
+
+func validationRule(raw rawValidation) models.DataValidationRule {
+	rule := models.DataValidationRule{
+		Ranges:     strings.Fields(raw.Sqref + " " + raw.SqrefElem),
+		Type:       raw.Type,
+		Operator:   raw.Operator,
+		AllowBlank: raw.AllowBlank,
+		Prompt:     raw.Prompt,
+	}
+	if rule.Type == "" {
+		rule.Type = "none"
+	}
+	formula1, formula2 := raw.Formula1.value(), raw.Formula2.value()
+	if rule.Type == "list" {
+		// An inline list is a quoted string, otherwise a range or name
+		if len(formula1) >= 2 && strings.HasPrefix(formula1, `"`) && strings.HasSuffix(formula1, `"`) {
+			formula1 = strings.ReplaceAll(formula1[1:len(formula1)-1], `""`, `"`)
+		}
+		rule.Source = formula1
+		return rule
+	}
+	rule.Formula1, rule.Formula2 = formula1, formula2
+	return rule
+}
+
+func formatRule(raw rawCfRule, ranges []string) models.ConditionalFormatRule {
+	rule := models.ConditionalFormatRule{
+		Ranges:     ranges,
+		Type:       raw.Type,
+		Operator:   raw.Operator,
+		Text:       raw.Text,
+		Priority:   raw.Priority,
+		StopIfTrue: raw.StopIfTrue,
+	}
+	for _, formula := range append(raw.Formulas, raw.F...) {
+		if formula = strings.TrimSpace(formula); formula != "" {
+			rule.Formulas = append(rule.Formulas, formula)
+		}
+	}
+	return rule
+}
+
+// addValidation appends a rule, or its ranges to an identical rule.
+func addValidation(rules []models.DataValidationRule, rule models.DataValidationRule) []models.DataValidationRule {
+	for i, existing := range rules {
+		existing.Ranges = rule.Ranges
+		if sameValidation(existing, rule) {
+			rules[i].Ranges = append(rules[i].Ranges, rule.Ranges...)
+			return rules
+		}
+	}
+	return append(rules, rule)
+}
+
+func sameValidation(a, b models.DataValidationRule) bool {
+	return a.Type == b.Type && a.Operator == b.Operator && a.Source == b.Source &&
+		a.Formula1 == b.Formula1 && a.Formula2 == b.Formula2 &&
+		a.AllowBlank == b.AllowBlank && a.Prompt == b.Prompt
+}
+
+// addFormat appends a rule, or its ranges to an identical rule.
+func addFormat(rules []models.ConditionalFormatRule, rule models.ConditionalFormatRule) []models.ConditionalFormatRule {
+	for i, existing := range rules {
+		if existing.Type == rule.Type && existing.Operator == rule.Operator && existing.Text == rule.Text &&
+			strings.Join(existing.Formulas, "\x00") == strings.Join(rule.Formulas, "\x00") {
+			rules[i].Ranges = append(rules[i].Ranges, rule.Ranges...)
+			return rules
+		}
+	}
+	return append(rules, rule)
+}
@@ -0,0 +1,83 @@
+package workbook
+
+import (
+	"reflect"
+	"testing"
+
+	"mcp-xlsm-server/internal/models"
+)
+
+func TestSheetRules(t *testing.T) {
+	file := fixture{sheets: []fixtureSheet{
+		{name: "Saisie", body: `<sheetData/>` +
+			`<conditionalFormatting sqref="B2:B10 D2:D10">` +
+			`<cfRule type="cellIs" dxfId="0" priority="2" operator="lessThan"><formula>0</formula></cfRule>` +
+			`<cfRule type="dataBar" priority="3"><dataBar><cfvo type="min"/><cfvo type="max"/><color rgb="FF638EC6"/></dataBar>` +
+			`<extLst><ext uri="{B025F937-C7B1-47D3-B67F-A62EFF666E3E}" xmlns:x14="http://schemas.microsoft.com/office/spreadsheetml/2009/9/main"><x14:id>{DB1}</x14:id></ext></extLst></cfRule>` +
+			`</conditionalFormatting>` +
+			`<conditionalFormatting sqref="F2:F10"><cfRule type="cellIs" dxfId="0" priority="4" operator="lessThan"><formula>0</formula></cfRule></conditionalFormatting>` +
+			`<conditionalFormatting sqref="A2:A10"><cfRule type="containsText" dxfId="1" priority="1" stopIfTrue="1" operator="containsText" text="Total">` +
+			`<formula>NOT(ISERROR(SEARCH("Total",A2)))</formula></cfRule></conditionalFormatting>` +
+			`<dataValidations count="3">` +
+			`<dataValidation type="list" allowBlank="1" showInputMessage="1" prompt="Choisir" sqref="C2:C10"><formula1>"Oui,""Non"""</formula1></dataValidation>` +
+			`<dataValidation type="decimal" operator="between" sqref="E2:E10"><formula1>0</formula1><formula2>100</formula2></dataValidation>` +
+			`<dataValidation type="list" allowBlank="1" showInputMessage="1" prompt="Choisir" sqref="G2"><formula1>"Oui,""Non"""</formula1></dataValidation>` +
+			`</dataValidations>` +
+			`<extLst>` +
+			`<ext uri="{78C0D931-6437-407d-A8EE-F0AAD7539E65}" xmlns:x14="http://schemas.microsoft.com/office/spreadsheetml/2009/9/main">` +
+			`<x14:conditionalFormattings><x14:conditionalFormatting xmlns:xm="http://schemas.microsoft.com/office/excel/2006/main">` +
+			`<x14:cfRule type="dataBar" id="{DB1}"><x14:dataBar minLength="0" maxLength="100"/></x14:cfRule><xm:sqref>B2:B10 D2:D10</xm:sqref>` +
+			`</x14:conditionalFormatting></x14:conditionalFormattings></ext>` +
+			`<ext uri="{CCE6A557-97BC-4b89-ADB6-D9C93CAAB3DF}" xmlns:x14="http://schemas.microsoft.com/office/spreadsheetml/2009/9/main">` +
+			`<x14:dataValidations count="1" xmlns:xm="http://schemas.microsoft.com/office/excel/2006/main">` +
+			`<x14:dataValidation type="list" allowBlank="1"><x14:formula1><xm:f>Listes!$A$1:$A$5</xm:f></x14:formula1><xm:sqref>H2:H10</xm:sqref></x14:dataValidation>` +
+			`</x14:dataValidations></ext>` +
+			`</extLst>`},
+		{name: "Listes", body: `<sheetData><row r="1"><c r="A1"><v>1</v></c></row></sheetData>`},
+	}}.open(t)
+
+	validations, formats, err := SheetRules(file, "Saisie")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantValidations := []models.DataValidationRule{
+		// Identical rules are reported once with both ranges
+		{Ranges: []string{"C2:C10", "G2"}, Type: "list", Source: `Oui,"Non"`, AllowBlank: true, Prompt: "Choisir"},
+		{Ranges: []string{"E2:E10"}, Type: "decimal", Operator: "between", Formula1: "0", Formula2: "100"},
+		// List sources on other sheets live in the extension list
+		{Ranges: []string{"H2:H10"}, Type: "list", Source: "Listes!$A$1:$A$5", AllowBlank: true},
+	}
+	if !reflect.DeepEqual(validations, wantValidations) {
+		t.Errorf("validations = %+v, want %+v", validations, wantValidations)
+	}
+	wantFormats := []models.ConditionalFormatRule{
+		{Ranges: []string{"B2:B10", "D2:D10", "F2:F10"}, Type: "cellIs", Operator: "lessThan", Formulas: []string{"0"}, Priority: 2},
+		// The extension rule completing the data bar is not listed
+		{Ranges: []string{"B2:B10", "D2:D10"}, Type: "dataBar", Priority: 3},
+		{
+			Ranges:     []string{"A2:A10"},
+			Type:       "containsText",
+			Operator:   "containsText",
+			Formulas:   []string{`NOT(ISERROR(SEARCH("Total",A2)))`},
+			Text:       "Total",
+			Priority:   1,
+			StopIfTrue: true,
+		},
+	}
+	if !reflect.DeepEqual(formats, wantFormats) {
+		t.Errorf("formats = %+v, want %+v", formats, wantFormats)
+	}
+
+	wantZones := []string{"C2:C10", "G2", "E2:E10", "H2:H10"}
+	if got := InputZones(validations); !reflect.DeepEqual(got, wantZones) {
+		t.Errorf("InputZones() = %v, want %v", got, wantZones)
+	}
+
+	validations, formats, err = SheetRules(file, "Listes")
+	if err != nil || validations != nil || formats != nil {
+		t.Errorf("SheetRules(Listes) = %v, %v, %v; want no rules", validations, formats, err)
+	}
+	if _, _, err := SheetRules(file, "Absente"); err == nil {
+		t.Error("SheetRules(Absente) succeeded, want a missing sheet error")
+	}
+}
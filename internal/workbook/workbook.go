@@ -0,0 +1,302 @@
+package workbook
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// Format is the on-disk format of a workbook.
+type Format string
+
+const (
+	FormatXLSX Format = "xlsx"
+	FormatXLSM Format = "xlsm"
+	FormatXLTX Format = "xltx"
+	FormatXLTM Format = "xltm"
+	FormatCSV  Format = "csv"
+	FormatTSV  Format = "tsv"
+	FormatODS  Format = "ods"
+	FormatXLS  Format = "xls"
+)
+
+// IsOOXML reports whether excelize reads and writes the format natively.
+// Other formats are converted on open and cannot be saved back.
+func (f Format) IsOOXML() bool {
+	switch f {
+	case FormatXLSX, FormatXLSM, FormatXLTX, FormatXLTM:
+		return true
+	}
+	return false
+}
+
+// Reader loads one format into an in-memory excelize workbook, so that
+// navigation, indexing and queries work the same whatever the format on
+// disk.
+type Reader interface {
+	Open(path string) (*excelize.File, error)
+}
+
+// ReaderFunc adapts a function to Reader.
+type ReaderFunc func(path string) (*excelize.File, error)
+
+func (fn ReaderFunc) Open(path string) (*excelize.File, error) {
+	return fn(path)
+}
+
+var (
+	readersMu sync.RWMutex
+	readers   = map[Format]Reader{}
+)
+
+// Register makes a reader available for a format, replacing any previous
+// one.
+func Register(format Format, reader Reader) {
+	readersMu.Lock()
+	defer readersMu.Unlock()
+	readers[format] = reader
+}
+
+func init() {
+	ooxml := ReaderFunc(func(path string) (*excelize.File, error) {
+		return excelize.OpenFile(path)
+	})
+	for _, format := range []Format{FormatXLSX, FormatXLSM, FormatXLTX, FormatXLTM} {
+		Register(format, ooxml)
+	}
+	Register(FormatCSV, ReaderFunc(openCSV))
+	Register(FormatTSV, ReaderFunc(openCSV))
+	Register(FormatODS, ReaderFunc(openODS))
+	Register(FormatXLS, ReaderFunc(openXLS))
+}
+
+// Options are the per-call settings of Open.
+type Options struct {
+	// Password decrypts an encrypted workbook. When empty, the one of the
+	// passwords file is tried.
+	Password string
+}
+
+// Open detects the format of path and loads it with the matching reader.
+// Encrypted workbooks fail with an *EncryptedError when no valid password
+// is available.
+func Open(path string, opts ...Options) (*excelize.File, error) {
+	var options Options
+	if len(opts) > 0 {
+		options = opts[0]
+	}
+
+	format, err := Detect(path)
+	if err != nil {
+		return nil, err
+	}
+
+	encryption, err := DetectEncryption(path)
+	if err != nil {
+		return nil, err
+	}
+	if encryption != EncryptionNone {
+		return openEncrypted(path, encryption, options.Password)
+	}
+
+	readersMu.RLock()
+	reader, ok := readers[format]
+	readersMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("no reader for %s workbooks", format)
+	}
+
+	file, err := reader.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s workbook: %w", format, err)
+	}
+	return file, nil
+}
+
+var (
+	zipMagic = []byte("PK\x03\x04")
+	oleMagic = []byte{0xd0, 0xcf, 0x11, 0xe0, 0xa1, 0xb1, 0x1a, 0xe1}
+)
+
+// Detect identifies the format from the file content, using the extension
+// only to tell OOXML variants and delimited text apart.
+func Detect(path string) (Format, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	header := make([]byte, 8)
+	n, err := io.ReadFull(f, header)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", err
+	}
+	header = header[:n]
+	ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(path), "."))
+
+	switch {
+	case bytes.HasPrefix(header, zipMagic):
+		if isODS(path) {
+			return FormatODS, nil
+		}
+		return ooxmlFormat(ext), nil
+
+	case bytes.HasPrefix(header, oleMagic):
+		// Encrypted OOXML packages are compound files too
+		if encryption, _ := DetectEncryption(path); encryption != EncryptionNone && !encryption.isXLS() {
+			return ooxmlFormat(ext), nil
+		}
+		return FormatXLS, nil
+	}
+
+	switch Format(ext) {
+	case FormatCSV, FormatTSV:
+		return Format(ext), nil
+	case FormatXLSX, FormatXLSM, FormatXLTX, FormatXLTM, FormatODS, FormatXLS:
+		return "", fmt.Errorf("%s is not a valid .%s workbook", filepath.Base(path), ext)
+	}
+	// Anything else is read as delimited text, as spreadsheet applications
+	// do with .txt drops
+	return FormatCSV, nil
+}
+
+// ooxmlFormat tells OOXML variants apart by extension, as they share the
+// same package layout.
+func ooxmlFormat(ext string) Format {
+	switch Format(ext) {
+	case FormatXLSM, FormatXLTX, FormatXLTM:
+		return Format(ext)
+	}
+	return FormatXLSX
+}
+
+// isODS checks the mimetype entry OpenDocument packages start with.
+func isODS(path string) bool {
+	archive, err := zip.OpenReader(path)
+	if err != nil {
+		return false
+	}
+	defer archive.Close()
+
+	for _, entry := range archive.File {
+		if entry.Name != "mimetype" {
+			continue
+		}
+		rc, err := entry.Open()
+		if err != nil {
+			return false
+		}
+		defer rc.Close()
+		mimetype, _ := io.ReadAll(io.LimitReader(rc, 128))
+		return strings.TrimSpace(string(mimetype)) == "application/vnd.oasis.opendocument.spreadsheet"
+	}
+	return false
+}
+
+// formulaCell is a converted cell with both its formula and the value the
+// source application last computed for it.
+type formulaCell struct {
+	formula string
+	value   interface{}
+}
+
+// sheetWriter fills one sheet of a converted workbook through the excelize
+// stream writer. Rows must come in increasing order.
+type sheetWriter struct {
+	file      *excelize.File
+	stream    *excelize.StreamWriter
+	dateStyle int
+	timeStyle int
+}
+
+// newWorkbook starts an empty workbook whose first sheet is named name.
+func newWorkbook(name string) (*excelize.File, error) {
+	file := excelize.NewFile()
+	if err := file.SetSheetName("Sheet1", name); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return file, nil
+}
+
+func newSheetWriter(file *excelize.File, sheet string) (*sheetWriter, error) {
+	if idx, _ := file.GetSheetIndex(sheet); idx < 0 {
+		if _, err := file.NewSheet(sheet); err != nil {
+			return nil, err
+		}
+	}
+	stream, err := file.NewStreamWriter(sheet)
+	if err != nil {
+		return nil, err
+	}
+	dateStyle, err := file.NewStyle(&excelize.Style{NumFmt: 14})
+	if err != nil {
+		return nil, err
+	}
+	timeStyle, err := file.NewStyle(&excelize.Style{NumFmt: 22})
+	if err != nil {
+		return nil, err
+	}
+	return &sheetWriter{file: file, stream: stream, dateStyle: dateStyle, timeStyle: timeStyle}, nil
+}
+
+// writeRow writes values from column A of row (1-based). Values are
+// float64, string, bool, time.Time, formulaCell or nil.
+func (w *sheetWriter) writeRow(row int, values []interface{}) error {
+	cells := make([]interface{}, len(values))
+	for i, value := range values {
+		cells[i] = w.cell(value)
+	}
+	cell, _ := excelize.CoordinatesToCellName(1, row)
+	return w.stream.SetRow(cell, cells)
+}
+
+func (w *sheetWriter) cell(value interface{}) interface{} {
+	switch v := value.(type) {
+	case time.Time:
+		style := w.timeStyle
+		if v.Hour() == 0 && v.Minute() == 0 && v.Second() == 0 {
+			style = w.dateStyle
+		}
+		return excelize.Cell{StyleID: style, Value: v}
+	case formulaCell:
+		cell, ok := w.cell(v.value).(excelize.Cell)
+		if !ok {
+			cell = excelize.Cell{Value: v.value}
+		}
+		cell.Formula = v.formula
+		return cell
+	}
+	return value
+}
+
+func (w *sheetWriter) flush() error {
+	return w.stream.Flush()
+}
+
+// sheetName makes name a valid sheet name: at most 31 characters and none
+// of : \ / ? * [ ].
+func sheetName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`:\/?*[]`, r) {
+			return '_'
+		}
+		return r
+	}, strings.Trim(strings.TrimSpace(name), "'"))
+	if runes := []rune(name); len(runes) > 31 {
+		name = string(runes[:31])
+	}
+	if name == "" {
+		name = "Sheet1"
+	}
+	return name
+}
@@ -0,0 +1,550 @@
+package workbook
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/richardlehane/mscfb"
+	"github.com/xuri/excelize/v2"
+)
+
+// BIFF8 record types read here
+const (
+	biffFormula    = 0x0006
+	biffEOF        = 0x000a
+	biffDateMode   = 0x0022
+	biffFilePass   = 0x002f
+	biffContinue   = 0x003c
+	biffBoundSheet = 0x0085
+	biffMulRK      = 0x00bd
+	biffXF         = 0x00e0
+	biffSST        = 0x00fc
+	biffLabelSST   = 0x00fd
+	biffNumber     = 0x0203
+	biffLabel      = 0x0204
+	biffBoolErr    = 0x0205
+	biffString     = 0x0207
+	biffRK         = 0x027e
+	biffFormat     = 0x041e
+	biffBOF        = 0x0809
+)
+
+// Cell error codes of BOOLERR and FORMULA records
+var biffErrors = map[byte]string{
+	0x00: "#NULL!", 0x07: "#DIV/0!", 0x0f: "#VALUE!", 0x17: "#REF!",
+	0x1d: "#NAME?", 0x24: "#NUM!", 0x2a: "#N/A",
+}
+
+// openXLS reads a legacy Excel 97-2003 workbook (BIFF8 in a compound
+// file). Cell values are kept with their date formats; formulas are read
+// as the values Excel last computed, since their token form is not
+// translated.
+func openXLS(path string) (*excelize.File, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	doc, err := mscfb.New(f)
+	if err != nil {
+		return nil, fmt.Errorf("invalid compound file: %w", err)
+	}
+
+	var stream []byte
+	for entry, err := doc.Next(); err == nil; entry, err = doc.Next() {
+		if len(entry.Path) > 0 {
+			continue
+		}
+		switch entry.Name {
+		case "Workbook":
+			stream = make([]byte, entry.Size)
+			if _, err := io.ReadFull(entry, stream); err != nil {
+				return nil, fmt.Errorf("failed to read Workbook stream: %w", err)
+			}
+		case "Book":
+			return nil, fmt.Errorf("Excel 5.0/95 workbooks are not supported, save as Excel 97-2003 or later")
+		}
+	}
+	if stream == nil {
+		return nil, fmt.Errorf("no Workbook stream, not an Excel workbook")
+	}
+
+	book, err := parseGlobals(stream)
+	if err != nil {
+		return nil, err
+	}
+	if len(book.sheets) == 0 {
+		return nil, fmt.Errorf("workbook has no worksheet")
+	}
+
+	file, err := newWorkbook(sheetName(book.sheets[0].name))
+	if err != nil {
+		return nil, err
+	}
+	for _, sheet := range book.sheets {
+		if err := book.readSheet(file, stream, sheet); err != nil {
+			file.Close()
+			return nil, fmt.Errorf("sheet %s: %w", sheet.name, err)
+		}
+	}
+	for _, sheet := range book.sheets {
+		if sheet.state != 0 {
+			// Visibility is informative, failing to set it is not fatal
+			_ = file.SetSheetVisible(sheetName(sheet.name), false, sheet.state == 2)
+		}
+	}
+	return file, nil
+}
+
+type biffSheet struct {
+	name   string
+	offset int
+	// hsState: 0 visible, 1 hidden, 2 very hidden
+	state byte
+}
+
+// biffBook is the workbook globals substream: sheets, shared strings and
+// the formats needed to recognise dates.
+type biffBook struct {
+	sheets   []biffSheet
+	strings  []string
+	formats  map[uint16]string
+	xfFormat []uint16
+	date1904 bool
+}
+
+// nextRecord returns the record at pos and the position of the next one.
+func nextRecord(stream []byte, pos int) (uint16, []byte, int, error) {
+	if pos+4 > len(stream) {
+		return 0, nil, 0, io.ErrUnexpectedEOF
+	}
+	typ := binary.LittleEndian.Uint16(stream[pos:])
+	size := int(binary.LittleEndian.Uint16(stream[pos+2:]))
+	end := pos + 4 + size
+	if end > len(stream) {
+		return 0, nil, 0, io.ErrUnexpectedEOF
+	}
+	return typ, stream[pos+4 : end], end, nil
+}
+
+func parseGlobals(stream []byte) (*biffBook, error) {
+	book := &biffBook{formats: make(map[uint16]string)}
+
+	typ, data, pos, err := nextRecord(stream, 0)
+	if err != nil || typ != biffBOF || len(data) < 2 {
+		return nil, fmt.Errorf("Workbook stream does not start with a BOF record")
+	}
+	if version := binary.LittleEndian.Uint16(data); version != 0x0600 {
+		return nil, fmt.Errorf("BIFF version %#x is not supported, only Excel 97-2003 (BIFF8)", version)
+	}
+
+	for {
+		typ, data, next, err := nextRecord(stream, pos)
+		if err != nil {
+			return nil, fmt.Errorf("truncated workbook globals: %w", err)
+		}
+
+		switch typ {
+		case biffEOF:
+			return book, nil
+
+		case biffFilePass:
+			// Open reports this before reading; kept for direct callers
+			return nil, fmt.Errorf("workbook is encrypted (%s)", filePassEncryption(data))
+
+		case biffDateMode:
+			book.date1904 = len(data) >= 2 && binary.LittleEndian.Uint16(data) == 1
+
+		case biffFormat:
+			if len(data) >= 2 {
+				text, _, err := unicodeString(data[2:], 2)
+				if err != nil {
+					return nil, fmt.Errorf("invalid FORMAT record: %w", err)
+				}
+				book.formats[binary.LittleEndian.Uint16(data)] = text
+			}
+
+		case biffXF:
+			if len(data) >= 4 {
+				book.xfFormat = append(book.xfFormat, binary.LittleEndian.Uint16(data[2:]))
+			}
+
+		case biffBoundSheet:
+			// Only worksheets; charts, macro and module sheets hold no cells
+			if len(data) >= 8 && data[5] == 0 {
+				name, _, err := unicodeString(data[6:], 1)
+				if err != nil {
+					return nil, fmt.Errorf("invalid BOUNDSHEET record: %w", err)
+				}
+				book.sheets = append(book.sheets, biffSheet{
+					name:   name,
+					offset: int(binary.LittleEndian.Uint32(data)),
+					state:  data[4] & 0x03,
+				})
+			}
+
+		case biffSST:
+			segments := [][]byte{data}
+			for {
+				ctyp, cdata, cnext, err := nextRecord(stream, next)
+				if err != nil || ctyp != biffContinue {
+					break
+				}
+				segments = append(segments, cdata)
+				next = cnext
+			}
+			if book.strings, err = parseSST(segments); err != nil {
+				return nil, fmt.Errorf("invalid shared string table: %w", err)
+			}
+		}
+
+		pos = next
+	}
+}
+
+// readSheet reads the cells of a worksheet substream and writes them to a
+// sheet of file in row order.
+func (b *biffBook) readSheet(file *excelize.File, stream []byte, sheet biffSheet) error {
+	typ, _, pos, err := nextRecord(stream, sheet.offset)
+	if err != nil || typ != biffBOF {
+		return fmt.Errorf("worksheet does not start with a BOF record")
+	}
+
+	cells := make(map[int]map[int]interface{})
+	set := func(row, col int, value interface{}) {
+		if value == nil {
+			return
+		}
+		if cells[row] == nil {
+			cells[row] = make(map[int]interface{})
+		}
+		cells[row][col] = value
+	}
+
+	// A string formula result follows in its own STRING record
+	pendingRow, pendingCol := -1, -1
+
+	for {
+		typ, data, next, err := nextRecord(stream, pos)
+		if err != nil {
+			return fmt.Errorf("truncated worksheet: %w", err)
+		}
+		if typ == biffEOF {
+			break
+		}
+		pos = next
+
+		if typ == biffString {
+			if pendingRow >= 0 {
+				text, _, err := unicodeString(data, 2)
+				if err != nil {
+					return fmt.Errorf("invalid STRING record: %w", err)
+				}
+				set(pendingRow, pendingCol, text)
+				pendingRow, pendingCol = -1, -1
+			}
+			continue
+		}
+		if len(data) < 6 {
+			continue
+		}
+		row := int(binary.LittleEndian.Uint16(data))
+		col := int(binary.LittleEndian.Uint16(data[2:]))
+		xf := binary.LittleEndian.Uint16(data[4:])
+
+		switch typ {
+		case biffLabelSST:
+			if len(data) >= 10 {
+				if idx := int(binary.LittleEndian.Uint32(data[6:])); idx < len(b.strings) {
+					set(row, col, b.strings[idx])
+				}
+			}
+		case biffLabel:
+			text, _, err := unicodeString(data[6:], 2)
+			if err != nil {
+				return fmt.Errorf("invalid LABEL record at row %d: %w", row+1, err)
+			}
+			set(row, col, text)
+		case biffNumber:
+			if len(data) >= 14 {
+				set(row, col, b.number(xf, math.Float64frombits(binary.LittleEndian.Uint64(data[6:]))))
+			}
+		case biffRK:
+			if len(data) >= 10 {
+				set(row, col, b.number(xf, rkValue(binary.LittleEndian.Uint32(data[6:]))))
+			}
+		case biffMulRK:
+			for i := 4; i+6 <= len(data)-2; i += 6 {
+				xf := binary.LittleEndian.Uint16(data[i:])
+				set(row, col, b.number(xf, rkValue(binary.LittleEndian.Uint32(data[i+2:]))))
+				col++
+			}
+		case biffBoolErr:
+			if len(data) >= 8 {
+				if data[7] == 0 {
+					set(row, col, data[6] != 0)
+				} else {
+					set(row, col, biffErrors[data[6]])
+				}
+			}
+		case biffFormula:
+			if len(data) < 14 {
+				continue
+			}
+			result := data[6:14]
+			if result[6] != 0xff || result[7] != 0xff {
+				set(row, col, b.number(xf, math.Float64frombits(binary.LittleEndian.Uint64(result))))
+				continue
+			}
+			switch result[0] {
+			case 0:
+				pendingRow, pendingCol = row, col
+			case 1:
+				set(row, col, result[2] != 0)
+			case 2:
+				set(row, col, biffErrors[result[2]])
+			}
+		}
+	}
+
+	writer, err := newSheetWriter(file, sheetName(sheet.name))
+	if err != nil {
+		return err
+	}
+	rowNumbers := make([]int, 0, len(cells))
+	for row := range cells {
+		rowNumbers = append(rowNumbers, row)
+	}
+	sort.Ints(rowNumbers)
+
+	for _, row := range rowNumbers {
+		width := 0
+		for col := range cells[row] {
+			if col+1 > width {
+				width = col + 1
+			}
+		}
+		values := make([]interface{}, width)
+		for col, value := range cells[row] {
+			values[col] = value
+		}
+		if err := writer.writeRow(row+1, values); err != nil {
+			return err
+		}
+	}
+	return writer.flush()
+}
+
+// number returns value as a time when its cell format is a date format.
+func (b *biffBook) number(xf uint16, value float64) interface{} {
+	if int(xf) < len(b.xfFormat) && DateFormat(int(b.xfFormat[xf]), b.formats[b.xfFormat[xf]]) != NotDate {
+		if date, err := excelize.ExcelDateToTime(value, b.date1904); err == nil {
+			return date
+		}
+	}
+	return value
+}
+
+// rkValue decodes an RK number: a truncated double or a 30-bit integer,
+// optionally divided by 100.
+func rkValue(rk uint32) float64 {
+	var value float64
+	if rk&0x02 != 0 {
+		value = float64(int32(rk) >> 2)
+	} else {
+		value = math.Float64frombits(uint64(rk&0xfffffffc) << 32)
+	}
+	if rk&0x01 != 0 {
+		value /= 100
+	}
+	return value
+}
+
+// unicodeString reads a BIFF8 string whose character count takes
+// countSize bytes, followed by a flags byte and the characters, and
+// returns it with the bytes used. A string running past data is an error.
+func unicodeString(data []byte, countSize int) (string, int, error) {
+	if len(data) < countSize+1 {
+		return "", 0, fmt.Errorf("string header needs %d bytes, record has %d", countSize+1, len(data))
+	}
+	count := int(data[0])
+	if countSize == 2 {
+		count = int(binary.LittleEndian.Uint16(data))
+	}
+	flags := data[countSize]
+	pos := countSize + 1
+	if flags&0x08 != 0 {
+		pos += 2 // rich text run count
+	}
+	if flags&0x04 != 0 {
+		pos += 4 // phonetic data size
+	}
+	return decodeChars(data, pos, count, flags&0x01 != 0)
+}
+
+// decodeChars reads count characters at pos, two bytes each when wide,
+// and returns them with the position after the last one.
+func decodeChars(data []byte, pos, count int, wide bool) (string, int, error) {
+	size := 1
+	if wide {
+		size = 2
+	}
+	if pos < 0 || pos > len(data) || count < 0 || count > (len(data)-pos)/size {
+		return "", 0, fmt.Errorf("string of %d characters at byte %d runs past the %d bytes of its record", count, pos, len(data))
+	}
+	end := pos + count*size
+
+	if wide {
+		units := make([]uint16, 0, count)
+		for i := pos; i < end; i += 2 {
+			units = append(units, binary.LittleEndian.Uint16(data[i:]))
+		}
+		return string(utf16.Decode(units)), end, nil
+	}
+
+	runes := make([]rune, 0, count)
+	for _, c := range data[pos:end] {
+		runes = append(runes, rune(c))
+	}
+	return string(runes), end, nil
+}
+
+// sstReader reads the shared string table across its CONTINUE records.
+// When characters of a string run into the next record, that record
+// starts with a new flags byte telling their width.
+type sstReader struct {
+	segments [][]byte
+	seg, pos int
+}
+
+func (r *sstReader) done() bool {
+	for r.seg < len(r.segments) && r.pos >= len(r.segments[r.seg]) {
+		r.seg++
+		r.pos = 0
+	}
+	return r.seg >= len(r.segments)
+}
+
+// remaining is the number of bytes left to read
+func (r *sstReader) remaining() int {
+	n := 0
+	for i := r.seg; i < len(r.segments); i++ {
+		n += len(r.segments[i])
+	}
+	if r.seg < len(r.segments) {
+		n -= r.pos
+	}
+	return n
+}
+
+func (r *sstReader) skip(n int) {
+	for n > 0 && !r.done() {
+		take := len(r.segments[r.seg]) - r.pos
+		if take > n {
+			take = n
+		}
+		r.pos += take
+		n -= take
+	}
+}
+
+func (r *sstReader) byte() byte {
+	if r.done() {
+		return 0
+	}
+	c := r.segments[r.seg][r.pos]
+	r.pos++
+	return c
+}
+
+func (r *sstReader) uint16() uint16 {
+	return uint16(r.byte()) | uint16(r.byte())<<8
+}
+
+func (r *sstReader) uint32() uint32 {
+	return uint32(r.uint16()) | uint32(r.uint16())<<16
+}
+
+func (r *sstReader) chars(count int, wide bool) (string, error) {
+	var text strings.Builder
+	for count > 0 {
+		if r.seg >= len(r.segments) {
+			return "", fmt.Errorf("string runs %d characters past the end of the table", count)
+		}
+		segment := r.segments[r.seg]
+		if r.pos >= len(segment) {
+			r.seg++
+			r.pos = 0
+			if r.seg >= len(r.segments) {
+				continue
+			}
+			wide = r.byte()&0x01 != 0
+			continue
+		}
+
+		size := 1
+		if wide {
+			size = 2
+		}
+		available := (len(segment) - r.pos) / size
+		if available > count {
+			available = count
+		}
+		if available == 0 {
+			// A wide character cannot be split; skip the odd byte
+			r.pos = len(segment)
+			continue
+		}
+		part, end, err := decodeChars(segment, r.pos, available, wide)
+		if err != nil {
+			return "", err
+		}
+		text.WriteString(part)
+		r.pos = end
+		count -= available
+	}
+	return text.String(), nil
+}
+
+// parseSST reads the strings of an SST record and its CONTINUE records.
+// The string count comes from the file, so it only sizes the table as far
+// as the bytes left could hold that many strings.
+func parseSST(segments [][]byte) ([]string, error) {
+	r := &sstReader{segments: segments}
+	if r.remaining() < 8 {
+		return nil, fmt.Errorf("SST record has %d bytes, expected at least 8", r.remaining())
+	}
+	r.skip(4) // total count
+	unique := int(r.uint32())
+
+	// Each string takes at least its count and flags bytes
+	strs := make([]string, 0, min(unique, r.remaining()/3))
+	for i := 0; i < unique; i++ {
+		if r.done() {
+			return nil, fmt.Errorf("table holds %d of the %d strings it declares", i, unique)
+		}
+		count := int(r.uint16())
+		flags := r.byte()
+		runs, extSize := 0, 0
+		if flags&0x08 != 0 {
+			runs = int(r.uint16())
+		}
+		if flags&0x04 != 0 {
+			extSize = int(r.uint32())
+		}
+		text, err := r.chars(count, flags&0x01 != 0)
+		if err != nil {
+			return nil, fmt.Errorf("string %d: %w", i, err)
+		}
+		strs = append(strs, text)
+		r.skip(runs*4 + extSize)
+	}
+	return strs, nil
+}
@@ -0,0 +1,107 @@
+package workbook
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+func TestUnicodeString(t *testing.T) {
+	tests := []struct {
+		name      string
+		data      []byte
+		countSize int
+		want      string
+		used      int
+		wantErr   bool
+	}{
+		{"compressed", []byte{3, 0, 0, 'a', 'b', 'c'}, 2, "abc", 6, false},
+		{"one byte count", []byte{2, 0, 'h', 'i', 'x'}, 1, "hi", 4, false},
+		{"wide", []byte{1, 0, 1, 0xac, 0x20}, 2, "€", 5, false},
+		{"rich text", []byte{1, 0, 0x08, 2, 0, 'z'}, 2, "z", 6, false},
+		{"empty record", nil, 2, "", 0, true},
+		{"header only", []byte{1, 0}, 2, "", 0, true},
+		{"rich text header past end", []byte{1, 0, 0x0c}, 2, "", 0, true},
+		{"count past end", []byte{9, 0, 0, 'a'}, 2, "", 0, true},
+		{"odd wide byte", []byte{2, 0, 1, 'a', 0, 'b'}, 2, "", 0, true},
+		{"huge count", []byte{0xff, 0xff, 1}, 2, "", 0, true},
+	}
+
+	for _, tt := range tests {
+		got, used, err := unicodeString(tt.data, tt.countSize)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: error = %v, want error %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && (got != tt.want || used != tt.used) {
+			t.Errorf("%s: got %q, %d; want %q, %d", tt.name, got, used, tt.want, tt.used)
+		}
+	}
+}
+
+func TestParseSST(t *testing.T) {
+	header := func(unique uint32) []byte {
+		b := make([]byte, 8)
+		binary.LittleEndian.PutUint32(b[4:], unique)
+		return b
+	}
+
+	tests := []struct {
+		name     string
+		segments [][]byte
+		want     []string
+		wantErr  bool
+	}{
+		{
+			name:     "two strings",
+			segments: [][]byte{append(header(2), 2, 0, 0, 'o', 'k', 1, 0, 1, 'e', 0)},
+			want:     []string{"ok", "e"},
+		},
+		{
+			name: "string split across CONTINUE with a width change",
+			segments: [][]byte{
+				append(header(1), 4, 0, 0, 'a', 'b'),
+				{1, 'c', 0, 'd', 0},
+			},
+			want: []string{"abcd"},
+		},
+		{name: "too short", segments: [][]byte{{1, 2, 3}}, wantErr: true},
+		{name: "huge declared count", segments: [][]byte{header(0xffffffff)}, wantErr: true},
+		{name: "truncated string", segments: [][]byte{append(header(1), 5, 0, 0, 'a')}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseSST(tt.segments)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: error = %v, want error %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if tt.wantErr {
+			continue
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("%s: string %d = %q, want %q", tt.name, i, got[i], tt.want[i])
+			}
+		}
+	}
+}
+
+func TestRKValue(t *testing.T) {
+	tests := []struct {
+		rk   uint32
+		want float64
+	}{
+		{uint32(42<<2) | 0x02, 42},
+		{uint32(1234<<2) | 0x03, 12.34},
+		{0x3ff00000, 1},
+	}
+	for _, tt := range tests {
+		if got := rkValue(tt.rk); got != tt.want {
+			t.Errorf("rkValue(%#x) = %v, want %v", tt.rk, got, tt.want)
+		}
+	}
+}
@@ -15,6 +15,9 @@ type Config struct {
 	Cache       CacheConfig       `yaml:"cache"`
 	Monitoring  MonitoringConfig  `yaml:"monitoring"`
 	Healthcheck HealthcheckConfig `yaml:"healthcheck"`
+	Watch       WatchConfig       `yaml:"watch"`
+	Secrets     SecretsConfig     `yaml:"secrets"`
+	Tokens      TokensConfig      `yaml:"tokens"`
 }
 
 type ServerConfig struct {
@@ -78,6 +81,26 @@ type LoggingConfig struct {
 	ErrorFile string `yaml:"error_file"`
 }
 
+// WatchConfig controls polling of workbooks registered by
+// build_navigation_map.
+type WatchConfig struct {
+	Enabled  bool          `yaml:"enabled"`
+	Interval time.Duration `yaml:"interval"`
+}
+
+// SecretsConfig points to credentials kept out of this file.
+// PasswordsFile maps path patterns to the passwords of encrypted
+// workbooks.
+type SecretsConfig struct {
+	PasswordsFile string `yaml:"passwords_file"`
+}
+
+// TokensConfig chooses how tokens are counted. ModelsFile replaces the
+// built-in model limits and tokenizers.
+type TokensConfig struct {
+	ModelsFile string `yaml:"models_file"`
+}
+
 type HealthcheckConfig struct {
 	Endpoint  string        `yaml:"endpoint"`
 	Interval  time.Duration `yaml:"interval"`
@@ -180,5 +203,9 @@ func defaultConfig() *Config {
 			Interval:  10 * time.Second,
 			Threshold: 3,
 		},
+		Watch: WatchConfig{
+			Enabled:  true,
+			Interval: 2 * time.Second,
+		},
 	}
 }
\ No newline at end of file